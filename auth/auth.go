@@ -0,0 +1,162 @@
+// Package auth authenticates callers of the recordtocsv ingestion servers.
+//
+// Authenticators work on transport-neutral Credentials, so the same API key,
+// mTLS or OIDC setup can protect both the HTTP and the gRPC ingestion modes.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ErrUnauthenticated is returned when the credentials are missing or invalid.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Credentials are the parts of a request an Authenticator may inspect.
+type Credentials struct {
+	// Header holds HTTP headers or gRPC metadata. Keys are canonical HTTP
+	// header names, e.g., "Authorization".
+	Header http.Header
+
+	// TLS is the state of the connection, nil for plaintext connections.
+	TLS *tls.ConnectionState
+}
+
+// FromHTTP returns the credentials of an HTTP request.
+func FromHTTP(r *http.Request) Credentials {
+	return Credentials{Header: r.Header, TLS: r.TLS}
+}
+
+// Principal identifies an authenticated caller.
+type Principal struct {
+	// Subject is the caller's identity: the API key owner, the certificate
+	// common name or the token subject.
+	Subject string
+
+	// Method names the authenticator that accepted the caller, e.g., "apikey".
+	Method string
+
+	// Claims holds additional attributes, such as OIDC token claims.
+	Claims map[string]interface{}
+}
+
+// Authenticator verifies credentials and returns the caller they identify.
+// It returns an error wrapping ErrUnauthenticated for rejected credentials.
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(ctx context.Context, creds Credentials) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	return f(ctx, creds)
+}
+
+// Any accepts callers accepted by at least one of the authenticators, tried in
+// order. It is useful while migrating from one method to another.
+func Any(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, creds Credentials) (*Principal, error) {
+		var errs []error
+		for _, a := range authenticators {
+			p, err := a.Authenticate(ctx, creds)
+			if err == nil {
+				return p, nil
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) == 0 {
+			return nil, ErrUnauthenticated
+		}
+		return nil, errors.Join(errs...)
+	})
+}
+
+// APIKeys authenticates callers by a static API key, sent in the X-API-Key
+// header or as "Authorization: Bearer <key>". The map goes from key to the
+// subject it identifies, e.g., the owning team.
+type APIKeys map[string]string
+
+func (k APIKeys) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	key := creds.Header.Get("X-API-Key")
+	if key == "" {
+		key = bearerToken(creds.Header)
+	}
+	if key == "" {
+		return nil, errors.Join(ErrUnauthenticated, errors.New("no API key"))
+	}
+	// Compare against every key so the time taken doesn't reveal a match
+	var subject string
+	for candidate, s := range k {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			subject = s
+		}
+	}
+	if subject == "" {
+		return nil, errors.Join(ErrUnauthenticated, errors.New("unknown API key"))
+	}
+	return &Principal{Subject: subject, Method: "apikey"}, nil
+}
+
+// MTLS authenticates callers by their verified TLS client certificate. The
+// server must be configured to require and verify client certificates
+// (tls.RequireAndVerifyClientCert); MTLS only checks the verified subject.
+type MTLS struct {
+	// AllowedSubjects limits accepted certificates by common name. When empty,
+	// any verified certificate is accepted.
+	AllowedSubjects []string
+}
+
+func (m MTLS) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	if creds.TLS == nil || len(creds.TLS.VerifiedChains) == 0 || len(creds.TLS.VerifiedChains[0]) == 0 {
+		return nil, errors.Join(ErrUnauthenticated, errors.New("no verified client certificate"))
+	}
+	cert := creds.TLS.VerifiedChains[0][0]
+	subject := cert.Subject.CommonName
+	if len(m.AllowedSubjects) > 0 && !slices.Contains(m.AllowedSubjects, subject) {
+		return nil, errors.Join(ErrUnauthenticated, errors.New("client certificate subject not allowed: "+subject))
+	}
+	return &Principal{Subject: subject, Method: "mtls"}, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(h http.Header) string {
+	const prefix = "Bearer "
+	v := h.Get("Authorization")
+	if len(v) < len(prefix) || !strings.EqualFold(v[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(v[len(prefix):])
+}
+
+type principalKey struct{}
+
+// NewContext returns a context carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by NewContext, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Middleware rejects HTTP requests that a doesn't accept with 401
+// Unauthorized, and passes the principal of accepted ones to next through the
+// request context.
+func Middleware(a Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r.Context(), FromHTTP(r))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
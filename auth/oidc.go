@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// OIDC authenticates callers by an OpenID Connect ID token sent as
+// "Authorization: Bearer <token>", verified against the issuer's published
+// keys.
+type OIDC struct {
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC discovers the issuer's configuration and returns an authenticator
+// accepting tokens issued for clientID.
+func NewOIDC(ctx context.Context, issuer, clientID string) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %q: %w", issuer, err)
+	}
+	return &OIDC{verifier: provider.Verifier(&oidc.Config{ClientID: clientID})}, nil
+}
+
+func (o *OIDC) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	raw := bearerToken(creds.Header)
+	if raw == "" {
+		return nil, errors.Join(ErrUnauthenticated, errors.New("no bearer token"))
+	}
+	token, err := o.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, errors.Join(ErrUnauthenticated, err)
+	}
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode token claims: %w", err)
+	}
+	return &Principal{Subject: token.Subject, Method: "oidc", Claims: claims}, nil
+}
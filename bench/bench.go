@@ -0,0 +1,239 @@
+// Package bench generates a reproducible write load against a core.Service,
+// to size QueueSize, AsyncBatch, FlushInterval and MaxOpenFiles for the
+// hardware it runs on. The same seed always generates the same payloads, so
+// runs with different settings can be compared.
+//
+//	service := core.New(dir, "bench", bench.Columns(), "daily")
+//	service.AsyncBatch = 256
+//	res, err := bench.Run(service, bench.Options{Records: 1_000_000, Writers: 8, Async: true})
+//	fmt.Println(res)
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// Options configures a Run.
+type Options struct {
+	// Records is the number of payloads recorded. Defaults to 100000.
+	Records int
+
+	// Writers is the number of goroutines recording concurrently. Defaults
+	// to 1.
+	Writers int
+
+	// Rows is the number of rows of each payload, recorded as a slice when
+	// greater than 1. Defaults to 1.
+	Rows int
+
+	// PayloadBytes is the length of the generated "payload" column. Defaults
+	// to 256.
+	PayloadBytes int
+
+	// Partitions, if positive, spreads the rows over this many values of the
+	// "tenant" column, for PartitionBy or GroupBy.
+	Partitions int
+
+	// Async records with RecordAsync and waits for the queue with Flush,
+	// instead of with Record.
+	Async bool
+
+	// Seed seeds the generated payloads.
+	Seed uint64
+}
+
+// Result is the outcome of a Run.
+type Result struct {
+	Records  int           // payloads recorded
+	Rows     int           // rows written
+	Bytes    int64         // CSV bytes written
+	Failed   int           // payloads that failed
+	Duration time.Duration // until the last row was written
+}
+
+// RowsPerSecond returns the rows written per second.
+func (r Result) RowsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Rows) / r.Duration.Seconds()
+}
+
+// BytesPerSecond returns the CSV bytes written per second.
+func (r Result) BytesPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d records, %d rows, %d bytes in %v: %.0f rows/s, %.1f MiB/s, %d failed",
+		r.Records, r.Rows, r.Bytes, r.Duration.Round(time.Millisecond),
+		r.RowsPerSecond(), r.BytesPerSecond()/(1<<20), r.Failed)
+}
+
+// Columns returns the columns of the generated payloads.
+func Columns() []string {
+	return []string{"id", "tenant", "status", "amount", "created_at", "payload"}
+}
+
+// statuses are the values of the "status" column.
+var statuses = []string{"pending", "confirmed", "cancelled", "refunded"}
+
+// Generator generates payloads with the Columns. It is not safe for
+// concurrent use.
+type Generator struct {
+	rnd          *rand.Rand
+	payloadBytes int
+	partitions   int
+	next         int64
+}
+
+// NewGenerator returns a generator of the payloads of opts, starting at the
+// given sequence number.
+func NewGenerator(opts Options, seq int64) *Generator {
+	opts = opts.withDefaults()
+	return &Generator{
+		rnd:          rand.New(rand.NewPCG(opts.Seed, uint64(seq))),
+		payloadBytes: opts.PayloadBytes,
+		partitions:   opts.Partitions,
+		next:         seq,
+	}
+}
+
+// letters are the characters of the generated "payload" column.
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ,\""
+
+// Next returns the next payload.
+func (g *Generator) Next() map[string]interface{} {
+	id := g.next
+	g.next++
+	tenant := ""
+	if g.partitions > 0 {
+		tenant = "tenant" + strconv.Itoa(g.rnd.IntN(g.partitions))
+	}
+	payload := make([]byte, g.payloadBytes)
+	for i := range payload {
+		payload[i] = letters[g.rnd.IntN(len(letters))]
+	}
+	return map[string]interface{}{
+		"id":         id,
+		"tenant":     tenant,
+		"status":     statuses[g.rnd.IntN(len(statuses))],
+		"amount":     strconv.FormatFloat(float64(g.rnd.IntN(1_000_000))/100, 'f', 2, 64),
+		"created_at": time.Unix(1_700_000_000+id, 0).UTC().Format(time.RFC3339),
+		"payload":    string(payload),
+	}
+}
+
+// withDefaults returns opts with the defaults of unset fields.
+func (o Options) withDefaults() Options {
+	if o.Records <= 0 {
+		o.Records = 100000
+	}
+	if o.Writers <= 0 {
+		o.Writers = 1
+	}
+	if o.Rows <= 0 {
+		o.Rows = 1
+	}
+	if o.PayloadBytes <= 0 {
+		o.PayloadBytes = 256
+	}
+	return o
+}
+
+// Run records the payloads of opts with service and measures the throughput.
+// It replaces the service's Metrics and OnError while it runs, and doesn't
+// close the service.
+func Run(service *core.Service, opts Options) (Result, error) {
+	opts = opts.withDefaults()
+	if err := service.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	var c counter
+	metrics, onError := service.Metrics, service.OnError
+	service.Metrics, service.OnError = &c, func(error) { c.failed.Add(1) }
+	defer func() { service.Metrics, service.OnError = metrics, onError }()
+
+	// Generate the payloads first, so generating them isn't measured
+	payloads := make([][]interface{}, opts.Writers)
+	for w := range payloads {
+		n := opts.Records / opts.Writers
+		if w < opts.Records%opts.Writers {
+			n++
+		}
+		g := NewGenerator(opts, int64(w)<<40)
+		payloads[w] = make([]interface{}, n)
+		for i := range payloads[w] {
+			if opts.Rows == 1 {
+				payloads[w][i] = g.Next()
+				continue
+			}
+			rows := make([]map[string]interface{}, opts.Rows)
+			for j := range rows {
+				rows[j] = g.Next()
+			}
+			payloads[w][i] = rows
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, opts.Writers)
+	start := time.Now()
+	for w := range payloads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, p := range payloads[w] {
+				var err error
+				if opts.Async {
+					err = service.RecordAsync(p)
+				} else if err = service.Record(p); err != nil {
+					c.failed.Add(1)
+					continue
+				}
+				if err != nil {
+					errs[w] = err // Closed, nothing more will be written
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if opts.Async {
+		service.Flush()
+	}
+
+	return Result{
+		Records:  opts.Records,
+		Rows:     int(c.rows.Load()),
+		Bytes:    c.bytes.Load(),
+		Failed:   int(c.failed.Load()),
+		Duration: time.Since(start),
+	}, errors.Join(errs...)
+}
+
+// counter is the core.Metrics of a Run.
+type counter struct {
+	rows, failed atomic.Int64
+	bytes        atomic.Int64
+}
+
+func (c *counter) ObserveWrite(rows int, bytes int64, d time.Duration) {
+	c.rows.Add(int64(rows))
+	c.bytes.Add(bytes)
+}
+
+func (c *counter) ObserveError(err error)                  {}
+func (c *counter) ObserveRotation(oldPath, newPath string) {}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ojipoji/recordtocsv/v2/bench"
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// benchmark records generated payloads, see package bench, and prints the
+// throughput, so settings can be compared on the target hardware.
+func benchmark(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var opts bench.Options
+	dir := fs.String("dir", "", "output directory; defaults to a temporary directory removed afterwards")
+	fs.IntVar(&opts.Records, "records", 100000, "number of payloads recorded")
+	fs.IntVar(&opts.Writers, "writers", 1, "goroutines recording concurrently")
+	fs.IntVar(&opts.Rows, "rows", 1, "rows per payload")
+	fs.IntVar(&opts.PayloadBytes, "payload-bytes", 256, "length of the payload column")
+	fs.IntVar(&opts.Partitions, "partitions", 0, "partition the rows by tenant over this many files")
+	fs.BoolVar(&opts.Async, "async", false, "record with RecordAsync")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "seed of the generated payloads")
+	queueSize := fs.Int("queue-size", 0, "RecordAsync queue capacity")
+	asyncBatch := fs.Int("async-batch", 0, "queued payloads written together")
+	flushInterval := fs.Duration("flush-interval", 0, "wait for an async batch to fill")
+	maxOpenFiles := fs.Int("max-open-files", 0, "files kept open between writes")
+	lock := fs.Bool("lock", false, "take an advisory file lock around each append")
+	compression := core.CompressionNone
+	fs.TextVar(&compression, "compression", core.CompressionNone, "file compression: none, gzip or zstd")
+	fs.Parse(args)
+
+	if *dir == "" {
+		tmp, err := os.MkdirTemp("", "recordtocsv-bench")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		*dir = tmp
+	}
+
+	service, err := core.NewChecked(*dir, "bench", bench.Columns(), "daily")
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	service.QueueSize = *queueSize
+	service.AsyncBatch = *asyncBatch
+	service.FlushInterval = *flushInterval
+	service.MaxOpenFiles = *maxOpenFiles
+	service.FileLock = *lock
+	service.Compression = compression
+	if opts.Partitions > 0 {
+		service.PartitionBy = "tenant"
+	}
+
+	res, err := bench.Run(service, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(res)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// lint checks that each file given as an argument conforms to RFC 4180, see
+// reader.Lint, and prints its violations.
+func lint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fields := fs.Int("fields", 0, "number of fields of every record; defaults to that of the first record")
+	max := fs.Int("max", 0, "violations printed per file; defaults to 100")
+	fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		return fmt.Errorf("lint: at least one file is required")
+	}
+
+	failed := 0
+	for _, path := range files {
+		report, err := reader.Lint(path, reader.LintOptions{Fields: *fields, MaxViolations: *max})
+		if err != nil {
+			return err
+		}
+		if report.OK() {
+			fmt.Printf("%s: OK, %d records\n", path, report.Records)
+			continue
+		}
+		failed++
+		for _, v := range report.Violations {
+			fmt.Printf("%s:%v\n", path, v)
+		}
+		if more := report.Total - len(report.Violations); more > 0 {
+			fmt.Printf("%s: %d more violations\n", path, more)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("lint: %d of %d files don't conform to RFC 4180", failed, len(files))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Command recordtocsv works with recordtocsv service configurations from the
+// shell.
+//
+// Usage:
+//
+//	recordtocsv record -config record.json < events.ndjson
+//	recordtocsv record -dir files/record -filename booking -columns id,status < events.ndjson
+//	recordtocsv check -config record.json
+//	recordtocsv repair -columns id,status files/record/booking_2025_08_26.csv
+//	recordtocsv lint files/record/booking_2025_08_26.csv
+//	recordtocsv bench -records 1000000 -writers 8 -async -async-batch 256
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "record":
+		err = record(os.Args[2:])
+	case "check":
+		err = check(os.Args[2:])
+	case "repair":
+		err = repair(os.Args[2:])
+	case "lint":
+		err = lint(os.Args[2:])
+	case "bench":
+		err = benchmark(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "recordtocsv: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recordtocsv: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  recordtocsv record [flags] < input   append JSON lines from stdin to rotated CSVs
+  recordtocsv check [flags]            validate a configuration without recording
+  recordtocsv repair [flags] file...   remove duplicate headers and fix row widths
+  recordtocsv lint [flags] file...     check that files strictly conform to RFC 4180
+  recordtocsv bench [flags]            measure the write throughput with generated records
+
+Run "recordtocsv <command> -h" for the flags of a command.`)
+}
+
+// check builds the service from the configuration file and flags and
+// validates it without recording.
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var sf serviceFlags
+	sf.register(fs)
+	fs.Parse(args)
+
+	if sf.config == "" && sf.filename == "" {
+		return fmt.Errorf("check: -config or -filename is required")
+	}
+
+	service, err := sf.service()
+	if err != nil {
+		return err
+	}
+	if err := service.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	fmt.Println("configuration OK")
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// serviceFlags are the flags shared by commands that build a service. Flags
+// override the values of -config.
+type serviceFlags struct {
+	config     string
+	dir        string
+	filename   string
+	columns    string
+	recordType string
+	sink       string
+	lock       bool
+	strict     bool
+
+	compression core.Compression
+}
+
+func (f *serviceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", "", "path to the JSON configuration file")
+	fs.StringVar(&f.dir, "dir", "", "output directory")
+	fs.StringVar(&f.filename, "filename", "", "base filename")
+	fs.StringVar(&f.columns, "columns", "", "comma-separated CSV columns")
+	fs.StringVar(&f.recordType, "type", "", "record type: daily, monthly or yearly")
+	fs.StringVar(&f.sink, "sink", "", "stream rows to - (standard output) or stderr instead of the files")
+	fs.BoolVar(&f.lock, "lock", false, "take an advisory file lock around each append")
+	fs.BoolVar(&f.strict, "strict", false, "reject payloads missing any column")
+	fs.TextVar(&f.compression, "compression", core.CompressionNone, "file compression: none, gzip or zstd")
+}
+
+// service builds the service from the configuration file and flags.
+func (f *serviceFlags) service() (*core.Service, error) {
+	cfg := &core.Config{RecordType: "daily"}
+	if f.config != "" {
+		var err error
+		if cfg, err = core.LoadConfig(f.config); err != nil {
+			return nil, err
+		}
+	}
+	if f.dir != "" {
+		cfg.Dir = f.dir
+	}
+	if f.filename != "" {
+		cfg.Filename = f.filename
+	}
+	if f.columns != "" {
+		cfg.Column = strings.Split(f.columns, ",")
+	}
+	if f.recordType != "" {
+		cfg.RecordType = f.recordType
+	}
+	if f.sink != "" {
+		cfg.Sink = f.sink
+	}
+
+	service, err := core.NewChecked(cfg.Dir, cfg.Filename, cfg.Column, cfg.RecordType)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := core.StandardSink(cfg.Sink)
+	if err != nil {
+		return nil, err
+	}
+	if sink != nil {
+		service.Sinks = []core.Sink{sink}
+	}
+	service.ConfigFile = f.config
+	service.FileLock = f.lock
+	service.Strict = f.strict
+	service.Compression = f.compression
+	return service, nil
+}
+
+// record reads JSON objects, one per line, from stdin and appends them to the
+// rotated CSV files. Lines holding a JSON array write one row per element.
+// Bad lines are reported and skipped unless -stop-on-error is given.
+func record(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	var sf serviceFlags
+	sf.register(fs)
+	stopOnError := fs.Bool("stop-on-error", false, "stop at the first line that can't be recorded")
+	fs.Parse(args)
+
+	service, err := sf.service()
+	if err != nil {
+		return err
+	}
+	if err := service.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	defer service.Close()
+
+	return recordLines(service, os.Stdin, *stopOnError)
+}
+
+func recordLines(service *core.Service, r io.Reader, stopOnError bool) error {
+	in := bufio.NewReader(r)
+	failed := 0
+	for lineNo := 1; ; lineNo++ {
+		// ReadBytes has no line length limit, unlike bufio.Scanner
+		line, readErr := in.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return fmt.Errorf("failed to read stdin: %w", readErr)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := recordLine(service, line); err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "recordtocsv: line %d: %v\n", lineNo, err)
+				if stopOnError {
+					return fmt.Errorf("stopped at line %d", lineNo)
+				}
+			}
+		}
+
+		if readErr != nil { // io.EOF
+			break
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d line(s) could not be recorded", failed)
+	}
+	return nil
+}
+
+func recordLine(service *core.Service, line []byte) error {
+	var payload interface{}
+	if err := core.DecodeJSON(line, &payload); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return service.Record(payload)
+}
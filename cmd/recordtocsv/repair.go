@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// repair writes a normalized copy of each file given as an argument, see
+// reader.Repair, and reports what it changed.
+func repair(args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	columns := fs.String("columns", "", "comma-separated CSV columns, the header of files that start with data")
+	out := fs.String("o", "", "output file, only with a single input file; defaults to replacing the file in place")
+	rejects := fs.String("rejects", "", "file receiving the rows with cells beyond the header")
+	fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		return fmt.Errorf("repair: at least one file is required")
+	}
+	if *out != "" && len(files) > 1 {
+		return fmt.Errorf("repair: -o needs a single input file")
+	}
+
+	var opts reader.NormalizeOptions
+	if *columns != "" {
+		opts.Schema = strings.Split(*columns, ",")
+	}
+	if *rejects != "" {
+		f, err := os.Create(*rejects)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opts.Rejects = f
+	}
+
+	for _, path := range files {
+		dst := path
+		if *out != "" {
+			dst = *out
+		}
+		report, err := reader.Repair(path, dst, opts)
+		if err != nil {
+			return err
+		}
+		if !report.Changed() {
+			fmt.Printf("%s: OK, %d rows\n", path, report.Rows)
+			continue
+		}
+		fmt.Printf("%s: %d rows, %d duplicate headers removed, %d padded, %d trimmed, %d rejected", path,
+			report.Rows, report.DuplicateHeaders, report.Padded, report.Trimmed, report.Rejected)
+		if report.MissingHeader {
+			fmt.Print(", header added")
+		}
+		fmt.Println()
+	}
+	return nil
+}
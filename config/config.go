@@ -0,0 +1,206 @@
+// Package config builds services from YAML or JSON files and environment
+// variables, so deployments can change columns and rotation without
+// recompiling.
+//
+// A file configures a single service at its top level, in the format of
+// core.Config, or named services for a Registry under "services", which
+// inherit the top-level settings:
+//
+//	dir: files/record
+//	record_type: daily
+//	services:
+//	  booking:
+//	    column: [id, request, response]
+//	  refund:
+//	    filename: refund_record
+//	    record_type: monthly
+//	    column: [id, amount]
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of the settings a configuration leaves out.
+const (
+	DefaultDir        = "files/record"
+	DefaultRecordType = "daily"
+)
+
+// Options control how a configuration is loaded.
+type Options struct {
+	// EnvPrefix, if set, lets environment variables override the settings of
+	// the file, see FromEnv. Variables of named services insert the upper
+	// case name, e.g., RECORDTOCSV_BOOKING_COLUMN for the service "booking"
+	// with the prefix "RECORDTOCSV".
+	EnvPrefix string
+
+	// NoValidate skips Service.Validate, which also checks that Dir is
+	// writable, creating it if needed.
+	NoValidate bool
+}
+
+// readDocument parses the file at path into its settings by JSON key, as YAML if its extension is .yaml or
+// .yml and as JSON otherwise.
+func readDocument(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+	doc := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Load builds the service configured at the top level of the file at path.
+func Load(path string, opts Options) (*core.Service, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, "services")
+	s, err := build(doc, opts.EnvPrefix, opts)
+	if err != nil {
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+	return s, nil
+}
+
+// LoadRegistry returns a registry creating the services listed under
+// "services" in the file at path. Every service is built and validated
+// up front, so a bad configuration fails here rather than on first use; Get
+// fails for names the file doesn't list. A service without a filename is
+// named after its key.
+func LoadRegistry(path string, opts Options) (*core.Registry, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	listed, ok := doc["services"].(map[string]any)
+	if !ok || len(listed) == 0 {
+		return nil, fmt.Errorf("config file %q lists no services", path)
+	}
+	delete(doc, "services")
+
+	docs := make(map[string]map[string]any, len(listed))
+	built := make(map[string]*core.Service, len(listed))
+	var errs []error
+	for name, v := range listed {
+		settings, ok := v.(map[string]any)
+		if !ok && v != nil {
+			errs = append(errs, fmt.Errorf("service %q: not an object", name))
+			continue
+		}
+		merged := maps.Clone(doc)
+		maps.Copy(merged, settings)
+		if merged["filename"] == nil {
+			merged["filename"] = name
+		}
+		docs[name] = merged
+		s, err := build(merged, serviceEnv(opts.EnvPrefix, name), opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("service %q: %w", name, err))
+			continue
+		}
+		built[name] = s
+	}
+	if err := errors.Join(errs...); err != nil {
+		for _, s := range built {
+			s.Close()
+		}
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+
+	return core.NewRegistry(func(name string) (*core.Service, error) {
+		if s, ok := built[name]; ok {
+			delete(built, name) // Built again after Registry.Remove
+			return s, nil
+		}
+		doc, ok := docs[name]
+		if !ok {
+			return nil, fmt.Errorf("service %q is not in config file %q", name, path)
+		}
+		return build(doc, serviceEnv(opts.EnvPrefix, name), Options{NoValidate: true})
+	}), nil
+}
+
+// serviceEnv returns the prefix of the environment variables of the named
+// service, or "" without a prefix.
+func serviceEnv(prefix, name string) string {
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "_" + envName(name)
+}
+
+// build creates a service from doc overridden by the environment variables
+// of prefix, filling in the defaults.
+func build(doc map[string]any, prefix string, opts Options) (*core.Service, error) {
+	cfg, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		if err := fromEnv(cfg, prefix); err != nil {
+			return nil, err
+		}
+	}
+	return newService(cfg, opts)
+}
+
+// decode converts doc to a core.Config through JSON, so the field names are
+// those of core.Config's JSON tags in both formats.
+func decode(doc map[string]any) (*core.Config, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg core.Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// newService creates the service of cfg with the defaults filled in, and
+// validates it unless opts.NoValidate is set.
+func newService(cfg *core.Config, opts Options) (*core.Service, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultDir
+	}
+	if cfg.RecordType == "" {
+		cfg.RecordType = DefaultRecordType
+	}
+	s, err := core.NewFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.NoValidate {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// FromEnv builds a service from environment variables named after the JSON
+// keys of core.Config, upper case and after prefix and an underscore, e.g.,
+// RECORDTOCSV_DIR, RECORDTOCSV_FILENAME, RECORDTOCSV_COLUMN and
+// RECORDTOCSV_RECORD_TYPE with the prefix "RECORDTOCSV". Lists, such as
+// the columns, are separated by commas, or given as a JSON array; objects,
+// such as the rules, are JSON.
+func FromEnv(prefix string) (*core.Service, error) {
+	cfg := &core.Config{}
+	if err := fromEnv(cfg, prefix); err != nil {
+		return nil, err
+	}
+	return newService(cfg, Options{})
+}
+
+// fromEnv overrides the settings of cfg with the environment variables of
+// prefix.
+func fromEnv(cfg *core.Config, prefix string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + envName(key)
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnv(v.Field(i), val); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnv sets field from the value of an environment variable.
+func setEnv(field reflect.Value, val string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(val)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(val), "["):
+		var list []string
+		if val != "" {
+			list = strings.Split(val, ",")
+			for i := range list {
+				list[i] = strings.TrimSpace(list[i])
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+	if val == "" {
+		field.SetZero()
+		return nil
+	}
+	return json.Unmarshal([]byte(val), field.Addr().Interface())
+}
+
+// envName converts a key or service name to its part of a variable name:
+// upper case, with anything but letters and digits replaced by underscores.
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// Format is the encoding of a stream read by AppendFrom.
+type Format int
+
+const (
+	// FormatCSV is CSV with a header row. Header cells are matched to the
+	// columns by payload key or by header label (see Headers).
+	FormatCSV Format = iota
+	// FormatNDJSON is one JSON object per line.
+	FormatNDJSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatCSV:
+		return "csv"
+	case FormatNDJSON:
+		return "ndjson"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// appendChunk is the number of rows AppendFrom maps and writes at once.
+const appendChunk = 1024
+
+// AppendFrom records every row of a CSV or NDJSON stream, for backfilling
+// data exported from another system. Rows go through the same mapping,
+// validation and sinks as Record. With TimeColumn or EventTimeColumn set,
+// each row is written to the file of the period of its timestamp; otherwise
+// all rows go to the current period.
+//
+// It returns the number of rows read. A malformed row, or one without a
+// valid timestamp, stops the import with an error naming its row; the rows
+// of earlier chunks are already written.
+//
+//	n, err := service.AppendFrom(f, core.FormatCSV)
+func (r *Service) AppendFrom(rd io.Reader, format Format) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if err := r.register(); err != nil {
+		return 0, err
+	}
+
+	var next func() (map[string]interface{}, error)
+	switch format {
+	case FormatCSV:
+		next = r.csvRows(rd)
+	case FormatNDJSON:
+		next = ndjsonRows(rd)
+	default:
+		return 0, fmt.Errorf("unsupported format %v", format)
+	}
+
+	read := 0
+	var chunk []interface{}
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		err := r.appendChunk(read-len(chunk)+1, chunk)
+		chunk = chunk[:0]
+		return err
+	}
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return read, errors.Join(flush(), fmt.Errorf("row %d: %w", read+1, err))
+		}
+		read++
+		chunk = append(chunk, row)
+		if len(chunk) == appendChunk {
+			if err := flush(); err != nil {
+				return read, err
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+// appendChunk writes the payloads read by AppendFrom, grouped by period.
+// first is the row number of the first payload. The caller must hold r.mu.
+func (r *Service) appendChunk(first int, payloads []interface{}) error {
+	if err := r.discover(payloads); err != nil {
+		return err
+	}
+	now, err := r.Now()
+	if err != nil {
+		return err
+	}
+	mapped := make([]mappedRow, 0, len(payloads))
+	times := make([]time.Time, 0, len(payloads))
+	for i, payload := range payloads {
+		m, err := r.mapRow(r.Column, payload)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", first+i, err)
+		}
+		if m.skip {
+			continue
+		}
+		t, err := r.rowTime(m, r.timeColumn(), now)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", first+i, err)
+		}
+		mapped, times = append(mapped, m), append(times, t)
+	}
+
+	start := time.Now()
+	batches, err := r.writeByTime(now, mapped, times)
+	r.observe(batches, start, err)
+	return err
+}
+
+// timeColumn returns TimeColumn, or EventTimeColumn if it isn't set.
+func (r *Service) timeColumn() string {
+	if r.TimeColumn != "" {
+		return r.TimeColumn
+	}
+	return r.EventTimeColumn
+}
+
+// csvRows returns a func reading the rows of a CSV stream as payloads keyed
+// by column. Header cells that aren't a column or label are kept as is, so
+// NewColumns decides about them, and NullValue cells are read as null.
+func (r *Service) csvRows(rd io.Reader) func() (map[string]interface{}, error) {
+	cr := r.csvReader(rd)
+	var keys []string
+	return func() (map[string]interface{}, error) {
+		if keys == nil {
+			header, err := cr.Read()
+			if err != nil {
+				return nil, err
+			}
+			keys = make([]string, len(header))
+			for i, label := range header {
+				keys[i] = label
+				if j := slices.Index(r.Headers, label); j >= 0 && j < len(r.Column) && !slices.Contains(r.Column, label) {
+					keys[i] = r.Column[j]
+				}
+			}
+		}
+		row, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		if len(row) > len(keys) {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("%w: line %d has %d cells, the header has %d", ErrHeaderMismatch, line, len(row), len(keys))
+		}
+		payload := make(map[string]interface{}, len(row))
+		for i, cell := range row {
+			if r.NullValue != "" && cell == r.NullValue {
+				payload[keys[i]] = nil
+				continue
+			}
+			payload[keys[i]] = cell
+		}
+		return payload, nil
+	}
+}
+
+// ndjsonRows returns a func reading the objects of an NDJSON stream. Blank
+// lines are skipped.
+func ndjsonRows(rd io.Reader) func() (map[string]interface{}, error) {
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(nil, 64<<20)
+	line := 0
+	return func() (map[string]interface{}, error) {
+		for sc.Scan() {
+			line++
+			text := bytes.TrimSpace(sc.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.UseNumber()
+			var payload map[string]interface{}
+			if err := dec.Decode(&payload); err != nil || payload == nil {
+				return nil, fmt.Errorf("line %d is not a JSON object", line)
+			}
+			return payload, nil
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
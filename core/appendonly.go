@@ -0,0 +1,47 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned in AppendOnly mode when a file is smaller than it
+// was after the previous write, i.e., it was truncated or replaced externally.
+var ErrTruncated = errors.New("file shrank since the last write")
+
+// TruncatedError reports a file that shrank between two writes.
+type TruncatedError struct {
+	Path     string
+	Expected int64 // size after the previous write
+	Actual   int64 // size found before this write
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%v: %q was %d bytes, now %d bytes", ErrTruncated, e.Path, e.Expected, e.Actual)
+}
+
+func (e *TruncatedError) Is(target error) bool {
+	return target == ErrTruncated
+}
+
+// checkGrowth verifies that filename is at least as large as after the last
+// write. It returns a *TruncatedError, after alerting OnTruncate, otherwise.
+func (r *Service) checkGrowth(filename string, size int64) error {
+	expected, ok := r.sizes[filename]
+	if !ok || size >= expected {
+		return nil
+	}
+	err := &TruncatedError{Path: filename, Expected: expected, Actual: size}
+	if r.OnTruncate != nil {
+		r.OnTruncate(err)
+	}
+	return err
+}
+
+// trackSize remembers the size of filename after a successful write.
+func (r *Service) trackSize(filename string, size int64) {
+	if r.sizes == nil {
+		r.sizes = make(map[string]int64)
+	}
+	r.sizes[filename] = size
+}
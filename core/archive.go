@@ -0,0 +1,137 @@
+package core
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// ArchiveSchemaName is the name of the entry of an Export archive holding the
+// current schema.
+const ArchiveSchemaName = "schema.json"
+
+// Export writes a zip archive of every file of the rotation periods between
+// from and to, inclusive, to w, e.g., to hand a quarter of data over to an
+// auditor in one download. A zero from or to leaves that end open.
+//
+// Files are archived as they are on disk, under their path relative to Dir,
+// so they still match their checksums; encrypted and compressed files stay
+// so. Their schema, checksum and stats sidecars are included when they exist,
+// along with ManifestName holding the manifest entries of the files, if
+// TrackDelivery wrote any, and ArchiveSchemaName holding the current Schema.
+func (r *Service) Export(from, to time.Time, w io.Writer) error {
+	files, err := r.FilesBetween(DateRange{From: from, To: to})
+	if err != nil {
+		return err
+	}
+	schema, err := r.Schema()
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	method := zip.Deflate
+	if r.Compression != CompressionNone || r.EncryptionKey != nil {
+		method = zip.Store // Deflate wouldn't shrink them
+	}
+	for _, path := range files {
+		if err := r.archiveFile(zw, path, method); err != nil {
+			return err
+		}
+		for _, sidecar := range []string{SchemaSuffix, ChecksumSuffix, StatsSuffix} {
+			err := r.archiveFile(zw, path+sidecar, zip.Deflate)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	entries, err := r.archiveManifest(files)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		if err := archiveJSON(zw, ManifestName, entries); err != nil {
+			return err
+		}
+	}
+	if err := archiveJSON(zw, ArchiveSchemaName, schema); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// archiveFile adds the file at path to the archive, named by its path
+// relative to Dir. Only the bytes it held when it was opened are added, so a
+// concurrent write can't leave a partial row in the archive.
+func (r *Service) archiveFile(zw *zip.Writer, path string, method uint16) error {
+	f, err := r.fs().Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info for %q: %w", path, err)
+	}
+	name, err := filepath.Rel(r.Dir, path)
+	if err != nil {
+		return fmt.Errorf("failed to name %q in archive: %w", path, err)
+	}
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     filepath.ToSlash(name),
+		Method:   method,
+		Modified: stat.ModTime(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %q to archive: %w", path, err)
+	}
+	if _, err := io.Copy(dst, io.LimitReader(f, stat.Size())); err != nil {
+		return fmt.Errorf("failed to archive %q: %w", path, err)
+	}
+	return nil
+}
+
+// archiveManifest returns the manifest entries of files.
+func (r *Service) archiveManifest(files []string) ([]ManifestEntry, error) {
+	m, err := openManifest(r.fs(), filepath.Join(r.Dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := m.Entries()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(files))
+	for i, path := range files {
+		names[i] = filepath.Base(path)
+	}
+	return slices.DeleteFunc(entries, func(e ManifestEntry) bool {
+		return !slices.Contains(names, e.File)
+	}), nil
+}
+
+// archiveJSON adds v as an indented JSON entry with the given name.
+func archiveJSON(zw *zip.Writer, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	dst, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	if _, err := dst.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	return nil
+}
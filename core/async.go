@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultQueueSize is the async queue capacity used when QueueSize is unset.
+const defaultQueueSize = 1024
+
+// AsyncError is reported when a record queued with RecordAsync could not be
+// written, after all retries. It carries the payload so it can be recovered.
+type AsyncError struct {
+	Payload interface{}
+	Err     error
+
+	// Saved is the file the payload was saved to, see FailedFile, or empty
+	// if it wasn't.
+	Saved string
+
+	at time.Time // of the period the record was meant for, zero for now
+}
+
+func (e *AsyncError) Error() string {
+	return fmt.Sprintf("async record failed: %v", e.Err)
+}
+
+func (e *AsyncError) Unwrap() error {
+	return e.Err
+}
+
+// RecordAsync queues the payload to be written by a background goroutine and
+// returns immediately. When the queue is full, it blocks or drops a payload,
+// see Backpressure. Failed writes are reported through OnError and Errors. See
+// Flush and Close for waiting on the queue. It fails with WAL, which doesn't
+// journal queued payloads.
+func (r *Service) RecordAsync(payload interface{}) error {
+	if r.WAL {
+		return errors.New("RecordAsync can't be used with WAL, queued payloads aren't journaled")
+	}
+
+	r.asyncMu.Lock()
+	defer r.asyncMu.Unlock() // Held while sending, so Close can't close the queue under us
+
+	if r.asyncClosed {
+		return ErrClosed
+	}
+	if r.queue == nil {
+		size := r.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		queue := make(chan interface{}, size)
+		r.queue = queue
+		r.stats.queue.Store(&queue)
+		r.drained = make(chan struct{})
+		go r.drain(r.queue, r.drained)
+	}
+
+	r.enqueue(r.queued(payload))
+	return nil
+}
+
+// drain writes queued payloads until the queue is closed, then closes drained.
+// Up to AsyncBatch payloads queued for the same period are written together,
+// waiting up to FlushInterval for the batch to fill.
+func (r *Service) drain(queue <-chan interface{}, drained chan<- struct{}) {
+	defer close(drained)
+	ctx := context.WithValue(context.Background(), queuedKey{}, true)
+	size := r.AsyncBatch
+	if size <= 0 || r.DeadLetter {
+		size = 1 // A merged payload would be dead-lettered as a whole
+	}
+	for payload := range queue {
+		var wait <-chan time.Time
+		var timer *time.Timer
+		if size > 1 && r.FlushInterval > 0 {
+			timer = time.NewTimer(r.FlushInterval)
+			wait = timer.C
+		}
+		var pending []queuedRecord
+		for {
+			if done, ok := payload.(flushMarker); ok {
+				r.writeQueued(ctx, pending)
+				pending = nil
+				close(done)
+				break
+			}
+			q, ok := payload.(queuedRecord)
+			if !ok {
+				q = queuedRecord{payload: payload}
+			}
+			if len(pending) > 0 && !r.samePeriod(pending[0].at, q.at) {
+				r.writeQueued(ctx, pending)
+				pending = nil
+			}
+			pending = append(pending, q)
+			if len(pending) >= size {
+				break
+			}
+			if payload, ok = nextQueued(queue, wait); !ok {
+				break
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		r.writeQueued(ctx, pending)
+	}
+}
+
+// nextQueued returns the next queued payload, waiting for it until wait
+// fires, or not at all if wait is nil. It reports false if there is none or
+// the queue was closed.
+func nextQueued(queue <-chan interface{}, wait <-chan time.Time) (interface{}, bool) {
+	if wait == nil {
+		select {
+		case payload, ok := <-queue:
+			return payload, ok
+		default:
+			return nil, false
+		}
+	}
+	select {
+	case payload, ok := <-queue:
+		return payload, ok
+	case <-wait:
+		return nil, false
+	}
+}
+
+// samePeriod reports whether records queued at a and b, zero for the time
+// they are written, go to the files of the same period.
+func (r *Service) samePeriod(a, b time.Time) bool {
+	if a.IsZero() || b.IsZero() {
+		return a.IsZero() && b.IsZero()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now, err := r.Now()
+	if err != nil {
+		return false
+	}
+	sa, errA := r.Suffix(a.In(now.Location()))
+	sb, errB := r.Suffix(b.In(now.Location()))
+	return errA == nil && errB == nil && sa == sb
+}
+
+// writeQueued writes queued records of the same period with a single record
+// call. If a payload error fails the merged records, nothing was written, so
+// they are written one by one to report only the failing ones.
+func (r *Service) writeQueued(ctx context.Context, pending []queuedRecord) {
+	if len(pending) == 0 {
+		return
+	}
+	at := pending[0].at
+	if len(pending) > 1 {
+		var merged []interface{}
+		for _, q := range pending {
+			items, _ := splitPayload(q.payload)
+			merged = append(merged, items...)
+		}
+		_, err := r.recordTraced(ctx, merged, at, false)
+		if err == nil {
+			return
+		}
+		if perr := (*PayloadError)(nil); !errors.As(err, &perr) {
+			for _, q := range pending {
+				r.reportError(&AsyncError{Payload: q.payload, Err: err, at: q.at})
+			}
+			return
+		}
+	}
+	for _, q := range pending {
+		if _, err := r.recordTraced(ctx, q.payload, q.at, false); err != nil {
+			r.reportError(&AsyncError{Payload: q.payload, Err: err, at: q.at})
+		}
+	}
+}
+
+// reportError saves an async failure to FailedFile and hands it to OnError
+// and Errors, so it isn't lost.
+func (r *Service) reportError(err *AsyncError) {
+	if r.saveFailed(err) {
+		err.Saved = r.FailedFile
+	}
+	r.logError("async record failed", "error", err.Err, "saved", err.Saved)
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+	if r.Errors != nil {
+		r.Errors <- err
+	}
+}
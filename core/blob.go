@@ -0,0 +1,82 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// validateBlobColumns checks that BlobColumns are columns of the service and
+// aren't compressed as well.
+func (r *Service) validateBlobColumns() error {
+	for _, col := range r.BlobColumns {
+		if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+			return fmt.Errorf("blob column %q is not one of the columns", col)
+		}
+		if _, ok := r.CellCompression[col]; ok {
+			return fmt.Errorf("blob column %q can't be compressed too", col)
+		}
+	}
+	return nil
+}
+
+// blobLabels returns the header labels of the BlobColumns.
+func (r *Service) blobLabels() []string {
+	labels := make([]string, len(r.BlobColumns))
+	for i, col := range r.BlobColumns {
+		labels[i] = r.label(col)
+	}
+	return labels
+}
+
+// blobOf names the blob file of cell after its SHA-256, so a value recorded
+// twice is stored once, and returns the reference written in the cell.
+func (r *Service) blobOf(cell string) (string, spill) {
+	sum := sha256.Sum256([]byte(cell))
+	rel := path.Join(filepath.Base(r.SpillDir()), hex.EncodeToString(sum[:])+reader.BlobExt)
+	return reader.BlobCellPrefix + rel, spill{path: filepath.FromSlash(rel), data: cell}
+}
+
+// spillBlobs moves the non-empty cells of BlobColumns to blob files, leaving
+// NullValue cells alone, and returns them.
+func (r *Service) spillBlobs(column []string, fields map[string]interface{}, record []string) []spill {
+	var spills []spill
+	for i, col := range column {
+		if record[i] == "" || !slices.Contains(r.BlobColumns, col) {
+			continue
+		}
+		if r.NullValue != "" && record[i] == r.NullValue && fields[col] == nil {
+			continue
+		}
+		var s spill
+		record[i], s = r.blobOf(record[i])
+		spills = append(spills, s)
+	}
+	return spills
+}
+
+// ResolveBlob returns the content of the blob file a cell of BlobColumns
+// refers to, decrypted when EncryptionKey is set. Other cells are returned as
+// they are. Use reader.ResolveBlob for files read without a service.
+func (r *Service) ResolveBlob(cell string) (string, error) {
+	return reader.ResolveBlobFunc(cell, func(rel string) ([]byte, error) {
+		f, err := r.fs().Open(filepath.Join(r.Dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var rd io.Reader = f
+		if r.EncryptionKey != nil {
+			if rd, err = NewDecryptReader(f, r.EncryptionKey); err != nil {
+				return nil, fmt.Errorf("failed to decrypt: %w", err)
+			}
+		}
+		return io.ReadAll(rd)
+	})
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"time"
+)
+
+// defaultDedupKeys is the default of DedupOptions.MaxKeys.
+const defaultDedupKeys = 1_000_000
+
+// bloomMagic starts a dedup state file holding Bloom filters.
+var bloomMagic = []byte("RCDB\x01")
+
+// Layout of a Bloom state file: the magic, the hash count, the filter size
+// in bits, the header of both generations, then the bits of both.
+const (
+	bloomKOffset   = 5
+	bloomMOffset   = 8
+	bloomGenOffset = 16
+	bloomGenSize   = 40 // present, start, count and period
+	bloomBitsStart = bloomGenOffset + 2*bloomGenSize
+)
+
+// bloomGen is a Bloom filter of the keys written in one generation: one
+// rotation period without a Window, and one Window with it.
+type bloomGen struct {
+	period string
+	start  time.Time
+	count  int64
+	bits   []byte
+}
+
+// bloomState remembers the dedup keys of the current and previous
+// generations in Bloom filters sized by MaxKeys and FalsePositiveRate.
+type bloomState struct {
+	m    uint64 // bits per filter
+	k    int    // hashes per key
+	gens [2]*bloomGen
+
+	// dirty holds the bytes of the current filter changed since the last
+	// save, and rolled is set when the generations changed.
+	dirty  map[uint64]bool
+	rolled bool
+}
+
+// newBloomState sizes the filters for n keys at false positive rate p.
+func newBloomState(n int, p float64) *bloomState {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (max(m, 64) + 7) / 8 * 8
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomState{m: m, k: min(max(k, 1), 30), dirty: map[uint64]bool{}}
+}
+
+// fresh returns an empty filter for the generation starting at t.
+func (s *bloomState) fresh(period string, t time.Time) *bloomGen {
+	return &bloomGen{period: period, start: t, bits: make([]byte, s.m/8)}
+}
+
+// advance starts a new generation where needed for a write at t to the
+// period of suffix, and reports false if the keys of the write are not to be
+// checked, for an earlier period without a Window.
+func (s *bloomState) advance(opts *DedupOptions, t time.Time, suffix string) bool {
+	cur := s.gens[0]
+	maxKeys := int64(opts.MaxKeys)
+	if maxKeys <= 0 {
+		maxKeys = defaultDedupKeys
+	}
+	switch {
+	case cur == nil:
+		s.gens = [2]*bloomGen{s.fresh(suffix, t), nil}
+	case opts.Window <= 0 && suffix < cur.period:
+		return false // An earlier period, e.g., backfilled by AppendFrom
+	case opts.Window <= 0 && suffix != cur.period:
+		s.gens = [2]*bloomGen{s.fresh(suffix, t), nil}
+	case opts.Window > 0 && t.Sub(cur.start) >= opts.Window:
+		prev := cur
+		if t.Sub(cur.start) >= 2*opts.Window {
+			prev = nil // Nothing written within the window
+		}
+		s.gens = [2]*bloomGen{s.fresh(suffix, t), prev}
+	case cur.count >= maxKeys:
+		// Keeps the keys of the full filter, dropping the older ones
+		s.gens = [2]*bloomGen{s.fresh(cur.period, t), cur}
+	default:
+		return true
+	}
+	s.rolled = true
+	clear(s.dirty)
+	return true
+}
+
+// positions returns the bit positions of key.
+func (s *bloomState) positions(key string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := mix(h1) | 1
+	pos := make([]uint64, s.k)
+	for i := range pos {
+		pos[i] = (h1 + uint64(i)*h2) % s.m
+	}
+	return pos
+}
+
+// has reports whether key may have been added to either generation.
+func (s *bloomState) has(key string) bool {
+	pos := s.positions(key)
+	for _, g := range s.gens {
+		if g != nil && g.has(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *bloomGen) has(pos []uint64) bool {
+	for _, p := range pos {
+		if g.bits[p/8]&(1<<(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds key to the current generation.
+func (s *bloomState) add(key string) {
+	g := s.gens[0]
+	for _, p := range s.positions(key) {
+		g.bits[p/8] |= 1 << (p % 8)
+		s.dirty[p/8] = true
+	}
+	g.count++
+}
+
+// encode returns the state file of the filters.
+func (s *bloomState) encode() []byte {
+	buf := make([]byte, bloomBitsStart+2*s.m/8)
+	copy(buf, bloomMagic)
+	buf[bloomKOffset] = byte(s.k)
+	binary.LittleEndian.PutUint64(buf[bloomMOffset:], s.m)
+	for i, g := range s.gens {
+		if g == nil {
+			continue
+		}
+		header := buf[bloomGenOffset+i*bloomGenSize:]
+		header[0] = 1
+		binary.LittleEndian.PutUint64(header[8:], uint64(g.start.UnixNano()))
+		binary.LittleEndian.PutUint64(header[16:], uint64(g.count))
+		copy(header[24:40], g.period)
+		copy(buf[bloomBitsStart+uint64(i)*s.m/8:], g.bits)
+	}
+	return buf
+}
+
+// decodeBloomState reads a state file written by encode. It reports false
+// for files of filters of another size, which are started afresh.
+func decodeBloomState(data []byte, want *bloomState) (*bloomState, bool, error) {
+	if len(data) < bloomBitsStart || !bytes.HasPrefix(data, bloomMagic) {
+		return nil, false, errors.New("not a dedup Bloom filter state")
+	}
+	s := &bloomState{m: binary.LittleEndian.Uint64(data[bloomMOffset:]), k: int(data[bloomKOffset]), dirty: map[uint64]bool{}}
+	if s.m != want.m || s.k != want.k {
+		return nil, false, nil
+	}
+	if uint64(len(data)) != bloomBitsStart+2*s.m/8 {
+		return nil, false, errors.New("truncated dedup Bloom filter state")
+	}
+	for i := range s.gens {
+		header := data[bloomGenOffset+i*bloomGenSize:]
+		if header[0] == 0 {
+			continue
+		}
+		bits := data[bloomBitsStart+uint64(i)*s.m/8:][:s.m/8]
+		s.gens[i] = &bloomGen{
+			period: string(bytes.TrimRight(header[24:40], "\x00")),
+			start:  time.Unix(0, int64(binary.LittleEndian.Uint64(header[8:]))),
+			count:  int64(binary.LittleEndian.Uint64(header[16:])),
+			bits:   bytes.Clone(bits),
+		}
+	}
+	return s, true, nil
+}
+
+// loadBloom reads the Bloom filters of StateFile, or starts empty ones.
+func (r *Service) loadBloom() error {
+	opts := r.Dedup
+	n := opts.MaxKeys
+	if n <= 0 {
+		n = defaultDedupKeys
+	}
+	want := newBloomState(n, opts.FalsePositiveRate)
+	r.bloom = want
+	if opts.StateFile == "" {
+		return nil
+	}
+	data, err := readFile(r.fs(), opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dedup state %q: %w", opts.StateFile, err)
+	}
+	s, ok, err := decodeBloomState(data, want)
+	if err != nil {
+		return fmt.Errorf("failed to parse dedup state %q: %w", opts.StateFile, err)
+	}
+	if !ok {
+		r.logWarn("dedup filter size changed, starting afresh", "path", opts.StateFile)
+		want.rolled = true // Overwritten on the next save
+		return nil
+	}
+	r.bloom = s
+	return nil
+}
+
+// saveBloom persists the filters: the whole file after the generations
+// changed, and only the changed bytes and the key count otherwise.
+func (r *Service) saveBloom() error {
+	s, path := r.bloom, r.Dedup.StateFile
+	if path == "" {
+		return nil
+	}
+	if s.rolled {
+		if err := replaceFile(r.fs(), path, s.encode()); err != nil {
+			return fmt.Errorf("failed to save dedup state: %w", err)
+		}
+		s.rolled = false
+		clear(s.dirty)
+		return nil
+	}
+
+	f, err := r.fs().OpenFile(path, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		s.rolled = true
+		return r.saveBloom()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save dedup state: %w", err)
+	}
+	defer f.Close()
+	g := s.gens[0]
+	for i := range s.dirty {
+		if _, err := f.WriteAt(g.bits[i:i+1], bloomBitsStart+int64(i)); err != nil {
+			return fmt.Errorf("failed to save dedup state: %w", err)
+		}
+	}
+	var count [8]byte
+	binary.LittleEndian.PutUint64(count[:], uint64(g.count))
+	if _, err := f.WriteAt(count[:], bloomGenOffset+16); err != nil {
+		return fmt.Errorf("failed to save dedup state: %w", err)
+	}
+	clear(s.dirty)
+	return f.Close()
+}
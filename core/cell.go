@@ -0,0 +1,119 @@
+package core
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// defaultFormulaPrefix neutralizes a formula when the file is opened in a
+// spreadsheet.
+const defaultFormulaPrefix = "'"
+
+// defaultTruncationMarker ends cells shortened by MaxCellLength.
+const defaultTruncationMarker = "…"
+
+// cells maps fields onto the columns and applies the cell rules. It also
+// returns the cells to spill, including those of BlobColumns, and the indexes
+// of the cells shrunk by the size limits, see limitSize.
+func (r *Service) cells(column []string, fields map[string]interface{}) ([]string, []spill, []int, error) {
+	record := values(column, fields)
+	if len(r.CellCompression) > 0 {
+		if err := r.compressCells(column, record); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if r.MaxCellLength > 0 || r.EscapeFormulas || r.EscapeNewlines {
+		for i, cell := range record {
+			if _, ok := r.CellCompression[column[i]]; ok {
+				continue // Truncating would corrupt it
+			}
+			if slices.Contains(r.BlobColumns, column[i]) {
+				continue // Stored as it is
+			}
+			// Escaped first, so the limit holds for the cell as written
+			record[i], _ = r.limitCell(r.escapeNewlines(cell))
+			record[i] = r.escapeFormula(record[i])
+		}
+	}
+	r.nullCells(column, fields, record)
+	var blobs []spill
+	if len(r.BlobColumns) > 0 {
+		blobs = r.spillBlobs(column, fields, record)
+	}
+	spills, changed, err := r.limitSize(column, record)
+	return record, append(blobs, spills...), changed, err
+}
+
+// nullCells writes NullValue into the cells of null and, unless
+// DistinguishMissing is set, missing fields.
+func (r *Service) nullCells(column []string, fields map[string]interface{}, record []string) {
+	if r.NullValue == "" {
+		return
+	}
+	for i, col := range column {
+		if val, ok := fields[col]; val == nil && (ok || !r.DistinguishMissing) {
+			record[i] = r.NullValue
+		}
+	}
+}
+
+// escapeNewlines applies EscapeNewlines to cell.
+func (r *Service) escapeNewlines(cell string) string {
+	if !r.EscapeNewlines {
+		return cell
+	}
+	return reader.EscapeNewlines(cell)
+}
+
+// escapeStart moves cut back to the start of the escape sequence of
+// EscapeNewlines that cutting cell at cut would split, if any.
+func (r *Service) escapeStart(cell string, cut int) int {
+	if !r.EscapeNewlines {
+		return cut
+	}
+	n := 0
+	for n < cut && cell[cut-1-n] == '\\' {
+		n++
+	}
+	return cut - n%2
+}
+
+// limitCell shortens cell to MaxCellLength characters, including the marker,
+// without splitting an escape sequence, and reports whether it did.
+func (r *Service) limitCell(cell string) (string, bool) {
+	if r.MaxCellLength <= 0 || utf8.RuneCountInString(cell) <= r.MaxCellLength {
+		return cell, false
+	}
+	marker := r.TruncationMarker
+	if marker == "" {
+		marker = defaultTruncationMarker
+	}
+	keep := max(r.MaxCellLength-utf8.RuneCountInString(marker), 0)
+	cut := 0
+	for i := 0; i < keep; i++ {
+		_, size := utf8.DecodeRuneInString(cell[cut:])
+		cut += size
+	}
+	return cell[:r.escapeStart(cell, cut)] + marker, true
+}
+
+// escapeFormula prefixes cells that a spreadsheet would evaluate as a formula,
+// i.e., starting with =, +, -, @, a tab or a carriage return. Numbers such as
+// "-5" are left alone.
+func (r *Service) escapeFormula(cell string) string {
+	if !r.EscapeFormulas || cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return cell
+	}
+	if _, err := strconv.ParseFloat(cell, 64); err == nil {
+		return cell
+	}
+	prefix := r.FormulaPrefix
+	if prefix == "" {
+		prefix = defaultFormulaPrefix
+	}
+	return prefix + cell
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+// queried returns the cells of column in the rows of Query.
+func queried(t *testing.T, s *Service, column string) []string {
+	t.Helper()
+	var cells []string
+	for row, err := range s.Query(nil, DateRange{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		cells = append(cells, row.Fields[column])
+	}
+	return cells
+}
+
+func TestEscapeNewlinesBeforeLimit(t *testing.T) {
+	s := New(t.TempDir(), "note", []string{"text"}, "daily")
+	s.EscapeNewlines = true
+	s.MaxCellLength = 6
+	for _, text := range []string{"abcd\nef", "ab\ncd", "abc\\de"} {
+		if err := s.Record(map[string]interface{}{"text": text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The escaped cells are limited, without keeping half an escape sequence
+	want := []string{`abcd…`, `ab\ncd`, `abc\\…`}
+	if got := rows(t, s); !slices.Equal(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if got, want := queried(t, s, "text"), []string{"abcd…", "ab\ncd", `abc\…`}; !slices.Equal(got, want) {
+		t.Errorf("queried = %q, want %q", got, want)
+	}
+}
+
+func TestUnescapeOnlyEscapedCells(t *testing.T) {
+	s := New(t.TempDir(), "note", []string{"id", "text"}, "daily")
+	s.EscapeNewlines = true
+	s.NullValue = `\n`
+	if err := s.Record(map[string]interface{}{"id": "1", "text": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Record(map[string]interface{}{"id": "2", "text": "a\nb"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queried(t, s, "text"), []string{`\n`, "a\nb"}; !slices.Equal(got, want) {
+		t.Errorf("queried = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// cellPrefixes are the markers of the cells compressed by CellCompression.
+var cellPrefixes = map[Compression]string{
+	CompressionGzip: reader.GzipCellPrefix,
+	CompressionZstd: reader.ZstdCellPrefix,
+}
+
+// validateCellCompression checks the columns and algorithms of
+// CellCompression.
+func (r *Service) validateCellCompression() error {
+	for col, c := range r.CellCompression {
+		if _, ok := cellPrefixes[c]; !ok {
+			return fmt.Errorf("unsupported compression %v of column %q", c, col)
+		}
+		if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+			return fmt.Errorf("compressed column %q is not one of the columns", col)
+		}
+	}
+	return nil
+}
+
+// compressCells compresses the non-empty cells of the CellCompression
+// columns in place.
+func (r *Service) compressCells(column []string, record []string) error {
+	for i, col := range column {
+		c, ok := r.CellCompression[col]
+		if !ok || record[i] == "" {
+			continue
+		}
+		cell, err := reader.CompressCell(record[i], cellPrefixes[c])
+		if err != nil {
+			return fmt.Errorf("failed to compress column %q: %w", col, err)
+		}
+		record[i] = cell
+	}
+	return nil
+}
+
+// compressedLabels returns the header labels of the CellCompression columns.
+func (r *Service) compressedLabels() []string {
+	var labels []string
+	for col := range r.CellCompression {
+		labels = append(labels, r.label(col))
+	}
+	return labels
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"io"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// byteOrderMark is U+FEFF, written in the output encoding by WriteBOM.
+const byteOrderMark = "\uFEFF"
+
+// transcode converts UTF-8 CSV text to Encoding, prefixed with the byte order
+// mark when it starts a file and WriteBOM is set.
+func (r *Service) transcode(data []byte, start bool) ([]byte, error) {
+	if start && r.WriteBOM {
+		data = append([]byte(byteOrderMark), data...)
+	}
+	if r.Encoding == nil {
+		return data, nil
+	}
+	return r.Encoding.NewEncoder().Bytes(data)
+}
+
+// decodeReader converts file content back to UTF-8 and drops a leading byte
+// order mark.
+func (r *Service) decodeReader(rd io.Reader) io.Reader {
+	if r.Encoding == nil && !r.WriteBOM {
+		return rd
+	}
+	dec := encoding.Nop.NewDecoder()
+	if r.Encoding != nil {
+		dec = r.Encoding.NewDecoder()
+	}
+	return transform.NewReader(rd, unicode.BOMOverride(dec))
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ChecksumSuffix is appended to a file name to form its checksum sidecar,
+// e.g., "booking_record_2025_08_26.csv.sha256". Sidecars use the format of
+// sha256sum, so "sha256sum -c" verifies them too.
+const ChecksumSuffix = ".sha256"
+
+// ErrChecksumMismatch is matched by *ChecksumError with errors.Is.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumError is returned by Verify for a file that changed or disappeared
+// since its checksum was recorded.
+type ChecksumError struct {
+	Path string
+	Want string // hex SHA-256 recorded when the period closed
+	Got  string // hex SHA-256 of the file now, empty if it is missing
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Got == "" {
+		return fmt.Sprintf("%v: %q is missing, expected sha256 %s", ErrChecksumMismatch, e.Path, e.Want)
+	}
+	return fmt.Sprintf("%v: %q has sha256 %s, expected %s", ErrChecksumMismatch, e.Path, e.Got, e.Want)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// checksumOf returns the hex SHA-256 of the file at path as stored on disk.
+func (r *Service) checksumOf(path string) (string, error) {
+	f, err := r.fs().Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksum writes the sidecar of a closed period's file in the
+// background, so the first write of the next period doesn't wait.
+func (r *Service) writeChecksum(path string) {
+	r.background.Add(1)
+	go func() {
+		defer r.background.Done()
+		sum, err := r.checksumOf(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return // Only written to Sinks
+		}
+		if err == nil {
+			err = r.saveChecksum(path, sum)
+		}
+		if err != nil {
+			r.logError("failed to write checksum", "path", path, "error", err)
+		}
+	}()
+}
+
+func (r *Service) saveChecksum(path, sum string) error {
+	line := sum + "  " + filepath.Base(path) + "\n"
+	return replaceFile(r.fs(), path+ChecksumSuffix, []byte(line))
+}
+
+// readChecksum returns the hex SHA-256 in the sidecar of path.
+func (r *Service) readChecksum(path string) (string, error) {
+	data, err := readFile(r.fs(), path+ChecksumSuffix)
+	if err != nil {
+		return "", err
+	}
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != 2*sha256.Size {
+		return "", fmt.Errorf("malformed checksum file %q", path+ChecksumSuffix)
+	}
+	return sum, nil
+}
+
+// Verify checks the service's closed files against the checksums recorded when
+// their periods closed, in the sidecar files written with Checksums and in
+// the manifest of TrackDelivery. It returns a *ChecksumError for every file
+// that was truncated, modified or deleted since, joined. Files without a
+// recorded checksum, such as the file of the current period, are skipped.
+//
+// Compaction and the quota of MaxTotalBytes update or remove the checksums of
+// the files they change, so only changes made outside the service fail.
+func (r *Service) Verify() error {
+	r.mu.Lock()
+	files, err := r.files()
+	var entries []ManifestEntry
+	if err == nil && r.TrackDelivery {
+		var m *Manifest
+		if m, err = r.manifest(); err == nil {
+			entries, err = m.Entries()
+		}
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Sidecars and manifest entries whose file is gone
+	sidecars, err := r.listFiles(r.Dir, ChecksumSuffix)
+	if err != nil {
+		return err
+	}
+	for _, sidecar := range sidecars {
+		if path := strings.TrimSuffix(sidecar, ChecksumSuffix); !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+	}
+	recorded := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if e.Checksum == "" {
+			continue
+		}
+		path := filepath.Join(r.Dir, e.File)
+		recorded[path] = strings.TrimPrefix(e.Checksum, "sha256:")
+		if !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+	}
+
+	var errs []error
+	for _, path := range files {
+		var want []string
+		sum, err := r.readChecksum(path)
+		switch {
+		case err == nil:
+			want = append(want, sum)
+		case !errors.Is(err, os.ErrNotExist):
+			errs = append(errs, err)
+		}
+		if sum, ok := recorded[path]; ok && !slices.Contains(want, sum) {
+			want = append(want, sum)
+		}
+		if len(want) == 0 {
+			continue
+		}
+
+		got, err := r.checksumOf(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		for _, sum := range want {
+			if got != sum {
+				errs = append(errs, &ChecksumError{Path: path, Want: sum, Got: got})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reseal updates the recorded checksums of a closed file after the service
+// rewrote it, e.g., by compaction. Files without recorded checksums are left
+// alone. The caller must hold r.mu.
+func (r *Service) reseal(path string) error {
+	_, err := r.fs().Stat(path + ChecksumSuffix)
+	sidecar := err == nil
+	tracked := false
+	var m *Manifest
+	if r.TrackDelivery {
+		if m, err = r.manifest(); err != nil {
+			return err
+		}
+		entries, err := m.Entries()
+		if err != nil {
+			return err
+		}
+		tracked = slices.ContainsFunc(entries, func(e ManifestEntry) bool {
+			return e.File == filepath.Base(path) && e.Checksum != ""
+		})
+	}
+	if !sidecar && !tracked {
+		return nil
+	}
+
+	rows, size, checksum, err := r.fileStats(path)
+	if err != nil {
+		return err
+	}
+	if sidecar {
+		if err := r.saveChecksum(path, strings.TrimPrefix(checksum, "sha256:")); err != nil {
+			return err
+		}
+	}
+	if tracked {
+		return m.update(filepath.Base(path), "", func(e *ManifestEntry) {
+			e.Rows, e.Bytes, e.Checksum = rows, size, checksum
+		})
+	}
+	return nil
+}
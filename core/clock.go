@@ -0,0 +1,62 @@
+package core
+
+import "time"
+
+// ClockPolicy decides where records go when the clock goes back to an
+// earlier rotation period after it was set back, e.g., by NTP or an
+// operator, or on a host whose clock was off at startup.
+//
+// Daylight saving time changes never move the clock back to an earlier
+// period: periods start at midnight, so both occurrences of a repeated hour,
+// e.g., 01:00-02:00 on a fall-back or 23:00-24:00 where the change is at
+// midnight, are on the same date and go to the same file, and a day whose
+// midnight is skipped starts at its first instant. Records placed by
+// EventTimeColumn are never held.
+type ClockPolicy int
+
+const (
+	// ClockWall writes every record to the period of the wall clock, so a
+	// clock gone back reopens the file of the earlier period, which may have
+	// been rotated already. This is the default.
+	ClockWall ClockPolicy = iota
+
+	// ClockMonotonic never goes back to an earlier period: records stay in
+	// the latest period the clock reached until the clock reaches a later
+	// one, so rotated files are never reopened.
+	ClockMonotonic
+)
+
+func (p ClockPolicy) String() string {
+	switch p {
+	case ClockWall:
+		return "wall"
+	case ClockMonotonic:
+		return "monotonic"
+	}
+	return "unknown"
+}
+
+// holdSuffix returns the period a record of the clock's period suffix goes
+// to under ClockPolicy. The caller must hold r.mu.
+func (r *Service) holdSuffix(suffix string) string {
+	if r.ClockPolicy != ClockMonotonic {
+		return suffix
+	}
+	if r.clockSuffix == "" || r.clockSuffix == suffix {
+		r.clockSuffix = suffix
+		return suffix
+	}
+	layout := suffixLayouts[r.RecordType]
+	latest, errL := time.Parse(layout, r.clockSuffix)
+	t, errT := time.Parse(layout, suffix)
+	if errL != nil || errT != nil || !t.Before(latest) {
+		// A later period, or RecordType changed
+		r.clockSuffix = suffix
+		return suffix
+	}
+	if r.clockBehind != suffix {
+		r.clockBehind = suffix
+		r.logWarn("clock is behind the current period, holding it", "period", r.clockSuffix, "clock_period", suffix)
+	}
+	return r.clockSuffix
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clocked returns a service whose clock is read from *now.
+func clocked(t *testing.T, now *time.Time) *Service {
+	t.Helper()
+	s := New(t.TempDir(), "event", []string{"id"}, "daily")
+	s.Clock = func() time.Time { return *now }
+	return s
+}
+
+// fileRows returns the data rows of the service's files by their period.
+func fileRows(t *testing.T, s *Service) map[string][]string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(s.Dir, "event_*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string][]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		period := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "event_"), ".csv")
+		out[period] = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")[1:]
+	}
+	return out
+}
+
+func recordID(t *testing.T, s *Service, id string) {
+	t.Helper()
+	if err := s.Record(map[string]interface{}{"id": id}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocationDecidesPeriod(t *testing.T) {
+	now := time.Date(2025, 8, 26, 20, 0, 0, 0, time.UTC)
+	s := clocked(t, &now)
+	s.Location = time.FixedZone("UTC+9", 9*60*60)
+	recordID(t, s, "1")
+
+	utc := clocked(t, &now)
+	utc.Location = time.UTC
+	recordID(t, utc, "2")
+
+	if got := fileRows(t, s); !slices.Equal(got["2025_08_27"], []string{"1"}) {
+		t.Errorf("UTC+9 files = %v, want the row on 2025_08_27", got)
+	}
+	if got := fileRows(t, utc); !slices.Equal(got["2025_08_26"], []string{"2"}) {
+		t.Errorf("UTC files = %v, want the row on 2025_08_26", got)
+	}
+}
+
+func TestClockSetBack(t *testing.T) {
+	later := time.Date(2025, 8, 27, 0, 0, 30, 0, time.UTC)
+	earlier := later.Add(-time.Minute)
+	for policy, want := range map[ClockPolicy]map[string][]string{
+		ClockWall:      {"2025_08_26": {"2"}, "2025_08_27": {"1", "3"}},
+		ClockMonotonic: {"2025_08_27": {"1", "2", "3"}},
+	} {
+		t.Run(policy.String(), func(t *testing.T) {
+			now := later
+			s := clocked(t, &now)
+			s.Location = time.UTC
+			s.ClockPolicy = policy
+			recordID(t, s, "1")
+			now = earlier // Set back by NTP
+			recordID(t, s, "2")
+			now = later
+			recordID(t, s, "3")
+
+			got := fileRows(t, s)
+			if len(got) != len(want) {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+			for period, rows := range want {
+				if !slices.Equal(got[period], rows) {
+					t.Errorf("%s = %v, want %v", period, got[period], rows)
+				}
+			}
+		})
+	}
+}
+
+func TestClockMonotonicMovesOnToLaterPeriod(t *testing.T) {
+	now := time.Date(2025, 8, 27, 12, 0, 0, 0, time.UTC)
+	s := clocked(t, &now)
+	s.Location = time.UTC
+	s.ClockPolicy = ClockMonotonic
+	recordID(t, s, "1")
+	now = now.AddDate(0, 0, -1)
+	recordID(t, s, "2")
+	now = now.AddDate(0, 0, 2)
+	recordID(t, s, "3")
+
+	got := fileRows(t, s)
+	if !slices.Equal(got["2025_08_27"], []string{"1", "2"}) || !slices.Equal(got["2025_08_28"], []string{"3"}) {
+		t.Errorf("files = %v", got)
+	}
+}
+
+func TestDaylightSavingFallBackKeepsOneFile(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 01:30 occurs twice on 2025-11-02, in EDT and then in EST
+	first := time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	if a, b := first.In(ny), second.In(ny); a.Hour() != b.Hour() {
+		t.Fatalf("%v and %v aren't the repeated hour", a, b)
+	}
+
+	now := first
+	s := clocked(t, &now)
+	s.Location = ny
+	recordID(t, s, "1")
+	now = second
+	recordID(t, s, "2")
+
+	if got := fileRows(t, s); len(got) != 1 || !slices.Equal(got["2025_11_02"], []string{"1", "2"}) {
+		t.Errorf("files = %v, want both rows on 2025_11_02", got)
+	}
+}
+
+func TestConfigTimeZone(t *testing.T) {
+	cfg := &Config{Dir: t.TempDir(), Filename: "event", Column: []string{"id"}, RecordType: "daily", TimeZone: "Mars/Olympus"}
+	if _, err := NewFromConfig(cfg); err == nil {
+		t.Error("accepted an unknown time zone")
+	}
+	cfg.TimeZone = "UTC"
+	s, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Location != time.UTC {
+		t.Errorf("location = %v, want UTC", s.Location)
+	}
+}
@@ -0,0 +1,359 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+// ErrPathCollision is returned when a service would write to the same files as
+// an already registered service and the collision policy doesn't allow it.
+var ErrPathCollision = errors.New("file path already used by another service")
+
+// CollisionPolicy decides what happens when two services resolve to the same
+// file names. Services whose files are partition files of another service,
+// e.g., "booking_x" next to "booking" partitioned by a field with the value
+// "x", fail with ErrPathCollision whatever the policy.
+type CollisionPolicy int
+
+const (
+	// CollisionShare lets services with the same file format share the file;
+	// their writes are serialized through one writer lock. Services that
+	// would write it differently, with other columns, header labels,
+	// Environment, Compression, EncryptionKey, line breaks, BOM, NullValue,
+	// Encoding, Preamble, RFC4180, EscapeNewlines or CellCompression, still
+	// fail with ErrPathCollision. This is the default.
+	CollisionShare CollisionPolicy = iota
+
+	// CollisionSuffix gives the later service its own files by appending a
+	// counter to its filename, e.g., "booking_record_2_2025_08_26.csv".
+	CollisionSuffix
+
+	// CollisionError rejects the later service with ErrPathCollision.
+	CollisionError
+)
+
+// pathEntry is a registered file name pattern and the services using it.
+type pathEntry struct {
+	mu     sync.Mutex
+	format fileFormat
+
+	// partitions is the path template of the partition files, see
+	// partitionVerb, or "" if the services don't partition.
+	partitions string
+
+	// owners are the tokens of the claimants of the services using it,
+	// rather than the services, so the registry doesn't keep them alive.
+	owners []*claimToken
+}
+
+// claimant holds the claim of a service on its path entry. Only the service
+// refers to it, so once a service that was never closed or unregistered is
+// unreachable, the finalizer of its claimant releases the claim, and
+// another service may claim the files with another format.
+type claimant struct {
+	key   string
+	entry *pathEntry
+	token *claimToken
+}
+
+// claimToken identifies a claimant in pathEntry.owners.
+type claimToken struct{ _ byte }
+
+// release removes the claim from the registry, once.
+func (c *claimant) release() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	c.entry.owners = slices.DeleteFunc(c.entry.owners, func(t *claimToken) bool { return t == c.token })
+	if len(c.entry.owners) == 0 && registry[c.key] == c.entry {
+		delete(registry, c.key)
+	}
+}
+
+// fileFormat holds the settings deciding what a service writes to its files,
+// which services sharing the files must agree on.
+type fileFormat struct {
+	column      []string
+	headers     []string
+	environment string
+	compression Compression
+	key         []byte
+	terminator  Terminator
+	bom         bool
+	nullValue   string
+	encoding    string
+	preamble    []string
+	rfc4180     bool
+	escapeNL    bool
+	cellComp    map[string]Compression
+}
+
+// fileFormat returns the format the service writes its files in.
+func (r *Service) fileFormat() fileFormat {
+	return fileFormat{
+		column:      slices.Clone(r.Column),
+		headers:     slices.Clone(r.HeaderRow()),
+		environment: r.Environment,
+		compression: r.Compression,
+		key:         slices.Clone(r.EncryptionKey),
+		terminator:  r.terminator(),
+		bom:         r.WriteBOM,
+		nullValue:   r.NullValue,
+		encoding:    encodingID(r.Encoding),
+		preamble:    slices.Clone(r.Preamble),
+		rfc4180:     r.RFC4180,
+		escapeNL:    r.EscapeNewlines,
+		cellComp:    maps.Clone(r.CellCompression),
+	}
+}
+
+// encodingID identifies e, which may not be comparable.
+func encodingID(e encoding.Encoding) string {
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T %v", e, e)
+}
+
+// mismatch names the first setting f and g differ in, or returns "" if they
+// agree.
+func (f fileFormat) mismatch(g fileFormat) string {
+	switch {
+	case !slices.Equal(f.column, g.column):
+		return "columns"
+	case !slices.Equal(f.headers, g.headers):
+		return "header labels"
+	case f.environment != g.environment:
+		return fmt.Sprintf("environments %q and %q", f.environment, g.environment)
+	case f.compression != g.compression:
+		return "compression"
+	case !bytes.Equal(f.key, g.key):
+		return "encryption keys"
+	case f.terminator != g.terminator:
+		return "line breaks"
+	case f.bom != g.bom:
+		return "byte order marks"
+	case f.nullValue != g.nullValue:
+		return "null values"
+	case f.encoding != g.encoding:
+		return "encodings"
+	case !slices.Equal(f.preamble, g.preamble):
+		return "preambles"
+	case f.rfc4180 != g.rfc4180:
+		return "RFC 4180 settings"
+	case f.escapeNL != g.escapeNL:
+		return "newline escaping"
+	case !maps.Equal(f.cellComp, g.cellComp):
+		return "cell compression"
+	}
+	return ""
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*pathEntry{}
+)
+
+// templateTime is the period the path templates are formatted at.
+var templateTime = time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+// partitionVerb stands for the partition in the path template of partition
+// files. Filenames and partitions can't contain it.
+const partitionVerb = "\x00"
+
+// pathKey returns the path template of the files of base, with Dir, DirLayout,
+// Namer and Compression applied and the period formatted at templateTime,
+// and of its partition files if the service partitions, which identify the
+// files the service writes to.
+func (r *Service) pathKey(base string) (key, partitions string, err error) {
+	dir, err := filepath.Abs(r.Dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve directory %q: %w", r.Dir, err)
+	}
+	template := func(base string) string {
+		name := r.namer().Name(base, templateTime) + r.Compression.Extension()
+		if r.DirLayout != "" {
+			name = templateTime.Format(r.DirLayout) + "/" + name
+		}
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
+	key = template(base)
+	if r.PartitionBy != "" || r.GroupBy != nil {
+		partitions = template(base + "_" + partitionVerb)
+	}
+	return key, partitions, nil
+}
+
+// isPartition reports whether key is the path template of one of the
+// partition files of the template partitions.
+func isPartition(key, partitions string) bool {
+	before, after, ok := strings.Cut(partitions, partitionVerb)
+	return ok && len(key) > len(before)+len(after) && strings.HasPrefix(key, before) && strings.HasSuffix(key, after)
+}
+
+// overlapping returns the key of a registered entry other than the one of key
+// whose files overlap with those of key and partitions, or "" if there is
+// none. The caller must hold registryMu.
+func overlapping(key, partitions string) string {
+	for other, entry := range registry {
+		if other != key && (isPartition(key, entry.partitions) || isPartition(other, partitions)) {
+			return other
+		}
+	}
+	return ""
+}
+
+// Register claims the service's file names, applying Collision if another
+// registered service already writes to them. Record registers the service
+// automatically on first use; calling Register at startup surfaces
+// collisions before any record is written.
+func (r *Service) Register() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.register()
+}
+
+// Unregister releases the file names claimed by Register. A service dropped
+// without Close or Unregister releases them once it is garbage collected.
+func (r *Service) Unregister() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unregister()
+}
+
+func (r *Service) register() error {
+	if r.entry != nil {
+		return nil
+	}
+
+	// Registration runs once per configuration, so it is also where the
+	// columns and location are checked before the first file is written.
+	if err := r.resolveColumns(); err != nil {
+		return err
+	}
+	if err := ValidateColumns(r.Column); err != nil {
+		return fmt.Errorf("invalid columns: %w", err)
+	}
+	if err := r.validateHeaders(); err != nil {
+		return err
+	}
+	if err := r.checkLocation(); err != nil {
+		return err
+	}
+	if err := r.validateRules(); err != nil {
+		return err
+	}
+	if err := r.validateEnrichers(); err != nil {
+		return err
+	}
+	if err := r.validateMirrors(); err != nil {
+		return err
+	}
+	if err := r.validateRFC4180(); err != nil {
+		return err
+	}
+	if err := r.claim(); err != nil {
+		return err
+	}
+
+	if r.WAL {
+		r.entry.mu.Lock()
+		err := r.claimJournal()
+		r.entry.mu.Unlock()
+		if err != nil {
+			r.unregister()
+			return err
+		}
+	}
+	return nil
+}
+
+// claim registers the path pattern, resolving collisions with other services.
+func (r *Service) claim() error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := r.filename()
+	for n := 2; ; n++ {
+		key, partitions, err := r.pathKey(name)
+		if err != nil {
+			return err
+		}
+
+		entry, ok := registry[key]
+		if other := overlapping(key, partitions); other != "" {
+			// Suffixed names overlap with the partition files all the same
+			return fmt.Errorf("%w: the files of %q and %q overlap through partitions", ErrPathCollision, key, other)
+		}
+		if !ok {
+			entry = &pathEntry{format: r.fileFormat(), partitions: partitions}
+			registry[key] = entry
+		} else if r.Collision == CollisionSuffix {
+			name = fmt.Sprintf("%s_%d", r.filename(), n)
+			continue
+		} else if err := r.collides(key, entry); err != nil {
+			return err
+		} else if entry.partitions == "" {
+			entry.partitions = partitions
+		}
+
+		c := &claimant{key: key, entry: entry, token: &claimToken{}}
+		entry.owners = append(entry.owners, c.token)
+		runtime.SetFinalizer(c, (*claimant).release)
+		r.entry, r.entryKey, r.name, r.claimant = entry, key, name, c
+		return nil
+	}
+}
+
+// collides returns the ErrPathCollision of sharing the files of key, already
+// claimed by entry, under the Collision policy, or nil if they can be shared.
+func (r *Service) collides(key string, entry *pathEntry) error {
+	if r.Collision == CollisionError {
+		return fmt.Errorf("%w: %q", ErrPathCollision, key)
+	}
+	if what := entry.format.mismatch(r.fileFormat()); what != "" {
+		return fmt.Errorf("%w: %q is written with different %s", ErrPathCollision, key, what)
+	}
+	return nil
+}
+
+// checkCollision reports whether registering the service would fail with
+// ErrPathCollision, without registering it.
+func (r *Service) checkCollision() error {
+	if r.entry != nil || r.Collision == CollisionSuffix {
+		return nil
+	}
+	key, partitions, err := r.pathKey(r.filename())
+	if err != nil {
+		return err
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if other := overlapping(key, partitions); other != "" {
+		return fmt.Errorf("%w: the files of %q and %q overlap through partitions", ErrPathCollision, key, other)
+	}
+	if entry, ok := registry[key]; ok {
+		return r.collides(key, entry)
+	}
+	return nil
+}
+
+func (r *Service) unregister() {
+	if r.entry == nil {
+		return
+	}
+
+	runtime.SetFinalizer(r.claimant, nil)
+	r.claimant.release()
+	r.entry, r.entryKey, r.name, r.claimant = nil, "", "", nil
+	r.releaseJournal()
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCollisionPartitionOverlapsFilename(t *testing.T) {
+	for _, policy := range []CollisionPolicy{CollisionShare, CollisionSuffix, CollisionError} {
+		dir := t.TempDir()
+		partitioned := New(dir, "booking", []string{"id", "hotel"}, "daily")
+		partitioned.PartitionBy = "hotel"
+		if err := partitioned.Register(); err != nil {
+			t.Fatal(err)
+		}
+		plain := New(dir, "booking_x", []string{"id", "hotel"}, "daily")
+		plain.Collision = policy
+		if err := plain.Register(); !errors.Is(err, ErrPathCollision) {
+			t.Errorf("policy %d: err = %v, want ErrPathCollision", policy, err)
+		}
+
+		// Registered the other way around
+		partitioned.Unregister()
+		plain.Unregister()
+		if err := plain.Register(); err != nil {
+			t.Fatal(err)
+		}
+		if err := partitioned.Register(); !errors.Is(err, ErrPathCollision) {
+			t.Errorf("policy %d, reversed: err = %v, want ErrPathCollision", policy, err)
+		}
+		plain.Unregister()
+	}
+}
+
+func TestCollisionKeyAppliesNamer(t *testing.T) {
+	dir := t.TempDir()
+	a := New(dir, "booking", []string{"id"}, "daily")
+	a.Namer = NamerFunc(func(base string, t time.Time) string { return t.Format("2006/01/02") + "/record.csv" })
+	b := New(dir, "payment", []string{"id"}, "daily")
+	b.Namer = a.Namer
+	b.Collision = CollisionError
+	if err := a.Register(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Unregister()
+	if err := b.Register(); !errors.Is(err, ErrPathCollision) {
+		t.Errorf("err = %v, want ErrPathCollision", err)
+	}
+
+	// Distinct DirLayout folders are distinct files
+	c := New(dir, "booking", []string{"id"}, "daily")
+	c.DirLayout = "2006"
+	c.Collision = CollisionError
+	if err := c.Register(); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	c.Unregister()
+}
+
+func TestCollisionFormatMismatch(t *testing.T) {
+	dir := t.TempDir()
+	a := New(dir, "booking", []string{"id"}, "daily")
+	if err := a.Register(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Unregister()
+	for name, set := range map[string]func(s *Service){
+		"preamble":         func(s *Service) { s.Preamble = []string{"# export"} },
+		"escape newlines":  func(s *Service) { s.EscapeNewlines = true },
+		"rfc4180":          func(s *Service) { s.RFC4180 = true },
+		"cell compression": func(s *Service) { s.CellCompression = map[string]Compression{"id": CompressionGzip} },
+	} {
+		b := New(dir, "booking", []string{"id"}, "daily")
+		set(b)
+		if err := b.Register(); !errors.Is(err, ErrPathCollision) {
+			t.Errorf("%s: err = %v, want ErrPathCollision", name, err)
+			b.Unregister()
+		}
+	}
+}
+
+func TestCollisionDroppedServiceReleasesPath(t *testing.T) {
+	dir := t.TempDir()
+	func() {
+		dropped := New(dir, "booking", []string{"id"}, "daily")
+		if err := dropped.Record(map[string]interface{}{"id": "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	reconfigured := New(dir, "booking", []string{"id", "status"}, "daily")
+	defer reconfigured.Unregister()
+	var err error
+	for range 10 {
+		runtime.GC()
+		if err = reconfigured.Register(); err == nil {
+			return
+		}
+	}
+	t.Errorf("path still claimed by a dropped service: %v", err)
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"maps"
+	"slices"
+	"unicode/utf8"
+)
+
+// defaultStatsMinRows is the MinRows of ColumnStatsOptions when it is zero.
+const defaultStatsMinRows = 100
+
+// ColumnStatsOptions configures the column statistics of TrackColumns.
+type ColumnStatsOptions struct {
+	// MinRows is the number of rows a period needs before an empty column is
+	// reported, so a quiet start of the day isn't mistaken for a broken feed.
+	// Defaults to 100.
+	MinRows int
+
+	// OnAnomaly, if set, receives every anomaly, besides the warning logged.
+	// It runs while the service is locked, so it must not record itself.
+	OnAnomaly func(a ColumnAnomaly)
+}
+
+// ColumnStat describes the cells written to a column in a rotation period.
+type ColumnStat struct {
+	Column    string `json:"column"`
+	Rows      int64  `json:"rows"`       // rows written
+	Empty     int64  `json:"empty"`      // empty or NullValue cells
+	MaxLength int    `json:"max_length"` // in characters
+}
+
+// EmptyRatio returns the share of empty cells, from 0 to 1.
+func (s ColumnStat) EmptyRatio() float64 {
+	if s.Rows == 0 {
+		return 0
+	}
+	return float64(s.Empty) / float64(s.Rows)
+}
+
+// ColumnAnomaly reports a column that had values in the previous rotation
+// period and is empty in every row of the current one so far, typically
+// because an upstream field was renamed.
+type ColumnAnomaly struct {
+	Column   string
+	Suffix   string     // of the current period
+	Stat     ColumnStat // of the current period
+	Previous ColumnStat // of the previous period
+}
+
+// columnStats holds the statistics of the current and previous periods.
+type columnStats struct {
+	suffix   string
+	current  map[string]*ColumnStat
+	previous map[string]ColumnStat
+	reported map[string]bool // columns reported in the current period
+}
+
+// ColumnStats returns the statistics of the columns in the current rotation
+// period, in column order, if TrackColumns is set. Only rows written by this
+// service since it started are counted.
+func (r *Service) ColumnStats() []ColumnStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stats []ColumnStat
+	for _, col := range r.Column {
+		if s, ok := r.colStats.current[col]; ok {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
+
+// trackColumns adds the rows of the batches of the current period to the
+// column statistics and reports the columns that became empty. The caller
+// must hold r.mu.
+func (r *Service) trackColumns(batches []*Batch) {
+	if r.TrackColumns == nil {
+		return
+	}
+	c := &r.colStats
+	if c.suffix != r.lastSuffix {
+		c.previous = make(map[string]ColumnStat, len(c.current))
+		for col, s := range c.current {
+			c.previous[col] = *s
+		}
+		c.suffix, c.current, c.reported = r.lastSuffix, make(map[string]*ColumnStat), make(map[string]bool)
+	}
+	for _, b := range batches {
+		if b.Suffix != c.suffix {
+			continue // Another period, for EventTimeColumn
+		}
+		for i, col := range b.Column {
+			s, ok := c.current[col]
+			if !ok {
+				s = &ColumnStat{Column: col}
+				c.current[col] = s
+			}
+			for _, row := range b.Rows {
+				s.Rows++
+				if i >= len(row) || row[i] == "" || row[i] == r.NullValue {
+					s.Empty++
+				} else if n := utf8.RuneCountInString(row[i]); n > s.MaxLength {
+					s.MaxLength = n
+				}
+			}
+		}
+	}
+	r.checkColumns()
+}
+
+// checkColumns reports the columns of the current period with only empty
+// cells after MinRows rows that had values in the previous period.
+func (r *Service) checkColumns() {
+	c := &r.colStats
+	minRows := int64(r.TrackColumns.MinRows)
+	if minRows <= 0 {
+		minRows = defaultStatsMinRows
+	}
+	for _, col := range slices.Sorted(maps.Keys(c.current)) {
+		s := c.current[col]
+		prev, ok := c.previous[col]
+		if c.reported[col] || s.Rows < minRows || s.Empty < s.Rows || !ok || prev.Empty == prev.Rows {
+			continue
+		}
+		c.reported[col] = true
+		r.logWarn("column became empty", "column", col, "suffix", c.suffix, "rows", s.Rows, "previous_empty_ratio", prev.EmptyRatio())
+		if r.TrackColumns.OnAnomaly != nil {
+			r.TrackColumns.OnAnomaly(ColumnAnomaly{Column: col, Suffix: c.suffix, Stat: *s, Previous: prev})
+		}
+	}
+}
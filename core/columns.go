@@ -0,0 +1,128 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// ErrHeaderMismatch is returned when two lists of columns that must agree
+// don't: Column and the fields of ColumnsFrom, Headers and Column, or the
+// header of a stream read by AppendFrom and its rows.
+var ErrHeaderMismatch = errors.New("header mismatch")
+
+// ColumnSpec pairs a payload key with the header label written for it.
+type ColumnSpec struct {
+	Key    string
+	Header string // defaults to Key
+}
+
+// Columns splits specs into the Column and Headers of a service:
+//
+//	service.Column, service.Headers = core.Columns([]core.ColumnSpec{
+//		{Key: "req_id", Header: "Request ID"},
+//		{Key: "status"},
+//	})
+func Columns(specs []ColumnSpec) (column, headers []string) {
+	column = make([]string, len(specs))
+	headers = make([]string, len(specs))
+	for i, spec := range specs {
+		column[i], headers[i] = spec.Key, spec.Header
+		if spec.Header == "" {
+			headers[i] = spec.Key
+		}
+	}
+	return column, headers
+}
+
+// StructColumns returns the columns of a struct type in field declaration
+// order, named the way Record reads struct payloads without CSVTags: from the
+// json tag, then the Go name, with the fields of embedded structs promoted.
+// v is a value of the struct or a pointer to it, which may be nil:
+//
+//	service.Column, err = core.StructColumns((*Booking)(nil))
+func StructColumns(v interface{}) ([]string, error) {
+	return structColumns(v, false)
+}
+
+func structColumns(v interface{}, csvTags bool) ([]string, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("columns need a struct, got %T", v)
+	}
+	plan := planFor(t, csvTags)
+	if plan == nil {
+		return nil, fmt.Errorf("type %v encodes itself through a method, its fields aren't the columns", t)
+	}
+	column := make([]string, len(plan.fields))
+	for i, f := range plan.fields {
+		column[i] = f.name
+	}
+	return column, nil
+}
+
+// resolveColumns sets Column from ColumnsFrom, or checks that they agree when
+// both are set.
+func (r *Service) resolveColumns() error {
+	if r.ColumnsFrom == nil {
+		return nil
+	}
+	column, err := structColumns(r.ColumnsFrom, r.CSVTags)
+	if err != nil {
+		return err
+	}
+	if len(r.Column) == 0 {
+		r.Column = column
+		return nil
+	}
+	if !slices.Equal(r.Column, column) {
+		return fmt.Errorf("%w: columns %q don't match the fields %q of %T", ErrHeaderMismatch, r.Column, column, r.ColumnsFrom)
+	}
+	return nil
+}
+
+// HeaderRow returns the header labels written to the files: Headers, or
+// Column when no labels are set.
+func (r *Service) HeaderRow() []string {
+	if len(r.Headers) > 0 {
+		return r.Headers
+	}
+	return r.Column
+}
+
+// label returns the header label of a payload key, or key itself if it isn't
+// one of the columns.
+func (r *Service) label(key string) string {
+	if i := slices.Index(r.Column, key); i >= 0 && i < len(r.Headers) {
+		return r.Headers[i]
+	}
+	return key
+}
+
+// validateHeaderAliases checks that HeaderAliases has no empty labels.
+func (r *Service) validateHeaderAliases() error {
+	for from, to := range r.HeaderAliases {
+		if from == "" || to == "" {
+			return fmt.Errorf("header alias %q → %q has an empty label", from, to)
+		}
+	}
+	return nil
+}
+
+// validateHeaders checks that Headers, if set, labels every column.
+func (r *Service) validateHeaders() error {
+	if len(r.Headers) == 0 {
+		return nil
+	}
+	if len(r.Headers) != len(r.Column) {
+		return fmt.Errorf("%w: %d headers given for %d columns", ErrHeaderMismatch, len(r.Headers), len(r.Column))
+	}
+	if err := ValidateColumns(r.Headers); err != nil {
+		return fmt.Errorf("invalid headers: %w", err)
+	}
+	return nil
+}
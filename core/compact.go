@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CompactOptions configures record-level retention: rows whose timestamp is
+// older than TTL are dropped by Compact, for data minimization where deleting
+// whole files is too coarse.
+type CompactOptions struct {
+	// TimeColumn is the column holding each row's timestamp, as RFC 3339 (the
+	// encoding of time.Time values) or Unix seconds.
+	TimeColumn string
+
+	// TTL is how long rows are kept.
+	TTL time.Duration
+}
+
+// Compact rewrites the CSV file at path without the rows that outlived
+// Compaction.TTL and returns how many were dropped. Rows with an empty or
+// unparseable timestamp are kept. The file keeps its header even when every
+// row is dropped.
+//
+// Compaction shrinks files, so other processes using AppendOnly on the same
+// files will report them as truncated.
+func (r *Service) Compact(path string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.compact(path, r.clock())
+}
+
+func (r *Service) compact(path string, now time.Time) (int, error) {
+	opts := r.Compaction
+	if opts == nil || opts.TimeColumn == "" || opts.TTL <= 0 {
+		return 0, errors.New("compaction needs a time column and a positive TTL")
+	}
+	if r.entry != nil {
+		r.entry.mu.Lock()
+		defer r.entry.mu.Unlock()
+	}
+
+	release, err := r.hold(path)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	rows, err := r.readRows(path)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	header, records := rows[0], rows[1:]
+	col := slices.Index(header, r.label(opts.TimeColumn))
+	if col < 0 {
+		return 0, fmt.Errorf("file %q has no column %q", path, opts.TimeColumn)
+	}
+
+	cutoff := now.Add(-opts.TTL)
+	kept := records[:0]
+	for _, row := range records {
+		if col < len(row) {
+			if t, ok := parseTimestamp(row[col]); ok && t.Before(cutoff) {
+				continue
+			}
+		}
+		kept = append(kept, row)
+	}
+	dropped := len(records) - len(kept)
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	var old File
+	if r.Shred != nil {
+		// Kept open, the replaced content can still be overwritten
+		if old, err = r.fs().OpenFile(path, os.O_RDWR, 0); err != nil {
+			return 0, fmt.Errorf("failed to compact %q: %w", path, err)
+		}
+		defer old.Close()
+	}
+	if err := r.rewrite(path, header, kept); err != nil {
+		return 0, fmt.Errorf("failed to compact %q: %w", path, err)
+	}
+	if old != nil {
+		if err := r.shred(old, path, "compaction", dropped); err != nil {
+			return dropped, err
+		}
+	}
+	if err := r.reseal(path); err != nil {
+		return dropped, fmt.Errorf("failed to update checksum of %q: %w", path, err)
+	}
+	r.logInfo("compacted CSV file", "path", path, "dropped", dropped, "kept", len(kept))
+	return dropped, nil
+}
+
+// parseTimestamp reads a cell written from a time.Time or a Unix timestamp.
+func parseTimestamp(cell string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, cell); err == nil {
+		return t, true
+	}
+	if sec, err := strconv.ParseInt(cell, 10, 64); err == nil {
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// Files returns the CSV files of the service in Dir, across all rotation
+// periods and partitions.
+func (r *Service) Files() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.files()
+}
+
+func (r *Service) files() ([]string, error) {
+	return r.listFiles(r.Dir, "")
+}
+
+// RunCompactor compacts every file of the service each interval until ctx is
+// done. Failures are passed to onError, if set, and don't stop the compactor.
+func (r *Service) RunCompactor(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		files, err := r.Files()
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+		for _, path := range files {
+			if _, err := r.Compact(path); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
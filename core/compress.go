@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression of the CSV files. Every append is written as
+// a complete gzip member or zstd frame, so files stay appendable and the
+// standard tools (gunzip, zstdcat) read the concatenation as one stream.
+type Compression int
+
+const (
+	// CompressionNone writes plain CSV files. This is the default.
+	CompressionNone Compression = iota
+	// CompressionGzip writes ".csv.gz" files.
+	CompressionGzip
+	// CompressionZstd writes ".csv.zst" files, which are usually smaller than
+	// gzip and faster to decompress.
+	CompressionZstd
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone: "none",
+	CompressionGzip: "gzip",
+	CompressionZstd: "zstd",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+func (c Compression) MarshalText() ([]byte, error) {
+	if name, ok := compressionNames[c]; ok {
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", int(c))
+}
+
+func (c *Compression) UnmarshalText(text []byte) error {
+	for value, name := range compressionNames {
+		if strings.EqualFold(string(text), name) {
+			*c = value
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown compression %q", text)
+}
+
+// Extension returns the suffix added after ".csv" to the file names, e.g.,
+// ".zst".
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// zstdEncoder compresses every frame; EncodeAll is safe for concurrent use.
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// compress returns data as one complete gzip member or zstd frame.
+func (r *Service) compress(data []byte) ([]byte, error) {
+	switch r.Compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", int(r.Compression))
+}
+
+// decompressReader returns a reader of the decompressed content of rd, reading
+// every frame. close releases the decompressor.
+func (r *Service) decompressReader(rd io.Reader) (io.Reader, func(), error) {
+	if r.Compression == CompressionNone {
+		return rd, func() {}, nil
+	}
+	br := bufio.NewReader(rd)
+	if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+		return br, func() {}, nil // Empty file
+	}
+	switch r.Compression {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		return zr, func() { zr.Close() }, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		return zr, zr.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unknown compression %d", int(r.Compression))
+}
@@ -0,0 +1,295 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config is the JSON file representation of a Service.
+//
+// Example:
+//
+//	{
+//	  "dir": "files/record",
+//	  "filename": "agoda_booking_record",
+//	  "column": ["id", "request", "response"],
+//	  "record_type": "daily"
+//	}
+type Config struct {
+	Dir        string   `json:"dir"`
+	Filename   string   `json:"filename"`
+	Column     []string `json:"column"`
+	Headers    []string `json:"headers,omitempty"` // header labels, see Service.Headers
+	RecordType string   `json:"record_type"`
+
+	// Environment is put in front of the file names, see
+	// Service.Environment, e.g., "prod".
+	Environment string `json:"environment,omitempty"`
+
+	// HeaderAliases maps the header labels of older files to the current
+	// ones, see Service.HeaderAliases, e.g., {"cust_id": "customer_id"}.
+	HeaderAliases map[string]string `json:"header_aliases,omitempty"`
+
+	// TimeZone is the IANA name of the time zone of the rotation periods, see
+	// Service.Location, e.g., "Europe/Berlin". Defaults to "Asia/Jakarta".
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// Rules are the column rules, see Service.Rules, e.g.,
+	// {"amount": {"type": "float", "on_invalid": "quarantine"}}.
+	Rules map[string]ColumnRule `json:"rules,omitempty"`
+
+	// Templates are the column templates, see Service.Templates, e.g.,
+	// {"price": "{{.currency}} {{.amount}}"}.
+	Templates map[string]string `json:"templates,omitempty"`
+
+	// Defaults are the default cells of missing fields, see Service.Defaults,
+	// e.g., {"currency": "USD"}.
+	Defaults map[string]string `json:"defaults,omitempty"`
+
+	// Normalize and NormalizeColumns clean up string fields, see
+	// Service.Normalize, e.g., {"email": {"trim": true, "lower": true}}.
+	Normalize        Normalization            `json:"normalize,omitempty"`
+	NormalizeColumns map[string]Normalization `json:"normalize_columns,omitempty"`
+
+	// NumberLocale formats the numeric columns of Rules, see
+	// Service.NumberLocale, e.g., {"decimal_comma": true, "grouping": true}.
+	NumberLocale NumberLocale `json:"number_locale,omitempty"`
+
+	// BlobColumns are moved to content-addressed sidecar files, see
+	// Service.BlobColumns, e.g., ["response"].
+	BlobColumns []string `json:"blob_columns,omitempty"`
+
+	// Compaction drops rows older than a TTL, see Service.Compaction, e.g.,
+	// {"time_column": "created_at", "ttl": "720h"}.
+	Compaction *CompactionConfig `json:"compaction,omitempty"`
+
+	// MaxTotalBytes caps the disk space used by the files, and Quota decides
+	// what happens beyond it, see Service.MaxTotalBytes and Service.Quota,
+	// e.g., 10737418240 and "delete_oldest".
+	MaxTotalBytes int64       `json:"max_total_bytes,omitempty"`
+	Quota         QuotaPolicy `json:"quota,omitempty"`
+
+	// Sink, if set, streams the rows to standard output or error instead of
+	// the files, see StandardSink: "-" or "stderr". Apply swaps the sink
+	// when it changes, replacing Sinks, which go back to the files when it
+	// is removed; Sinks set in code are kept while it doesn't change.
+	Sink string `json:"sink,omitempty"`
+}
+
+// CompactionConfig is the representation of CompactOptions in Config, with
+// the TTL as a duration string such as "720h".
+type CompactionConfig struct {
+	TimeColumn string `json:"time_column"`
+	TTL        string `json:"ttl"`
+}
+
+// options returns the CompactOptions of c.
+func (c *CompactionConfig) options() (*CompactOptions, error) {
+	if c == nil {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compaction TTL %q: %w", c.TTL, err)
+	}
+	if c.TimeColumn == "" || ttl <= 0 {
+		return nil, errors.New("compaction needs a time column and a positive TTL")
+	}
+	return &CompactOptions{TimeColumn: c.TimeColumn, TTL: ttl}, nil
+}
+
+// LoadConfig reads and decodes the JSON configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// NewFromConfigFile creates a Service from the JSON configuration
+// file at path. The path is remembered so the service can be reloaded later.
+func NewFromConfigFile(path string) (*Service, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+	r.ConfigFile = path
+	return r, nil
+}
+
+// NewFromConfig creates a Service from cfg, checking its columns and filename
+// like NewChecked.
+func NewFromConfig(cfg *Config) (*Service, error) {
+	r, err := NewChecked(cfg.Dir, cfg.Filename, cfg.Column, cfg.RecordType)
+	if err != nil {
+		return nil, err
+	}
+	r.Headers = cfg.Headers
+	r.HeaderAliases = cfg.HeaderAliases
+	r.Environment = cfg.Environment
+	r.Rules = cfg.Rules
+	r.Templates = cfg.Templates
+	r.Defaults = cfg.Defaults
+	r.Normalize = cfg.Normalize
+	r.NormalizeColumns = cfg.NormalizeColumns
+	r.NumberLocale = cfg.NumberLocale
+	r.BlobColumns = cfg.BlobColumns
+	r.MaxTotalBytes = cfg.MaxTotalBytes
+	r.Quota = cfg.Quota
+	if r.Location, err = loadLocation(cfg.TimeZone); err != nil {
+		return nil, err
+	}
+	if r.Compaction, err = cfg.Compaction.options(); err != nil {
+		return nil, err
+	}
+	sink, err := StandardSink(cfg.Sink)
+	if err != nil {
+		return nil, err
+	}
+	if sink != nil {
+		r.Sinks = []Sink{sink}
+	}
+	r.configSink = cfg.Sink
+	return r, nil
+}
+
+// Apply replaces the service configuration with cfg. It waits for any write in
+// progress to finish, so no record is split across two configurations. An
+// invalid TimeZone, Compaction or Sink fails it, keeping the current
+// configuration; see UpdateConfig for checking the rest of cfg too.
+func (r *Service) Apply(cfg *Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.apply(cfg)
+}
+
+// apply replaces the service configuration with cfg. The caller must hold
+// r.mu.
+func (r *Service) apply(cfg *Config) error {
+	loc, err := loadLocation(cfg.TimeZone)
+	if err != nil {
+		return err
+	}
+	compaction, err := cfg.Compaction.options()
+	if err != nil {
+		return err
+	}
+	var sink Sink
+	if cfg.Sink != r.configSink {
+		if sink, err = StandardSink(cfg.Sink); err != nil {
+			return err
+		}
+	}
+
+	// Paths may change, so the service registers again on its next record
+	r.unregister()
+
+	r.Dir = cfg.Dir
+	r.Filename = cfg.Filename
+	r.Column = cfg.Column
+	r.Headers = cfg.Headers
+	r.HeaderAliases = cfg.HeaderAliases
+	r.Environment = cfg.Environment
+	r.Rules = cfg.Rules
+	r.Templates = cfg.Templates
+	r.Defaults = cfg.Defaults
+	r.Normalize = cfg.Normalize
+	r.NormalizeColumns = cfg.NormalizeColumns
+	r.NumberLocale = cfg.NumberLocale
+	r.BlobColumns = cfg.BlobColumns
+	r.RecordType = cfg.RecordType
+	r.MaxTotalBytes = cfg.MaxTotalBytes
+	r.Quota = cfg.Quota
+	r.Location = loc
+	r.Compaction = compaction
+	if cfg.Sink != r.configSink {
+		// Swapped under r.mu, between two writes
+		r.Sinks = nil
+		if sink != nil {
+			r.Sinks = []Sink{sink}
+		}
+		r.configSink = cfg.Sink
+	}
+	return nil
+}
+
+// loadLocation loads the time zone of Config.TimeZone, nil for the default.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// Reload re-reads ConfigFile and applies it to the running service with
+// UpdateConfig. The current configuration is kept if the file can't be loaded
+// or is invalid.
+func (r *Service) Reload() error {
+	if r.ConfigFile == "" {
+		return fmt.Errorf("cannot reload configuration: ConfigFile is not set")
+	}
+	cfg, err := LoadConfig(r.ConfigFile)
+	if err != nil {
+		return err
+	}
+	if err := r.UpdateConfig(cfg); err != nil {
+		return fmt.Errorf("config file %q: %w", r.ConfigFile, err)
+	}
+	return nil
+}
+
+// WatchConfig polls ConfigFile every interval and reloads the service when the
+// file's modification time or size changes. It blocks until ctx is done.
+// Reload failures are passed to onError, if given, and the previous
+// configuration stays active.
+func (r *Service) WatchConfig(ctx context.Context, interval time.Duration, onError func(error)) {
+	var lastMod time.Time
+	var lastSize int64
+	if stat, err := os.Stat(r.ConfigFile); err == nil {
+		lastMod, lastSize = stat.ModTime(), stat.Size()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stat, err := os.Stat(r.ConfigFile)
+		if err != nil {
+			if onError != nil {
+				onError(fmt.Errorf("failed to stat config file %q: %w", r.ConfigFile, err))
+			}
+			continue
+		}
+		if stat.ModTime().Equal(lastMod) && stat.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = stat.ModTime(), stat.Size()
+
+		if err := r.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestConfigRetention(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{
+		"dir": "files", "filename": "booking", "column": ["id", "at"], "record_type": "daily",
+		"compaction": {"time_column": "at", "ttl": "720h"},
+		"max_total_bytes": 1024, "quota": "delete_oldest"
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Dir = t.TempDir()
+	s, err := NewFromConfig(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := s.Compaction; c == nil || c.TimeColumn != "at" || c.TTL != 720*time.Hour {
+		t.Errorf("compaction = %+v", c)
+	}
+	if s.MaxTotalBytes != 1024 || s.Quota != QuotaDeleteOldest {
+		t.Errorf("quota = %d, %v", s.MaxTotalBytes, s.Quota)
+	}
+
+	cfg.Compaction.TTL = "a month"
+	if err := s.UpdateConfig(&cfg); err == nil {
+		t.Error("accepted an invalid TTL")
+	}
+	cfg.Compaction, cfg.MaxTotalBytes, cfg.Quota = nil, 0, QuotaReject
+	if err := s.UpdateConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s.Compaction != nil || s.MaxTotalBytes != 0 {
+		t.Errorf("retention kept after reload: %+v, %d", s.Compaction, s.MaxTotalBytes)
+	}
+}
+
+func TestApplySwapsSink(t *testing.T) {
+	cfg := &Config{Dir: t.TempDir(), Filename: "booking", Column: []string{"id"}, RecordType: "daily"}
+	s, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := pingSink{}
+	s.Sinks = []Sink{custom}
+	if err := s.Apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sinks) != 1 || s.Sinks[0] != Sink(custom) {
+		t.Errorf("sinks set in code replaced by an unchanged config: %v", s.Sinks)
+	}
+
+	cfg.Sink = SinkStderr
+	if err := s.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sinks) != 1 {
+		t.Fatalf("sinks = %v", s.Sinks)
+	}
+	if _, ok := s.Sinks[0].(*WriterSink); !ok {
+		t.Errorf("sink = %T, want *WriterSink", s.Sinks[0])
+	}
+
+	cfg.Sink = SinkFiles
+	if err := s.Apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sinks) != 0 {
+		t.Errorf("sinks = %v, want the files", s.Sinks)
+	}
+}
+
+func TestApplyRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{Dir: dir, Filename: "booking", Column: []string{"id"}, RecordType: "daily", TimeZone: "Asia/Jakarta"}
+	s, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []Config{
+		{Dir: t.TempDir(), Filename: "other", Column: []string{"id"}, RecordType: "daily", TimeZone: "Mars/Olympus"},
+		{Dir: t.TempDir(), Filename: "other", Column: []string{"id"}, RecordType: "daily", Sink: "carrier-pigeon"},
+	} {
+		if err := s.Apply(&bad); err == nil {
+			t.Errorf("Apply(%+v) succeeded", bad)
+		}
+	}
+	if s.Dir != dir || s.Filename != "booking" || s.Location.String() != "Asia/Jakarta" {
+		t.Errorf("configuration changed by a failed Apply: %q, %q, %v", s.Dir, s.Filename, s.Location)
+	}
+}
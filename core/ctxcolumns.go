@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ContextExtractor returns the value of a context column for the context of
+// a record, e.g., its trace or request ID, or "" if ctx has none.
+type ContextExtractor func(ctx context.Context) string
+
+// validateContextColumns checks that ContextColumns are columns of the
+// service with an extractor each.
+func (r *Service) validateContextColumns() error {
+	cols := make([]string, 0, len(r.ContextColumns))
+	for col := range r.ContextColumns {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	for _, col := range cols {
+		if r.ContextColumns[col] == nil {
+			return fmt.Errorf("context column %q has no extractor", col)
+		}
+		if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+			return fmt.Errorf("context column %q is not one of the columns", col)
+		}
+	}
+	return nil
+}
+
+// contextValues runs the extractors of ContextColumns on ctx and returns the
+// values found, or nil if there are none.
+func (r *Service) contextValues(ctx context.Context) map[string]string {
+	var values map[string]string
+	for col, extract := range r.ContextColumns {
+		if extract == nil {
+			continue
+		}
+		if v := extract(ctx); v != "" {
+			if values == nil {
+				values = make(map[string]string, len(r.ContextColumns))
+			}
+			values[col] = v
+		}
+	}
+	return values
+}
+
+// stampContext sets the context columns of fields to the values of the
+// record being written.
+func (r *Service) stampContext(fields map[string]interface{}) {
+	for col, v := range r.ctxValues {
+		fields[col] = v
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInvalidPayload is matched by *PayloadError with errors.Is, to tell bad
+// records, which fail again when retried, from I/O failures, which match
+// ErrWriteFailed.
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// PayloadError is returned by Record for a payload that can't be mapped onto
+// the columns, e.g., a marshal failure, a missing required column or a
+// rejected value. Err is the cause, e.g., a *MissingColumnsError.
+type PayloadError struct {
+	Err error
+
+	// DeadLetter is the file the payload was written to, see DeadLetter, or
+	// empty if it wasn't.
+	DeadLetter string
+}
+
+func (e *PayloadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PayloadError) Is(target error) bool {
+	return target == ErrInvalidPayload
+}
+
+// deadLetterRecord is a line of the dead-letter file.
+type deadLetterRecord struct {
+	Time    time.Time       `json:"time"`
+	Error   string          `json:"error"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Value holds the payload printed with %+v if it can't be encoded.
+	Value string `json:"value,omitempty"`
+}
+
+// DeadLetterPath returns the file that payloads failing at t are written to
+// by DeadLetter, e.g., "booking_record.deadletter_2025_08_26.jsonl".
+func (r *Service) DeadLetterPath(t time.Time) (string, error) {
+	suffix, err := r.Suffix(t)
+	if err != nil {
+		return "", err
+	}
+	return r.deadLetterPath(suffix), nil
+}
+
+func (r *Service) deadLetterPath(suffix string) string {
+	// Like the quarantine file, not name_..., so it isn't taken for a partition
+	return r.nameIn(r.Dir, r.baseName()+".deadletter", suffix) + ".jsonl"
+}
+
+// payloadError wraps the mapping failure of payload in a *PayloadError,
+// writing the payload to the dead-letter file of suffix with DeadLetter.
+// Failures to write it are logged, the payload error is returned either way.
+func (r *Service) payloadError(suffix string, payload interface{}, err error) error {
+	perr := &PayloadError{Err: err}
+	if !r.DeadLetter || r.DryRun {
+		return perr
+	}
+	path := r.deadLetterPath(suffix)
+	if werr := r.deadLetter(path, payload, err); werr != nil {
+		r.logError("failed to write dead letter", "path", path, "error", werr)
+		return perr
+	}
+	r.logWarn("dead-lettered record", "path", path, "error", err)
+	perr.DeadLetter = path
+	return perr
+}
+
+// deadLetter appends payload and the reason it failed to the file at path.
+func (r *Service) deadLetter(path string, payload interface{}, cause error) error {
+	rec := deadLetterRecord{Time: r.clock(), Error: cause.Error()}
+	if raw, err := json.Marshal(payload); err == nil {
+		rec.Payload = raw
+	} else {
+		rec.Value = fmt.Sprintf("%+v", payload)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if r.entry != nil {
+		r.entry.mu.Lock()
+		defer r.entry.mu.Unlock()
+	}
+	if err := r.mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := r.fs().OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, r.FileMode())
+	if err != nil {
+		return err
+	}
+	n, err := f.Write(append(line, '\n'))
+	r.usage += int64(n)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
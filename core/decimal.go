@@ -0,0 +1,43 @@
+package core
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalExp bounds the exponent of TypeDecimal values, so a value like
+// "1e999999999" can't make a cell of a billion digits.
+const maxDecimalExp = 1000
+
+// formatDecimal returns the decimal number raw, e.g., "19.90", "-0.5" or
+// "1.5e3", as a TypeDecimal cell: with scale decimals if scale is set, and
+// otherwise with the digits it was given, exponents written out. It reports
+// whether raw is a decimal number. The digits never go through a float, so
+// amounts don't pick up binary rounding errors such as 0.30000000000000004.
+func formatDecimal(raw string, scale int) (string, bool) {
+	raw = strings.Replace(raw, "E", "e", 1)
+	if !isNumberCell(raw) {
+		return "", false
+	}
+	mantissa, exp, hasExp := strings.Cut(raw, "e")
+	if scale == 0 && !hasExp {
+		return strings.TrimPrefix(raw, "+"), true
+	}
+	if hasExp {
+		e, err := strconv.Atoi(exp)
+		if err != nil || e < -maxDecimalExp || e > maxDecimalExp {
+			return "", false
+		}
+		if scale == 0 {
+			// Exactly as many decimals as the exponent leaves
+			_, frac, _ := strings.Cut(mantissa, ".")
+			scale = max(len(frac)-e, 0)
+		}
+	}
+	d, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return "", false
+	}
+	return d.FloatString(scale), true
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// CellUnmarshaler is implemented by types that parse their own cell, the
+// counterpart of CellMarshaler for Decode.
+type CellUnmarshaler interface {
+	UnmarshalCell(cell string) error
+}
+
+var (
+	cellUnmarshalerType = reflect.TypeFor[CellUnmarshaler]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// ErrDecodeTarget is returned by Decode, DecodeFields and DecodeAll for a
+// destination that isn't a non-nil pointer to a struct, or to a slice of
+// structs or struct pointers for DecodeAll.
+var ErrDecodeTarget = errors.New("invalid decode destination")
+
+// Decode sets the fields of the struct dest points to from row, a row of
+// cells in the order of Column, e.g., from reader.Reader. Fields are matched
+// to columns by their tags like payloads are mapped, see CSVTags, so a struct
+// that was recorded decodes back into the same type. Cells are parsed by
+// CellUnmarshaler, encoding.TextUnmarshaler, RFC 3339 for time.Time and
+// strconv for numbers and bools; nested values are read as JSON. Empty cells
+// leave nil pointers and zero values, and fields without a column are left
+// untouched.
+func (r *Service) Decode(row []string, dest any) error {
+	r.mu.Lock()
+	column, csvTags := r.Column, r.CSVTags
+	r.mu.Unlock()
+
+	fields := make(map[string]string, len(column))
+	for i, col := range column {
+		if i < len(row) {
+			fields[col] = row[i]
+		}
+	}
+	return decodeFields(fields, dest, csvTags)
+}
+
+// DecodeFields is like Decode for cells keyed by payload key, such as the
+// Fields of a RecordRow, matching the fields by their json tags.
+func DecodeFields(fields map[string]string, dest any) error {
+	return decodeFields(fields, dest, false)
+}
+
+func decodeFields(fields map[string]string, dest any, csvTags bool) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrDecodeTarget, dest)
+	}
+	return decodeStruct(fields, v.Elem(), csvTags)
+}
+
+// DecodeAll reads every row of the CSV file at path into the slice dest
+// points to, appending a struct, or a pointer to one, per row like Decode.
+// The file's header labels are mapped back to the columns through Headers,
+// and files are decrypted and decompressed like OpenFile does. A row that
+// fails to decode stops the read with an error giving its line.
+//
+//	var bookings []Booking
+//	err := service.DecodeAll(service.BatchPath(batch), &bookings)
+func (r *Service) DecodeAll(path string, dest any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: %T", ErrDecodeTarget, dest)
+	}
+	slice := v.Elem()
+	elem := slice.Type().Elem()
+	ptr := elem.Kind() == reflect.Pointer
+	if ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrDecodeTarget, dest)
+	}
+
+	r.mu.Lock()
+	keys := make(map[string]string, len(r.Headers))
+	for i, label := range r.Headers {
+		if i < len(r.Column) {
+			keys[label] = r.Column[i]
+		}
+	}
+	opts, csvTags := r.readOptions(), r.CSVTags
+	r.mu.Unlock()
+
+	var err error
+	line := 0
+	r.queryFile(path, nil, opts, func(row QueryRow, rerr error) bool {
+		if rerr != nil {
+			err = rerr
+			return false
+		}
+		line++
+		fields := make(map[string]string, len(row.Fields))
+		for label, cell := range row.Fields {
+			key, ok := keys[label]
+			if !ok {
+				key = label
+			}
+			fields[key] = cell
+		}
+		item := reflect.New(elem)
+		if derr := decodeStruct(fields, item.Elem(), csvTags); derr != nil {
+			err = fmt.Errorf("line %d of %q: %w", line, path, derr)
+			return false
+		}
+		if !ptr {
+			item = item.Elem()
+		}
+		slice = reflect.Append(slice, item)
+		return true
+	})
+	v.Elem().Set(slice)
+	return err
+}
+
+// decodeStruct sets the fields of the struct v from fields by the names of
+// typeFields.
+func decodeStruct(fields map[string]string, v reflect.Value, csvTags bool) error {
+	for _, f := range typeFields(v.Type(), csvTags) {
+		cell, ok := fields[f.name]
+		if !ok {
+			continue
+		}
+		if _, set := fieldByIndex(v, f.index); !set && cell == "" {
+			continue // Leave the embedded pointer nil, as JSON omitted it
+		}
+		if err := decodeCell(cell, settableField(v, f.index), f.quoted); err != nil {
+			return fmt.Errorf("failed to decode column %q: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// settableField is like reflect.Value.FieldByIndex but allocates nil embedded
+// pointers on the way.
+func settableField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// decodeCell parses cell into v, the reverse of fieldValue. quoted is set for
+// fields with the ",string" option.
+func decodeCell(cell string, v reflect.Value, quoted bool) error {
+	if v.Kind() == reflect.Pointer {
+		if cell == "" {
+			v.SetZero()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+	}
+	if u, ok := unmarshaler(v); ok {
+		switch u := u.(type) {
+		case CellUnmarshaler:
+			return u.UnmarshalCell(cell)
+		case encoding.TextUnmarshaler:
+			if cell == "" {
+				return nil
+			}
+			return u.UnmarshalText([]byte(cell))
+		}
+	}
+	if v.Kind() == reflect.Pointer {
+		return decodeCell(cell, v.Elem(), quoted)
+	}
+	if cell == "" {
+		v.SetZero()
+		return nil
+	}
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, cell)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if reflect.PointerTo(v.Type()).Implements(jsonUnmarshalerType) {
+		return decodeJSON(cell, v)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if quoted {
+			return json.Unmarshal([]byte(cell), v.Addr().Interface())
+		}
+		v.SetString(cell)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(cell, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(cell, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(cell, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return decodeJSON(cell, v) // Structs, maps, slices and arrays
+}
+
+// decodeJSON reads cell into v as JSON, or as a JSON string if it isn't
+// valid JSON, since string values were written unquoted.
+func decodeJSON(cell string, v reflect.Value) error {
+	err := json.Unmarshal([]byte(cell), v.Addr().Interface())
+	if err == nil {
+		return nil
+	}
+	quoted, _ := json.Marshal(cell)
+	if json.Unmarshal(quoted, v.Addr().Interface()) == nil {
+		return nil
+	}
+	return err
+}
+
+// unmarshaler returns the CellUnmarshaler or encoding.TextUnmarshaler of v,
+// or of its address, preferring CellUnmarshaler. Types that are also
+// json.Unmarshalers are read as JSON instead of text, like they were
+// written.
+func unmarshaler(v reflect.Value) (any, bool) {
+	for _, c := range []reflect.Value{v, v.Addr()} {
+		if c.Kind() != reflect.Pointer {
+			continue
+		}
+		if c.Type().Implements(cellUnmarshalerType) {
+			return c.Interface(), true
+		}
+	}
+	if v.Type() == timeType || v.Type() == reflect.PointerTo(timeType) {
+		return nil, false
+	}
+	for _, c := range []reflect.Value{v, v.Addr()} {
+		if c.Kind() != reflect.Pointer || c.Type().Implements(jsonUnmarshalerType) {
+			// Read as JSON, the way they were written
+			continue
+		}
+		if c.Type().Implements(textUnmarshalerType) {
+			return c.Interface(), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// DedupOptions configures skipping of records whose key was already written,
+// e.g., when an upstream retry delivers the same event twice.
+type DedupOptions struct {
+	// Column is the payload field holding the key, e.g., "id". It doesn't have
+	// to be one of the columns. Records without the key are never skipped.
+	Column string
+
+	// Window is how long a key is remembered. Zero remembers keys for the
+	// current file only, until the next rotation.
+	Window time.Duration
+
+	// StateFile, if set, persists the remembered keys as JSON, so duplicates
+	// are also caught across restarts. New keys are appended to it after
+	// every write, and it is compacted to the keys still remembered once it
+	// has grown to about twice their number, or when a new file starts.
+	// With FalsePositiveRate, it holds the Bloom filters instead, of a fixed
+	// size, and only their changed bytes are written.
+	StateFile string
+
+	// FalsePositiveRate, if positive, remembers the keys in Bloom filters
+	// instead of exactly, bounding the memory and StateFile used to about
+	// 2.4 bytes per key of MaxKeys at 1%, and 3.6 at 0.1%. In exchange, this
+	// fraction of distinct records is skipped as duplicates. Keys are
+	// remembered for at least Window, or for the current file without one,
+	// and at most twice as long.
+	FalsePositiveRate float64
+
+	// MaxKeys is the number of keys a Bloom filter is sized for. Once full, a
+	// new one is started and the keys before the previous one are forgotten.
+	// Defaults to 1,000,000.
+	MaxKeys int
+}
+
+// validate checks the Bloom filter options.
+func (o *DedupOptions) validate() error {
+	if o.FalsePositiveRate < 0 || o.FalsePositiveRate >= 1 {
+		return fmt.Errorf("dedup false positive rate %v is not between 0 and 1", o.FalsePositiveRate)
+	}
+	if o.MaxKeys < 0 {
+		return fmt.Errorf("negative dedup key bound %d", o.MaxKeys)
+	}
+	return nil
+}
+
+// dedupCompactMin is the number of keys appended to the dedup StateFile
+// before it is compacted, at the least.
+const dedupCompactMin = 1024
+
+// dedupState holds the remembered keys and when they were written. The
+// StateFile holds it as JSON, followed by a dedupKey line for every key
+// remembered since.
+type dedupState struct {
+	Period string               `json:"period"` // rotation suffix the keys belong to
+	Keys   map[string]time.Time `json:"keys"`
+
+	order    []dedupKey // Keys by time written, with forgotten ones, for Window
+	appended int        // keys appended to the StateFile since it was compacted
+	stale    bool       // the StateFile must be compacted before appending to it
+}
+
+// dedupKey is a key remembered at T.
+type dedupKey struct {
+	Key string    `json:"key"`
+	T   time.Time `json:"t"`
+}
+
+// reset forgets all keys and starts period.
+func (s *dedupState) reset(period string) {
+	s.Period, s.Keys, s.order, s.stale = period, map[string]time.Time{}, nil, true
+}
+
+// add remembers key as written at t.
+func (s *dedupState) add(key string, t time.Time) {
+	s.Keys[key] = t
+	s.order = append(s.order, dedupKey{key, t})
+}
+
+// expire forgets the keys written window or longer before t, oldest first,
+// so it only visits the expired ones.
+func (s *dedupState) expire(t time.Time, window time.Duration) {
+	n := 0
+	for ; n < len(s.order) && t.Sub(s.order[n].T) >= window; n++ {
+		k := s.order[n]
+		if written, ok := s.Keys[k.Key]; ok && written.Equal(k.T) {
+			delete(s.Keys, k.Key)
+		}
+	}
+	if n > 0 {
+		s.order = slices.Delete(s.order, 0, n)
+	}
+}
+
+// dedup drops the rows whose key was already written, including repeats
+// within mapped, and returns the kept rows with their keys. The keys are only
+// remembered once the rows were written, see remember. The rows of a Tx are
+// only dropped for keys written before it, see txKeys.
+func (r *Service) dedup(t time.Time, suffix string, mapped []mappedRow) ([]mappedRow, []string, error) {
+	if r.Dedup == nil {
+		return mapped, nil, nil
+	}
+	if err := r.loadDedup(); err != nil {
+		return nil, nil, err
+	}
+
+	var seen func(key string) bool
+	if r.bloom != nil {
+		if !r.bloom.advance(r.Dedup, t, suffix) {
+			return mapped, nil, nil
+		}
+		seen = r.bloom.has
+	} else {
+		state := r.seen
+		if r.Dedup.Window <= 0 && suffix < state.Period {
+			return mapped, nil, nil // An earlier period, e.g., backfilled by AppendFrom
+		}
+		if r.Dedup.Window <= 0 && state.Period != suffix {
+			state.reset(suffix)
+		}
+		if r.Dedup.Window > 0 {
+			state.expire(t, r.Dedup.Window)
+		}
+		seen = func(key string) bool {
+			_, ok := state.Keys[key]
+			return ok
+		}
+	}
+
+	kept := mapped[:0:0]
+	var keys []string
+	batch := map[string]bool{}
+	for _, m := range mapped {
+		val, ok := m.fields[r.Dedup.Column]
+		if !ok || val == nil {
+			kept = append(kept, m)
+			continue
+		}
+		// Partitions are separate files, so a key is only unique within one
+		key := r.partitionOf(m) + "\x00" + formatValue(val)
+		if r.inTx {
+			if seen(key) && !r.txKeys[key] {
+				r.logDebug("skipped duplicate transaction row", "key", formatValue(val))
+				continue
+			}
+			if r.txKeys == nil {
+				r.txKeys = map[string]bool{}
+			}
+			r.txKeys[key] = true
+		} else if seen(key) || batch[key] {
+			r.logDebug("skipped duplicate record", "key", formatValue(val))
+			continue
+		}
+		kept = append(kept, m)
+		if !batch[key] {
+			batch[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return kept, keys, nil
+}
+
+// remember marks keys as written at t and persists them if configured.
+func (r *Service) remember(t time.Time, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if r.bloom != nil {
+		for _, key := range keys {
+			r.bloom.add(key)
+		}
+		return r.saveBloom()
+	}
+	for _, key := range keys {
+		r.seen.add(key, t)
+	}
+	if r.Dedup.StateFile == "" {
+		return nil
+	}
+	if r.seen.stale || r.seen.appended+len(keys) >= max(dedupCompactMin, len(r.seen.Keys)) {
+		return r.compactDedup()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, key := range keys {
+		if err := enc.Encode(dedupKey{key, t}); err != nil {
+			return fmt.Errorf("failed to encode dedup state: %w", err)
+		}
+	}
+	f, err := r.fs().OpenFile(r.Dedup.StateFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, r.FileMode())
+	if err != nil {
+		return fmt.Errorf("failed to save dedup state: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save dedup state: %w", err)
+	}
+	r.seen.appended += len(keys)
+	return nil
+}
+
+// compactDedup replaces the StateFile with the keys still remembered.
+func (r *Service) compactDedup() error {
+	data, err := json.Marshal(r.seen)
+	if err != nil {
+		return fmt.Errorf("failed to encode dedup state: %w", err)
+	}
+	if err := replaceFile(r.fs(), r.Dedup.StateFile, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save dedup state: %w", err)
+	}
+	r.seen.appended, r.seen.stale = 0, false
+	return nil
+}
+
+// loadDedup reads the persisted keys on first use.
+func (r *Service) loadDedup() error {
+	if r.seen != nil || r.bloom != nil {
+		return nil
+	}
+	if r.Dedup.FalsePositiveRate > 0 {
+		return r.loadBloom()
+	}
+	state := &dedupState{Keys: map[string]time.Time{}}
+	if r.Dedup.StateFile == "" {
+		r.seen = state
+		return nil
+	}
+	data, err := readFile(r.fs(), r.Dedup.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		state.stale = true // Start it with the state, not a key
+		r.seen = state
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dedup state %q: %w", r.Dedup.StateFile, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(state); err != nil {
+		return fmt.Errorf("failed to parse dedup state %q: %w", r.Dedup.StateFile, err)
+	}
+	if state.Keys == nil {
+		state.Keys = map[string]time.Time{}
+	}
+	for key, t := range state.Keys {
+		state.order = append(state.order, dedupKey{key, t})
+	}
+	slices.SortFunc(state.order, func(a, b dedupKey) int { return a.T.Compare(b.T) })
+	for {
+		var k dedupKey
+		err := dec.Decode(&k)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A crash cut the last append short; its keys are lost
+			r.logWarn("dropped torn dedup state entry", "path", r.Dedup.StateFile, "error", err)
+			state.stale = true
+			break
+		}
+		state.add(k.Key, k.T)
+		state.appended++
+	}
+	r.seen = state
+	return nil
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDedupWindowAcrossRestart(t *testing.T) {
+	now := time.Date(2025, 8, 26, 10, 0, 0, 0, time.UTC)
+	s := clocked(t, &now)
+	state := filepath.Join(t.TempDir(), "dedup.json")
+	s.Dedup = &DedupOptions{Column: "id", Window: time.Hour, StateFile: state}
+	recordID(t, s, "1")
+	recordID(t, s, "2")
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The snapshot of the first write, and the key of the second appended
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Errorf("state file has %d lines, want 2:\n%s", lines, data)
+	}
+
+	restarted := clocked(t, &now)
+	restarted.Dir = s.Dir
+	restarted.Dedup = &DedupOptions{Column: "id", Window: time.Hour, StateFile: state}
+	now = now.Add(30 * time.Minute)
+	recordID(t, restarted, "1")
+	recordID(t, restarted, "2")
+	recordID(t, restarted, "3")
+	now = now.Add(45 * time.Minute)
+	recordID(t, restarted, "1") // Expired
+	recordID(t, restarted, "3")
+
+	if got := fileRows(t, restarted)["2025_08_26"]; !slices.Equal(got, []string{"1", "2", "3", "1"}) {
+		t.Errorf("rows = %v", got)
+	}
+}
+
+func TestDedupStateCompacts(t *testing.T) {
+	now := time.Date(2025, 8, 26, 10, 0, 0, 0, time.UTC)
+	s := clocked(t, &now)
+	state := filepath.Join(t.TempDir(), "dedup.json")
+	s.Dedup = &DedupOptions{Column: "id", Window: time.Minute, StateFile: state}
+	for i := range 3 * dedupCompactMin {
+		now = now.Add(time.Second)
+		recordID(t, s, strconv.Itoa(i))
+	}
+	if n := len(s.seen.Keys); n != 60 {
+		t.Errorf("remembered %d keys, want 60", n)
+	}
+	if n := len(s.seen.order); n != 60 {
+		t.Errorf("kept %d keys in order, want 60", n)
+	}
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > dedupCompactMin+1 {
+		t.Errorf("state file has %d lines, want it compacted", lines)
+	}
+}
+
+func TestDedupTornState(t *testing.T) {
+	now := time.Date(2025, 8, 26, 10, 0, 0, 0, time.UTC)
+	state := filepath.Join(t.TempDir(), "dedup.json")
+	// A state file of an earlier version, then an append cut short
+	data := `{"period":"2025_08_26","keys":{"\u00001":"2025-08-26T09:00:00Z"}}` + "\n" +
+		`{"key":"\u00002","t":"2025-08-26T09:30:00Z"}` + "\n" +
+		`{"key":"\u00003","t":"2025-08`
+	if err := os.WriteFile(state, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := clocked(t, &now)
+	s.Dedup = &DedupOptions{Column: "id", StateFile: state}
+	for _, id := range []string{"1", "2", "3", "4"} {
+		recordID(t, s, id)
+	}
+	if got := fileRows(t, s)["2025_08_26"]; !slices.Equal(got, []string{"3", "4"}) {
+		t.Errorf("rows = %v", got)
+	}
+
+	restarted := clocked(t, &now)
+	restarted.Dir = s.Dir
+	restarted.Dedup = &DedupOptions{Column: "id", StateFile: state}
+	recordID(t, restarted, "4")
+	if got := fileRows(t, restarted)["2025_08_26"]; !slices.Equal(got, []string{"3", "4"}) {
+		t.Errorf("rows after restart = %v", got)
+	}
+}
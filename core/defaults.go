@@ -0,0 +1,25 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+)
+
+// applyDefaults fills the missing and null fields that have one of Defaults.
+func (r *Service) applyDefaults(fields map[string]interface{}) {
+	for key, val := range r.Defaults {
+		if fields[key] == nil {
+			fields[key] = val
+		}
+	}
+}
+
+// validateDefaults checks that Defaults are for columns of the service.
+func (r *Service) validateDefaults() error {
+	for key := range r.Defaults {
+		if !slices.Contains(r.Column, key) && !r.DiscoverColumns {
+			return fmt.Errorf("default for column %q, which is not one of the columns", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DerivedColumn computes the value of Column from the other fields of each
+// payload, e.g., a duration from two timestamps. The result is written like a
+// payload field of the same value; nil leaves the cell empty and an error
+// fails the record.
+type DerivedColumn struct {
+	Column string
+	Func   func(f Fields) (interface{}, error)
+}
+
+// Fields are the values of one payload by key, as passed to a DerivedColumn:
+// strings, json.Number for numbers, bools, nil, and maps and slices for
+// nested values. Derived columns computed earlier are included.
+type Fields map[string]interface{}
+
+// String returns the field as it would be written to its cell, or "" if it
+// is missing.
+func (f Fields) String(key string) string {
+	return formatValue(f[key])
+}
+
+// Float returns the field as a number, parsing numeric strings, or false if
+// it is missing or not a number.
+func (f Fields) Float(key string) (float64, bool) {
+	switch v := f[key].(type) {
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Time returns the field as a time, from RFC 3339 (the encoding of time.Time
+// values) or Unix seconds, or false if it is missing or not a time.
+func (f Fields) Time(key string) (time.Time, bool) {
+	if t, ok := f[key].(time.Time); ok {
+		return t, true
+	}
+	return parseTimestamp(f.String(key))
+}
+
+// derive adds the Derive columns to fields, in order.
+func (r *Service) derive(fields map[string]interface{}) error {
+	for _, d := range r.Derive {
+		val, err := d.Func(Fields(fields))
+		if err != nil {
+			return fmt.Errorf("failed to derive column %q: %w", d.Column, err)
+		}
+		if val, err = fieldOf(val); err != nil {
+			return fmt.Errorf("failed to derive column %q: %w", d.Column, err)
+		}
+		fields[d.Column] = val
+	}
+	return nil
+}
+
+// fieldOf converts a value to what it would be as a payload field, through
+// JSON or its CellMarshaler, so it is written the same way.
+func fieldOf(val interface{}) (interface{}, error) {
+	switch val.(type) {
+	case nil, string, bool, json.Number:
+		return val, nil
+	}
+	if s, ok, err := marshalCell(reflect.ValueOf(val)); ok || err != nil {
+		return s, err
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var field interface{}
+	if err := dec.Decode(&field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"reflect"
+	"slices"
+)
+
+// PayloadReport describes what recording a payload would produce, see
+// ValidatePayload.
+type PayloadReport struct {
+	// Rows are the cells that would be written, one entry per row.
+	Rows [][]string
+
+	// Empty lists columns that would be written as empty cells in at least one
+	// row, because the field is missing, null or an empty string.
+	Empty []string
+
+	// Malformed lists columns holding nested objects or arrays, which are
+	// written as JSON text rather than a plain cell value.
+	Malformed []string
+
+	// Truncated lists columns whose value would be shortened to fit the
+	// configured cell limits.
+	Truncated []string
+
+	// Invalid lists columns with a value that breaks its rule, see Rules.
+	Invalid []string
+
+	// Spilled lists columns whose value would be moved to a sidecar file, see
+	// OversizeSpill.
+	Spilled []string
+}
+
+// ValidatePayload runs the full mapping pipeline on the payload without
+// touching disk and reports the resulting rows and any suspicious columns.
+// The returned error is the one Record would fail with, e.g., a
+// *MissingColumnsError in Strict mode.
+//
+// It is meant for CI tests and for onboarding new payload types.
+func (r *Service) ValidatePayload(payload interface{}) (*PayloadReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &PayloadReport{}
+	items, _ := splitPayload(payload)
+	for _, item := range items {
+		fields, err := r.fields(item)
+		if err != nil {
+			return report, err
+		}
+		if _, _, changed, err := r.cells(r.Column, fields); err == nil {
+			for _, i := range changed {
+				if r.Oversize == OversizeSpill {
+					report.Spilled = appendOnce(report.Spilled, r.Column[i])
+				} else {
+					report.Truncated = appendOnce(report.Truncated, r.Column[i])
+				}
+			}
+		}
+		for _, col := range r.Column {
+			switch val := fields[col]; {
+			case val == nil || val == "":
+				report.Empty = appendOnce(report.Empty, col)
+			case isNested(val):
+				report.Malformed = appendOnce(report.Malformed, col)
+			}
+			if _, truncated := r.limitCell(r.escapeNewlines(formatValue(fields[col]))); truncated {
+				report.Truncated = appendOnce(report.Truncated, col)
+			}
+			if rule, ok := r.Rules[col]; ok {
+				if _, invalid := checkRule(col, rule, fields[col]); invalid != nil {
+					report.Invalid = appendOnce(report.Invalid, col)
+				}
+			}
+		}
+	}
+
+	records, err := r.rows(r.Column, payload)
+	report.Rows = records
+	return report, err
+}
+
+// isNested reports whether a decoded field value is an object or an array.
+func isNested(val interface{}) bool {
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+func appendOnce(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+)
+
+// BenchmarkRecord compares steady appends with encoders taken from the pool
+// and with a new encoder for every batch.
+func BenchmarkRecord(b *testing.B) {
+	for _, pooled := range []bool{true, false} {
+		name := "unpooled"
+		if pooled {
+			name = "pooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			if !pooled {
+				defer func(old int) { maxPooledBuffer = old }(maxPooledBuffer)
+				maxPooledBuffer = -1 // Nothing goes back to the pool
+			}
+			s := New(b.TempDir(), "bench", []string{"id", "status", "amount", "note"}, "daily")
+			defer s.Close()
+			rows := make([]map[string]interface{}, 16)
+			for i := range rows {
+				rows[i] = map[string]interface{}{"id": strconv.Itoa(i), "status": "ok", "amount": 12.5, "note": "a, \"quoted\" note"}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if err := s.Record(rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
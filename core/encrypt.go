@@ -0,0 +1,355 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// encryptedMagic starts every encrypted file. It is followed by frames of
+// [4-byte big-endian length][1-byte kind][12-byte nonce][AES-GCM ciphertext]
+// and ends with a final frame, which appends replace, so files can keep
+// growing without re-encrypting earlier rows. The length counts the bytes
+// after it. Data frames are authenticated with their index in the file and
+// the final frame holds the number of data frames, so frames can't be
+// dropped, reordered or repeated unnoticed.
+var encryptedMagic = []byte("RCSVENC2")
+
+// encryptedMagicV1 starts the encrypted files of earlier versions, whose
+// frames are [4-byte length][12-byte nonce][ciphertext] without index or
+// final frame. They are still read and appended to.
+var encryptedMagicV1 = []byte("RCSVENC1")
+
+// Frame kinds
+const (
+	frameData  byte = 0
+	frameFinal byte = 1
+)
+
+const (
+	// frameChunk is the most plaintext sealed in one frame; larger writes are
+	// split into several frames.
+	frameChunk = 1 << 20
+
+	// frameOverhead is the size of the kind, nonce and tag of a frame.
+	frameOverhead = 1 + 12 + 16
+
+	// maxFrameSize bounds the length read from a frame header, so a corrupt
+	// one can't make the reader allocate gigabytes.
+	maxFrameSize = frameChunk + frameOverhead
+
+	// finalSize is the size of the final frame, including its length.
+	finalSize = 4 + frameOverhead + 8
+)
+
+// ErrNotEncrypted is returned by NewDecryptReader for a file that doesn't start
+// with the encrypted file header.
+var ErrNotEncrypted = errors.New("file is not encrypted by recordtocsv")
+
+// ErrEncryptedTruncated is returned when reading an encrypted file that ends
+// without its final frame, e.g., because trailing frames were cut off or an
+// append was interrupted.
+var ErrEncryptedTruncated = errors.New("encrypted file is truncated")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// frameAAD returns the additional data a frame is authenticated with: the
+// format, the kind and, for data frames, the index.
+func frameAAD(kind byte, index uint64) []byte {
+	aad := make([]byte, 0, len(encryptedMagic)+9)
+	aad = append(aad, encryptedMagic...)
+	aad = append(aad, kind)
+	if kind == frameData {
+		aad = binary.BigEndian.AppendUint64(aad, index)
+	}
+	return aad
+}
+
+// sealFrames encrypts plaintext into data frames numbered from index, split
+// every frameChunk bytes, followed by the final frame, and by the file header
+// if index is 0, i.e., for a new file. Appends write the result over the
+// final frame of the file, see sealedEnd.
+func sealFrames(key, plaintext []byte, index uint64) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if index == 0 {
+		out.Write(encryptedMagic)
+	}
+	seal := func(kind byte, plain []byte) error {
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		sealed := gcm.Seal(nil, nonce, plain, frameAAD(kind, index))
+		binary.Write(&out, binary.BigEndian, uint32(1+len(nonce)+len(sealed)))
+		out.WriteByte(kind)
+		out.Write(nonce)
+		out.Write(sealed)
+		return nil
+	}
+	for len(plaintext) > 0 {
+		chunk := plaintext[:min(len(plaintext), frameChunk)]
+		plaintext = plaintext[len(chunk):]
+		if err := seal(frameData, chunk); err != nil {
+			return nil, err
+		}
+		index++
+	}
+	if err := seal(frameFinal, binary.BigEndian.AppendUint64(nil, index)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// sealFrameV1 encrypts plaintext into one frame of the format of earlier
+// versions, for appends to their files.
+func sealFrameV1(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	sealed := gcm.Seal(nil, nonce, plaintext, nil)
+	binary.Write(&out, binary.BigEndian, uint32(len(nonce)+len(sealed)))
+	out.Write(nonce)
+	out.Write(sealed)
+	return out.Bytes(), nil
+}
+
+// sealAppend encrypts plaintext for an append to the encrypted file f of the
+// given size, and returns it with the offset to write it at: over the final
+// frame of the file, or at its end for a new file or one of an earlier
+// version.
+func sealAppend(key []byte, f io.ReaderAt, size int64, plaintext []byte) ([]byte, int64, error) {
+	if size == 0 {
+		data, err := sealFrames(key, plaintext, 0)
+		return data, 0, err
+	}
+	magic := make([]byte, len(encryptedMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, 0, fmt.Errorf("failed to read encrypted file header: %w", err)
+	}
+	if bytes.Equal(magic, encryptedMagicV1) {
+		data, err := sealFrameV1(key, plaintext)
+		return data, size, err
+	}
+	if !bytes.Equal(magic, encryptedMagic) {
+		return nil, 0, ErrNotEncrypted
+	}
+	index, err := sealedEnd(key, f, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := sealFrames(key, plaintext, index)
+	return data, size - finalSize, err
+}
+
+// sealedEnd reads the final frame of the encrypted file f of the given size
+// and returns the index of the next data frame.
+func sealedEnd(key []byte, f io.ReaderAt, size int64) (uint64, error) {
+	if size < int64(len(encryptedMagic))+finalSize {
+		return 0, ErrEncryptedTruncated
+	}
+	frame := make([]byte, finalSize)
+	if _, err := f.ReadAt(frame, size-finalSize); err != nil {
+		return 0, fmt.Errorf("failed to read final frame: %w", err)
+	}
+	if binary.BigEndian.Uint32(frame) != finalSize-4 || frame[4] != frameFinal {
+		return 0, ErrEncryptedTruncated
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return 0, err
+	}
+	nonce := frame[5 : 5+gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, frame[5+gcm.NonceSize():], frameAAD(frameFinal, 0))
+	if err != nil || len(plain) != 8 {
+		return 0, fmt.Errorf("%w: final frame doesn't authenticate", ErrEncryptedTruncated)
+	}
+	return binary.BigEndian.Uint64(plain), nil
+}
+
+// decryptReader yields the plaintext of an encrypted file frame by frame.
+type decryptReader struct {
+	r     *bufio.Reader
+	gcm   cipher.AEAD
+	v1    bool   // file of an earlier version, without index or final frame
+	index uint64 // of the next data frame
+	buf   []byte // decrypted data not yet returned
+	done  bool
+}
+
+// NewDecryptReader returns a reader of the plaintext of a file written with
+// Service.EncryptionKey. Tampered frames fail with an error, as do frames that
+// were dropped, reordered or repeated, and a file cut off before its final
+// frame fails with ErrEncryptedTruncated. Files of earlier versions are read
+// without these checks.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, ErrNotEncrypted
+	}
+	switch {
+	case bytes.Equal(magic, encryptedMagic):
+		return &decryptReader{r: br, gcm: gcm}, nil
+	case bytes.Equal(magic, encryptedMagicV1):
+		return &decryptReader{r: br, gcm: gcm, v1: true}, nil
+	}
+	return nil, ErrNotEncrypted
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next decrypts the following frame into d.buf.
+func (d *decryptReader) next() error {
+	var size uint32
+	if err := binary.Read(d.r, binary.BigEndian, &size); err != nil {
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("truncated encrypted frame: %w", err)
+		}
+		if !d.v1 {
+			return ErrEncryptedTruncated
+		}
+		d.done = true
+		return nil
+	}
+	if d.v1 {
+		return d.nextV1(size)
+	}
+	if size > maxFrameSize || size < frameOverhead {
+		return fmt.Errorf("malformed encrypted frame %d: length %d", d.index, size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(d.r, frame); err != nil {
+		return fmt.Errorf("%w: frame %d is cut off", ErrEncryptedTruncated, d.index)
+	}
+	kind, nonce, sealed := frame[0], frame[1:1+d.gcm.NonceSize()], frame[1+d.gcm.NonceSize():]
+	if kind != frameData && kind != frameFinal {
+		return fmt.Errorf("malformed encrypted frame %d: unknown kind %d", d.index, kind)
+	}
+	plain, err := d.gcm.Open(nil, nonce, sealed, frameAAD(kind, d.index))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt frame %d: %w", d.index, err)
+	}
+	if kind == frameData {
+		d.buf = plain
+		d.index++
+		return nil
+	}
+
+	if len(plain) != 8 || binary.BigEndian.Uint64(plain) != d.index {
+		return fmt.Errorf("final frame doesn't match the %d frames before it", d.index)
+	}
+	if _, err := d.r.ReadByte(); !errors.Is(err, io.EOF) {
+		return errors.New("data after the final encrypted frame")
+	}
+	d.done = true
+	return nil
+}
+
+// nextV1 decrypts the following frame of a file of an earlier version, of
+// the given size. The frame is read as it arrives rather than allocated up
+// front, so a corrupt size can't make the reader allocate gigabytes.
+func (d *decryptReader) nextV1(size uint32) error {
+	var frame bytes.Buffer
+	if n, err := frame.ReadFrom(io.LimitReader(d.r, int64(size))); err != nil || n < int64(size) {
+		return fmt.Errorf("truncated encrypted frame: %w", io.ErrUnexpectedEOF)
+	}
+	nonceSize := d.gcm.NonceSize()
+	if frame.Len() < nonceSize {
+		return errors.New("malformed encrypted frame")
+	}
+	data := frame.Bytes()
+	plain, err := d.gcm.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt frame: %w", err)
+	}
+	d.buf = plain
+	return nil
+}
+
+// OpenFile opens a CSV file written by the service for reading, transparently
+// decrypting it when EncryptionKey is set, decompressing it when Compression
+// is set and converting it back to UTF-8, without byte order mark, when
+// Encoding or WriteBOM are set.
+func (r *Service) OpenFile(path string) (io.ReadCloser, error) {
+	f, err := r.fs().Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	rd, release, err := r.plainReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	if rd == io.Reader(f) {
+		return f, nil
+	}
+	return readCloser{Reader: rd, Closer: f, release: release}, nil
+}
+
+// plainReader undoes the encryption, compression and encoding of the file
+// content read from raw. release frees the decompressor.
+func (r *Service) plainReader(raw io.Reader) (io.Reader, func(), error) {
+	rd := raw
+	if r.EncryptionKey != nil {
+		var err error
+		if rd, err = NewDecryptReader(raw, r.EncryptionKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+	}
+	rd, release, err := r.decompressReader(rd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.decodeReader(rd), release, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+	release func()
+}
+
+func (rc readCloser) Close() error {
+	if rc.release != nil {
+		rc.release()
+	}
+	return rc.Closer.Close()
+}
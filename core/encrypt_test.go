@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{7}, 32)
+
+// encryptedFile records three batches with an encrypted service and returns
+// the raw bytes of its file.
+func encryptedFile(t *testing.T) (string, []byte) {
+	t.Helper()
+	s := New(t.TempDir(), "booking", []string{"id", "status"}, "daily")
+	s.EncryptionKey = testKey
+	for _, id := range []string{"1", "2", "3"} {
+		if err := s.Record(map[string]interface{}{"id": id, "status": "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.csv"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0], data
+}
+
+func decrypt(data []byte) (string, error) {
+	rd, err := NewDecryptReader(bytes.NewReader(data), testKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := io.ReadAll(rd)
+	return string(plain), err
+}
+
+// frames splits an encrypted file into its frames, after the magic.
+func frames(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var out [][]byte
+	rest := data[len(encryptedMagic):]
+	for len(rest) > 0 {
+		size := int(binary.BigEndian.Uint32(rest))
+		out = append(out, rest[:4+size])
+		rest = rest[4+size:]
+	}
+	return out
+}
+
+func join(magic []byte, frames ...[]byte) []byte {
+	return append(bytes.Clone(magic), bytes.Join(frames, nil)...)
+}
+
+func TestEncryptedAppendsRoundTrip(t *testing.T) {
+	_, data := encryptedFile(t)
+	plain, err := decrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,status\n1,ok\n2,ok\n3,ok\n"; plain != want {
+		t.Errorf("plaintext = %q, want %q", plain, want)
+	}
+	// One frame per append, the first with the header, and the final frame,
+	// which every append replaced
+	if got := len(frames(t, data)); got != 4 {
+		t.Errorf("got %d frames, want 4", got)
+	}
+}
+
+func TestEncryptedTampering(t *testing.T) {
+	_, data := encryptedFile(t)
+	f := frames(t, data)
+	final := f[len(f)-1]
+
+	tests := map[string][]byte{
+		"missing final frame": join(encryptedMagic, f[:len(f)-1]...),
+		"dropped last row":    join(encryptedMagic, f[0], f[1], final),
+		"dropped middle row":  join(encryptedMagic, f[0], f[2], final),
+		"reordered rows":      join(encryptedMagic, f[0], f[2], f[1], final),
+		"repeated row":        join(encryptedMagic, f[0], f[1], f[1], f[2], final),
+		"data after final":    join(encryptedMagic, append(slices.Clone(f), f[1])...),
+		"cut mid-frame":       data[:len(data)-10],
+	}
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			if plain, err := decrypt(tampered); err == nil {
+				t.Errorf("decrypted %q without error", plain)
+			}
+		})
+	}
+
+	if _, err := decrypt(join(encryptedMagic, f[:len(f)-1]...)); !errors.Is(err, ErrEncryptedTruncated) {
+		t.Errorf("missing final frame: err = %v, want ErrEncryptedTruncated", err)
+	}
+}
+
+func TestEncryptedOversizedFrameLength(t *testing.T) {
+	data := append(bytes.Clone(encryptedMagic), 0xff, 0xff, 0xff, 0xff, frameData)
+	_, err := decrypt(data)
+	if err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("err = %v, want a malformed frame error", err)
+	}
+}
+
+func TestEncryptedAppendAfterTruncationFails(t *testing.T) {
+	path, data := encryptedFile(t)
+	if err := os.WriteFile(path, data[:len(data)-finalSize], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(filepath.Dir(path), "booking", []string{"id", "status"}, "daily")
+	s.EncryptionKey = testKey
+	if err := s.Record(map[string]interface{}{"id": "4", "status": "ok"}); err == nil {
+		t.Error("appended to a file without its final frame")
+	}
+}
+
+func TestEncryptedVersion1FilesStillRead(t *testing.T) {
+	first, err := sealFrameV1(testKey, []byte("id\n1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := sealFrameV1(testKey, []byte("2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := decrypt(join(encryptedMagicV1, first, second))
+	if err != nil || plain != "id\n1\n2\n" {
+		t.Errorf("plaintext = %q, %v", plain, err)
+	}
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// EnrichPolicy decides what a failed Enricher lookup does to the record.
+type EnrichPolicy int
+
+const (
+	// EnrichReject fails the record. This is the default.
+	EnrichReject EnrichPolicy = iota
+
+	// EnrichFallback writes the record with the Fallback values of the
+	// enricher's columns the payload lacks, and logs the failure.
+	EnrichFallback
+)
+
+func (p EnrichPolicy) String() string {
+	switch p {
+	case EnrichReject:
+		return "reject"
+	case EnrichFallback:
+		return "fallback"
+	}
+	return "unknown"
+}
+
+// ErrEnrichTimeout is returned for an Enricher lookup that took longer than
+// its Timeout.
+var ErrEnrichTimeout = errors.New("enrichment timed out")
+
+// Enricher resolves columns of each payload from an external source, e.g.,
+// the country of a user_id from a cache or a user service, so the rows are
+// written denormalized:
+//
+//	service.Enrichers = []core.Enricher{{
+//		Columns: []string{"country"},
+//		Func: func(ctx context.Context, f core.Fields) (map[string]interface{}, error) {
+//			country, err := users.Country(ctx, f.String("user_id"))
+//			return map[string]interface{}{"country": country}, err
+//		},
+//		Timeout:   50 * time.Millisecond,
+//		OnFailure: core.EnrichFallback,
+//		Fallback:  map[string]string{"country": "unknown"},
+//	}}
+//
+// Lookups run while the record is written, with the service locked, so a
+// slow source delays every record; bound it with Timeout and keep a cache in
+// Func. With RecordAsync they run on the queue's goroutine, not the caller's.
+type Enricher struct {
+	// Columns lists the columns Func resolves. Each must be one of the
+	// service's columns.
+	Columns []string
+
+	// Func returns the values of Columns for the fields of a payload, by
+	// column. Columns it leaves out keep the payload's value. ctx is the
+	// record's, see RecordContext, and is canceled after Timeout. Func must
+	// not change f or record with the service.
+	Func func(ctx context.Context, f Fields) (map[string]interface{}, error)
+
+	// Timeout bounds each lookup. Zero means no timeout. A lookup that
+	// doesn't return in time fails with ErrEnrichTimeout and is left
+	// running.
+	Timeout time.Duration
+
+	// OnFailure decides what a failed lookup does. Defaults to EnrichReject.
+	OnFailure EnrichPolicy
+
+	// Fallback holds the cells of Columns written by EnrichFallback, keyed
+	// by column. Columns without one are left empty.
+	Fallback map[string]string
+}
+
+// validateEnrichers checks that Enrichers have a Func and resolve columns of
+// the service.
+func (r *Service) validateEnrichers() error {
+	for i, e := range r.Enrichers {
+		if e.Func == nil {
+			return fmt.Errorf("enricher %d has no Func", i)
+		}
+		if len(e.Columns) == 0 {
+			return fmt.Errorf("enricher %d has no columns", i)
+		}
+		for _, col := range e.Columns {
+			if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+				return fmt.Errorf("enricher %d column %q is not one of the columns", i, col)
+			}
+		}
+		for col := range e.Fallback {
+			if !slices.Contains(e.Columns, col) {
+				return fmt.Errorf("enricher %d has a fallback for column %q, which it doesn't resolve", i, col)
+			}
+		}
+	}
+	return nil
+}
+
+// enrich adds the columns of Enrichers to fields, in order.
+func (r *Service) enrich(fields map[string]interface{}) error {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, e := range r.Enrichers {
+		values, err := e.lookup(ctx, fields)
+		if err == nil {
+			for col, val := range values {
+				if val, err = fieldOf(val); err != nil {
+					break
+				}
+				fields[col] = val
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if e.OnFailure != EnrichFallback {
+			return fmt.Errorf("failed to enrich columns %v: %w", e.Columns, err)
+		}
+		r.logWarn("failed to enrich record, using fallback", "columns", e.Columns, "error", err)
+		for _, col := range e.Columns {
+			if val, ok := fields[col]; ok && val != nil {
+				continue
+			}
+			if cell, ok := e.Fallback[col]; ok {
+				fields[col] = cell
+			} else {
+				fields[col] = nil
+			}
+		}
+	}
+	return nil
+}
+
+// lookup calls Func within Timeout.
+func (e Enricher) lookup(ctx context.Context, fields map[string]interface{}) (map[string]interface{}, error) {
+	if e.Timeout <= 0 {
+		return e.Func(ctx, Fields(fields))
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	type result struct {
+		values map[string]interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	f := Fields(maps.Clone(fields)) // fields keeps changing if Func overruns
+	go func() {
+		values, err := e.Func(ctx, f)
+		done <- result{values, err}
+	}()
+	select {
+	case res := <-done:
+		return res.values, res.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrEnrichTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
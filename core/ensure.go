@@ -0,0 +1,96 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// EnsureFile creates the file of the rotation period of t, in the zone of Now,
+// with only its header, and those of Projections, unless they already exist,
+// so consumers expecting a file at the start of every period find one on days
+// without records. With TrackDelivery, the file is added to the manifest at
+// StageCreated. It returns the path of the file.
+//
+// EnsureFile is a first write for WriteMode: files are truncated by
+// WriteTruncate, and WriteExclusive fails for existing ones. It only applies
+// to the unpartitioned file, and writes nothing with DryRun.
+func (r *Service) EnsureFile(t time.Time) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return "", ErrClosed
+	}
+	if err := r.register(); err != nil {
+		return "", err
+	}
+	if err := r.loadColumns(); err != nil {
+		return "", err
+	}
+	header := r.HeaderRow()
+	if len(header) == 0 {
+		return "", errors.New("no columns to write the header of")
+	}
+	now, err := r.Now()
+	if err != nil {
+		return "", err
+	}
+	suffix, err := r.Suffix(t.In(now.Location()))
+	if err != nil {
+		return "", err
+	}
+	path := r.path(suffix, "")
+	if r.DryRun {
+		return path, nil
+	}
+
+	r.entry.mu.Lock()
+	defer r.entry.mu.Unlock()
+	if err := r.ensure(path, header); err != nil {
+		return path, err
+	}
+	for _, p := range r.Projections {
+		labels := make([]string, len(p.Columns))
+		for i, col := range p.Columns {
+			labels[i] = labelOf(r.Column, header, col)
+		}
+		if err := r.ensure(r.projectionPathIn(r.Dir, p.Name, suffix, ""), labels); err != nil {
+			return path, err
+		}
+	}
+	if r.SchemaFiles {
+		r.writeFileSchema(path)
+	}
+
+	if r.TrackDelivery {
+		m, err := r.manifest()
+		if err == nil {
+			err = m.update(filepath.Base(path), suffix, func(e *ManifestEntry) {
+				if _, ok := e.Stages[StageCreated]; !ok {
+					e.Stages[StageCreated] = r.clock()
+				}
+			})
+		}
+		if err != nil {
+			return path, fmt.Errorf("failed to update manifest: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// ensure creates the file at path with only the header, applying WriteMode.
+// The caller must hold the entry lock.
+func (r *Service) ensure(path string, header []string) error {
+	if err := r.mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := r.openMode(path); err != nil {
+		return fmt.Errorf("failed to create %q: %w", path, err)
+	}
+	if err := r.createFile(path, header); err != nil {
+		return fmt.Errorf("failed to create %q: %w", path, err)
+	}
+	return nil
+}
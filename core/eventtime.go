@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// eventTimes returns the EventTimeColumn timestamp of every mapped row of
+// payload.
+func (r *Service) eventTimes(payload interface{}, mapped []mappedRow, now time.Time) ([]time.Time, error) {
+	_, list := splitPayload(payload)
+	times := make([]time.Time, len(mapped))
+	for i, m := range mapped {
+		t, err := r.rowTime(m, r.EventTimeColumn, now)
+		if err != nil {
+			if list {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			return nil, err
+		}
+		times[i] = t
+	}
+	return times, nil
+}
+
+// writeByTime writes every mapped row to the files of the period of its
+// time. The batches of the current period are returned, to be observed; the
+// other periods' are only reported to Metrics, since a late or early row
+// doesn't rotate the current files. The caller must hold r.mu.
+func (r *Service) writeByTime(now time.Time, mapped []mappedRow, times []time.Time) ([]*Batch, error) {
+	current, err := r.Suffix(now)
+	if err != nil {
+		return nil, err
+	}
+	type period struct {
+		time time.Time
+		rows []mappedRow
+	}
+	periods := map[string]*period{}
+	var order []string
+	for i, m := range mapped {
+		suffix, err := r.Suffix(times[i])
+		if err != nil {
+			return nil, err
+		}
+		p, ok := periods[suffix]
+		if !ok {
+			p = &period{time: times[i]}
+			periods[suffix] = p
+			order = append(order, suffix)
+		}
+		p.rows = append(p.rows, m)
+	}
+
+	var observed []*Batch
+	for _, suffix := range order {
+		p := periods[suffix]
+		start := time.Now()
+		batches, err := r.writeMapped(p.time, suffix, p.rows)
+		if err != nil {
+			return observed, err
+		}
+		if suffix == current {
+			observed = batches
+		} else if r.Metrics != nil {
+			rows, bytes := 0, int64(0)
+			for _, b := range batches {
+				rows, bytes = rows+len(b.Rows), bytes+b.bytes
+			}
+			r.Metrics.ObserveWrite(rows, bytes, time.Since(start))
+		}
+	}
+	return observed, nil
+}
+
+// rowTime returns the timestamp in column of the row, in the time zone of
+// now, or now if column is empty. String timestamps are parsed with
+// EventTimeLayout, then as RFC 3339 or Unix seconds.
+func (r *Service) rowTime(m mappedRow, column string, now time.Time) (time.Time, error) {
+	if column == "" {
+		return now, nil
+	}
+	val, ok := m.fields[column]
+	if t, isTime := val.(time.Time); isTime {
+		return t.In(now.Location()), nil
+	}
+	if !ok || val == nil {
+		return time.Time{}, fmt.Errorf("no timestamp in column %q", column)
+	}
+	cell := formatValue(val)
+	if r.EventTimeLayout != "" {
+		if t, err := time.ParseInLocation(r.EventTimeLayout, cell, now.Location()); err == nil {
+			return t.In(now.Location()), nil
+		}
+	}
+	// Also how time.Time fields of struct and JSON payloads are encoded
+	t, ok := parseTimestamp(cell)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q in column %q", cell, column)
+	}
+	return t.In(now.Location()), nil
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ExportOptions tunes ExportAll.
+type ExportOptions struct {
+	// Workers is the number of goroutines mapping payloads concurrently.
+	// Defaults to runtime.GOMAXPROCS(0).
+	Workers int
+
+	// ChunkSize is the number of payloads mapped by one worker and written in
+	// one batch. Defaults to 1024.
+	ChunkSize int
+}
+
+// exportChunk is a run of consecutive payloads and, once done is closed, their
+// mapped rows.
+type exportChunk struct {
+	offset   int // index of the first payload
+	payloads []interface{}
+
+	done   chan struct{}
+	mapped []mappedRow
+	err    error
+}
+
+// ExportAll records every payload of the sequence, for bulk exports of
+// millions of rows. Payloads are mapped onto the columns in parallel, in
+// chunks, while the chunks are written one after another in sequence order,
+// so the files end up exactly as with one Record call per payload.
+//
+// All rows go to the period current when the export starts, and the service
+// is locked for the duration, so concurrent Record calls wait. Column must be
+// set: the columns aren't discovered during an export. It returns the number
+// of rows written; on error, every chunk before the failing one is written.
+func (r *Service) ExportAll(payloads iter.Seq[interface{}], opts ExportOptions) (int, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = 1024
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if err := r.register(); err != nil {
+		return 0, err
+	}
+	if len(r.Column) == 0 {
+		return 0, errors.New("export needs columns, they aren't discovered during an export")
+	}
+	timeNow, err := r.Now()
+	if err != nil {
+		return 0, err
+	}
+	suffix, err := r.Suffix(timeNow)
+	if err != nil {
+		return 0, err
+	}
+
+	column := r.Column
+	jobs := make(chan *exportChunk)
+	ordered := make(chan *exportChunk, workers)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case c, ok := <-jobs:
+					if !ok {
+						return
+					}
+					c.mapped, c.err = r.mapChunk(column, c)
+					close(c.done)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		chunk := &exportChunk{done: make(chan struct{})}
+		send := func() bool {
+			c := chunk
+			chunk = &exportChunk{offset: c.offset + len(c.payloads), done: make(chan struct{})}
+			// Queued for writing before mapping, so ordered keeps sequence order
+			for _, ch := range []chan<- *exportChunk{ordered, jobs} {
+				select {
+				case ch <- c:
+				case <-stop:
+					return false
+				}
+			}
+			return true
+		}
+		for p := range payloads {
+			chunk.payloads = append(chunk.payloads, p)
+			if len(chunk.payloads) == size && !send() {
+				return
+			}
+		}
+		if len(chunk.payloads) > 0 {
+			send()
+		}
+	}()
+
+	written := 0
+	for c := range ordered {
+		<-c.done
+		if c.err != nil {
+			err = c.err
+			break
+		}
+		start := time.Now()
+		batches, werr := r.writeMapped(timeNow, suffix, c.mapped)
+		r.observe(batches, start, werr)
+		if werr != nil {
+			err = werr
+			break
+		}
+		for _, b := range batches {
+			written += len(b.Rows)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	return written, err
+}
+
+// mapChunk maps the payloads of c. It only reads the service configuration,
+// so it can run while the exporting goroutine holds r.mu.
+func (r *Service) mapChunk(column []string, c *exportChunk) ([]mappedRow, error) {
+	var mapped []mappedRow
+	for i, p := range c.payloads {
+		m, err := r.mapRows(column, p)
+		if err != nil {
+			return nil, fmt.Errorf("payload %d: %w", c.offset+i, err)
+		}
+		mapped = append(mapped, m...)
+	}
+	return mapped, nil
+}
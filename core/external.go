@@ -0,0 +1,52 @@
+package core
+
+import "os"
+
+// writtenFile is a CSV file as the service left it after its last append.
+type writtenFile struct {
+	info os.FileInfo
+	size int64
+}
+
+// checkReplaced detects that the file at path, found as stat, was removed,
+// replaced or truncated by another process since the service's last append,
+// e.g., by logrotate with or without copytruncate. What the service knew of
+// the old file is forgotten, so the rows go on to the new one as to any new
+// file: appendAt writes the header to an empty file, and rows are numbered
+// and preallocated afresh. AppendOnly reports a shrunken file instead. The
+// caller must hold r.mu.
+func (r *Service) checkReplaced(path string, stat os.FileInfo) {
+	last, ok := r.written[path]
+	if !ok || r.AppendOnly {
+		return
+	}
+	// os.SameFile only compares the file infos of the OS filesystem
+	replaced := os.SameFile(last.info, last.info) && !os.SameFile(last.info, stat)
+	if !replaced && stat.Size() >= last.size {
+		return
+	}
+	r.logWarn("CSV file was replaced or truncated since the last write", "path", path, "size", last.size, "found", stat.Size())
+	r.forgetFile(path)
+}
+
+// trackWritten remembers the file at path, found as stat before an append of
+// n bytes.
+func (r *Service) trackWritten(path string, stat os.FileInfo, n int64) {
+	if r.AppendOnly {
+		return
+	}
+	if r.written == nil {
+		r.written = make(map[string]writtenFile)
+	}
+	r.written[path] = writtenFile{info: stat, size: stat.Size() + n}
+}
+
+// forgetFile drops what the service knows of the file at path, after it was
+// removed or replaced.
+func (r *Service) forgetFile(path string) {
+	delete(r.written, path)
+	delete(r.rowCounts, path)
+	delete(r.headers, path)
+	delete(r.reserved, path)
+	r.usageKnown = false
+}
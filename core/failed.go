@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// saveFailed appends the payload of an async record that failed to write to
+// FailedFile, with the time of the period it was meant for, and returns
+// whether it did. Payload errors, which would fail again, aren't saved.
+func (r *Service) saveFailed(err *AsyncError) bool {
+	path := r.FailedFile
+	if path == "" || errors.Is(err.Err, ErrInvalidPayload) {
+		return false
+	}
+	at := err.at
+	if at.IsZero() {
+		at = r.clock()
+	}
+	rec := deadLetterRecord{Time: at, Error: err.Err.Error()}
+	raw, merr := json.Marshal(err.Payload)
+	if merr != nil {
+		r.logError("failed to save failed record", "path", path, "error", merr)
+		return false
+	}
+	rec.Payload = raw
+	line, merr := json.Marshal(rec)
+	if merr != nil {
+		r.logError("failed to save failed record", "path", path, "error", merr)
+		return false
+	}
+
+	r.failedMu.Lock()
+	defer r.failedMu.Unlock()
+	if werr := appendLines(path, [][]byte{line}); werr != nil {
+		r.logError("failed to save failed record", "path", path, "error", werr)
+		return false
+	}
+	return true
+}
+
+// Replay records the payloads saved to the JSON lines file at path, e.g.,
+// FailedFile once the outage is over, or a dead-letter file once its records
+// are fixed, each to the files of the period it was meant for, like RecordAt.
+// Payloads that fail again are kept in the file, which is removed once every
+// payload was recorded. It returns the number of payloads recorded and the
+// failures joined with errors.Join.
+//
+// The file is taken over while it is replayed, so records failing meanwhile
+// are appended to a new FailedFile and replayed by a later call.
+func (r *Service) Replay(path string) (int, error) {
+	r.failedMu.Lock()
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = os.Remove(path)
+	}
+	r.failedMu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to take over %q: %w", path, err)
+	}
+
+	replayed := 0
+	var kept [][]byte
+	var errs []error
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var rec deadLetterRecord
+		if err := json.Unmarshal(text, &rec); err != nil || len(rec.Payload) == 0 {
+			if err == nil {
+				err = errors.New("no payload")
+			}
+			errs = append(errs, fmt.Errorf("line %d of %q: %w", line, path, err))
+			kept = append(kept, bytes.Clone(text))
+			continue
+		}
+		var payload interface{} = rec.Payload
+		if rec.Payload[0] == '[' {
+			// Saved from a slice payload, one row per element
+			var items []json.RawMessage
+			if err := json.Unmarshal(rec.Payload, &items); err == nil {
+				payload = items
+			}
+		}
+		if err := r.RecordAt(rec.Time, payload); err != nil {
+			errs = append(errs, fmt.Errorf("line %d of %q: %w", line, path, err))
+			rec.Error = err.Error()
+			if text, err = json.Marshal(rec); err != nil {
+				text = bytes.Clone(sc.Bytes())
+			}
+			kept = append(kept, text)
+			continue
+		}
+		replayed++
+	}
+
+	if len(kept) > 0 {
+		r.failedMu.Lock()
+		err := appendLines(path, kept)
+		r.failedMu.Unlock()
+		if err != nil {
+			// Don't lose them: they are in no other place now
+			errs = append(errs, fmt.Errorf("failed to keep %d payloads in %q: %w", len(kept), path, err))
+			for _, line := range kept {
+				r.logError("lost payload to replay", "path", path, "line", string(line))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		r.logWarn("replayed records", "path", path, "replayed", replayed, "failed", len(kept))
+	}
+	return replayed, errors.Join(errs...)
+}
+
+// appendLines appends lines to the file at path on the OS filesystem,
+// creating it and its directory if needed.
+func appendLines(path string, lines [][]byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// failbackInterval is how often the primary Dir is probed while failed over.
+const failbackInterval = 10 * time.Second
+
+// FailoverEvent describes a switch between Dir and FallbackDir.
+type FailoverEvent struct {
+	From string // the directory written until now
+	To   string // the directory written from now on
+
+	// Err is the write error that caused a failover, ErrStalled for one
+	// started by StallFailover, or nil when the service recovered to Dir.
+	Err error
+
+	// Merged lists the files in Dir that rows written to FallbackDir were
+	// merged into on recovery.
+	Merged []string
+}
+
+// failoverState tracks writes to FallbackDir.
+type failoverState struct {
+	active  bool      // writing to FallbackDir
+	checked bool      // FallbackDir was checked for files left before a restart
+	probed  time.Time // last probe of Dir
+}
+
+// isDiskError reports whether err is a failure of the filesystem rather than
+// of the records, e.g., a read-only or full disk or a vanished mount.
+func isDiskError(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) || isTransientErrno(err)
+}
+
+// writeFailover writes the batch to Dir, or to FallbackDir while Dir fails.
+// The caller must hold the entry lock.
+func (r *Service) writeFailover(b *Batch) error {
+	s := &r.failover
+	if !s.checked {
+		s.checked = true
+		// Rows left in FallbackDir before a restart are merged on recovery
+		files, err := r.fallbackFiles()
+		s.active = err == nil && len(files) > 0
+	}
+	if r.stallFailover.Swap(false) && !s.active {
+		r.logError("failing over to fallback directory after a stalled write", "dir", r.Dir, "fallback_dir", r.FallbackDir)
+		s.active, s.probed = true, r.clock()
+		if r.OnFailover != nil {
+			r.OnFailover(FailoverEvent{From: r.Dir, To: r.FallbackDir, Err: ErrStalled})
+		}
+	}
+
+	if s.active {
+		if now := r.clock(); now.Sub(s.probed) >= failbackInterval {
+			s.probed = now
+			if err := r.failback(); err != nil {
+				r.logWarn("primary directory still unavailable", "dir", r.Dir, "err", err)
+			}
+		}
+		if s.active {
+			return r.writeFile(r.FallbackDir, b)
+		}
+	}
+
+	err := r.writeFile(r.Dir, b)
+	if err == nil || !isDiskError(err) {
+		return err
+	}
+	r.logError("failing over to fallback directory", "dir", r.Dir, "fallback_dir", r.FallbackDir, "err", err)
+	if ferr := r.writeFile(r.FallbackDir, b); ferr != nil {
+		return errors.Join(err, fmt.Errorf("fallback failed: %w", ferr))
+	}
+	s.active, s.probed = true, r.clock()
+	if r.OnFailover != nil {
+		r.OnFailover(FailoverEvent{From: r.Dir, To: r.FallbackDir, Err: err})
+	}
+	return nil
+}
+
+// fallbackFiles returns the service's CSV files in FallbackDir, including
+// those of its projections.
+func (r *Service) fallbackFiles() ([]string, error) {
+	files, err := r.listFiles(r.FallbackDir, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range r.Projections {
+		named, err := r.listNamed(r.FallbackDir, r.projectionBase(p.Name), "")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, named...)
+	}
+	return files, nil
+}
+
+// failback merges the files in FallbackDir back into Dir if it is writable
+// again, appending their rows to the files of the same name, and switches
+// writes back to Dir. The caller must hold the entry lock.
+func (r *Service) failback() error {
+	if err := checkWritable(r.fs(), r.Dir); err != nil {
+		return err
+	}
+	files, err := r.fallbackFiles()
+	if err != nil {
+		return err
+	}
+
+	var merged []string
+	for _, src := range files {
+		rows, err := r.readRows(src)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.FallbackDir, src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(r.Dir, rel)
+		if err := r.mkdir(filepath.Dir(dst)); err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			header := rows[0]
+			if r.NewColumns == ColumnsAppend {
+				if err := r.widenHeader(dst, header); err != nil {
+					return err
+				}
+			}
+			offset, n, err := r.appendAt(dst, header, rows[1:])
+			if err != nil {
+				return fmt.Errorf("failed to merge %q into %q: %w", src, dst, err)
+			}
+			if r.Receipts != nil {
+				r.emitReceipts(dst, header, rows[1:], offset, n)
+			}
+			if err := r.reseal(dst); err != nil {
+				return err
+			}
+		}
+		if err := r.fs().Remove(src); err != nil {
+			return fmt.Errorf("failed to remove merged fallback file %q: %w", src, err)
+		}
+		merged = append(merged, dst)
+	}
+
+	r.failover.active = false
+	r.logInfo("recovered primary directory", "dir", r.Dir, "merged", len(merged))
+	if r.OnFailover != nil {
+		r.OnFailover(FailoverEvent{From: r.FallbackDir, To: r.Dir, Merged: merged})
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// structPlan lists how to read the fields of a struct type, the way
+// encoding/json encodes them.
+type structPlan struct {
+	fields []fieldPlan
+}
+
+// fieldPlan is one encoded field of a struct.
+type fieldPlan struct {
+	name      string
+	index     []int // reflect field index path, through embedded structs
+	omitEmpty bool
+	quoted    bool // ",string" option
+}
+
+// plans caches the *structPlan of each payload type, or nil for types that
+// take the JSON path.
+var plans sync.Map // planKey -> *structPlan
+
+// planKey is a payload type and whether its fields are named by their csv
+// tags, see Service.CSVTags.
+type planKey struct {
+	t       reflect.Type
+	csvTags bool
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	timeType          = reflect.TypeFor[time.Time]()
+)
+
+// planFor returns the cached plan of t, or nil if payloads of type t must be
+// converted through JSON: maps, custom marshalers and anything but structs.
+func planFor(t reflect.Type, csvTags bool) *structPlan {
+	key := planKey{t, csvTags}
+	if p, ok := plans.Load(key); ok {
+		return p.(*structPlan)
+	}
+	var plan *structPlan
+	if t.Kind() == reflect.Struct && (!hasCustomEncoding(t) || inlinesEncoding(t)) {
+		plan = &structPlan{fields: typeFields(t, csvTags)}
+	}
+	plans.Store(key, plan)
+	return plan
+}
+
+// hasCustomEncoding reports whether JSON encodes t through a method.
+func hasCustomEncoding(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// inlinesEncoding reports whether the custom encoding of t may be promoted
+// from a field with the inline option, which is flattened instead.
+func inlinesEncoding(t reflect.Type) bool {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		_, opts, _ := fieldTag(f, false) // The inline option is read either way
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && hasOption(opts, "inline") && hasCustomEncoding(ft) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeFields collects the encoded fields of t, including promoted fields of
+// embedded structs. Field names come from the json tag, or with csvTags from
+// the csv tag, then the json tag, and then the Go name. Like encoding/json,
+// the shallowest field wins a name conflict, and conflicts at the same depth
+// drop the name unless exactly one of the fields is tagged.
+//
+// The inline tag option flattens a struct field like an untagged embedded
+// one, also when it is named, tagged or has its own encoding, e.g.,
+// `csv:",inline"` on an embedded time-stamped base type, or
+// `csv:"billing_,inline"`, which prefixes the names of the fields with the
+// tag name: billing_street, billing_city.
+func typeFields(t reflect.Type, csvTags bool) []fieldPlan {
+	type candidate struct {
+		fieldPlan
+		depth  int
+		tagged bool
+	}
+	var candidates []candidate
+	var walk func(t reflect.Type, index []int, prefix string, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, prefix string, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, opts, tagged := fieldTag(f, csvTags)
+			if name == "-" && !tagged {
+				continue
+			}
+			idx := append(append([]int(nil), index...), i)
+
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && hasOption(opts, "inline") && (f.IsExported() || f.Anonymous) {
+				walk(ft, idx, prefix+name, visited)
+				continue
+			}
+			if f.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+				walk(ft, idx, prefix, visited) // Promote the embedded fields
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			candidates = append(candidates, candidate{
+				fieldPlan: fieldPlan{
+					name:      prefix + name,
+					index:     idx,
+					omitEmpty: strings.Contains(opts, ",omitempty"),
+					quoted:    strings.Contains(opts, ",string"),
+				},
+				depth:  len(idx),
+				tagged: tagged,
+			})
+		}
+	}
+	walk(t, nil, "", map[reflect.Type]bool{})
+
+	var fields []fieldPlan
+	for i, c := range candidates {
+		dominant, conflict := true, false
+		for j, o := range candidates {
+			if i == j || o.name != c.name {
+				continue
+			}
+			switch {
+			case o.depth < c.depth, o.depth == c.depth && o.tagged && !c.tagged:
+				dominant = false
+			case o.depth == c.depth && o.tagged == c.tagged:
+				conflict = true
+			}
+		}
+		if dominant && !conflict {
+			fields = append(fields, c.fieldPlan)
+		}
+	}
+	return fields
+}
+
+// hasOption reports whether the tag options, as returned by fieldTag, include
+// option.
+func hasOption(opts, option string) bool {
+	for opts != "" {
+		var o string
+		o, opts, _ = strings.Cut(strings.TrimPrefix(opts, ","), ",")
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldTag returns the name and options of the field's json tag, or of its
+// csv tag with csvTags or the inline option, which encoding/json doesn't
+// know. tagged reports whether a tag set the name.
+func fieldTag(f reflect.StructField, csvTags bool) (name, opts string, tagged bool) {
+	tag, ok := f.Tag.Lookup("csv")
+	if _, csvOpts, _ := strings.Cut(tag, ","); !ok || !csvTags && !hasOption(","+csvOpts, "inline") {
+		tag = f.Tag.Get("json")
+	}
+	name, rest, hasOpts := strings.Cut(tag, ",")
+	if hasOpts {
+		opts = "," + rest
+	}
+	if name == "-" && !hasOpts {
+		return "-", opts, false // Ignored field
+	}
+	return name, opts, name != ""
+}
+
+// structFields reads the fields of a struct value into the same map toMap
+// would produce, without encoding the whole payload: scalars become their
+// cell text, nested values their decoded JSON.
+func (p *structPlan) structFields(v reflect.Value) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(p.fields))
+	for _, f := range p.fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok {
+			continue // Behind a nil embedded pointer, JSON omits it
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		val, err := fieldValue(fv, f.quoted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map field %q: %w", f.name, err)
+		}
+		fields[f.name] = val
+	}
+	return fields, nil
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports a nil embedded
+// pointer instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldValue converts a field to its toMap representation, or to the cell of
+// its CellMarshaler.
+func fieldValue(v reflect.Value, quoted bool) (interface{}, error) {
+	for {
+		if s, ok, err := marshalCell(v); ok || err != nil {
+			return s, err
+		}
+		if m, ok := methodEncoded(v); ok {
+			return decodeValue(m)
+		}
+		if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+			break
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if hasCustomEncoding(v.Type()) {
+		return decodeValue(v.Interface()) // A pointer method JSON can't call either
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if quoted {
+			b, _ := json.Marshal(v.String())
+			return string(b), nil
+		}
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float(), v.Type().Bits())
+	case reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil, nil // JSON null
+		}
+	}
+	return decodeValue(v.Interface()) // Structs, maps, slices and arrays
+}
+
+// methodEncoded returns what JSON encodes v through a MarshalJSON or
+// MarshalText method of, if any: v, before a pointer is dereferenced, or
+// its address for a pointer receiver when v is addressable, as in
+// encoding/json. time.Time is left to fieldValue.
+func methodEncoded(v reflect.Value) (interface{}, bool) {
+	t := v.Type()
+	if t == timeType || t == reflect.PointerTo(timeType) || t.Kind() == reflect.Interface {
+		return nil, false
+	}
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface(), true
+	}
+	if pt := reflect.PointerTo(t); v.CanAddr() && (pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)) {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// formatFloat formats f exactly like encoding/json.
+func formatFloat(f float64, bits int) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(f, 'g', -1, bits))
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 && (bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21)) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9, as encoding/json does
+		if n := len(s); n >= 4 && s[n-4] == 'e' && s[n-3] == '-' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	}
+	return s, nil
+}
+
+// decodeValue round-trips a single value through JSON, for values whose
+// encoding isn't reproduced by fieldValue.
+func decodeValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// isEmptyValue reports whether v is empty in the sense of ",omitempty".
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+type taggedBooking struct {
+	ID      string `csv:"booking_id" json:"id"`
+	Status  string `csv:"state"`
+	Billing struct {
+		City string `json:"city"`
+	} `csv:"billing_,inline"`
+}
+
+func TestFieldNamesFollowJSONTags(t *testing.T) {
+	payload := taggedBooking{ID: "1", Status: "paid"}
+	payload.Billing.City = "Bandung"
+	tests := map[bool][]string{
+		false: {"id", "Status", "billing_city"},
+		true:  {"booking_id", "state", "billing_city"},
+	}
+	for csvTags, want := range tests {
+		s := New(t.TempDir(), "booking", nil, "daily")
+		s.ColumnsFrom = taggedBooking{}
+		s.CSVTags = csvTags
+		if err := s.Record(payload); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(s.Column, want) {
+			t.Errorf("CSVTags %v: columns = %q, want %q", csvTags, s.Column, want)
+		}
+		if got := rows(t, s); !slices.Equal(got, []string{"1,paid,Bandung"}) {
+			t.Errorf("CSVTags %v: rows = %q", csvTags, got)
+		}
+
+		var decoded taggedBooking
+		if err := s.Decode([]string{"1", "paid", "Bandung"}, &decoded); err != nil || decoded != payload {
+			t.Errorf("CSVTags %v: decoded %+v, %v", csvTags, decoded, err)
+		}
+	}
+}
+
+// counter marshals itself through a pointer receiver.
+type counter struct{ N int }
+
+func (c *counter) MarshalJSON() ([]byte, error) {
+	return []byte(`"#` + strconv.Itoa(c.N) + `"`), nil
+}
+
+func TestFieldPointerReceiverMarshaler(t *testing.T) {
+	type payload struct {
+		Value counter  `json:"value"`
+		Ptr   *counter `json:"ptr"`
+		Nil   *counter `json:"nil"`
+	}
+	p := payload{Value: counter{1}, Ptr: &counter{2}}
+	// Like json.Marshal, which only calls the method of addressable values
+	for name, data := range map[string]interface{}{"pointer": &p, "value": p} {
+		got, err := fieldsOf(data, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := toMap(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: fields = %v, want %v", name, got, want)
+		}
+	}
+	if got, _ := fieldsOf(&p, false); got["value"] != "#1" || got["ptr"] != "#2" || got["nil"] != nil {
+		t.Errorf("fields = %v", got)
+	}
+}
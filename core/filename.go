@@ -0,0 +1,129 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilename is returned for a Filename or Dir that isn't safe to
+// write to, e.g., one taken from tenant configuration.
+var ErrInvalidFilename = errors.New("invalid filename")
+
+// InvalidFilenameError reports why a filename or directory was rejected.
+type InvalidFilenameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidFilenameError) Error() string {
+	return fmt.Sprintf("%v %q: %s", ErrInvalidFilename, e.Name, e.Reason)
+}
+
+func (e *InvalidFilenameError) Is(target error) bool {
+	return target == ErrInvalidFilename
+}
+
+// windowsReserved are device names Windows refuses as file names, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ValidateFilename checks that name is a single file name that is valid on
+// both Unix and Windows: no path separators or "..", none of the characters
+// <>:"|?* or control characters, no trailing dot or space and no reserved
+// device name such as CON. It returns an *InvalidFilenameError otherwise.
+func ValidateFilename(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidFilenameError{Name: name, Reason: reason}
+	}
+	switch {
+	case name == "":
+		return invalid("must not be empty")
+	case name == "." || name == "..":
+		return invalid("must not refer to a directory")
+	case strings.ContainsAny(name, `/\`):
+		return invalid("must not contain path separators")
+	case strings.ContainsAny(name, `<>:"|?*`):
+		return invalid(`must not contain any of <>:"|?*`)
+	case strings.ContainsFunc(name, func(c rune) bool { return c < 0x20 || c == 0x7f }):
+		return invalid("must not contain control characters")
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		return invalid("must not end with a dot or space")
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return invalid("is a reserved device name on Windows")
+	}
+	return nil
+}
+
+// SanitizeFilename returns name with everything ValidateFilename would reject
+// replaced by '_', for callers that prefer escaping over rejecting.
+func SanitizeFilename(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(`/\<>:"|?*`, c) {
+			return '_'
+		}
+		return c
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	base, ext, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// checkLocation validates Filename with its Environment prefix, that the
+// names of Namer and DirLayout stay within Dir and, when BaseDir is set, that
+// Dir stays within it.
+func (r *Service) checkLocation() error {
+	if err := ValidateFilename(r.Filename); err != nil {
+		return err
+	}
+	if r.Environment != "" {
+		if err := ValidateFilename(r.filename()); err != nil {
+			return err
+		}
+	}
+	if r.Namer != nil {
+		if name := r.Namer.Name(r.filename(), time.Now()); !filepath.IsLocal(filepath.FromSlash(name)) {
+			return &InvalidFilenameError{Name: name, Reason: "is named by Namer outside of Dir"}
+		}
+	}
+	if r.DirLayout != "" {
+		if name := time.Now().Format(r.DirLayout); !filepath.IsLocal(filepath.FromSlash(name)) {
+			return &InvalidFilenameError{Name: name, Reason: "is a DirLayout folder outside of Dir"}
+		}
+	}
+	if r.BaseDir == "" {
+		return nil
+	}
+	base, err := filepath.Abs(r.BaseDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve base directory %q: %w", r.BaseDir, err)
+	}
+	dir, err := filepath.Abs(r.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory %q: %w", r.Dir, err)
+	}
+	rel, err := filepath.Rel(base, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &InvalidFilenameError{Name: r.Dir, Reason: fmt.Sprintf("directory is outside of %q", r.BaseDir)}
+	}
+	return nil
+}
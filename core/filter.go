@@ -0,0 +1,28 @@
+package core
+
+import "slices"
+
+// FieldIn returns a Filter accepting the payloads whose field key is one of
+// values, compared as written to its cell, e.g., only failed responses:
+//
+//	service.Filter = core.FieldIn("status", "500", "502", "503")
+func FieldIn(key string, values ...string) func(f Fields) bool {
+	return func(f Fields) bool {
+		return slices.Contains(values, f.String(key))
+	}
+}
+
+// FilterCounts returns the number of rows Filter accepted and skipped.
+func (r *Service) FilterCounts() (accepted, skipped int64) {
+	return r.accepted.Load(), r.filtered.Load()
+}
+
+// accept applies Filter to the fields of a row.
+func (r *Service) accept(fields map[string]interface{}) bool {
+	if r.Filter(Fields(fields)) {
+		r.accepted.Add(1)
+		return true
+	}
+	r.filtered.Add(1)
+	return false
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// ErrFollowLagged is yielded by Follow when the loop fell so far behind the
+// writes that rows were dropped.
+var ErrFollowLagged = errors.New("follower fell behind")
+
+// followBuffer is the number of rows a Follow loop may be behind before the
+// oldest are dropped.
+const followBuffer = 1 << 16
+
+// follower is the queue of one Follow loop.
+type follower struct {
+	mu      sync.Mutex
+	rows    []RecordRow
+	dropped int
+	closed  bool
+	ready   chan struct{} // signaled when rows are queued or closed is set
+}
+
+// Follow streams the rows the service writes from the moment the loop
+// starts, like tail -F on its files: rows of a new period come from the new
+// file, with their Path, without any polling. Rows written to the files by
+// other processes aren't seen, and Line is always 0.
+//
+// The iteration ends when ctx is done or the service is closed, after the
+// rows written before Close. A loop that falls more than 65536 rows behind
+// loses the oldest ones and is told with an error matching ErrFollowLagged.
+//
+//	go func() {
+//		for row, err := range service.Follow(ctx) {
+//			if err != nil {
+//				log.Print(err)
+//				continue
+//			}
+//			monitor(row.Fields)
+//		}
+//	}()
+func (r *Service) Follow(ctx context.Context) iter.Seq2[RecordRow, error] {
+	return func(yield func(RecordRow, error) bool) {
+		f := &follower{ready: make(chan struct{}, 1)}
+		r.followMu.Lock()
+		if r.followClosed {
+			r.followMu.Unlock()
+			return
+		}
+		r.followers = append(r.followers, f)
+		r.followMu.Unlock()
+		defer func() {
+			r.followMu.Lock()
+			r.followers = slices.DeleteFunc(r.followers, func(g *follower) bool { return g == f })
+			r.followMu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-f.ready:
+			}
+			f.mu.Lock()
+			rows, dropped, closed := f.rows, f.dropped, f.closed
+			f.rows, f.dropped = nil, 0
+			f.mu.Unlock()
+
+			if dropped > 0 && !yield(RecordRow{}, fmt.Errorf("%w: %d rows dropped", ErrFollowLagged, dropped)) {
+				return
+			}
+			for _, row := range rows {
+				if !yield(row, nil) {
+					return
+				}
+			}
+			if closed {
+				return
+			}
+		}
+	}
+}
+
+// follow queues the rows of a written batch for every Follow loop.
+func (r *Service) follow(b *Batch) {
+	r.followMu.Lock()
+	defer r.followMu.Unlock()
+	if len(r.followers) == 0 {
+		return
+	}
+
+	path := r.BatchPath(b)
+	rows := make([]RecordRow, len(b.Rows))
+	for i, cells := range b.Rows {
+		fields := make(map[string]string, len(b.Column))
+		for j, key := range b.Column {
+			if j < len(cells) {
+				fields[key] = cells[j]
+			}
+		}
+		rows[i] = RecordRow{Path: path, Fields: fields}
+	}
+	for _, f := range r.followers {
+		f.mu.Lock()
+		f.rows = append(f.rows, rows...)
+		if over := len(f.rows) - followBuffer; over > 0 {
+			f.rows = slices.Delete(f.rows, 0, over)
+			f.dropped += over
+		}
+		f.mu.Unlock()
+		f.signal()
+	}
+}
+
+// closeFollowers ends every Follow loop once it has yielded its queued rows.
+func (r *Service) closeFollowers() {
+	r.followMu.Lock()
+	defer r.followMu.Unlock()
+	r.followClosed = true
+	for _, f := range r.followers {
+		f.mu.Lock()
+		f.closed = true
+		f.mu.Unlock()
+		f.signal()
+	}
+}
+
+func (f *follower) signal() {
+	select {
+	case f.ready <- struct{}{}:
+	default: // Already signaled
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// FS is the filesystem a Service keeps its files on: the CSV files and their
+// sidecars, such as the schema, journal, manifest and dedup state. Set
+// Service.FS to an in-memory FS in unit tests (see the memfs package), to an
+// SFTP server (see the sftpfs package) or to an adapter for a mounted object
+// store. Implementations must be safe for concurrent use.
+//
+// The configuration file of NewFromConfigFile and the files of other packages,
+// such as sink/xlsx and upload, are always on the OS filesystem.
+type FS interface {
+	// Open opens a file for reading.
+	Open(name string) (File, error)
+
+	// Create creates or truncates a file for writing.
+	Create(name string) (File, error)
+
+	// OpenFile opens a file with the os.O_* flags, e.g., os.O_APPEND.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+
+	MkdirAll(path string, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+
+	// Rename replaces newpath with oldpath. It should be atomic, since the
+	// service writes files through a temporary file and a rename.
+	Rename(oldpath, newpath string) error
+
+	Remove(name string) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// File is a file opened through an FS. FileLock only locks files that are
+// *os.File, since only processes sharing the OS filesystem need the lock.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Closer
+	Stat() (fs.FileInfo, error)
+}
+
+// OSFS is the FS of the operating system, used when Service.FS is nil.
+type OSFS struct{}
+
+var _ FS = OSFS{}
+
+func (OSFS) Open(name string) (File, error)   { return open(os.Open(name)) }
+func (OSFS) Create(name string) (File, error) { return open(os.Create(name)) }
+
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return open(os.OpenFile(name, flag, perm))
+}
+
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (OSFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFS) Remove(name string) error                     { return os.Remove(name) }
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+
+// open converts the result of an os function, keeping a nil File nil.
+func open(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// fs returns FS, or the OS filesystem if it isn't set, creating files and
+// directories with DirPerm, FilePerm and Owner when they are set.
+func (r *Service) fs() FS {
+	var fsys FS = OSFS{}
+	if r.FS != nil {
+		fsys = r.FS
+	}
+	if r.DirPerm == 0 && r.FilePerm == 0 && r.Owner == nil {
+		return fsys
+	}
+	return permFS{FS: fsys, dirPerm: r.DirMode(), filePerm: r.FileMode(), owner: r.Owner}
+}
+
+// lockFile takes the FileLock of f, if it is an OS file.
+func lockFile(f File) error {
+	if osf, ok := f.(*os.File); ok {
+		return lockOSFile(osf)
+	}
+	return nil
+}
+
+// tryLockFile is lockFile without blocking, reporting false if another file
+// holds the lock. Files of other file systems are always locked.
+func tryLockFile(f File) (bool, error) {
+	if osf, ok := f.(*os.File); ok {
+		return tryLockOSFile(osf)
+	}
+	return true, nil
+}
+
+// unlockFile releases the lock taken by lockFile.
+func unlockFile(f File) error {
+	if osf, ok := f.(*os.File); ok {
+		return unlockOSFile(osf)
+	}
+	return nil
+}
+
+// readFile is os.ReadFile on fsys.
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeFile is os.WriteFile on fsys.
+func writeFile(fsys FS, name string, data []byte) error {
+	f, err := fsys.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// replaceFile writes data to name through a temporary file and a rename, so
+// readers never see a partial file.
+func replaceFile(fsys FS, name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := writeFile(fsys, tmp, data); err != nil {
+		fsys.Remove(tmp)
+		return fmt.Errorf("failed to write %q: %w", tmp, err)
+	}
+	if err := fsys.Rename(tmp, name); err != nil {
+		fsys.Remove(tmp)
+		return fmt.Errorf("failed to replace %q: %w", name, err)
+	}
+	return nil
+}
+
+// glob is filepath.Glob on fsys for a pattern whose directory part has no
+// wildcards, as in all the service's patterns.
+func glob(fsys FS, pattern string) ([]string, error) {
+	dir, base := filepath.Split(pattern)
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := filepath.Match(base, ""); err != nil {
+		return nil, err
+	}
+	entries, err := fsys.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, e := range entries {
+		if ok, _ := filepath.Match(base, e.Name()); ok {
+			matches = append(matches, filepath.Join(dir, e.Name()))
+		}
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrClosed is returned by Record and RecordAsync after Close.
+var ErrClosed = errors.New("service is closed")
+
+// flushMarker is queued by Flush; drain closes it once every payload queued
+// before it has been written.
+type flushMarker chan struct{}
+
+// Flush blocks until every payload queued by RecordAsync so far has been
+// written or reported as failed.
+func (r *Service) Flush() error {
+	r.asyncMu.Lock()
+	if r.queue == nil {
+		r.asyncMu.Unlock()
+		return nil
+	}
+	done := make(flushMarker)
+	r.queue <- done
+	r.asyncMu.Unlock()
+
+	<-done
+	return nil
+}
+
+// Close writes the queued async payloads, waits for running period summaries,
+// releases the service's file names and closes every sink that implements
+// io.Closer. Later Record and RecordAsync calls fail with ErrClosed. Closing
+// a closed service does nothing, so Close is safe to call from several
+// shutdown hooks. Records still buffered by PauseBuffer are reported as
+// failed with ErrPaused.
+func (r *Service) Close() error {
+	r.asyncMu.Lock()
+	if r.asyncClosed {
+		r.asyncMu.Unlock()
+		return nil
+	}
+	r.asyncClosed = true
+	queue, drained := r.queue, r.drained
+	r.queue = nil
+	r.asyncMu.Unlock()
+
+	if queue != nil {
+		close(queue)
+		<-drained
+	}
+
+	r.mu.Lock()
+	r.closed = true
+	r.stopWarmup()
+	r.stopRotation()
+	r.unregister()
+	sinks := r.Sinks
+	r.mu.Unlock()
+	r.closeFollowers()
+	r.dropPaused()
+
+	r.background.Wait()
+	r.openFiles.closeAll()
+
+	var errs []error
+	for _, sink := range sinks {
+		if c, ok := sink.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,22 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockUnsupported = errors.New("advisory file locks are not supported on this platform")
+
+func lockOSFile(f *os.File) error {
+	return errLockUnsupported
+}
+
+func unlockOSFile(f *os.File) error {
+	return errLockUnsupported
+}
+
+func tryLockOSFile(f *os.File) (bool, error) {
+	return false, errLockUnsupported
+}
@@ -0,0 +1,29 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package core
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockOSFile takes an exclusive advisory lock on f, blocking until it is available.
+func lockOSFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockOSFile releases the advisory lock taken by lockOSFile.
+func unlockOSFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// tryLockOSFile is lockOSFile without blocking, reporting false if another
+// file holds the lock.
+func tryLockOSFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,38 @@
+//go:build windows
+
+package core
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffset is the high offset of the byte locked on Windows. It lies far
+// beyond the end of any file, so other handles can still read and write the
+// file itself while it is locked.
+const lockOffset = 0x7fffffff
+
+// lockOSFile takes an exclusive lock on f, blocking until it is available.
+func lockOSFile(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffset}
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, ol)
+}
+
+// unlockOSFile releases the lock taken by lockOSFile.
+func unlockOSFile(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffset}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, ol)
+}
+
+// tryLockOSFile takes an exclusive lock on f without blocking, reporting false
+// if another handle holds it.
+func tryLockOSFile(f *os.File) (bool, error) {
+	ol := &windows.Overlapped{OffsetHigh: lockOffset}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
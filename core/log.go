@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+func (r *Service) logDebug(msg string, args ...any) {
+	r.logAt(slog.LevelDebug, msg, args...)
+}
+
+func (r *Service) logInfo(msg string, args ...any) {
+	r.logAt(slog.LevelInfo, msg, args...)
+}
+
+func (r *Service) logWarn(msg string, args ...any) {
+	r.logAt(slog.LevelWarn, msg, args...)
+}
+
+func (r *Service) logError(msg string, args ...any) {
+	r.logAt(slog.LevelError, msg, args...)
+}
+
+// logAt logs to Logger, if set, with the service's filename as context.
+func (r *Service) logAt(level slog.Level, msg string, args ...any) {
+	if r.Logger == nil {
+		return
+	}
+	r.Logger.Log(context.Background(), level, msg, append([]any{"service", r.Filename}, args...)...)
+}
+
+// logRetry logs a write that is about to be retried.
+func (r *Service) logRetry(attempt int, err error, backoff time.Duration) {
+	r.logWarn("retrying write", "attempt", attempt, "backoff", backoff, "error", err)
+}
+
+// mkdirAll ensures Dir exists, logging when it had to be created.
+func (r *Service) mkdirAll() error {
+	return r.mkdir(r.Dir)
+}
+
+// mkdir ensures dir exists, logging when it had to be created.
+func (r *Service) mkdir(dir string) error {
+	created := false
+	if r.Logger != nil {
+		_, err := r.fs().Stat(dir)
+		created = errors.Is(err, os.ErrNotExist)
+	}
+	if err := r.fs().MkdirAll(dir, r.DirMode()); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+	if created {
+		r.logInfo("created directory", "dir", dir)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ManifestName is the file name of the manifest kept in Dir.
+const ManifestName = "manifest.json"
+
+// Stage is a step in the delivery pipeline of a finalized file.
+type Stage string
+
+const (
+	StageCreated      Stage = "created"      // EnsureFile created it, with only the header
+	StageFinalized    Stage = "finalized"    // the period is over, no more rows
+	StageCompressed   Stage = "compressed"   // a compressed copy was produced
+	StageUploaded     Stage = "uploaded"     // the file reached remote storage
+	StageAcknowledged Stage = "acknowledged" // downstream confirmed it
+)
+
+// AckSuffix is appended to a file name to form its acknowledgement marker.
+// Downstream consumers can create e.g. "booking_record_2025_08_26.csv.ack" in
+// Dir instead of calling Acknowledge.
+const AckSuffix = ".ack"
+
+// ManifestEntry tracks one finalized file, or one created by EnsureFile.
+type ManifestEntry struct {
+	File   string              `json:"file"`   // base name within Dir
+	Period string              `json:"period"` // rotation suffix, e.g., "2025_08_26"
+	Stages map[Stage]time.Time `json:"stages"` // when each stage was reached
+
+	// Rows, Bytes and Checksum describe the file when it was finalized: its
+	// data rows, its size on disk and "sha256:" followed by the hex SHA-256 of
+	// its content on disk.
+	Rows     int64  `json:"rows,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+
+	// Stats are the period's totals, see SummaryOptions.StatsFile.
+	Stats *PeriodStats `json:"stats,omitempty"`
+}
+
+// Reached reports whether the file reached the given stage.
+func (e *ManifestEntry) Reached(stage Stage) bool {
+	_, ok := e.Stages[stage]
+	return ok
+}
+
+// Manifest is the list of finalized files in a directory and their delivery
+// progress, persisted as JSON. Updates rewrite the file atomically.
+type Manifest struct {
+	fs   FS
+	path string
+
+	mu      sync.Mutex
+	entries []*ManifestEntry
+}
+
+// OpenManifest loads the manifest at path, or returns an empty one if the file
+// doesn't exist yet.
+func OpenManifest(path string) (*Manifest, error) {
+	return openManifest(OSFS{}, path)
+}
+
+func openManifest(fsys FS, path string) (*Manifest, error) {
+	m := &Manifest{fs: fsys, path: path}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// load re-reads the manifest file. The caller must hold m.mu or own m.
+func (m *Manifest) load() error {
+	data, err := readFile(m.fs, m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		m.entries = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest %q: %w", m.path, err)
+	}
+	var entries []*ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse manifest %q: %w", m.path, err)
+	}
+	m.entries = entries
+	return nil
+}
+
+// save writes the manifest through a temporary file and a rename, so readers
+// never see a partial manifest. The caller must hold m.mu.
+func (m *Manifest) save() error {
+	data, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := replaceFile(m.fs, m.path, data); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// update reloads the manifest, applies fn to the entry of file (creating it)
+// and saves the result. Reloading first keeps changes made by other processes.
+func (m *Manifest) update(file, period string, fn func(e *ManifestEntry)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(m.entries, func(e *ManifestEntry) bool { return e.File == file })
+	if i < 0 {
+		m.entries = append(m.entries, &ManifestEntry{File: file, Period: period, Stages: map[Stage]time.Time{}})
+		i = len(m.entries) - 1
+	}
+	e := m.entries[i]
+	if e.Stages == nil {
+		e.Stages = map[Stage]time.Time{}
+	}
+	fn(e)
+	return m.save()
+}
+
+// Mark records that file reached stage now. Stages already reached keep their
+// original time.
+func (m *Manifest) Mark(file string, stage Stage) error {
+	return m.update(file, "", func(e *ManifestEntry) {
+		if _, ok := e.Stages[stage]; !ok {
+			e.Stages[stage] = time.Now()
+		}
+	})
+}
+
+// Entries returns a copy of all entries in manifest order.
+func (m *Manifest) Entries() ([]ManifestEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	entries := make([]ManifestEntry, len(m.entries))
+	for i, e := range m.entries {
+		entries[i] = *e
+		entries[i].Stages = make(map[Stage]time.Time, len(e.Stages))
+		for k, v := range e.Stages {
+			entries[i].Stages[k] = v
+		}
+	}
+	return entries, nil
+}
+
+// manifest returns the manifest of Dir, opening it on first use.
+func (r *Service) manifest() (*Manifest, error) {
+	path := filepath.Join(r.Dir, ManifestName)
+	if r.manifestFile != nil && r.manifestFile.path == path {
+		return r.manifestFile, nil
+	}
+	m, err := openManifest(r.fs(), path)
+	if err != nil {
+		return nil, err
+	}
+	r.manifestFile = m
+	return m, nil
+}
+
+// finalize adds a closed period's file to the manifest. The file is read in
+// the background for its row count and checksum, so the first write of the
+// next period doesn't wait; the entry appears once it is complete.
+func (r *Service) finalize(path, period string) {
+	m, err := r.manifest()
+	if err != nil {
+		r.logError("failed to update manifest", "path", path, "error", err)
+		return
+	}
+	finalized := r.clock()
+
+	r.background.Add(1)
+	go func() {
+		defer r.background.Done()
+		rows, size, checksum, err := r.fileStats(path)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil // Only written to Sinks
+		}
+		if err == nil {
+			err = m.update(filepath.Base(path), period, func(e *ManifestEntry) {
+				e.Period = period
+				e.Rows, e.Bytes, e.Checksum = rows, size, checksum
+				e.Stages[StageFinalized] = finalized
+			})
+		}
+		if err != nil {
+			r.logError("failed to update manifest", "path", path, "error", err)
+		}
+	}()
+}
+
+// fileStats reads the file at path once, counting its data rows and hashing
+// its content on disk.
+func (r *Service) fileStats(path string) (rows, size int64, checksum string, err error) {
+	f, err := r.fs().Open(path)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	raw := &countingReader{r: io.TeeReader(f, h)}
+	rd, release, err := r.plainReader(raw)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	defer release()
+	cr := r.csvReader(rd)
+	cr.ReuseRecord = true
+	for {
+		if _, err := cr.Read(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return 0, 0, "", fmt.Errorf("failed to read CSV file %q: %w", path, err)
+		}
+		rows++
+	}
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return 0, 0, "", fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	return max(rows-1, 0), raw.n, "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// MarkDelivered records that the file at path reached a delivery stage, e.g.,
+// StageUploaded from an uploader's completion callback.
+func (r *Service) MarkDelivered(path string, stage Stage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, err := r.manifest()
+	if err != nil {
+		return err
+	}
+	return m.Mark(filepath.Base(path), stage)
+}
+
+// Acknowledge records that downstream confirmed receipt of the file at path.
+func (r *Service) Acknowledge(path string) error {
+	return r.MarkDelivered(path, StageAcknowledged)
+}
+
+// Undelivered returns the finalized files in the manifest that weren't
+// acknowledged yet. Acknowledgement marker files (see AckSuffix) found in Dir
+// are recorded in the manifest first.
+func (r *Service) Undelivered() ([]ManifestEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, err := r.manifest()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := m.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var undelivered []ManifestEntry
+	for _, e := range entries {
+		if e.Reached(StageAcknowledged) || !e.Reached(StageFinalized) {
+			continue
+		}
+		if _, err := r.fs().Stat(filepath.Join(r.Dir, e.File+AckSuffix)); err == nil {
+			if err := m.Mark(e.File, StageAcknowledged); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		undelivered = append(undelivered, e)
+	}
+	return undelivered, nil
+}
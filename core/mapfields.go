@@ -0,0 +1,74 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// mapFields converts the flat map payloads most callers already hold without
+// a JSON round trip, keeping strings exactly as given, e.g., with invalid
+// UTF-8 that JSON would replace. ok is false for other payloads.
+//
+// A url.Values key with a single value maps to that value, and one with
+// several to the list of them, written as a JSON array.
+func mapFields(data interface{}) (fields map[string]interface{}, ok bool, err error) {
+	switch m := data.(type) {
+	case map[string]string:
+		if m == nil {
+			return nil, true, nil // JSON null
+		}
+		fields = make(map[string]interface{}, len(m))
+		for key, val := range m {
+			fields[key] = val
+		}
+	case url.Values:
+		if m == nil {
+			return nil, true, nil
+		}
+		fields = make(map[string]interface{}, len(m))
+		for key, vals := range m {
+			if len(vals) == 1 {
+				fields[key] = vals[0]
+				continue
+			}
+			list := make([]interface{}, len(vals))
+			for i, val := range vals {
+				list[i] = val
+			}
+			fields[key] = list
+		}
+	case map[string]interface{}:
+		if m == nil {
+			return nil, true, nil
+		}
+		fields = make(map[string]interface{}, len(m))
+		for key, val := range m {
+			if fields[key], err = mapValue(val); err != nil {
+				return nil, true, fmt.Errorf("%w: failed to map field %q: %w", ErrMarshalPayload, key, err)
+			}
+		}
+	default:
+		return nil, false, nil
+	}
+	return fields, true, nil
+}
+
+// mapValue converts a value of a map[string]interface{} payload like fieldOf,
+// with the common numbers formatted directly unless a CellMarshaler may be
+// registered for them.
+func mapValue(val interface{}) (interface{}, error) {
+	if cellCount.Load() == 0 {
+		switch v := val.(type) {
+		case int:
+			return json.Number(strconv.Itoa(v)), nil
+		case int64:
+			return json.Number(strconv.FormatInt(v, 10)), nil
+		case float64:
+			s, err := formatFloat(v, 64)
+			return json.Number(s), err
+		}
+	}
+	return fieldOf(val)
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// CellMarshaler is implemented by types that render their own cell, e.g.,
+// a money type written as "IDR 15000.00". It takes precedence over the JSON
+// encoding fields are otherwise written with.
+type CellMarshaler interface {
+	MarshalCell() (string, error)
+}
+
+var cellMarshalerType = reflect.TypeFor[CellMarshaler]()
+
+// cellFuncs holds the functions of RegisterCellMarshaler by type, and
+// cellTypes caches the function found for each field type, nil if none.
+var (
+	cellMu    sync.Mutex
+	cellFuncs = map[reflect.Type]func(reflect.Value) (string, error){}
+	cellTypes sync.Map // reflect.Type -> func(reflect.Value) (string, error)
+	cellCount atomic.Int32
+)
+
+// RegisterCellMarshaler renders the payload fields of type T with fn, for
+// types that can't implement CellMarshaler, such as decimal.Decimal or
+// uuid.UUID from other modules. T may be an interface, e.g., proto.Message,
+// to render every type implementing it. Register types at init, before
+// recording; a later registration replaces an earlier one for the same T.
+//
+//	func init() {
+//		core.RegisterCellMarshaler(func(d decimal.Decimal) (string, error) {
+//			return d.StringFixed(2), nil
+//		})
+//	}
+func RegisterCellMarshaler[T any](fn func(v T) (string, error)) {
+	cellMu.Lock()
+	defer cellMu.Unlock()
+	cellFuncs[reflect.TypeFor[T]()] = func(v reflect.Value) (string, error) {
+		return fn(v.Interface().(T))
+	}
+	cellTypes.Clear()
+	cellCount.Store(int32(len(cellFuncs)))
+}
+
+// cellFunc returns how values of type t render their cell, or nil if they
+// use their JSON encoding. Registered functions win over MarshalCell, exact
+// types over interfaces.
+func cellFunc(t reflect.Type) func(reflect.Value) (string, error) {
+	if fn, ok := cellTypes.Load(t); ok {
+		return fn.(func(reflect.Value) (string, error))
+	}
+	cellMu.Lock()
+	fn := cellFuncs[t]
+	if fn == nil {
+		for it, f := range cellFuncs {
+			if it.Kind() == reflect.Interface && t.Implements(it) {
+				fn = f
+				break
+			}
+		}
+	}
+	cellMu.Unlock()
+	if fn == nil && t.Implements(cellMarshalerType) {
+		fn = func(v reflect.Value) (string, error) {
+			return v.Interface().(CellMarshaler).MarshalCell()
+		}
+	}
+	cellTypes.Store(t, fn)
+	return fn
+}
+
+// marshalCell renders v through its cell function, reporting false if it has
+// none. Methods on the pointer are found for addressable values.
+func marshalCell(v reflect.Value) (string, bool, error) {
+	fn := cellFunc(v.Type())
+	if fn == nil && v.CanAddr() {
+		if fn = cellFunc(v.Addr().Type()); fn != nil {
+			v = v.Addr()
+		}
+	}
+	if fn == nil {
+		return "", false, nil
+	}
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return "", false, nil // JSON null, unless a pointer method handles nil
+	}
+	s, err := fn(v)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to marshal %v cell: %w", v.Type(), err)
+	}
+	return s, true, nil
+}
+
+// marshalMapCells replaces the fields of a map payload whose values have a
+// cell function with their cell, after toMap encoded them as JSON.
+func marshalMapCells(v reflect.Value, fields map[string]interface{}) error {
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	elem := v.Type().Elem()
+	if elem.Kind() != reflect.Interface && cellFunc(elem) == nil && cellFunc(reflect.PointerTo(elem)) == nil {
+		return nil // No value of the map can have one
+	}
+	for iter := v.MapRange(); iter.Next(); {
+		val := iter.Value()
+		if val.Kind() == reflect.Interface {
+			if val.IsNil() {
+				continue
+			}
+			val = val.Elem()
+		}
+		if elem.Kind() == reflect.Interface && cellCount.Load() == 0 && !val.Type().Implements(cellMarshalerType) {
+			continue // The common map[string]interface{} without cell types
+		}
+		s, ok, err := marshalCell(val)
+		if err != nil {
+			return fmt.Errorf("failed to map field %q: %w", iter.Key().String(), err)
+		}
+		if ok {
+			fields[iter.Key().String()] = s
+		}
+	}
+	return nil
+}
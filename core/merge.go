@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// Merge writes the rows of every file of the rotation periods between from
+// and to, inclusive, to dst as one CSV under a single header, oldest first,
+// e.g., to roll the daily files of a month up into one. A zero from or to
+// leaves that end open. It returns the number of rows written.
+//
+// Files whose headers differ, e.g., after columns were appended, are merged
+// under the union of their headers in order of appearance, with empty cells
+// for the columns a file lacks. Labels renamed since are merged with the
+// current ones through HeaderAliases. A header naming a column twice can't be
+// remapped and fails with an error matching ErrHeaderMismatch. Without
+// files, only the service's header is written. Encrypted and re-encoded
+// files are decoded like OpenFile does.
+func (r *Service) Merge(from, to time.Time, dst io.Writer) (int, error) {
+	files, err := r.FilesBetween(DateRange{From: from, To: to})
+	if err != nil {
+		return 0, err
+	}
+
+	headers := make([][]string, len(files))
+	union := slices.Clone(r.HeaderRow())
+	if len(files) > 0 {
+		union = nil
+	}
+	for i, path := range files {
+		header, err := r.fileHeader(path)
+		if err != nil {
+			return 0, err
+		}
+		header = reader.AliasHeader(header, r.HeaderAliases)
+		for j, label := range header {
+			if slices.Contains(header[:j], label) {
+				return 0, fmt.Errorf("%w: %q names column %q twice", ErrHeaderMismatch, path, label)
+			}
+			if !slices.Contains(union, label) {
+				union = append(union, label)
+			}
+		}
+		headers[i] = header
+	}
+
+	cw := r.csvWriter(csv.NewWriter(dst))
+	if err := cw.Write(union); err != nil {
+		return 0, err
+	}
+	rows := 0
+	for i, path := range files {
+		n, err := r.mergeFile(cw, path, headers[i], union)
+		rows += n
+		if err != nil {
+			return rows, err
+		}
+	}
+	cw.Flush()
+	return rows, cw.Error()
+}
+
+// fileHeader returns the first row of the file at path, or nil if it is empty.
+func (r *Service) fileHeader(path string) ([]string, error) {
+	f, err := r.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := r.csvReader(f)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %q: %w", path, err)
+	}
+	return header, nil
+}
+
+// mergeFile writes the rows of the file at path, after its header, with the
+// cells moved from the file's columns to those of union.
+func (r *Service) mergeFile(cw *csv.Writer, path string, header, union []string) (int, error) {
+	f, err := r.OpenFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	cr := r.csvReader(f)
+	cr.ReuseRecord = true
+
+	index := make([]int, len(header))
+	for i, label := range header {
+		index[i] = slices.Index(union, label)
+	}
+	out := make([]string, len(union))
+	rows := 0
+	for first := true; ; first = false {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, fmt.Errorf("failed to read %q: %w", path, err)
+		}
+		if first {
+			continue // The header
+		}
+		clear(out)
+		for i, cell := range row {
+			if i < len(index) {
+				out[index[i]] = cell
+			}
+		}
+		if err := cw.Write(out); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import "time"
+
+// Metrics receives instrumentation events from a Service, so recording that
+// silently stalls or fails can be alerted on. Implementations must be safe for
+// concurrent use.
+type Metrics interface {
+	// ObserveWrite is called after a successful Record with the number of rows
+	// and CSV bytes written and the time the write took.
+	ObserveWrite(rows int, bytes int64, d time.Duration)
+
+	// ObserveError is called when a Record fails.
+	ObserveError(err error)
+
+	// ObserveRotation is called when the active file changes from one rotation
+	// period to the next.
+	ObserveRotation(oldPath, newPath string)
+}
+
+// observe reports the outcome of a Record to Metrics and tracks rotations.
+func (r *Service) observe(batches []*Batch, start time.Time, err error) {
+	if err != nil {
+		r.periodErrors++
+		r.stats.errors.Add(1)
+		if r.Metrics != nil {
+			r.Metrics.ObserveError(err)
+		}
+		return
+	}
+	if len(batches) == 0 {
+		return
+	}
+
+	if suffix := batches[0].Suffix; r.lastSuffix != suffix {
+		r.advance(suffix)
+	}
+	r.armWarmup(batches[0].Suffix)
+	r.armRotation(batches[0].Suffix)
+
+	rows, bytes := 0, int64(0)
+	for _, b := range batches {
+		if r.partitions == nil {
+			r.partitions = make(map[string]int)
+		}
+		r.partitions[b.Partition] += len(b.Rows)
+		rows += len(b.Rows)
+		bytes += b.bytes
+	}
+	r.usage += bytes
+	r.trackColumns(batches)
+	r.stats.rows.Add(int64(rows))
+	r.stats.bytes.Add(bytes)
+	r.stats.lastWrite.Store(r.clock().UnixNano())
+
+	if r.Metrics != nil {
+		r.Metrics.ObserveWrite(rows, bytes, time.Since(start))
+	}
+}
+
+// advance makes suffix the current period, rotating the files of the previous
+// one.
+func (r *Service) advance(suffix string) {
+	if r.lastSuffix != "" {
+		r.rotate(r.lastSuffix, suffix)
+		r.written = nil
+	}
+	r.lastSuffix = suffix
+	r.partitions = nil
+	r.usageKnown = false // Measured again, other processes may have written
+	r.periodErrors = 0
+	r.reserved = nil
+	r.rowCounts = nil
+}
+
+// RotateEvent describes a file closed by a rotation.
+type RotateEvent struct {
+	OldPath string // the closed file
+	NewPath string // the file of the new period, for the same partition
+
+	// Rows counts the rows this service wrote to OldPath. Rows written before
+	// a restart or by other processes aren't included.
+	Rows int
+}
+
+// rotate handles the end of the oldSuffix period for every file written in
+// it.
+func (r *Service) rotate(oldSuffix, newSuffix string) {
+	var opts SummaryOptions
+	if r.Summary != nil {
+		opts = r.summaryOptions()
+	}
+	for partition, rows := range r.partitions {
+		r.closeFile(r.path(oldSuffix, partition), r.path(newSuffix, partition), oldSuffix, rows, opts)
+	}
+}
+
+// closeFile handles the end of the file at oldPath of the period with the
+// given suffix, to which the service wrote rows, followed by newPath. opts
+// are the summaryOptions of the file.
+func (r *Service) closeFile(oldPath, newPath, suffix string, rows int, opts SummaryOptions) {
+	r.openFiles.close(oldPath)
+	r.logInfo("rotated file", "old_path", oldPath, "new_path", newPath, "rows", rows)
+	r.stats.rotations.Add(1)
+	if r.Metrics != nil {
+		r.Metrics.ObserveRotation(oldPath, newPath)
+	}
+	if r.TrackDelivery {
+		r.finalize(oldPath, suffix)
+	}
+	if r.Checksums {
+		r.writeChecksum(oldPath)
+	}
+	if r.OnRotate != nil {
+		r.OnRotate(RotateEvent{OldPath: oldPath, NewPath: newPath, Rows: rows})
+	}
+	if r.Summary != nil {
+		r.background.Add(1)
+		go func(path string, errCount int) {
+			defer r.background.Done()
+			r.summarize(opts, path, errCount)
+		}(oldPath, r.periodErrors)
+	}
+}
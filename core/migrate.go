@@ -0,0 +1,356 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// FileSchema describes how to read a CSV file: its columns, their types and
+// the version of the service's schema the file was written with. With
+// SchemaFiles, it is written next to every file, e.g.,
+// "booking_record_2025_08_26.csv.schema.json".
+type FileSchema struct {
+	// Version is 1 until the first AddColumn or RenameColumn, and increases
+	// with each of them.
+	Version int            `json:"version"`
+	Columns []SchemaColumn `json:"columns"`
+
+	// Migrations lists every change up to Version, oldest first, so a loader
+	// can map the columns of an older file to the current ones.
+	Migrations []Migration `json:"migrations,omitempty"`
+}
+
+// SchemaColumn is a column of a FileSchema, in header order.
+type SchemaColumn struct {
+	Key    string     `json:"key"`
+	Header string     `json:"header"`
+	Type   ColumnType `json:"type"`             // from Rules, TypeString if it has none
+	Layout string     `json:"layout,omitempty"` // of TypeTime columns
+
+	// Locale is the NumberLocale of TypeInt, TypeFloat and TypeDecimal columns,
+	// if any.
+	Locale *NumberLocale `json:"locale,omitempty"`
+}
+
+// MigrationOp is the kind of a schema change.
+type MigrationOp string
+
+const (
+	MigrationAddColumn    MigrationOp = "add_column"
+	MigrationRenameColumn MigrationOp = "rename_column"
+)
+
+// Migration is a schema change, made by AddColumn or RenameColumn.
+type Migration struct {
+	Version int         `json:"version"` // the version it introduced
+	Op      MigrationOp `json:"op"`
+	Column  string      `json:"column"`         // the added column, or the new key
+	From    string      `json:"from,omitempty"` // the old key of a renamed column
+	At      time.Time   `json:"at"`
+}
+
+// AddColumn appends a column to the schema and records the change in the
+// schema file (see SchemaPath), bumping its version. The header of the
+// current files is widened on their next write, padding their rows with
+// empty cells; files of closed periods keep their header and, with
+// SchemaFiles, the schema they were written with.
+//
+// Column is updated in place. Change the code setting it too, or use
+// DiscoverColumns, which loads the persisted columns on the next run.
+func (r *Service) AddColumn(spec ColumnSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.loadColumns(); err != nil {
+		return err
+	}
+	if slices.Contains(r.Column, spec.Key) {
+		return fmt.Errorf("column %q already exists", spec.Key)
+	}
+	column := append(slices.Clip(r.Column), spec.Key)
+	if err := ValidateColumns(column); err != nil {
+		return err
+	}
+	headers := r.Headers
+	if len(headers) > 0 || (spec.Header != "" && spec.Header != spec.Key) {
+		if len(headers) == 0 {
+			headers = r.Column // Labeled by their key
+		}
+		label := spec.Header
+		if label == "" {
+			label = spec.Key
+		}
+		headers = append(slices.Clip(headers), label)
+	}
+
+	if err := r.migrate(Migration{Op: MigrationAddColumn, Column: spec.Key}, column); err != nil {
+		return err
+	}
+	r.Column, r.Headers = column, headers
+	r.logInfo("added column", "column", spec.Key, "version", r.schema.Version)
+	return nil
+}
+
+// RenameColumn renames the payload key of a column, along with its header
+// label unless Headers gives it another one, and records the change in the
+// schema file (see SchemaPath), bumping its version. The header of the
+// current files is rewritten right away; files of closed periods keep the old
+// name. Rules and RequiredColumns follow the column.
+//
+// Column is updated in place. Change the code setting it too, or use
+// DiscoverColumns, which loads the persisted columns on the next run.
+func (r *Service) RenameColumn(from, to string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.loadColumns(); err != nil {
+		return err
+	}
+	i := slices.Index(r.Column, from)
+	if i < 0 {
+		return fmt.Errorf("no column %q", from)
+	}
+	if slices.Contains(r.Column, to) {
+		return fmt.Errorf("column %q already exists", to)
+	}
+	column := slices.Clone(r.Column)
+	column[i] = to
+	if err := ValidateColumns(column); err != nil {
+		return err
+	}
+	headers := r.Headers
+	if i < len(headers) && headers[i] == from {
+		headers = slices.Clone(headers)
+		headers[i] = to
+	}
+
+	var relabeled []string
+	if oldLabel, newLabel := r.label(from), labelOf(column, headers, to); oldLabel != newLabel {
+		var err error
+		if relabeled, err = r.relabelCurrent(oldLabel, newLabel); err != nil {
+			return err
+		}
+	}
+	if err := r.migrate(Migration{Op: MigrationRenameColumn, Column: to, From: from}, column); err != nil {
+		return err
+	}
+
+	r.Column, r.Headers = column, headers
+	if rule, ok := r.Rules[from]; ok {
+		rules := maps.Clone(r.Rules)
+		delete(rules, from)
+		rules[to] = rule
+		r.Rules = rules
+	}
+	if j := slices.Index(r.RequiredColumns, from); j >= 0 {
+		r.RequiredColumns = slices.Clone(r.RequiredColumns)
+		r.RequiredColumns[j] = to
+	}
+	if r.SchemaFiles {
+		for _, path := range relabeled {
+			r.writeFileSchema(path)
+		}
+	}
+	r.logInfo("renamed column", "from", from, "to", to, "version", r.schema.Version)
+	return nil
+}
+
+// Schema returns the current schema of the service's files.
+func (r *Service) Schema() (FileSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.loadColumns(); err != nil {
+		return FileSchema{}, err
+	}
+	return r.fileSchema()
+}
+
+// ReadSchema returns the schema written next to the CSV file at path by
+// SchemaFiles.
+func (r *Service) ReadSchema(path string) (FileSchema, error) {
+	var s FileSchema
+	b, err := readFile(r.fs(), path+SchemaSuffix)
+	if err != nil {
+		return s, fmt.Errorf("failed to read schema of %q: %w", path, err)
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("failed to parse schema of %q: %w", path, err)
+	}
+	return s, nil
+}
+
+// loadColumns sets Column from the schema file, like the first write does,
+// if DiscoverColumns is set and Column is still nil.
+func (r *Service) loadColumns() error {
+	if !r.DiscoverColumns || len(r.Column) > 0 {
+		return nil
+	}
+	column, err := r.loadSchema()
+	if err != nil {
+		return err
+	}
+	r.Column = column
+	return nil
+}
+
+// migrate records m in the schema file, persisted with the new columns.
+func (r *Service) migrate(m Migration, column []string) error {
+	s, err := r.registry()
+	if err != nil {
+		return err
+	}
+	m.Version = max(s.Version, 1) + 1
+	m.At = r.clock()
+	next := &schemaFile{
+		Columns:    column,
+		Version:    m.Version,
+		Migrations: append(slices.Clip(s.Migrations), m),
+	}
+	return r.writeRegistry(next)
+}
+
+// relabelCurrent renames a header label in the files of the current period
+// and returns those it rewrote.
+func (r *Service) relabelCurrent(oldLabel, newLabel string) ([]string, error) {
+	suffix := r.lastSuffix
+	if suffix == "" {
+		now, err := r.Now()
+		if err != nil {
+			return nil, err
+		}
+		if suffix, err = r.Suffix(now); err != nil {
+			return nil, err
+		}
+	}
+	if r.entry != nil {
+		r.entry.mu.Lock()
+		defer r.entry.mu.Unlock()
+	}
+
+	partitions := []string{""}
+	for partition := range r.partitions {
+		if partition != "" {
+			partitions = append(partitions, partition)
+		}
+	}
+	var relabeled []string
+	for _, partition := range partitions {
+		path := r.path(suffix, partition)
+		ok, err := r.relabel(path, oldLabel, newLabel)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			relabeled = append(relabeled, path)
+		}
+	}
+	return relabeled, nil
+}
+
+// relabel rewrites the file at path with oldLabel renamed to newLabel in its
+// header, reporting whether it did. Missing files and files without the label
+// are left alone.
+func (r *Service) relabel(path, oldLabel, newLabel string) (bool, error) {
+	release, err := r.hold(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	rows, err := r.readRows(path)
+	if err != nil || len(rows) == 0 {
+		return false, err
+	}
+	i := slices.Index(rows[0], oldLabel)
+	if i < 0 {
+		return false, nil
+	}
+	rows[0][i] = newLabel
+	if err := r.rewrite(path, rows[0], rows[1:]); err != nil {
+		return false, fmt.Errorf("failed to rename column of %q: %w", path, err)
+	}
+	r.logInfo("renamed CSV header column", "path", path, "from", oldLabel, "to", newLabel)
+	return true, nil
+}
+
+// labelOf returns the header label of key in column, labeled by headers.
+func labelOf(column, headers []string, key string) string {
+	if i := slices.Index(column, key); i >= 0 && i < len(headers) {
+		return headers[i]
+	}
+	return key
+}
+
+// fileSchema returns the schema of files written with the current columns.
+func (r *Service) fileSchema() (FileSchema, error) {
+	s, err := r.registry()
+	if err != nil {
+		return FileSchema{}, err
+	}
+	out := FileSchema{Version: max(s.Version, 1), Migrations: s.Migrations}
+	header := r.HeaderRow()
+	for i, key := range r.Column {
+		col := SchemaColumn{Key: key, Header: key}
+		if i < len(header) {
+			col.Header = header[i]
+		}
+		if rule, ok := r.Rules[key]; ok {
+			col.Type = rule.Type
+			if rule.Type == TypeTime {
+				col.Layout = rule.Layout
+				if col.Layout == "" {
+					col.Layout = time.RFC3339
+				}
+			}
+			if locale := r.numberLocale(key); rule.Type.numeric() && locale != (NumberLocale{}) {
+				col.Locale = &locale
+			}
+		}
+		out.Columns = append(out.Columns, col)
+	}
+	return out, nil
+}
+
+// writeFileSchema writes the schema sidecar of the file at path, unless it
+// was already written for the current version. Failures are logged rather
+// than returned, since the rows are already written; the sidecar is retried
+// on the next write.
+func (r *Service) writeFileSchema(path string) {
+	s, err := r.registry()
+	if err == nil && r.schemas[path] == max(s.Version, 1) {
+		return
+	}
+	var schema FileSchema
+	var data []byte
+	if err == nil {
+		schema, err = r.fileSchema()
+	}
+	if err == nil {
+		data, err = json.MarshalIndent(schema, "", "  ")
+	}
+	if err == nil {
+		err = replaceFile(r.fs(), path+SchemaSuffix, append(data, '\n'))
+	}
+	if err != nil {
+		r.logError("failed to write schema", "path", path+SchemaSuffix, "error", err)
+		return
+	}
+	if r.schemas == nil {
+		r.schemas = make(map[string]int)
+	}
+	r.schemas[path] = schema.Version
+}
+
+// migrated reports whether the schema was changed by AddColumn or
+// RenameColumn, so the header of the current files may need to be widened.
+func (r *Service) migrated() bool {
+	return r.schema != nil && len(r.schema.Migrations) > 0
+}
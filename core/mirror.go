@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Extension returns the file extension of the format, ".csv" or ".jsonl".
+func (f Format) Extension() string {
+	if f == FormatNDJSON {
+		return ".jsonl"
+	}
+	return ".csv"
+}
+
+// MirrorPath returns the path of the file the batch is mirrored to in format,
+// the CSV file's path with the format's extension, e.g.,
+// "booking_record_2025_08_26.jsonl".
+func (r *Service) MirrorPath(b *Batch, format Format) string {
+	return mirrorPath(r.BatchPath(b), format)
+}
+
+// mirrorPath returns the path of the mirror in format of the CSV file at path.
+func mirrorPath(path string, format Format) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + format.Extension()
+}
+
+// validateMirrors checks the formats of Mirrors.
+func (r *Service) validateMirrors() error {
+	for i, f := range r.Mirrors {
+		if f != FormatNDJSON {
+			return fmt.Errorf("unsupported mirror format %v", f)
+		}
+		if slices.Contains(r.Mirrors[:i], f) {
+			return fmt.Errorf("mirror format %v is declared twice", f)
+		}
+	}
+	if len(r.Mirrors) > 0 && (r.EncryptionKey != nil || r.Compression != CompressionNone || r.Encoding != nil) {
+		return errors.New("mirrors can't be combined with EncryptionKey, Compression or Encoding")
+	}
+	return nil
+}
+
+// writeMirrors appends the batch to the mirror files of the CSV file at path.
+// The caller must hold the entry lock.
+func (r *Service) writeMirrors(path string, b *Batch) error {
+	for _, f := range r.Mirrors {
+		mpath := mirrorPath(path, f)
+		if err := r.openMode(mpath); err != nil {
+			return &WriteError{Path: mpath, Rows: len(b.Rows), Err: err}
+		}
+		n, err := r.appendNDJSON(mpath, b)
+		b.bytes += n
+		if err != nil {
+			return &WriteError{Path: mpath, Rows: len(b.Rows), Err: err}
+		}
+	}
+	return nil
+}
+
+// appendNDJSON appends the rows of the batch to the file at path as one JSON
+// object per line, keyed by column.
+func (r *Service) appendNDJSON(path string, b *Batch) (int64, error) {
+	var buf bytes.Buffer
+	for _, row := range b.Rows {
+		buf.WriteByte('{')
+		for i, col := range b.Column {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(col)
+			buf.Write(key)
+			buf.WriteByte(':')
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			r.writeJSONCell(&buf, col, cell)
+		}
+		buf.WriteString("}\n")
+	}
+
+	file, err := r.fs().OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, r.FileMode())
+	if err != nil {
+		return 0, fmt.Errorf("failed to open/create mirror file %q: %w", path, err)
+	}
+	defer file.Close()
+	if r.FileLock {
+		if err := lockFile(file); err != nil {
+			return 0, fmt.Errorf("failed to lock mirror file %q: %w", path, err)
+		}
+		defer unlockFile(file)
+	}
+	n, err := file.Write(buf.Bytes())
+	if err != nil {
+		return int64(n), fmt.Errorf("failed to write mirror file %q: %w", path, err)
+	}
+	return int64(n), nil
+}
+
+// writeJSONCell writes the cell of col as a JSON value: a number, without
+// the formatting of its NumberLocale, or a bool for columns given that type by
+// Rules, null for their empty cells, and a string otherwise.
+func (r *Service) writeJSONCell(buf *bytes.Buffer, col, cell string) {
+	switch r.Rules[col].Type {
+	case TypeInt, TypeFloat, TypeDecimal:
+		if cell == "" {
+			buf.WriteString("null")
+			return
+		}
+		num := r.numberLocale(col).Parse(cell)
+		if _, err := strconv.ParseFloat(num, 64); err == nil && json.Valid([]byte(num)) {
+			buf.WriteString(num)
+			return
+		}
+	case TypeBool:
+		if cell == "" {
+			buf.WriteString("null")
+			return
+		}
+		if v, err := strconv.ParseBool(cell); err == nil {
+			buf.WriteString(strconv.FormatBool(v))
+			return
+		}
+	}
+	s, _ := json.Marshal(cell)
+	buf.Write(s)
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Namer names the CSV file of each rotation period. Set Service.Namer for
+// schemes such as date-first directories or names including the host or
+// shard; the default is a SuffixNamer with the layout of RecordType.
+type Namer interface {
+	// Name returns the path of the file holding the period that starts at t,
+	// relative to Dir and with forward slashes, e.g., "2025/08/26/record.csv".
+	// base is the Filename, followed by "_" and the partition for the files
+	// of a partition. The service appends the Compression extension.
+	Name(base string, t time.Time) string
+}
+
+// NamerFunc adapts a function to a Namer.
+type NamerFunc func(base string, t time.Time) string
+
+func (f NamerFunc) Name(base string, t time.Time) string { return f(base, t) }
+
+// NameParser is implemented by Namers whose names can be read back. The
+// service lists its files through it, for Files, FilesBetween, Query, the
+// disk quota, Verify and FallbackDir; with a Namer that isn't a NameParser,
+// those fail.
+type NameParser interface {
+	// Parse returns the base and the period of a name returned by Name, or
+	// false for any other file. Only the date and clock of t are used, its
+	// location doesn't matter.
+	Parse(name string) (base string, t time.Time, ok bool)
+}
+
+// SuffixNamer names files after the base and the period formatted with
+// Layout, e.g., "booking_record_2025_08_26.csv" for the daily layout
+// "2006_01_02". Layout must format every period to the same width.
+type SuffixNamer struct {
+	Layout string
+}
+
+var _ NameParser = SuffixNamer{}
+
+func (n SuffixNamer) Name(base string, t time.Time) string {
+	return base + "_" + t.Format(n.Layout) + ".csv"
+}
+
+func (n SuffixNamer) Parse(name string) (string, time.Time, bool) {
+	stem, ok := strings.CutSuffix(name, ".csv")
+	width := len(time.Time{}.Format(n.Layout))
+	if !ok || strings.Contains(stem, "/") || len(stem) <= width || stem[len(stem)-width-1] != '_' {
+		return "", time.Time{}, false
+	}
+	t, err := time.Parse(n.Layout, stem[len(stem)-width:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return stem[:len(stem)-width-1], t, true
+}
+
+// LayoutNamer is a time layout in which "{base}" stands for the base, e.g.,
+// "2006/01/02/{base}.csv" for date-first directories. Every element of the
+// layout must be zero-padded, such as 01 rather than 1, so names can be
+// parsed back.
+type LayoutNamer string
+
+var _ NameParser = LayoutNamer("")
+
+// baseVerb is the placeholder of the base in a LayoutNamer.
+const baseVerb = "{base}"
+
+func (n LayoutNamer) Name(base string, t time.Time) string {
+	before, after, _ := strings.Cut(string(n), baseVerb)
+	return t.Format(before) + base + t.Format(after)
+}
+
+func (n LayoutNamer) Parse(name string) (string, time.Time, bool) {
+	before, after, found := strings.Cut(string(n), baseVerb)
+	if !found {
+		return "", time.Time{}, false
+	}
+	// Zero-padded layouts format every time to the same width
+	var ref time.Time
+	head, tail := len(ref.Format(before)), len(ref.Format(after))
+	if len(name) <= head+tail {
+		return "", time.Time{}, false
+	}
+	// A separator that can't appear in either layout
+	t, err := time.Parse(before+"\x00"+after, name[:head]+"\x00"+name[len(name)-tail:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return name[head : len(name)-tail], t, true
+}
+
+// namer returns Namer, or the default SuffixNamer.
+func (r *Service) namer() Namer {
+	if r.Namer != nil {
+		return r.Namer
+	}
+	return SuffixNamer{Layout: suffixLayouts[r.RecordType]}
+}
+
+// baseName returns Filename, with its Environment prefix, as resolved by the
+// collision policy.
+func (r *Service) baseName() string {
+	if r.name != "" {
+		return r.name
+	}
+	return r.filename()
+}
+
+// filename returns Filename with the Environment prefix, e.g.,
+// "prod_booking_record".
+func (r *Service) filename() string {
+	if r.Environment == "" {
+		return r.Filename
+	}
+	return r.Environment + "_" + r.Filename
+}
+
+// nameIn returns the path in dir of the file of base for the period with the
+// given suffix.
+func (r *Service) nameIn(dir, base, suffix string) string {
+	loc := time.UTC
+	if now, err := r.Now(); err == nil {
+		loc = now.Location()
+	}
+	t, _ := time.ParseInLocation(suffixLayouts[r.RecordType], suffix, loc)
+	name := r.namer().Name(base, t) + r.Compression.Extension()
+	if r.DirLayout != "" {
+		name = t.Format(r.DirLayout) + "/" + name
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// parseName returns the rotation suffix and partition of the service's file
+// at path in dir, or false for any other file.
+func (r *Service) parseName(dir, path string) (suffix, partition string, ok bool) {
+	return r.parseNamed(dir, r.baseName(), path)
+}
+
+// parseNamed is like parseName for the files of base, see Projection.
+func (r *Service) parseNamed(dir, base, path string) (suffix, partition string, ok bool) {
+	parser, isParser := r.namer().(NameParser)
+	rel, err := filepath.Rel(dir, path)
+	if !isParser || err != nil {
+		return "", "", false
+	}
+	name, hasExt := strings.CutSuffix(filepath.ToSlash(rel), r.Compression.Extension())
+	if !hasExt {
+		return "", "", false
+	}
+	if r.DirLayout != "" {
+		// Zero-padded, like the layout of a LayoutNamer
+		width := len(time.Time{}.Format(r.DirLayout))
+		if len(name) <= width || name[width] != '/' {
+			return "", "", false
+		}
+		if _, err := time.Parse(r.DirLayout, name[:width]); err != nil {
+			return "", "", false
+		}
+		name = name[width+1:]
+	}
+	named, t, ok := parser.Parse(name)
+	if !ok {
+		return "", "", false
+	}
+	if named != base {
+		partition, ok = strings.CutPrefix(named, base+"_")
+		if !ok {
+			return "", "", false
+		}
+	}
+	suffix, err = r.Suffix(t)
+	return suffix, partition, err == nil
+}
+
+// listFiles returns the service's files in dir, sorted, or their sidecars
+// with the given suffix if it isn't empty.
+func (r *Service) listFiles(dir, sidecar string) ([]string, error) {
+	return r.listNamed(dir, r.baseName(), sidecar)
+}
+
+// listNamed is like listFiles for the files of base, see Projection.
+func (r *Service) listNamed(dir, base, sidecar string) ([]string, error) {
+	if r.Namer == nil && r.DirLayout == "" {
+		pattern := filepath.Join(dir, base+"_*.csv"+r.Compression.Extension()) + sidecar
+		files, err := glob(r.fs(), pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files matching %q: %w", pattern, err)
+		}
+		return files, nil
+	}
+	if _, ok := r.namer().(NameParser); !ok {
+		return nil, fmt.Errorf("can't list files named by %T, it doesn't implement NameParser", r.Namer)
+	}
+
+	var files []string
+	err := walkFiles(r.fs(), dir, func(path string) {
+		if file, ok := strings.CutSuffix(path, sidecar); ok {
+			if _, _, ok := r.parseNamed(dir, base, file); ok {
+				files = append(files, path)
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in %q: %w", dir, err)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// walkFiles calls fn with the path of every file in dir and its
+// subdirectories. A missing dir has no files.
+func walkFiles(fsys FS, dir string, fn func(path string)) error {
+	entries, err := fsys.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if err := walkFiles(fsys, path, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		fn(path)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization cleans up the string fields of a column before they are
+// written. The steps run in field order.
+type Normalization struct {
+	// NFC converts the text to Unicode normalization form C, so the same
+	// characters typed differently, e.g., "é" as e and a combining accent,
+	// compare and sort alike.
+	NFC bool `json:"nfc,omitempty"`
+
+	// CollapseNewlines replaces every run of carriage returns and line feeds
+	// with a single space, for consumers that split lines without honoring
+	// CSV quotes.
+	CollapseNewlines bool `json:"collapse_newlines,omitempty"`
+
+	// Trim removes leading and trailing white space.
+	Trim bool `json:"trim,omitempty"`
+
+	// Lower converts the text to lower case, e.g., for emails.
+	Lower bool `json:"lower,omitempty"`
+}
+
+// apply returns s normalized.
+func (n Normalization) apply(s string) string {
+	if n.NFC {
+		s = norm.NFC.String(s)
+	}
+	if n.CollapseNewlines && strings.ContainsAny(s, "\r\n") {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] != '\r' && s[i] != '\n' {
+				b.WriteByte(s[i])
+			} else if i == 0 || s[i-1] != '\r' && s[i-1] != '\n' {
+				b.WriteByte(' ')
+			}
+		}
+		s = b.String()
+	}
+	if n.Trim {
+		s = strings.TrimSpace(s)
+	}
+	if n.Lower {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// normalization returns how the column is normalized.
+func (r *Service) normalization(col string) Normalization {
+	if n, ok := r.NormalizeColumns[col]; ok {
+		return n
+	}
+	return r.Normalize
+}
+
+// normalize applies Normalize and NormalizeColumns to the string fields of
+// the columns.
+func (r *Service) normalize(column []string, fields map[string]interface{}) {
+	for _, col := range column {
+		if s, ok := fields[col].(string); ok {
+			fields[col] = r.normalization(col).apply(s)
+		}
+	}
+}
+
+// normalizing reports whether any column is normalized.
+func (r *Service) normalizing() bool {
+	return r.Normalize != Normalization{} || len(r.NormalizeColumns) > 0
+}
+
+// validateNormalize checks that NormalizeColumns are for columns of the
+// service.
+func (r *Service) validateNormalize() error {
+	for key := range r.NormalizeColumns {
+		if !slices.Contains(r.Column, key) && !r.DiscoverColumns {
+			return fmt.Errorf("normalization for column %q, which is not one of the columns", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package core
+
+import "strings"
+
+// NumberLocale controls how the cells of TypeInt, TypeFloat and TypeDecimal
+// columns are written, e.g., for spreadsheets set to a European locale. The
+// zero value writes them as Go and JSON do, e.g., "1234.5".
+type NumberLocale struct {
+	// DecimalComma writes a comma as the decimal separator, e.g., "1234,5".
+	DecimalComma bool `json:"decimal_comma,omitempty"`
+
+	// Grouping separates the thousands of the integer part, with a point
+	// under DecimalComma and a comma otherwise, e.g., "1.234,5" or "1,234.5".
+	Grouping bool `json:"grouping,omitempty"`
+}
+
+// separators returns the decimal and thousands separators of the locale.
+func (l NumberLocale) separators() (decimal, group byte) {
+	if l.DecimalComma {
+		return ',', '.'
+	}
+	return '.', ','
+}
+
+// Format writes the number cell, e.g., "-1234.5" or "1.5e+21", in the
+// locale. Other cells are returned as is.
+func (l NumberLocale) Format(cell string) string {
+	if l == (NumberLocale{}) || !isNumberCell(cell) {
+		return cell
+	}
+	decimal, group := l.separators()
+	mantissa, exp, _ := strings.Cut(cell, "e")
+	whole, frac, hasFrac := strings.Cut(mantissa, ".")
+
+	var b strings.Builder
+	if whole[0] == '-' || whole[0] == '+' {
+		b.WriteByte(whole[0])
+		whole = whole[1:]
+	}
+	for i := 0; i < len(whole); i++ {
+		if l.Grouping && i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(group)
+		}
+		b.WriteByte(whole[i])
+	}
+	if hasFrac {
+		b.WriteByte(decimal)
+		b.WriteString(frac)
+	}
+	if exp != "" {
+		b.WriteByte('e')
+		b.WriteString(exp)
+	}
+	return b.String()
+}
+
+// Parse returns the number cell written by Format in the locale as Go and
+// JSON write it, e.g., "1234.5" for "1.234,5", so files can be read back.
+// Cells that aren't numbers in the locale are returned as is.
+func (l NumberLocale) Parse(cell string) string {
+	if l == (NumberLocale{}) {
+		return cell
+	}
+	decimal, group := l.separators()
+	plain := make([]byte, 0, len(cell))
+	for i := 0; i < len(cell); i++ {
+		switch c := cell[i]; c {
+		case group:
+			if !l.Grouping {
+				return cell
+			}
+		case decimal:
+			plain = append(plain, '.')
+		case '.':
+			return cell // Only the separators of the locale are points
+		default:
+			plain = append(plain, c)
+		}
+	}
+	if !isNumberCell(string(plain)) {
+		return cell
+	}
+	return string(plain)
+}
+
+// isNumberCell reports whether cell is a number as TypeInt, TypeFloat and
+// TypeDecimal rules write it: an optional sign, digits, an optional fraction and an
+// optional exponent.
+func isNumberCell(cell string) bool {
+	mantissa, exp, hasExp := strings.Cut(cell, "e")
+	if hasExp {
+		exp = trimSign(exp)
+		if exp == "" || strings.Trim(exp, "0123456789") != "" {
+			return false
+		}
+	}
+	whole, frac, hasFrac := strings.Cut(trimSign(mantissa), ".")
+	return whole != "" && strings.Trim(whole, "0123456789") == "" &&
+		(!hasFrac || frac != "" && strings.Trim(frac, "0123456789") == "")
+}
+
+// trimSign removes a leading sign from s.
+func trimSign(s string) string {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		return s[1:]
+	}
+	return s
+}
+
+// numberLocale returns the locale of the cells of col: the Locale of its rule
+// or else NumberLocale.
+func (r *Service) numberLocale(col string) NumberLocale {
+	if rule, ok := r.Rules[col]; ok && rule.Locale != nil {
+		return *rule.Locale
+	}
+	return r.NumberLocale
+}
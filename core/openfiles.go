@@ -0,0 +1,147 @@
+package core
+
+import (
+	"container/list"
+	"os"
+	"sync"
+)
+
+// openFiles keeps the CSV files left open between writes for MaxOpenFiles,
+// most recently used first. A file is taken out while it is written, so two
+// writes never share a handle.
+type openFiles struct {
+	mu     sync.Mutex
+	order  *list.List // of *openFile
+	byPath map[string]*list.Element
+}
+
+// openFile is a handle kept by openFiles.
+type openFile struct {
+	path string
+	file File
+}
+
+// take removes the handle of path from the cache and returns it, or nil if
+// there is none.
+func (o *openFiles) take(path string) File {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.byPath[path]
+	if !ok {
+		return nil
+	}
+	o.order.Remove(e)
+	delete(o.byPath, path)
+	return e.Value.(*openFile).file
+}
+
+// put returns the handle of path to the cache and closes the least recently
+// used handles beyond limit.
+func (o *openFiles) put(path string, file File, limit int) {
+	o.mu.Lock()
+	if o.order == nil {
+		o.order, o.byPath = list.New(), make(map[string]*list.Element)
+	}
+	var evicted []File
+	if e, ok := o.byPath[path]; ok { // Opened by a concurrent write meanwhile
+		o.order.Remove(e)
+		evicted = append(evicted, e.Value.(*openFile).file)
+	}
+	o.byPath[path] = o.order.PushFront(&openFile{path: path, file: file})
+	for o.order.Len() > limit {
+		f := o.order.Remove(o.order.Back()).(*openFile)
+		delete(o.byPath, f.path)
+		evicted = append(evicted, f.file)
+	}
+	o.mu.Unlock()
+	for _, f := range evicted {
+		f.Close()
+	}
+}
+
+// has reports whether the handle of path is open.
+func (o *openFiles) has(path string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.byPath[path]
+	return ok
+}
+
+// close closes the handle of path, if it is open, e.g., before the file is
+// replaced.
+func (o *openFiles) close(path string) {
+	if f := o.take(path); f != nil {
+		f.Close()
+	}
+}
+
+// closeAll closes every handle.
+func (o *openFiles) closeAll() {
+	o.mu.Lock()
+	var files []File
+	for path, e := range o.byPath {
+		files = append(files, e.Value.(*openFile).file)
+		delete(o.byPath, path)
+	}
+	if o.order != nil {
+		o.order.Init()
+	}
+	o.mu.Unlock()
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// appendFile opens the CSV file at path for appending, creating it if needed,
+// or reuses its handle kept open for MaxOpenFiles. release closes the file or,
+// if keep is set, returns it to the cache.
+func (r *Service) appendFile(path string) (file File, release func(keep bool), err error) {
+	if r.MaxOpenFiles <= 0 {
+		file, err := r.fs().OpenFile(path, r.appendFlags(), r.FileMode())
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, func(bool) { file.Close() }, nil
+	}
+	file = r.openFiles.take(path)
+	if file != nil && !r.stillAt(path, file) {
+		file.Close()
+		file = nil
+	}
+	if file == nil {
+		if file, err = r.fs().OpenFile(path, r.appendFlags(), r.FileMode()); err != nil {
+			return nil, nil, err
+		}
+	}
+	limit := r.MaxOpenFiles
+	return file, func(keep bool) {
+		if !keep {
+			file.Close()
+			return
+		}
+		r.openFiles.put(path, file, limit)
+	}, nil
+}
+
+// stillAt reports whether file is still the file at path, i.e., it wasn't
+// renamed, replaced or removed since it was opened, e.g., by a compaction or
+// by another process. Files of an FS whose file infos os.SameFile can't
+// compare are always reopened.
+func (r *Service) stillAt(path string, file File) bool {
+	open, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := r.fs().Stat(path)
+	return err == nil && os.SameFile(open, current)
+}
+
+// appendFlags returns the flags the CSV files are opened with for appends.
+// Encrypted files are read and written at an offset instead, since appends
+// replace their final frame, see sealAppend.
+func (r *Service) appendFlags() int {
+	if r.EncryptionKey != nil {
+		return os.O_RDWR | os.O_CREATE
+	}
+	return os.O_APPEND | os.O_CREATE | os.O_WRONLY
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// queuedRecord is a payload queued by RecordAsync with the time it was
+// recorded, for OrderedRotation.
+type queuedRecord struct {
+	payload interface{}
+	at      time.Time
+}
+
+// queuedKey marks the context of the records written by drain, which must
+// not wait for the queue they are taken from.
+type queuedKey struct{}
+
+// queued returns what RecordAsync queues for payload: the payload itself, or
+// the payload with the current time for OrderedRotation. Payloads are placed
+// by their EventTimeColumn instead, if there is one. The caller must hold
+// r.asyncMu, so the queue is in time order.
+func (r *Service) queued(payload interface{}) interface{} {
+	if !r.OrderedRotation || r.EventTimeColumn != "" {
+		return payload
+	}
+	return queuedRecord{payload: payload, at: r.clock()}
+}
+
+// fence waits, for OrderedRotation, until the async queue has written the
+// records queued before a record that would start a new period, so none of
+// them lands in a file after it rotated. The caller must hold r.mu, which is
+// released while waiting; fence reports false if the service was closed
+// meanwhile.
+func (r *Service) fence(ctx context.Context, at time.Time) bool {
+	if !r.OrderedRotation || ctx.Value(queuedKey{}) != nil {
+		return true
+	}
+	now, err := r.Now()
+	if err != nil {
+		return true // Failed again by record
+	}
+	if !at.IsZero() {
+		now = at.In(now.Location())
+	}
+	if suffix, err := r.Suffix(now); err != nil || suffix == r.lastSuffix {
+		return true
+	}
+	r.mu.Unlock()
+	r.Flush()
+	r.mu.Lock()
+	return !r.closed
+}
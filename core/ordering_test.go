@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOrderedRotationAcrossBoundary(t *testing.T) {
+	day1 := time.Date(2025, 8, 26, 23, 59, 59, 0, time.UTC)
+	var now atomic.Pointer[time.Time]
+	now.Store(&day1)
+
+	s := New(t.TempDir(), "event", []string{"id", "day"}, "daily")
+	s.Location = time.UTC
+	s.Clock = func() time.Time { return *now.Load() }
+	s.OrderedRotation = true
+
+	const workers, perWorker = 8, 50
+	// record writes the rows of one day from several goroutines, half of them
+	// queued by RecordAsync and half written by Record
+	record := func(day string) {
+		var wg sync.WaitGroup
+		for w := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range perWorker {
+					row := map[string]interface{}{"id": fmt.Sprintf("%s-%d-%d", day, w, i), "day": day}
+					var err error
+					if w%2 == 0 {
+						err = s.RecordAsync(row)
+					} else {
+						err = s.Record(row)
+					}
+					if err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	record("2025_08_26")
+	// Rows of the first day may still be queued when the clock moves on
+	day2 := day1.Add(2 * time.Second)
+	now.Store(&day2)
+	record("2025_08_27")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, day := range []string{"2025_08_26", "2025_08_27"} {
+		data, err := os.ReadFile(filepath.Join(s.Dir, "event_"+day+".csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")[1:]
+		if len(lines) != workers*perWorker {
+			t.Errorf("%s: got %d rows, want %d", day, len(lines), workers*perWorker)
+		}
+		for _, line := range lines {
+			if !strings.HasSuffix(line, ","+day) {
+				t.Errorf("%s: row %q belongs to another day", day, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrOversized is matched by *OversizedError with errors.Is.
+var ErrOversized = errors.New("record too large")
+
+// OversizedError is returned when a cell or row exceeds MaxCellBytes or
+// MaxRowBytes and can't be shrunk under the Oversize policy.
+type OversizedError struct {
+	Column string // empty for a row over MaxRowBytes
+	Size   int
+	Limit  int
+}
+
+func (e *OversizedError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("%v: row is %d bytes, the limit is %d", ErrOversized, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("%v: column %q is %d bytes, the limit is %d", ErrOversized, e.Column, e.Size, e.Limit)
+}
+
+func (e *OversizedError) Is(target error) bool {
+	return target == ErrOversized
+}
+
+// OversizePolicy decides what happens to cells over MaxCellBytes and rows over
+// MaxRowBytes.
+type OversizePolicy int
+
+const (
+	// OversizeTruncate cuts cells short, ending them with TruncationMarker.
+	// For rows, the largest cells are cut first.
+	OversizeTruncate OversizePolicy = iota
+	// OversizeSpill moves the cell to a sidecar file in SpillDir and writes
+	// the sidecar's path, relative to Dir, into the cell instead. For rows,
+	// the largest cells are spilled first.
+	OversizeSpill
+	// OversizeReject fails the record with an *OversizedError.
+	OversizeReject
+)
+
+// SpillSuffix is appended to Filename for the directory in Dir holding the
+// sidecar files of OversizeSpill, e.g., "booking_record.spill".
+const SpillSuffix = ".spill"
+
+// spill is a cell moved to a sidecar file.
+type spill struct {
+	path string // relative to Dir, as written in the cell
+	data string
+}
+
+// SpillDir returns the directory of the sidecar files, see OversizeSpill.
+func (r *Service) SpillDir() string {
+	name := r.filename()
+	if r.name != "" {
+		name = r.name // Resolved by the collision policy
+	}
+	return filepath.Join(r.Dir, name+SpillSuffix)
+}
+
+// limitSize applies MaxCellBytes and MaxRowBytes to record in place. It returns
+// the cells to write to sidecar files and the indexes of the changed cells.
+func (r *Service) limitSize(column []string, record []string) ([]spill, []int, error) {
+	if r.MaxCellBytes <= 0 && r.MaxRowBytes <= 0 {
+		return nil, nil, nil
+	}
+	var spills []spill
+	var changed []int
+	shrink := func(i, limit int) bool {
+		cell := record[i]
+		if slices.Contains(r.BlobColumns, column[i]) {
+			return false // Already a blob reference
+		}
+		switch r.Oversize {
+		case OversizeSpill:
+			s := r.spillOf(cell)
+			if len(s.path) >= len(cell) {
+				return false // Spilling wouldn't make the cell smaller
+			}
+			record[i] = s.path
+			spills = append(spills, s)
+		case OversizeTruncate:
+			record[i] = r.cutBytes(cell, limit)
+		default:
+			return false
+		}
+		changed = append(changed, i)
+		return true
+	}
+
+	if r.MaxCellBytes > 0 {
+		for i, cell := range record {
+			if len(cell) > r.MaxCellBytes && !shrink(i, r.MaxCellBytes) {
+				return nil, nil, &OversizedError{Column: column[i], Size: len(cell), Limit: r.MaxCellBytes}
+			}
+		}
+	}
+
+	if r.MaxRowBytes > 0 {
+		size := 0
+		for _, cell := range record {
+			size += len(cell)
+		}
+		for size > r.MaxRowBytes {
+			largest := 0
+			for i, cell := range record {
+				if len(cell) > len(record[largest]) {
+					largest = i
+				}
+			}
+			before := len(record[largest])
+			if !shrink(largest, max(before-(size-r.MaxRowBytes), 0)) || len(record[largest]) >= before {
+				return nil, nil, &OversizedError{Size: size, Limit: r.MaxRowBytes}
+			}
+			size -= before - len(record[largest])
+		}
+	}
+	return spills, changed, nil
+}
+
+// cutBytes shortens cell to at most limit bytes, including the marker,
+// without splitting a character or an escape sequence.
+func (r *Service) cutBytes(cell string, limit int) string {
+	if len(cell) <= limit {
+		return cell
+	}
+	marker := r.TruncationMarker
+	if marker == "" {
+		marker = defaultTruncationMarker
+	}
+	if len(marker) > limit {
+		marker = ""
+	}
+	cut := limit - len(marker)
+	for cut > 0 && !utf8.RuneStart(cell[cut]) {
+		cut--
+	}
+	return cell[:r.escapeStart(cell, cut)] + marker
+}
+
+// spillOf names the sidecar file of cell after its content, so a value
+// recorded twice is stored once.
+func (r *Service) spillOf(cell string) spill {
+	sum := sha256.Sum256([]byte(cell))
+	name := filepath.Base(r.SpillDir())
+	return spill{path: filepath.Join(name, hex.EncodeToString(sum[:16])+".txt"), data: cell}
+}
+
+// isSpillRef reports whether cell refers to a sidecar file of OversizeSpill
+// in dir, the base of SpillDir.
+func isSpillRef(cell, dir string) bool {
+	name, ok := strings.CutPrefix(cell, dir+string(filepath.Separator))
+	if !ok {
+		return false
+	}
+	sum, ok := strings.CutSuffix(name, ".txt")
+	return ok && len(sum) == 32 && strings.Trim(sum, "0123456789abcdef") == ""
+}
+
+// writeSpills stores the sidecar files of the rows, encrypted like the CSV
+// files when EncryptionKey is set.
+func (r *Service) writeSpills(mapped []mappedRow) error {
+	for _, m := range mapped {
+		for _, s := range m.spills {
+			path := filepath.Join(r.Dir, s.path)
+			if _, err := r.fs().Stat(path); err == nil {
+				continue // Same content already spilled
+			}
+			if err := r.fs().MkdirAll(filepath.Dir(path), r.DirMode()); err != nil {
+				return fmt.Errorf("failed to create spill directory: %w", err)
+			}
+			data := []byte(s.data)
+			if r.EncryptionKey != nil {
+				var err error
+				if data, err = sealFrames(r.EncryptionKey, data, 0); err != nil {
+					return fmt.Errorf("failed to encrypt spill file %q: %w", path, err)
+				}
+			}
+			if err := replaceFile(r.fs(), path, data); err != nil {
+				return fmt.Errorf("failed to write spill file: %w", err)
+			}
+			r.usage += int64(len(data))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// partition groups mapped rows into one batch per PartitionBy or GroupBy
+// value, keeping the order in which partitions first appear.
+func (r *Service) partition(t time.Time, suffix string, mapped []mappedRow) []*Batch {
+	var batches []*Batch
+	index := map[string]*Batch{}
+	for _, m := range mapped {
+		p := r.partitionOf(m)
+		b, ok := index[p]
+		if !ok {
+			b = &Batch{Time: t, Suffix: suffix, Partition: p, Column: r.Column, Header: r.Headers}
+			index[p] = b
+			batches = append(batches, b)
+		}
+		b.Rows = append(b.Rows, m.cells)
+	}
+	return batches
+}
+
+// partitionOf returns the file name segment of the row's partition.
+func (r *Service) partitionOf(m mappedRow) string {
+	if r.GroupBy != nil {
+		if group := r.GroupBy(m.fields); group != "" {
+			return sanitizePartition(group)
+		}
+		return ""
+	}
+	if r.PartitionBy == "" {
+		return ""
+	}
+	val, ok := m.fields[r.PartitionBy]
+	if !ok || val == nil {
+		return ""
+	}
+	return sanitizePartition(formatValue(val))
+}
+
+// sanitizePartition makes a payload value safe to use in a file name by
+// replacing everything but letters, digits, '-' and '.' with '_'.
+func sanitizePartition(s string) string {
+	s = strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.':
+			return c
+		}
+		return '_'
+	}, s)
+	if strings.Trim(s, ".") == "" {
+		return strings.Repeat("_", len(s)) // Never "." or ".."
+	}
+	return s
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrPaused is returned by Record while the service is paused under
+// PauseReject, or when the PauseBuffer is full.
+var ErrPaused = errors.New("service is paused")
+
+// PausePolicy decides what happens to records while the service is paused.
+type PausePolicy int
+
+const (
+	// PauseReject fails records with ErrPaused. This is the default.
+	PauseReject PausePolicy = iota
+
+	// PauseBuffer keeps records in memory, up to PauseBuffer of them, and
+	// writes them on Resume, to the periods they were recorded in.
+	PauseBuffer
+)
+
+func (p PausePolicy) String() string {
+	switch p {
+	case PauseReject:
+		return "reject"
+	case PauseBuffer:
+		return "buffer"
+	}
+	return "unknown"
+}
+
+// pausedRecord is a record kept by PauseBuffer.
+type pausedRecord struct {
+	payload interface{}
+	at      time.Time // zero to take the time from EventTimeColumn
+	actor   string
+	values  map[string]string // of ContextColumns
+}
+
+// Pause stops writing records, e.g., to halt disk writes during an incident
+// without restarting, until Resume is called. It waits for a write in
+// progress, so no record is written once it returns. Records are rejected or
+// buffered, see PausePolicy; Append fails with ErrPaused. Maintenance such
+// as Compact and retention keeps running.
+func (r *Service) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.paused.Swap(true) {
+		r.logInfo("paused recording", "policy", r.PausePolicy.String())
+	}
+}
+
+// Resume writes the records buffered by PauseBuffer, in order, and resumes
+// recording. It returns the errors of the buffered records that failed,
+// which are also reported like RecordAsync failures.
+func (r *Service) Resume() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.paused.Swap(false) {
+		return nil
+	}
+	buffered := r.pauseBuffer
+	r.pauseBuffer = nil
+	r.logInfo("resumed recording", "buffered", len(buffered))
+
+	var errs []error
+	for _, p := range buffered {
+		r.actor, r.ctxValues = p.actor, p.values
+		start := time.Now()
+		batches, err := r.record(p.payload, p.at)
+		r.observe(batches, start, err)
+		if err != nil {
+			errs = append(errs, err)
+			r.reportError(&AsyncError{Payload: p.payload, Err: err, at: p.at})
+		}
+	}
+	r.actor, r.ctxValues = "", nil
+	return errors.Join(errs...)
+}
+
+// Enabled reports whether records are written, i.e., the service isn't
+// paused. It doesn't lock the service.
+func (r *Service) Enabled() bool {
+	return !r.paused.Load()
+}
+
+// pauseRecord rejects or buffers a record made while paused. The caller
+// must hold r.mu.
+func (r *Service) pauseRecord(payload interface{}, at time.Time) error {
+	limit := r.PauseBuffer
+	if limit <= 0 {
+		limit = defaultQueueSize
+	}
+	if r.PausePolicy != PauseBuffer || len(r.pauseBuffer) >= limit {
+		return ErrPaused
+	}
+	if at.IsZero() && r.EventTimeColumn == "" {
+		at = r.clock()
+	}
+	r.pauseBuffer = append(r.pauseBuffer, pausedRecord{payload: payload, at: at, actor: r.actor, values: r.ctxValues})
+	return nil
+}
+
+// dropPaused reports the records still buffered by PauseBuffer at Close as
+// failed with ErrPaused.
+func (r *Service) dropPaused() {
+	r.mu.Lock()
+	buffered := r.pauseBuffer
+	r.pauseBuffer = nil
+	r.mu.Unlock()
+	for _, p := range buffered {
+		r.reportError(&AsyncError{Payload: p.payload, Err: ErrPaused, at: p.at})
+	}
+}
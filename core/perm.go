@@ -0,0 +1,114 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultDirPerm  fs.FileMode = 0755
+	defaultFilePerm fs.FileMode = 0644
+)
+
+// Owner is the user and group given to the files and directories a service
+// creates, see Service.Owner. -1 keeps the process's ID, like os.Chown.
+type Owner struct {
+	UID, GID int
+}
+
+// Chowner is implemented by filesystems that can change the owner of a
+// file. OSFS implements it on Unix; on other filesystems, Owner is ignored.
+type Chowner interface {
+	Chown(name string, uid, gid int) error
+}
+
+var _ Chowner = OSFS{}
+
+func (OSFS) Chown(name string, uid, gid int) error { return os.Chown(name, uid, gid) }
+
+// DirMode returns the permissions of the directories the service creates,
+// DirPerm or 0755, before the umask.
+func (r *Service) DirMode() fs.FileMode {
+	if r.DirPerm != 0 {
+		return r.DirPerm
+	}
+	return defaultDirPerm
+}
+
+// FileMode returns the permissions of the files the service creates,
+// FilePerm or 0644, before the umask.
+func (r *Service) FileMode() fs.FileMode {
+	if r.FilePerm != 0 {
+		return r.FilePerm
+	}
+	return defaultFilePerm
+}
+
+// permFS creates every file and directory with the service's modes and
+// owner, whichever call creates it: appends, sidecars or rewrites through a
+// temporary file.
+type permFS struct {
+	FS
+	dirPerm, filePerm fs.FileMode
+	owner             *Owner
+}
+
+func (p permFS) Create(name string) (File, error) {
+	return p.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, p.filePerm)
+}
+
+func (p permFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&os.O_CREATE == 0 {
+		return p.FS.OpenFile(name, flag, perm)
+	}
+	created := false
+	if p.owner != nil {
+		_, err := p.FS.Stat(name)
+		created = errors.Is(err, fs.ErrNotExist)
+	}
+	f, err := p.FS.OpenFile(name, flag, p.filePerm)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		if err := p.chown(name); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p permFS) MkdirAll(path string, perm fs.FileMode) error {
+	// The directories that don't exist yet, deepest first
+	var missing []string
+	if p.owner != nil {
+		for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+			if _, err := p.FS.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			missing = append(missing, dir)
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	if err := p.FS.MkdirAll(path, p.dirPerm); err != nil {
+		return err
+	}
+	for _, dir := range missing {
+		if err := p.chown(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p permFS) chown(name string) error {
+	if c, ok := p.FS.(Chowner); ok {
+		return c.Chown(name, p.owner.UID, p.owner.GID)
+	}
+	return nil
+}
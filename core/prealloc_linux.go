@@ -0,0 +1,13 @@
+package core
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reserveOSFile allocates disk blocks for size bytes of f from off without
+// changing its size.
+func reserveOSFile(f *os.File, off, size int64) error {
+	return unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, off, size)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package core
+
+import "os"
+
+// reserveOSFile does nothing: only Linux can allocate blocks beyond the end of
+// a file without changing its size.
+func reserveOSFile(f *os.File, off, size int64) error {
+	return nil
+}
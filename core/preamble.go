@@ -0,0 +1,83 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CommentPrefix starts the lines of Preamble. Readers that honor comment
+// lines skip them, e.g., reader.Options.Comment, pandas' comment="#" or
+// DuckDB's comment='#'.
+const CommentPrefix = '#'
+
+// validatePreamble checks that every line of Preamble fits on one line.
+func (r *Service) validatePreamble() error {
+	for _, line := range r.Preamble {
+		if strings.ContainsAny(line, "\r\n") {
+			return fmt.Errorf("preamble line %q contains a line break", line)
+		}
+	}
+	return nil
+}
+
+// writePreamble writes the Preamble comment lines to buf.
+func (r *Service) writePreamble(buf *bytes.Buffer) {
+	term := r.terminator().bytes()
+	for _, line := range r.Preamble {
+		buf.WriteByte(CommentPrefix)
+		if line != "" {
+			buf.WriteByte(' ')
+			buf.WriteString(line)
+		}
+		buf.WriteString(term)
+	}
+}
+
+// writeRow writes row with cw, which writes to buf. With a Preamble, a first
+// cell starting with CommentPrefix is quoted, which csv.Writer doesn't do,
+// so the row isn't skipped as a comment when read back.
+func (r *Service) writeRow(cw *csv.Writer, buf *bytes.Buffer, row []string) error {
+	if len(r.Preamble) == 0 || len(row) == 0 || !strings.HasPrefix(row[0], string(CommentPrefix)) {
+		return cw.Write(row)
+	}
+	cw.Flush()
+	mark := buf.Len()
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+	cw.Flush()
+	if buf.Bytes()[mark] != CommentPrefix {
+		return cw.Error() // Quoted already
+	}
+	// Written as is, so the cell has no quotes to escape
+	rest := bytes.Clone(buf.Bytes()[mark+len(row[0]):])
+	buf.Truncate(mark)
+	buf.WriteByte('"')
+	buf.WriteString(row[0])
+	buf.WriteByte('"')
+	buf.Write(rest)
+	return cw.Error()
+}
+
+// csvReader returns a reader of the CSV rows of rd, a file written by the
+// service, skipping the Preamble.
+func (r *Service) csvReader(rd io.Reader) *csv.Reader {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	if len(r.Preamble) > 0 {
+		cr.Comment = CommentPrefix
+	}
+	return cr
+}
+
+// comment returns the comment character of the service's files, for
+// reader.Options.
+func (r *Service) comment() rune {
+	if len(r.Preamble) > 0 {
+		return CommentPrefix
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// Projection writes a subset of the columns to files of their own, next to
+// the service's file of every period and partition, e.g., a slim index of
+// ids and statuses beside the full file holding request and response
+// bodies. Projection files rotate and are locked with the service's files.
+type Projection struct {
+	// Name follows Filename and a dot in the names of the projection's files,
+	// e.g., "index" for "booking_record.index_2025_08_26.csv".
+	Name string
+
+	// Columns lists the columns written, in order. Each must be one of the
+	// service's columns.
+	Columns []string
+}
+
+// ProjectionFiles returns the files of the projection with the given name,
+// sorted like Files.
+func (r *Service) ProjectionFiles(name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.listNamed(r.Dir, r.projectionBase(name), "")
+}
+
+// ProjectionPath returns the path of the projection's file the batch is
+// written to.
+func (r *Service) ProjectionPath(name string, b *Batch) string {
+	return r.projectionPathIn(r.Dir, name, b.Suffix, b.Partition)
+}
+
+// projectionBase returns the base name of the projection's files.
+func (r *Service) projectionBase(name string) string {
+	return r.baseName() + "." + name
+}
+
+// projectionPathIn is like pathIn for the files of a projection.
+func (r *Service) projectionPathIn(dir, name, suffix, partition string) string {
+	base := r.projectionBase(name)
+	if partition != "" {
+		base += "_" + partition
+	}
+	return r.cachedName(dir, base, suffix)
+}
+
+// validateProjections checks the names and columns of Projections.
+func (r *Service) validateProjections() error {
+	var names []string
+	for _, p := range r.Projections {
+		if err := ValidateFilename(r.Filename + "." + p.Name); err != nil || p.Name == "" {
+			return fmt.Errorf("invalid projection name %q", p.Name)
+		}
+		if slices.Contains(names, p.Name) {
+			return fmt.Errorf("projection %q is declared twice", p.Name)
+		}
+		names = append(names, p.Name)
+		if len(p.Columns) == 0 {
+			return fmt.Errorf("projection %q has no columns", p.Name)
+		}
+		for _, col := range p.Columns {
+			if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+				return fmt.Errorf("projection %q column %q is not one of the columns", p.Name, col)
+			}
+		}
+	}
+	return nil
+}
+
+// writeProjections appends the columns of every projection of the batch to
+// their files in dir. The caller must hold the entry lock.
+func (r *Service) writeProjections(dir string, b *Batch) error {
+	for _, p := range r.Projections {
+		header := b.HeaderRow()
+		index := make([]int, len(p.Columns))
+		labels := make([]string, len(p.Columns))
+		for i, col := range p.Columns {
+			index[i] = slices.Index(b.Column, col)
+			if index[i] < 0 {
+				return fmt.Errorf("projection %q column %q is not one of the columns", p.Name, col)
+			}
+			labels[i] = header[index[i]]
+		}
+		rows := make([][]string, len(b.Rows))
+		for i, row := range b.Rows {
+			rows[i] = make([]string, len(index))
+			for j, k := range index {
+				if k < len(row) {
+					rows[i][j] = row[k]
+				}
+			}
+		}
+
+		path := r.projectionPathIn(dir, p.Name, b.Suffix, b.Partition)
+		if err := r.mkdir(filepath.Dir(path)); err != nil {
+			return &WriteError{Path: path, Rows: len(rows), Err: err}
+		}
+		if err := r.openMode(path); err != nil {
+			return &WriteError{Path: path, Rows: len(rows), Err: err}
+		}
+		n, err := r.appendRows(path, labels, rows)
+		b.bytes += n
+		if err != nil {
+			return &WriteError{Path: path, Rows: len(rows), Err: err}
+		}
+	}
+	return nil
+}
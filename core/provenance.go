@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Provenance stamps where, and on whose behalf, every row was written into
+// columns of their own, for audit trails. Each field names the column that
+// receives the value, and must be one of the columns; empty fields stamp
+// nothing. Stamps replace payload fields of the same key and are set before
+// Derive, so derived columns and Filter see them.
+type Provenance struct {
+	Hostname string // the host name, from os.Hostname
+	Pod      string // the POD_NAME environment variable, e.g., from the Kubernetes downward API
+	PID      string // the process ID
+	Actor    string // the actor of the record's context, see WithActor
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor stamped into the Actor
+// column of Provenance by RecordContext and RecordResult, e.g., the user or
+// job on whose behalf the record is written.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set on ctx with WithActor, or "".
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// columns returns the columns stamped by p, by value kind.
+func (p *Provenance) columns() map[string]string {
+	cols := make(map[string]string, 4)
+	for kind, col := range map[string]string{"Hostname": p.Hostname, "Pod": p.Pod, "PID": p.PID, "Actor": p.Actor} {
+		if col != "" {
+			cols[kind] = col
+		}
+	}
+	return cols
+}
+
+// validateProvenance checks that the columns of Provenance are distinct
+// columns of the service.
+func (r *Service) validateProvenance() error {
+	if r.Provenance == nil {
+		return nil
+	}
+	seen := map[string]string{}
+	for kind, col := range r.Provenance.columns() {
+		if other, ok := seen[col]; ok {
+			return fmt.Errorf("provenance column %q is used for both %s and %s", col, min(kind, other), max(kind, other))
+		}
+		seen[col] = kind
+		if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+			return fmt.Errorf("provenance column %q is not one of the columns", col)
+		}
+	}
+	return nil
+}
+
+// stamp sets the Provenance columns of fields. The host, pod and process are
+// looked up once.
+func (r *Service) stamp(fields map[string]interface{}) {
+	p := r.Provenance
+	if r.host == nil {
+		hostname, err := os.Hostname()
+		if err != nil {
+			r.logError("failed to get host name", "error", err)
+		}
+		r.host = &hostInfo{hostname: hostname, pod: os.Getenv("POD_NAME"), pid: strconv.Itoa(os.Getpid())}
+	}
+	if p.Hostname != "" {
+		fields[p.Hostname] = r.host.hostname
+	}
+	if p.Pod != "" {
+		fields[p.Pod] = r.host.pod
+	}
+	if p.PID != "" {
+		fields[p.PID] = r.host.pid
+	}
+	if p.Actor != "" {
+		fields[p.Actor] = r.actor
+	}
+}
+
+// hostInfo holds the values stamped by Provenance for the process.
+type hostInfo struct {
+	hostname, pod, pid string
+}
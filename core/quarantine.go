@@ -0,0 +1,58 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// QuarantinePath returns the file that records quarantined at t are written
+// to, e.g., "booking_record.quarantine_2025_08_26.csv". It has the columns of
+// the CSV files plus an "error" column with the broken rule.
+func (r *Service) QuarantinePath(t time.Time) (string, error) {
+	suffix, err := r.Suffix(t)
+	if err != nil {
+		return "", err
+	}
+	return r.quarantinePath(suffix), nil
+}
+
+func (r *Service) quarantinePath(suffix string) string {
+	// Not name_..., so the file isn't mistaken for a partition by Files
+	return r.nameIn(r.Dir, r.baseName()+".quarantine", suffix)
+}
+
+// quarantine writes the rows with a quarantined value to the quarantine file
+// and returns the others. Quarantined rows always go to the file in Dir, not
+// to Sinks.
+func (r *Service) quarantine(suffix string, mapped []mappedRow) ([]mappedRow, error) {
+	if !slices.ContainsFunc(mapped, func(m mappedRow) bool { return m.invalid != nil }) {
+		return mapped, nil
+	}
+
+	kept := mapped[:0:0]
+	var records [][]string
+	for _, m := range mapped {
+		if m.invalid == nil {
+			kept = append(kept, m)
+			continue
+		}
+		records = append(records, append(slices.Clone(m.cells), m.invalid.Error()))
+		r.logWarn("quarantined record", "column", m.invalid.Column, "reason", m.invalid.Reason)
+	}
+
+	if r.entry != nil {
+		r.entry.mu.Lock()
+		defer r.entry.mu.Unlock()
+	}
+	path := r.quarantinePath(suffix)
+	if err := r.mkdir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	header := append(slices.Clone(r.HeaderRow()), "error")
+	if _, err := r.appendRows(path, header, records); err != nil {
+		return nil, fmt.Errorf("failed to quarantine records to %q: %w", path, err)
+	}
+	return kept, nil
+}
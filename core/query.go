@@ -0,0 +1,317 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// DateRange selects rotation periods by time. A zero From or To leaves that
+// end open.
+type DateRange struct {
+	From, To time.Time
+}
+
+// QueryRow is a row found by Query.
+type QueryRow struct {
+	// Path is the file the row was read from.
+	Path string
+
+	// Fields maps each header label of the file to the row's cell.
+	Fields map[string]string
+}
+
+// Query streams the rows whose cells equal every value in filter, from the
+// files of the rotation periods that overlap dates, oldest first. Filter
+// keys are payload keys or header labels; a file without one of the
+// filtered columns has no matches. Encrypted and re-encoded files are
+// decoded like OpenFile does.
+//
+// Only the file list is taken under the service lock, so records may be
+// written while the rows are read. Stop the iteration early to skip the
+// remaining files.
+//
+//	for row, err := range service.Query(map[string]string{"booking_id": "X"}, core.DateRange{From: tuesday}) {
+//		...
+//	}
+func (r *Service) Query(filter map[string]string, dates DateRange) iter.Seq2[QueryRow, error] {
+	return func(yield func(QueryRow, error) bool) {
+		files, err := r.FilesBetween(dates)
+		if err != nil {
+			yield(QueryRow{}, err)
+			return
+		}
+
+		r.mu.Lock()
+		labels := make(map[string]string, len(filter))
+		for key, val := range filter {
+			labels[r.label(key)] = val
+		}
+		opts := r.readOptions()
+		r.mu.Unlock()
+
+		for _, path := range files {
+			if !r.queryFile(path, labels, opts, yield) {
+				return
+			}
+		}
+	}
+}
+
+// RecordRow is a row read back by Records.
+type RecordRow struct {
+	// Path is the file the row was read from, and Line the row's number in
+	// it, 1 for the first row after the header.
+	Path string
+	Line int
+
+	// Fields maps each column of the file, by payload key, to the row's cell.
+	// Header labels that aren't a column of the service are kept as is.
+	Fields map[string]string
+}
+
+// Records streams every row of the files of the rotation periods from from to
+// to, oldest first, like Query without a filter. A zero from or to leaves
+// that end open. Rows are read one at a time, so breaking out of the loop
+// stops reading instead of loading whole files; a failed file is yielded as
+// an error and the iteration goes on with the next one unless stopped.
+//
+//	for row, err := range service.Records(lastWeek, time.Now()) {
+//		if err != nil {
+//			return err
+//		}
+//		if row.Fields["status"] == "cancelled" {
+//			break
+//		}
+//	}
+func (r *Service) Records(from, to time.Time) iter.Seq2[RecordRow, error] {
+	return func(yield func(RecordRow, error) bool) {
+		r.mu.Lock()
+		keys := make(map[string]string, len(r.Headers))
+		for i, label := range r.Headers {
+			if i < len(r.Column) {
+				keys[label] = r.Column[i]
+			}
+		}
+		r.mu.Unlock()
+
+		path, line := "", 0
+		for row, err := range r.Query(nil, DateRange{From: from, To: to}) {
+			if err != nil {
+				if !yield(RecordRow{}, err) {
+					return
+				}
+				continue
+			}
+			if row.Path != path {
+				path, line = row.Path, 0
+			}
+			line++
+			fields := make(map[string]string, len(row.Fields))
+			for label, cell := range row.Fields {
+				key, ok := keys[label]
+				if !ok {
+					key = label
+				}
+				fields[key] = cell
+			}
+			if !yield(RecordRow{Path: path, Line: line, Fields: fields}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// readOptions holds the settings of the service that queryFile reads files
+// with, taken under r.mu.
+type readOptions struct {
+	compressed  []string          // labels of the CellCompression columns
+	skipHeaders bool              // SkipRepeatedHeaders
+	unescape    bool              // EscapeNewlines
+	aliases     map[string]string // HeaderAliases
+	blobs       []string          // labels of the BlobColumns
+	spillDir    string            // base of SpillDir
+	null        string            // NullValue
+}
+
+// escaped reports whether the cell of the column label was escaped by
+// EscapeNewlines. Compressed cells, blob and spill references, and NullValue
+// cells never are.
+func (o readOptions) escaped(label, cell string) bool {
+	if slices.Contains(o.compressed, label) || slices.Contains(o.blobs, label) {
+		return false
+	}
+	return (o.null == "" || cell != o.null) && !isSpillRef(cell, o.spillDir)
+}
+
+// readOptions returns the settings queryFile reads files with. The caller
+// must hold r.mu.
+func (r *Service) readOptions() readOptions {
+	return readOptions{
+		compressed:  r.compressedLabels(),
+		skipHeaders: r.SkipRepeatedHeaders,
+		unescape:    r.EscapeNewlines,
+		aliases:     maps.Clone(r.HeaderAliases),
+		blobs:       r.blobLabels(),
+		spillDir:    filepath.Base(r.SpillDir()),
+		null:        r.NullValue,
+	}
+}
+
+// queryFile yields the matching rows of one file and reports whether to go on.
+// The cells of the compressed columns are decompressed first, after line
+// breaks are unescaped in the cells escaped on write, rows equal to the header are skipped with
+// skipHeaders, and the header is read through the aliases.
+func (r *Service) queryFile(path string, filter map[string]string, opts readOptions, yield func(QueryRow, error) bool) bool {
+	f, err := r.OpenFile(path)
+	if err != nil {
+		return yield(QueryRow{}, err)
+	}
+	defer f.Close()
+
+	cr := r.csvReader(f)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	if err != nil {
+		return yield(QueryRow{}, fmt.Errorf("failed to read CSV header of %q: %w", path, err))
+	}
+	written := header
+	header = reader.AliasHeader(header, opts.aliases)
+
+	match := make(map[int]string, len(filter))
+	for label, val := range filter {
+		i := slices.Index(header, label)
+		if i < 0 {
+			return true // Can't match, files written before the column was added
+		}
+		match[i] = val
+	}
+	var decompress []int
+	for i, label := range header {
+		if slices.Contains(opts.compressed, label) {
+			decompress = append(decompress, i)
+		}
+	}
+
+	skipped := 0
+	defer func() {
+		if skipped > 0 {
+			r.skippedHeaders.Add(int64(skipped))
+			r.logWarn("skipped repeated header lines", "path", path, "lines", skipped)
+		}
+	}()
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return true
+		}
+		if err != nil {
+			return yield(QueryRow{}, fmt.Errorf("failed to read CSV file %q: %w", path, err))
+		}
+		if opts.skipHeaders && slices.Equal(row, written) {
+			skipped++
+			continue
+		}
+		if opts.unescape {
+			for i, cell := range row {
+				if i < len(header) && opts.escaped(header[i], cell) {
+					row[i] = reader.UnescapeNewlines(cell)
+				}
+			}
+		}
+		for _, i := range decompress {
+			if i < len(row) {
+				if row[i], err = reader.DecompressCell(row[i]); err != nil {
+					return yield(QueryRow{}, fmt.Errorf("failed to read CSV file %q: %w", path, err))
+				}
+			}
+		}
+		if !matches(row, match) {
+			continue
+		}
+		fields := make(map[string]string, len(header))
+		for i, label := range header {
+			if i < len(row) {
+				fields[label] = row[i]
+			}
+		}
+		if !yield(QueryRow{Path: path, Fields: fields}, nil) {
+			return false
+		}
+	}
+}
+
+// SkippedHeaders returns the number of repeated header lines Query, Records
+// and DecodeAll have skipped so far, see SkipRepeatedHeaders. A file read twice is
+// counted twice.
+func (r *Service) SkippedHeaders() int64 {
+	return r.skippedHeaders.Load()
+}
+
+func matches(row []string, match map[int]string) bool {
+	for i, val := range match {
+		if i >= len(row) || row[i] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// FilesBetween lists the files whose rotation suffix falls within dates,
+// oldest period first, including every partition of each period. Suffixes
+// sort like the periods they name, so they are compared as strings.
+func (r *Service) FilesBetween(dates DateRange) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now, err := r.Now()
+	if err != nil {
+		return nil, err
+	}
+	bound := func(t time.Time) (string, error) {
+		if t.IsZero() {
+			return "", nil
+		}
+		return r.Suffix(t.In(now.Location()))
+	}
+	from, err := bound(dates.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := bound(dates.To)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := r.files()
+	if err != nil {
+		return nil, err
+	}
+	suffixes := make(map[string]string, len(files))
+	var selected []string
+	for _, path := range files {
+		suffix, _, ok := r.parseName(r.Dir, path)
+		if !ok {
+			continue // Not a rotated file of this service
+		}
+		if from != "" && suffix < from || to != "" && suffix > to {
+			continue
+		}
+		suffixes[path] = suffix
+		selected = append(selected, path)
+	}
+	slices.SortStableFunc(selected, func(a, b string) int {
+		return strings.Compare(suffixes[a], suffixes[b])
+	})
+	return selected, nil
+}
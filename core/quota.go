@@ -0,0 +1,310 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// ErrQuotaExceeded is returned when the files of a service use more than
+// MaxTotalBytes and the quota policy doesn't make room.
+var ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+// QuotaPolicy decides what happens once the files exceed MaxTotalBytes.
+type QuotaPolicy int
+
+const (
+	// QuotaReject fails further Record calls with ErrQuotaExceeded. This is
+	// the default.
+	QuotaReject QuotaPolicy = iota
+
+	// QuotaDeleteOldest deletes the oldest files, by modification time, until
+	// the usage is below the quota again, along with their sidecars: mirror,
+	// checksum, schema, stats, row index and acknowledgement files, the
+	// dead-letter file of their period once no file of it is left, and the
+	// blob and spill files no other file refers to. Files being written to or
+	// held open are kept.
+	QuotaDeleteOldest
+
+	// QuotaNotify keeps recording; only OnQuota is called.
+	QuotaNotify
+)
+
+var quotaPolicyNames = []string{"reject", "delete_oldest", "notify"}
+
+func (p QuotaPolicy) String() string {
+	if p < 0 || int(p) >= len(quotaPolicyNames) {
+		return fmt.Sprintf("QuotaPolicy(%d)", int(p))
+	}
+	return quotaPolicyNames[p]
+}
+
+// MarshalText encodes the policy by name, e.g., "delete_oldest".
+func (p QuotaPolicy) MarshalText() ([]byte, error) {
+	if p < 0 || int(p) >= len(quotaPolicyNames) {
+		return nil, fmt.Errorf("unknown quota policy %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a policy name written by MarshalText.
+func (p *QuotaPolicy) UnmarshalText(text []byte) error {
+	i := slices.Index(quotaPolicyNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown quota policy %q", text)
+	}
+	*p = QuotaPolicy(i)
+	return nil
+}
+
+// checkQuota enforces MaxTotalBytes before the batches are written. The
+// usage, see measureUsage, is measured once and then tracked from the bytes
+// written, and measured again at every rotation. The caller must hold r.mu.
+func (r *Service) checkQuota(batches []*Batch) error {
+	if r.MaxTotalBytes <= 0 {
+		return nil
+	}
+	if !r.usageKnown {
+		usage, err := r.measureUsage()
+		if err != nil {
+			return err
+		}
+		r.usage, r.usageKnown = usage, true
+	}
+	if r.usage < r.MaxTotalBytes {
+		return nil
+	}
+
+	if r.OnQuota != nil {
+		r.OnQuota(r.usage, r.MaxTotalBytes)
+	}
+	switch r.Quota {
+	case QuotaNotify:
+		return nil
+	case QuotaDeleteOldest:
+		if err := r.deleteOldest(batches); err != nil {
+			return err
+		}
+		if r.usage < r.MaxTotalBytes {
+			return nil
+		}
+	}
+	r.logWarn("disk quota exceeded", "usage", r.usage, "limit", r.MaxTotalBytes)
+	return fmt.Errorf("%w: %d of %d bytes used in %q", ErrQuotaExceeded, r.usage, r.MaxTotalBytes, r.Dir)
+}
+
+// measureUsage sums the sizes of the service's files and their sidecars:
+// those of fileUsage, the dead-letter files of their periods, and the blob
+// and spill files.
+func (r *Service) measureUsage() (int64, error) {
+	files, err := r.files()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	suffixes := map[string]bool{}
+	for _, f := range files {
+		total += r.fileUsage(f)
+		if suffix, _, ok := r.parseName(r.Dir, f); ok {
+			suffixes[suffix] = true
+		}
+	}
+	for suffix := range suffixes {
+		total += r.sizeOf(r.deadLetterPath(suffix))
+	}
+	err = walkFiles(r.fs(), r.SpillDir(), func(path string) {
+		total += r.sizeOf(path)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure %q: %w", r.SpillDir(), err)
+	}
+	return total, nil
+}
+
+// fileUsage returns the size of the file at path with its companions, see
+// deleteCompanions.
+func (r *Service) fileUsage(path string) int64 {
+	total := r.sizeOf(path)
+	for _, sidecar := range companionSuffixes {
+		total += r.sizeOf(path + sidecar)
+	}
+	for _, format := range r.Mirrors {
+		total += r.sizeOf(mirrorPath(path, format))
+	}
+	return total
+}
+
+// sizeOf returns the size of the file at path, 0 if it doesn't exist.
+func (r *Service) sizeOf(path string) int64 {
+	if stat, err := r.fs().Stat(path); err == nil {
+		return stat.Size()
+	}
+	return 0
+}
+
+// deleteOldest removes files, oldest first, until the usage is below the
+// quota, keeping the files the batches are written to and those held open.
+func (r *Service) deleteOldest(batches []*Batch) error {
+	files, err := r.files()
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var candidates []file
+	for _, f := range files {
+		if r.openFiles.has(f) || slices.ContainsFunc(batches, func(b *Batch) bool { return r.BatchPath(b) == f }) {
+			continue
+		}
+		if stat, err := r.fs().Stat(f); err == nil {
+			candidates = append(candidates, file{f, r.fileUsage(f), stat.ModTime()})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b file) int { return a.mod.Compare(b.mod) })
+
+	var deleted []string
+	refs := map[string]bool{}
+	defer func() {
+		remaining := slices.DeleteFunc(files, func(f string) bool { return slices.Contains(deleted, f) })
+		r.deleteDeadLetters(deleted, remaining)
+		r.deleteUnreferenced(refs, remaining, batches)
+		if usage, err := r.measureUsage(); err == nil {
+			r.usage = usage // Also less the dead letters and blobs
+		}
+	}()
+	for _, f := range candidates {
+		if r.usage < r.MaxTotalBytes {
+			break
+		}
+		own := map[string]bool{}
+		if err := r.sidecarRefs(f.path, own); err != nil {
+			r.logWarn("failed to list the blobs of a file deleted to free quota", "path", f.path, "error", err)
+		}
+		for rel := range own {
+			if !refs[rel] {
+				// Counted as freed until measured again, most blobs belong to one row
+				refs[rel] = true
+				r.usage -= r.sizeOf(filepath.Join(r.Dir, rel))
+			}
+		}
+		if err := r.deleteShredded(f.path, "quota"); err != nil {
+			return fmt.Errorf("failed to delete %q to free quota: %w", f.path, err)
+		}
+		deleted = append(deleted, f.path)
+		r.deleteCompanions(f.path)
+		r.usage -= f.size
+		r.logInfo("deleted file to free quota", "path", f.path, "bytes", f.size)
+	}
+	return nil
+}
+
+// companionSuffixes are the suffixes of the sidecar files of a file.
+var companionSuffixes = []string{ChecksumSuffix, SchemaSuffix, StatsSuffix, AckSuffix, reader.IndexSuffix}
+
+// deleteCompanions removes the sidecar files of the deleted file at path.
+func (r *Service) deleteCompanions(path string) {
+	for _, sidecar := range companionSuffixes {
+		r.fs().Remove(path + sidecar)
+	}
+	for _, format := range r.Mirrors {
+		if err := r.deleteShredded(mirrorPath(path, format), "quota"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			r.logWarn("failed to delete mirror to free quota", "path", mirrorPath(path, format), "error", err)
+		}
+	}
+}
+
+// deleteDeadLetters removes the dead-letter files of the periods of the
+// deleted files that no remaining file belongs to.
+func (r *Service) deleteDeadLetters(deleted, remaining []string) {
+	for _, path := range deleted {
+		suffix, _, ok := r.parseName(r.Dir, path)
+		if !ok || slices.ContainsFunc(remaining, func(f string) bool {
+			s, _, ok := r.parseName(r.Dir, f)
+			return ok && s == suffix
+		}) {
+			continue
+		}
+		dl := r.deadLetterPath(suffix)
+		if err := r.deleteShredded(dl, "quota"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			r.logWarn("failed to delete dead letters to free quota", "path", dl, "error", err)
+		}
+	}
+}
+
+// sidecarRefs adds the blob and spill files the cells of the file at path
+// refer to, relative to Dir, to refs.
+func (r *Service) sidecarRefs(path string, refs map[string]bool) error {
+	spills := r.Oversize == OversizeSpill && (r.MaxCellBytes > 0 || r.MaxRowBytes > 0)
+	if len(r.BlobColumns) == 0 && !spills {
+		return nil
+	}
+	f, err := r.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cr := r.csvReader(f)
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV file %q: %w", path, err)
+		}
+		r.cellRefs(row, refs)
+	}
+}
+
+// cellRefs adds the blob and spill files the cells refer to, relative to
+// Dir, to refs.
+func (r *Service) cellRefs(cells []string, refs map[string]bool) {
+	spillDir := filepath.Base(r.SpillDir())
+	for _, cell := range cells {
+		if rel, ok := reader.BlobPath(cell); ok {
+			refs[filepath.FromSlash(rel)] = true
+		} else if isSpillRef(cell, spillDir) {
+			refs[cell] = true
+		}
+	}
+}
+
+// deleteUnreferenced removes the blob and spill files of refs that neither
+// the remaining files nor the batches about to be written refer to. They are
+// all kept if one of the files can't be read.
+func (r *Service) deleteUnreferenced(refs map[string]bool, remaining []string, batches []*Batch) {
+	if len(refs) == 0 {
+		return
+	}
+	kept := map[string]bool{}
+	for _, b := range batches {
+		for _, row := range b.Rows {
+			r.cellRefs(row, kept)
+		}
+	}
+	for _, path := range remaining {
+		if err := r.sidecarRefs(path, kept); err != nil {
+			r.logWarn("kept blobs of files deleted to free quota", "error", err)
+			return
+		}
+	}
+	for rel := range refs {
+		if kept[rel] {
+			continue
+		}
+		path := filepath.Join(r.Dir, rel)
+		if err := r.deleteShredded(path, "quota"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			r.logWarn("failed to delete blob to free quota", "path", path, "error", err)
+		}
+	}
+}
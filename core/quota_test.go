@@ -0,0 +1,124 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestQuotaDeletesCompanions(t *testing.T) {
+	now := time.Date(2025, 8, 26, 10, 0, 0, 0, time.UTC)
+	s := New(t.TempDir(), "event", []string{"id", "body"}, "daily")
+	s.Clock = func() time.Time { return now }
+	s.Mirrors = []Format{FormatNDJSON}
+	s.BlobColumns = []string{"body"}
+	s.DeadLetter = true
+	record := func(id, body string) {
+		t.Helper()
+		if err := s.Record(map[string]interface{}{"id": id, "body": body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("1", "shared")
+	record("2", "only the first day")
+	if err := s.Record(42); err == nil {
+		t.Fatal("recorded a payload that isn't an object")
+	}
+	first := filepath.Join(s.Dir, "event_2025_08_26.csv")
+	if err := os.WriteFile(first+reader.IndexSuffix, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	shared, _ := s.blobOf("shared")
+	own, _ := s.blobOf("only the first day")
+	deadLetter := s.deadLetterPath("2025_08_26")
+
+	now = now.Add(24 * time.Hour)
+	record("3", "shared")
+	second := filepath.Join(s.Dir, "event_2025_08_27.csv")
+	sharedPath := filepath.Join(s.Dir, strings.TrimPrefix(shared, reader.BlobCellPrefix))
+	s.MaxTotalBytes = s.fileUsage(second) + s.sizeOf(sharedPath) + 1
+	s.Quota = QuotaDeleteOldest
+	record("4", "shared")
+
+	for _, path := range []string{
+		first,
+		mirrorPath(first, FormatNDJSON),
+		first + reader.IndexSuffix,
+		deadLetter,
+		filepath.Join(s.Dir, strings.TrimPrefix(own, reader.BlobCellPrefix)),
+	} {
+		if exists(path) {
+			t.Errorf("%s wasn't deleted", path)
+		}
+	}
+	for _, path := range []string{
+		second,
+		mirrorPath(second, FormatNDJSON),
+		sharedPath,
+	} {
+		if !exists(path) {
+			t.Errorf("%s was deleted", path)
+		}
+	}
+}
+
+func TestQuotaCountsSidecars(t *testing.T) {
+	s := New(t.TempDir(), "event", []string{"id", "body"}, "daily")
+	s.Mirrors = []Format{FormatNDJSON}
+	s.BlobColumns = []string{"body"}
+	if err := s.Record(map[string]interface{}{"id": "1", "body": strings.Repeat("x", 512)}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := s.Files()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	stat, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The CSV file alone fits, not with its mirror and blob
+	s.MaxTotalBytes = stat.Size() * 2
+	err = s.Record(map[string]interface{}{"id": "2", "body": "short"})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("err = %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestQuotaKeepsOpenFiles(t *testing.T) {
+	s := New(t.TempDir(), "event", []string{"id", "region"}, "daily")
+	s.PartitionBy = "region"
+	s.MaxOpenFiles = 10
+	for _, region := range []string{"eu", "us"} {
+		if err := s.Record(map[string]interface{}{"id": "1", "region": region}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := s.Files()
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+
+	s.MaxTotalBytes = 1
+	s.Quota = QuotaDeleteOldest
+	err = s.Record(map[string]interface{}{"id": "2", "region": "us"})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("err = %v, want ErrQuotaExceeded", err)
+	}
+	for _, path := range files {
+		if !exists(path) {
+			t.Errorf("%s was deleted while open", path)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReceiptOptions emit a Receipt for every row appended to the CSV files, so
+// downstream consumers can acknowledge rows individually and notice rows
+// they missed: the receipts of a file cover its bytes after the header
+// without gaps. Rows written to FallbackDir get receipts there, and again in
+// Dir once they are merged back.
+type ReceiptOptions struct {
+	// File, if set, receives every receipt as a JSON line. A relative path
+	// is in Dir.
+	File string
+
+	// Func, if set, is called with the receipts of every append, in row
+	// order, while the service is locked.
+	Func func(receipts []Receipt)
+}
+
+// Receipt identifies a row appended to a CSV file.
+type Receipt struct {
+	Time time.Time `json:"time"`
+	Path string    `json:"path"`
+
+	// Start and End are the byte range of the row in the file, End
+	// excluded. With Compression, EncryptionKey or Encoding, rows can't be
+	// read separately, and they are the range of the whole append instead.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+
+	// SHA256 is the hash of the row's CSV line, including its line break,
+	// which precedes it with NoTrailingNewline, before any Encoding,
+	// Compression or EncryptionKey. Of plain files, it
+	// hashes the bytes from Start to End.
+	SHA256 string `json:"sha256"`
+}
+
+// receipts returns the receipts of rows appended at offset in n bytes,
+// after the header if the file was empty.
+func (r *Service) receipts(path string, header []string, rows [][]string, offset, n int64) ([]Receipt, error) {
+	var buf bytes.Buffer
+	cw := r.csvWriter(csv.NewWriter(&buf))
+	term := r.terminator().bytes()
+	line := func(row []string) ([]byte, error) {
+		buf.Reset()
+		if r.NoTrailingNewline {
+			buf.WriteString(term)
+		}
+		if err := r.writeRow(cw, &buf, row); err != nil {
+			return nil, err
+		}
+		cw.Flush()
+		if r.NoTrailingNewline {
+			buf.Truncate(buf.Len() - len(term))
+		}
+		return buf.Bytes(), cw.Error()
+	}
+
+	plain := r.Encoding == nil && r.Compression == CompressionNone && r.EncryptionKey == nil
+	start := offset
+	if plain && offset == 0 {
+		h, err := line(header)
+		if err != nil {
+			return nil, err
+		}
+		start = int64(len(h))
+		if r.NoTrailingNewline {
+			start -= int64(len(term)) // The header has none before it
+		}
+		if r.WriteBOM {
+			start += int64(len(byteOrderMark))
+		}
+		if len(r.Preamble) > 0 {
+			var preamble bytes.Buffer
+			r.writePreamble(&preamble)
+			start += int64(preamble.Len())
+		}
+	}
+	now := r.clock()
+	receipts := make([]Receipt, len(rows))
+	for i, row := range rows {
+		b, err := line(row)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		rc := Receipt{Time: now, Path: path, Start: offset, End: offset + n, SHA256: hex.EncodeToString(sum[:])}
+		if plain {
+			rc.Start, rc.End = start, start+int64(len(b))
+			start = rc.End
+		}
+		receipts[i] = rc
+	}
+	return receipts, nil
+}
+
+// emitReceipts passes the receipts of rows appended to path to Receipts.
+// Failures are logged rather than returned: the rows are written, and
+// failing the record would have them written twice by a retry. Consumers
+// see the missing receipts as a gap.
+func (r *Service) emitReceipts(path string, header []string, rows [][]string, offset, n int64) {
+	receipts, err := r.receipts(path, header, rows, offset, n)
+	if err == nil && r.Receipts.File != "" {
+		err = r.writeReceipts(receipts)
+	}
+	if err != nil {
+		r.logError("failed to write receipts", "path", path, "rows", len(rows), "error", err)
+		return
+	}
+	if r.Receipts.Func != nil {
+		r.Receipts.Func(receipts)
+	}
+}
+
+// writeReceipts appends the receipts to File.
+func (r *Service) writeReceipts(receipts []Receipt) error {
+	path := r.Receipts.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rc := range receipts {
+		if err := enc.Encode(rc); err != nil {
+			return err
+		}
+	}
+	f, err := r.fs().OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, r.FileMode())
+	if err != nil {
+		return fmt.Errorf("failed to open receipt file %q: %w", path, err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write receipt file %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// Recorder is the write side of a Service. Application code that depends on
+// it rather than on *Service can be tested with a fake, and wrapped by the
+// decorators under middleware/, e.g., for retries, metrics or fan-out.
+type Recorder interface {
+	// Record records a payload, or one row per element of a slice payload.
+	Record(payload interface{}) error
+
+	// RecordBatch records the payloads together, like a committed Tx.
+	RecordBatch(payloads []interface{}) error
+
+	// Close writes what is still buffered and releases the recorder.
+	Close() error
+}
+
+var _ Recorder = (*Service)(nil)
+
+// RecordBatch records the payloads together, like a Tx with all of them
+// committed at once: they are all mapped and validated before any is
+// written. Slice payloads add one row per element.
+func (r *Service) RecordBatch(payloads []interface{}) error {
+	var items []interface{}
+	for _, payload := range payloads {
+		split, _ := splitPayload(payload)
+		items = append(items, split...)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	_, err := r.recordTraced(context.Background(), items, time.Time{}, false)
+	return err
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Registry manages named services, e.g., one per tenant or event type,
+// created on first use. Its RecordAsync writes the payloads of every service
+// from one shared queue, and Close closes them all.
+//
+//	tenants := core.NewRegistry(func(name string) (*core.Service, error) {
+//		return core.NewChecked("files/tenants/"+name, "booking_record", columns, "daily")
+//	})
+//	defer tenants.Close()
+//	tenants.RecordAsync(tenantID, payload)
+type Registry struct {
+	// New creates the service of a name on first use. It is called with the
+	// registry locked, once per name.
+	New func(name string) (*Service, error)
+
+	// QueueSize is the capacity of the shared RecordAsync queue. Defaults to
+	// 1024; RecordAsync blocks while the queue is full.
+	QueueSize int
+
+	mu       sync.Mutex
+	services map[string]*Service
+	closed   bool
+
+	// asyncMu guards the lazily started shared queue, like Service.asyncMu.
+	asyncMu     sync.Mutex
+	queue       chan registryItem
+	drained     chan struct{}
+	asyncClosed bool
+}
+
+// registryItem is a payload queued for service, or a flushMarker.
+type registryItem struct {
+	service *Service
+	payload interface{}
+}
+
+// NewRegistry creates a registry whose services are created by newService.
+func NewRegistry(newService func(name string) (*Service, error)) *Registry {
+	return &Registry{New: newService}
+}
+
+// Get returns the service of name, creating it with New if it doesn't exist
+// yet. A failed creation is returned and retried on the next Get.
+func (g *Registry) Get(name string) (*Service, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return nil, ErrClosed
+	}
+	if s, ok := g.services[name]; ok {
+		return s, nil
+	}
+	if g.New == nil {
+		return nil, errors.New("registry has no New func")
+	}
+	s, err := g.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service %q: %w", name, err)
+	}
+	if g.services == nil {
+		g.services = make(map[string]*Service)
+	}
+	g.services[name] = s
+	return s, nil
+}
+
+// Lookup returns the service of name if it was created.
+func (g *Registry) Lookup(name string) (*Service, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.services[name]
+	return s, ok
+}
+
+// Names returns the names of the created services, sorted.
+func (g *Registry) Names() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Sorted(maps.Keys(g.services))
+}
+
+// Record writes the payload with the service of name.
+func (g *Registry) Record(name string, payload interface{}) error {
+	s, err := g.Get(name)
+	if err != nil {
+		return err
+	}
+	return s.Record(payload)
+}
+
+// RecordAsync queues the payload for the service of name, which is created
+// first if needed, and returns immediately. One goroutine writes the queue of
+// every service; failed writes are reported through the OnError and Errors
+// of the payload's service.
+func (g *Registry) RecordAsync(name string, payload interface{}) error {
+	s, err := g.Get(name)
+	if err != nil {
+		return err
+	}
+
+	g.asyncMu.Lock()
+	defer g.asyncMu.Unlock() // Held while sending, so Close can't close the queue under us
+
+	if g.asyncClosed {
+		return ErrClosed
+	}
+	if g.queue == nil {
+		size := g.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		g.queue = make(chan registryItem, size)
+		g.drained = make(chan struct{})
+		go g.drain(g.queue, g.drained)
+	}
+
+	g.queue <- registryItem{service: s, payload: payload}
+	return nil
+}
+
+// drain writes queued payloads until the queue is closed, then closes drained.
+func (g *Registry) drain(queue <-chan registryItem, drained chan<- struct{}) {
+	defer close(drained)
+	for item := range queue {
+		if done, ok := item.payload.(flushMarker); ok {
+			close(done)
+			continue
+		}
+		// A service removed while the payload was queued fails it with ErrClosed
+		if err := item.service.Record(item.payload); err != nil {
+			item.service.reportError(&AsyncError{Payload: item.payload, Err: err})
+		}
+	}
+}
+
+// Flush blocks until every payload queued by RecordAsync so far, on the
+// registry or on its services, has been written or reported as failed.
+func (g *Registry) Flush() error {
+	g.flushQueue()
+
+	var errs []error
+	for _, s := range g.all() {
+		if err := s.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flushQueue blocks until every payload queued by the registry's RecordAsync
+// so far has been written or reported as failed.
+func (g *Registry) flushQueue() {
+	g.asyncMu.Lock()
+	if g.queue == nil {
+		g.asyncMu.Unlock()
+		return
+	}
+	done := make(flushMarker)
+	g.queue <- registryItem{payload: done}
+	g.asyncMu.Unlock()
+	<-done
+}
+
+// RunCompactor compacts every file of every service with Compaction set each
+// interval until ctx is done, like Service.RunCompactor. Services created
+// later are included. Failures are passed to onError, if set, and don't stop
+// the compactor.
+func (g *Registry) RunCompactor(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	report := func(name string, err error) {
+		if onError != nil {
+			onError(fmt.Errorf("service %q: %w", name, err))
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, name := range g.Names() {
+			s, ok := g.Lookup(name)
+			if !ok || s.Compaction == nil {
+				continue
+			}
+			files, err := s.Files()
+			if err != nil {
+				report(name, err)
+				continue
+			}
+			for _, path := range files {
+				if ctx.Err() != nil {
+					return
+				}
+				if _, err := s.Compact(path); err != nil {
+					report(name, err)
+				}
+			}
+		}
+	}
+}
+
+// Remove closes the service of name and forgets it, so the next Get creates
+// it again. It first writes the payloads queued by the registry's RecordAsync
+// so far, so it must not be called from the OnError of a service; payloads
+// queued for the service while it is removed fail with ErrClosed and are
+// reported like other failed async writes, see AsyncError.
+func (g *Registry) Remove(name string) error {
+	if _, ok := g.Lookup(name); !ok {
+		return nil
+	}
+	g.flushQueue()
+
+	g.mu.Lock()
+	s, ok := g.services[name]
+	delete(g.services, name)
+	g.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.Close()
+}
+
+// Close writes the queued async payloads, then closes every service. Later
+// calls fail with ErrClosed. Closing a closed registry does nothing.
+func (g *Registry) Close() error {
+	g.asyncMu.Lock()
+	if g.asyncClosed {
+		g.asyncMu.Unlock()
+		return nil
+	}
+	g.asyncClosed = true
+	queue, drained := g.queue, g.drained
+	g.queue = nil
+	g.asyncMu.Unlock()
+
+	if queue != nil {
+		close(queue)
+		<-drained
+	}
+
+	g.mu.Lock()
+	g.closed = true
+	services := g.services
+	g.services = nil
+	g.mu.Unlock()
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		if err := services[name].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("service %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// all returns the created services.
+func (g *Registry) all() []*Service {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Collect(maps.Values(g.services))
+}
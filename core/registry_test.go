@@ -0,0 +1,47 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistryRemoveWritesQueued(t *testing.T) {
+	dir := t.TempDir()
+	g := NewRegistry(func(name string) (*Service, error) {
+		return New(dir, name, []string{"id"}, "daily"), nil
+	})
+	defer g.Close()
+	for _, id := range []string{"1", "2", "3"} {
+		if err := g.RecordAsync("booking", map[string]interface{}{"id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, _ := g.Lookup("booking")
+	if err := g.Remove("booking"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rows(t, s), " "); got != "1 2 3" {
+		t.Errorf("rows = %q, want the queued payloads", got)
+	}
+}
+
+func TestRegistryRemovedServiceReportsQueued(t *testing.T) {
+	var failed []error
+	s := New(t.TempDir(), "booking", []string{"id"}, "daily")
+	s.OnError = func(err error) { failed = append(failed, err) }
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service is closed by a Remove racing with the queued payload
+	g := &Registry{}
+	g.queue = make(chan registryItem, 1)
+	g.drained = make(chan struct{})
+	g.queue <- registryItem{service: s, payload: map[string]interface{}{"id": "1"}}
+	close(g.queue)
+	g.drain(g.queue, g.drained)
+	if len(failed) != 1 || !errors.Is(failed[0], ErrClosed) {
+		t.Errorf("reported %v, want the payload failed with ErrClosed", failed)
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Placement is where a row written by RecordResult landed.
+type Placement struct {
+	Path      string // the CSV file, see BatchPath
+	Suffix    string // rotation suffix of the file's period
+	Partition string // PartitionBy or GroupBy value of the row, if any
+
+	// Row is the 1-based data row of the file, not counting the header, for
+	// Query or a CSV reader to find the row again. It is counted by the
+	// service, so rows appended to the same file by other processes, e.g.,
+	// with FileLock, or removed by Compact can shift it. It is 0 for rows
+	// that only went to Sinks other than the FileSink.
+	Row int64
+}
+
+// WriteResult describes what a RecordResult call wrote.
+type WriteResult struct {
+	// Rows holds the placement of every written row, by file in the order the
+	// files were written and in payload order within a file. Rows skipped by
+	// Dedup, Filter or Sampling have none.
+	Rows []Placement
+
+	// Bytes is the number of bytes appended to the CSV files.
+	Bytes int64
+}
+
+// RecordResult is like RecordContext and also returns where the rows landed,
+// so callers can log or store a pointer to each record.
+func (r *Service) RecordResult(ctx context.Context, payload interface{}) (WriteResult, error) {
+	batches, err := r.recordTraced(ctx, payload, time.Time{}, true)
+	var res WriteResult
+	for _, b := range batches {
+		for i := range b.Rows {
+			p := Placement{Path: r.BatchPath(b), Suffix: b.Suffix, Partition: b.Partition}
+			if b.firstRow > 0 {
+				p.Row = b.firstRow + int64(i)
+			}
+			res.Rows = append(res.Rows, p)
+		}
+		res.Bytes += b.bytes
+	}
+	return res, err
+}
+
+// recordTraced records the payload in a span, to the period of at unless it
+// is zero. With place, it returns every written batch, numbering the rows of
+// the files, including batches of other periods written for EventTimeColumn.
+func (r *Service) recordTraced(ctx context.Context, payload interface{}, at time.Time, place bool) ([]*Batch, error) {
+	return r.watched(ctx, func(w *watch) ([]*Batch, error) {
+		return r.recordLocked(ctx, payload, at, place, w)
+	})
+}
+
+// recordLocked is recordTraced for a call tracked by the Watchdog with w, if
+// any. It writes nothing if the call was abandoned before it got the lock.
+func (r *Service) recordLocked(ctx context.Context, payload interface{}, at time.Time, place bool, w *watch) ([]*Batch, error) {
+	end := r.startSpan(ctx, "recordtocsv.Record")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !w.begin() {
+		end(nil, ErrStalled)
+		return nil, ErrStalled
+	}
+	if r.closed {
+		end(nil, ErrClosed)
+		return nil, ErrClosed
+	}
+
+	if r.actor = ActorFrom(ctx); r.actor != "" {
+		defer func() { r.actor = "" }()
+	}
+	if len(r.ContextColumns) > 0 {
+		r.ctxValues = r.contextValues(ctx)
+		defer func() { r.ctxValues = nil }()
+	}
+	if len(r.Enrichers) > 0 {
+		r.ctx = ctx
+		defer func() { r.ctx = nil }()
+	}
+	if r.paused.Load() {
+		err := r.pauseRecord(payload, at)
+		end(nil, err)
+		return nil, err
+	}
+	if !r.fence(ctx, at) {
+		end(nil, ErrClosed)
+		return nil, ErrClosed
+	}
+	if place {
+		r.placed = []*Batch{}
+		defer func() { r.placed = nil }()
+	}
+	start := time.Now()
+	lastSuffix := r.lastSuffix
+	batches, err := r.record(payload, at)
+	r.observe(batches, start, err)
+	end(r.batchAttrs(batches, lastSuffix != "" && lastSuffix != r.lastSuffix), err)
+	return r.placed, err
+}
+
+// placing reports whether the rows being written are numbered for
+// RecordResult.
+func (r *Service) placing() bool {
+	return r.placed != nil
+}
+
+// fileRows returns the number of data rows of the file at path, counting
+// them on first use. A missing file has none.
+func (r *Service) fileRows(path string) (int64, error) {
+	if n, ok := r.rowCounts[path]; ok {
+		return n, nil
+	}
+	f, err := r.OpenFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	cr := r.csvReader(f)
+	cr.ReuseRecord = true
+	var rows int64
+	for {
+		if _, err := cr.Read(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to count rows of %q: %w", path, err)
+		}
+		rows++
+	}
+	rows = max(rows-1, 0) // The header
+	if r.rowCounts == nil {
+		r.rowCounts = make(map[string]int64)
+	}
+	r.rowCounts[path] = rows
+	return rows, nil
+}
+
+// countRows adds appended rows to the count of the file at path, if it is
+// known.
+func (r *Service) countRows(path string, rows int) {
+	if n, ok := r.rowCounts[path]; ok {
+		r.rowCounts[path] = n + int64(rows)
+	}
+}
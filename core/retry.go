@@ -0,0 +1,67 @@
+package core
+
+import "time"
+
+// RetryPolicy controls how writes that fail with a transient I/O error are
+// retried. The zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values of 0 or 1 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry; it doubles after each
+	// failed attempt. Defaults to 50ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts. Defaults to 5s.
+	MaxBackoff time.Duration
+
+	// Retryable reports whether err is worth retrying. Defaults to IsTransient.
+	Retryable func(err error) bool
+}
+
+// IsTransient reports whether err is an I/O error that may succeed when tried
+// again, such as a full disk, a busy file or a stale network filesystem handle.
+func IsTransient(err error) bool {
+	return isTransientErrno(err)
+}
+
+// Do runs fn, retrying it according to the policy while it fails with a
+// retryable error, and returns the last error. It is the retry loop of the
+// service's writes, for wrappers such as middleware/retry.
+func (p RetryPolicy) Do(fn func() error) error {
+	return p.do(fn, nil)
+}
+
+// do runs fn, retrying it according to the policy while it fails with a
+// retryable error. onRetry, if not nil, is called before each retry. The last
+// error is returned.
+func (p RetryPolicy) do(fn func() error, onRetry func(attempt int, err error, backoff time.Duration)) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = 50 * time.Millisecond
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, backoff)
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
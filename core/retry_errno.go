@@ -0,0 +1,21 @@
+//go:build !plan9
+
+package core
+
+import (
+	"errors"
+	"syscall"
+)
+
+func isTransientErrno(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case syscall.ENOSPC, syscall.EBUSY, syscall.EAGAIN, syscall.EINTR,
+		syscall.EIO, syscall.ETIMEDOUT, syscall.ESTALE:
+		return true
+	}
+	return errno.Timeout() || errno.Temporary()
+}
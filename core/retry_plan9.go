@@ -0,0 +1,7 @@
+//go:build plan9
+
+package core
+
+func isTransientErrno(err error) bool {
+	return false
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// ErrNonConforming is matched by the errors of records whose rows wouldn't
+// conform to RFC 4180 with RFC4180 set.
+var ErrNonConforming = errors.New("output doesn't conform to RFC 4180")
+
+// validateRFC4180 checks that RFC4180 isn't combined with settings that add
+// lines or bytes outside the records.
+func (r *Service) validateRFC4180() error {
+	if !r.RFC4180 {
+		return nil
+	}
+	var errs []error
+	if len(r.Preamble) > 0 {
+		errs = append(errs, errors.New("RFC4180 can't be combined with Preamble"))
+	}
+	if r.WriteBOM {
+		errs = append(errs, errors.New("RFC4180 can't be combined with WriteBOM"))
+	}
+	return errors.Join(errs...)
+}
+
+// checkConforming checks that data, rows encoded by the service that are
+// width fields wide, conforms to RFC 4180.
+func checkConforming(data []byte, width int) error {
+	report, err := reader.LintReader(bytes.NewReader(data), reader.LintOptions{Fields: width, MaxViolations: 1})
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("%w: %v", ErrNonConforming, report.Err())
+	}
+	return nil
+}
+
+// Lint checks that the CSV file at path, in the service's FS, strictly
+// conforms to RFC 4180, see reader.LintReader, e.g., to find the files
+// written before RFC4180 was set. Files with Compression or EncryptionKey are
+// checked as OpenFile reads them. It returns an error if the file can't be
+// read, and the violations in the report.
+func (r *Service) Lint(path string) (reader.LintReport, error) {
+	f, err := r.OpenFile(path)
+	if err != nil {
+		return reader.LintReport{}, err
+	}
+	defer f.Close()
+	report, err := reader.LintReader(f, reader.LintOptions{})
+	if err != nil {
+		return report, fmt.Errorf("failed to lint %q: %w", path, err)
+	}
+	return report, nil
+}
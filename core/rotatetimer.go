@@ -0,0 +1,108 @@
+package core
+
+import "time"
+
+// maxRotationWait bounds the wait of RotateOnTime and MaxFileOpenDuration for
+// the rotation of a period.
+const maxRotationWait = time.Minute
+
+// armRotation schedules the rotation of the period of suffix when it is due,
+// see rotationDue, once per period. The caller must hold r.mu.
+func (r *Service) armRotation(suffix string) {
+	if !r.RotateOnTime && r.MaxFileOpenDuration <= 0 || r.DryRun || r.rotationSuffix == suffix {
+		return
+	}
+	now, err := r.Now()
+	if err != nil {
+		return
+	}
+	due, err := r.rotationDue(suffix, now)
+	if err != nil {
+		return
+	}
+	r.stopRotation()
+	r.rotationSuffix = suffix
+	r.background.Add(1)
+	// Timers run on the monotonic clock, so a wait ending at the boundary
+	// misses it after the wall clock was changed; wake up now and then to
+	// check the clock again instead
+	wait := min(max(due.Sub(now), 0), maxRotationWait)
+	r.rotationTimer = time.AfterFunc(wait, func() {
+		defer r.background.Done()
+		r.rotateOnTime(suffix)
+	})
+}
+
+// stopRotation cancels a scheduled rotation. The caller must hold r.mu.
+func (r *Service) stopRotation() {
+	if r.rotationTimer != nil && r.rotationTimer.Stop() {
+		r.background.Done()
+	}
+	r.rotationTimer = nil
+}
+
+// rotationDue returns when the files of the period of suffix are rotated
+// without a later record: at the end of the period with RotateOnTime,
+// MaxFileOpenDuration after it otherwise, in the zone of now.
+func (r *Service) rotationDue(suffix string, now time.Time) (time.Time, error) {
+	start, err := time.ParseInLocation(suffixLayouts[r.RecordType], suffix, now.Location())
+	if err != nil {
+		return time.Time{}, err
+	}
+	due := r.nextPeriod(start)
+	if !r.RotateOnTime {
+		due = due.Add(r.MaxFileOpenDuration)
+	}
+	return due, nil
+}
+
+// rotationTarget returns the period the files of the period of suffix rotate
+// to now, or "" if they aren't due yet. The caller must hold r.mu.
+func (r *Service) rotationTarget(suffix string) (string, error) {
+	now, err := r.Now()
+	if err != nil {
+		return "", err
+	}
+	due, err := r.rotationDue(suffix, now)
+	if err != nil || now.Before(due) {
+		return "", err
+	}
+	next, err := r.Suffix(now)
+	if err != nil {
+		return "", err
+	}
+	if next = r.holdSuffix(next); next == suffix {
+		return "", nil
+	}
+	return next, nil
+}
+
+// rotateOnTime rotates the files of the period of suffix if they are due,
+// unless a write did already, and waits again otherwise.
+func (r *Service) rotateOnTime(suffix string) {
+	if r.OrderedRotation {
+		r.mu.Lock()
+		next, _ := r.rotationTarget(suffix)
+		r.mu.Unlock()
+		if next != "" {
+			r.Flush() // Rows queued before the end of the period go to its files
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.lastSuffix != suffix {
+		return
+	}
+	next, err := r.rotationTarget(suffix)
+	if err != nil {
+		r.logError("failed to rotate files", "error", err)
+		return
+	}
+	if next == "" {
+		// Woken up to check the clock, or it was set back
+		r.rotationTimer, r.rotationSuffix = nil, ""
+		r.armRotation(suffix)
+		return
+	}
+	r.advance(next)
+}
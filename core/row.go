@@ -0,0 +1,317 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrMarshalPayload is returned for a payload that can't be converted to
+// JSON, or whose JSON isn't an object, to be mapped onto the columns.
+var ErrMarshalPayload = errors.New("failed to marshal payload")
+
+// MissingColumnsError is returned when a payload lacks required columns, see
+// Service.Strict and Service.RequiredColumns.
+type MissingColumnsError struct {
+	// Columns lists the missing columns in configuration order.
+	Columns []string
+}
+
+func (e *MissingColumnsError) Error() string {
+	return fmt.Sprintf("payload is missing required columns: %s", strings.Join(e.Columns, ", "))
+}
+
+// Rows maps a payload onto the service columns. Slice and array payloads, such
+// as []map[string]interface{} or a slice of structs, produce one row per
+// element; any other payload produces a single row.
+func (r *Service) Rows(data interface{}) ([][]string, error) {
+	return r.rows(r.Column, data)
+}
+
+func (r *Service) rows(column []string, data interface{}) ([][]string, error) {
+	mapped, err := r.mapRows(column, data)
+	if err != nil {
+		return nil, err
+	}
+	records := make([][]string, len(mapped))
+	for i, m := range mapped {
+		records[i] = m.cells
+	}
+	return records, nil
+}
+
+// mappedRow is a single payload mapped onto the columns.
+type mappedRow struct {
+	fields  map[string]interface{} // decoded payload fields
+	cells   []string               // cell values in column order
+	spills  []spill                // cells moved to sidecar files
+	invalid *InvalidValueError     // set if the row goes to the quarantine file
+	skip    bool                   // set if Filter left the row out
+}
+
+// mapRows maps every element of the payload, see Rows.
+func (r *Service) mapRows(column []string, data interface{}) ([]mappedRow, error) {
+	items, list := splitPayload(data)
+	mapped := make([]mappedRow, 0, len(items))
+	for i, item := range items {
+		m, err := r.mapRow(column, item)
+		if err != nil {
+			if list {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			return nil, err
+		}
+		if !m.skip {
+			mapped = append(mapped, m)
+		}
+	}
+	return mapped, nil
+}
+
+// splitPayload returns the elements of a slice or array payload, or the
+// payload itself. list reports whether data was a slice or array.
+func splitPayload(data interface{}) (items []interface{}, list bool) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !isList(v) {
+		return []interface{}{data}, false
+	}
+	items = make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, true
+}
+
+// isList reports whether v holds several payloads. Byte slices are excluded,
+// since JSON encodes them as a single string.
+func isList(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// Row maps the payload onto the service columns and returns the cell values in
+// column order, applying the service's validation rules. It returns nil for a
+// payload left out by Filter.
+func (r *Service) Row(data interface{}) ([]string, error) {
+	m, err := r.mapRow(r.Column, data)
+	return m.cells, err
+}
+
+func (r *Service) mapRow(column []string, data interface{}) (mappedRow, error) {
+	fields, err := r.fields(data)
+	if err != nil {
+		return mappedRow{}, err
+	}
+	if len(r.Defaults) > 0 {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		r.applyDefaults(fields)
+	}
+	if r.RowIDs != nil {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		r.assignID(fields)
+	}
+	if r.Provenance != nil {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		r.stamp(fields)
+	}
+	if len(r.ctxValues) > 0 {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		r.stampContext(fields)
+	}
+	if len(r.Enrichers) > 0 {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		if err := r.enrich(fields); err != nil {
+			return mappedRow{}, err
+		}
+	}
+	if len(r.Derive) > 0 {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		if err := r.derive(fields); err != nil {
+			return mappedRow{}, err
+		}
+	}
+	if len(r.Templates) > 0 {
+		if fields == nil {
+			fields = map[string]interface{}{} // A null payload
+		}
+		if err := r.render(column, fields); err != nil {
+			return mappedRow{}, err
+		}
+	}
+	if r.normalizing() {
+		r.normalize(column, fields)
+	}
+	if r.Filter != nil && !r.inTx && !r.accept(fields) {
+		return mappedRow{skip: true}, nil
+	}
+	if err := r.checkRequired(column, fields); err != nil {
+		return mappedRow{}, err
+	}
+	invalid, err := r.applyRules(column, fields)
+	if err != nil {
+		return mappedRow{}, err
+	}
+	cells, spills, _, err := r.cells(column, fields)
+	if err != nil {
+		return mappedRow{}, err
+	}
+	if r.RowChecksums != nil {
+		r.checksumRow(column, cells)
+	}
+	return mappedRow{fields: fields, cells: cells, spills: spills, invalid: invalid}, nil
+}
+
+// fields converts a single payload to its column values keyed by name.
+func (r *Service) fields(data interface{}) (map[string]interface{}, error) {
+	return fieldsOf(data, r.CSVTags)
+}
+
+// fieldsOf reads structs through their cached field plan and flat maps with
+// mapFields, and converts anything else with toMap, which gives the same
+// result for structs but is several times slower. csvTags names struct
+// fields after their csv tags, see Service.CSVTags.
+func fieldsOf(data interface{}, csvTags bool) (map[string]interface{}, error) {
+	if fields, ok, err := mapFields(data); ok {
+		return fields, err
+	}
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil // JSON null
+		}
+		if planFor(v.Type().Elem(), csvTags) == nil {
+			break // e.g., a MarshalJSON method on the pointer
+		}
+		v = v.Elem()
+	}
+	if v.IsValid() {
+		if plan := planFor(v.Type(), csvTags); plan != nil {
+			return plan.structFields(v)
+		}
+	}
+	fields, err := toMap(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := marshalMapCells(v, fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// checkRequired returns a *MissingColumnsError if fields lacks a column
+// required by Strict or RequiredColumns.
+func (r *Service) checkRequired(column []string, fields map[string]interface{}) error {
+	required := r.RequiredColumns
+	if r.Strict {
+		required = column
+	}
+	var missing []string
+	for _, col := range required {
+		if val, ok := fields[col]; !ok || val == nil {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingColumnsError{Columns: missing}
+	}
+	return nil
+}
+
+// Values maps the payload onto the given columns and returns the cell values in
+// column order. Missing or nil fields become empty strings.
+func Values(column []string, data interface{}) ([]string, error) {
+	dataMap, err := fieldsOf(data, false)
+	if err != nil {
+		return nil, err
+	}
+	return values(column, dataMap), nil
+}
+
+// toMap converts the payload to a map for easy column-based access.
+// Numbers are kept as json.Number, so large integers don't lose precision.
+func toMap(data interface{}) (map[string]interface{}, error) {
+	var dataMap map[string]interface{}
+	// Using json.Marshal then json.Unmarshal is acceptable for generic interface{}
+	// but direct struct field mapping is more efficient if payload type is known.
+	// For this generic case, it's a common pattern.
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w to JSON: %w", ErrMarshalPayload, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(jsonBytes))
+	dec.UseNumber()
+	if err := dec.Decode(&dataMap); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal JSON to map: %w", ErrMarshalPayload, err)
+	}
+	return dataMap, nil
+}
+
+// DecodeJSON is json.Unmarshal, but keeps numbers as json.Number so they are
+// written as sent, e.g., "19.90" rather than "19.9". Use it to decode JSON
+// payloads before recording them.
+func DecodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+func values(column []string, dataMap map[string]interface{}) []string {
+	record := make([]string, len(column))
+	for i, col := range column {
+		record[i] = formatValue(dataMap[col]) // Empty string for missing or nil values
+	}
+	return record
+}
+
+// formatValue renders a decoded field value as a cell. Numbers keep their
+// JSON text, times arrive as their RFC 3339 JSON encoding, and nested objects
+// and arrays are written as compact JSON.
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	}
+	return fmt.Sprintf("%v", val)
+}
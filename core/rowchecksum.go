@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// RowChecksums fills a column with a checksum of the other cells of every
+// row, so tampering with or corruption of single rows of long-kept audit
+// files is found by VerifyRows, or by reader.VerifyRow on the read side.
+// Checksums are computed from the cells as written, after Rules,
+// truncation and CellCompression, and replace payload fields of the same
+// key.
+type RowChecksums struct {
+	// Column receives the checksums and must be one of the columns.
+	Column string
+
+	// Key, if set, makes the checksums HMAC-SHA256 with this key instead of
+	// SHA-256, so altered rows can't be given a matching checksum without
+	// the key.
+	Key []byte
+}
+
+// ErrRowChecksum is matched by *RowChecksumError with errors.Is.
+var ErrRowChecksum = errors.New("row checksum mismatch")
+
+// RowChecksumError is returned by VerifyRows for a row whose cells don't
+// match its checksum.
+type RowChecksumError struct {
+	Path string
+	Line int // 1 for the first row after the header
+}
+
+func (e *RowChecksumError) Error() string {
+	return fmt.Sprintf("%v: line %d of %q", ErrRowChecksum, e.Line, e.Path)
+}
+
+func (e *RowChecksumError) Is(target error) bool {
+	return target == ErrRowChecksum
+}
+
+// validateRowChecksums checks that the RowChecksums column is one of the
+// columns.
+func (r *Service) validateRowChecksums() error {
+	if r.RowChecksums == nil {
+		return nil
+	}
+	col := r.RowChecksums.Column
+	if col == "" {
+		return errors.New("row checksum column is not set")
+	}
+	if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+		return fmt.Errorf("row checksum column %q is not one of the columns", col)
+	}
+	if r.RowIDs != nil && r.RowIDs.Column == col {
+		return fmt.Errorf("row checksum column %q is also the row ID column", col)
+	}
+	return nil
+}
+
+// checksumRow sets the RowChecksums cell of the row of cells in column
+// order, if the column is one of them.
+func (r *Service) checksumRow(column, cells []string) {
+	i := slices.Index(column, r.RowChecksums.Column)
+	if i < 0 {
+		return
+	}
+	others := make([]string, 0, len(cells)-1)
+	others = append(append(others, cells[:i]...), cells[i+1:]...)
+	cells[i] = reader.RowChecksum(others, r.RowChecksums.Key)
+}
+
+// VerifyRows checks the RowChecksums of every row of the CSV file at path
+// and returns a *RowChecksumError for each row that doesn't match, joined
+// with errors.Join. Files without the checksum column, e.g., written before
+// RowChecksums was set, fail with an error.
+func (r *Service) VerifyRows(path string) error {
+	r.mu.Lock()
+	opts := r.RowChecksums
+	label := ""
+	if opts != nil {
+		label = r.label(opts.Column)
+	}
+	r.mu.Unlock()
+	if opts == nil {
+		return errors.New("RowChecksums is not set")
+	}
+
+	f, err := r.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cr := r.csvReader(f)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header of %q: %w", path, err)
+	}
+	col := slices.Index(header, label)
+	if col < 0 {
+		return fmt.Errorf("%q has no row checksum column %q", path, label)
+	}
+
+	var errs []error
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read CSV file %q: %w", path, err))
+			break
+		}
+		if !reader.VerifyRow(row, col, opts.Key) {
+			errs = append(errs, &RowChecksumError{Path: path, Line: line})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RowIDs fills a column with a generated identifier for every row, so rows
+// can be cross-referenced even when their payloads carry no ID. Payloads
+// that have a value for the column keep it. IDs are set after Defaults and
+// before Provenance and Derive, so derived columns and Filter see them.
+type RowIDs struct {
+	// Column receives the IDs and must be one of the columns.
+	Column string
+
+	// Generator generates the IDs. Defaults to UUIDv7.
+	Generator IDGenerator
+}
+
+// IDGenerator generates the identifiers of RowIDs.
+type IDGenerator interface {
+	// NewID returns a new identifier for a row written at t, the time of the
+	// service's Clock. It is called while the service is locked.
+	NewID(t time.Time) string
+}
+
+// IDGeneratorFunc adapts a function to an IDGenerator.
+type IDGeneratorFunc func(t time.Time) string
+
+func (f IDGeneratorFunc) NewID(t time.Time) string { return f(t) }
+
+// UUIDv7 generates RFC 9562 version 7 UUIDs, such as
+// "01920f4e-7c3a-7b2e-9c1d-3f5a8e2b6d40", which sort by time to the
+// millisecond. The 12 bits after the version hold the fraction of the
+// millisecond, so IDs of the same millisecond sort too, to about 250ns.
+type UUIDv7 struct{}
+
+func (UUIDv7) NewID(t time.Time) string {
+	var u [16]byte
+	ms := uint64(t.UnixMilli())
+	frac := uint16(uint64(t.Nanosecond()%1e6) * 4096 / 1e6)
+	binary.BigEndian.PutUint64(u[:8], ms<<16|uint64(frac))
+	rand.Read(u[8:])
+	u[6] = 0x70 | u[6]&0x0f // Version 7
+	u[8] = 0x80 | u[8]&0x3f // RFC 9562 variant
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	hex.Encode(s[9:13], u[4:6])
+	hex.Encode(s[14:18], u[6:8])
+	hex.Encode(s[19:23], u[8:10])
+	hex.Encode(s[24:], u[10:])
+	s[8], s[13], s[18], s[23] = '-', '-', '-', '-'
+	return string(s[:])
+}
+
+// ULID generates ULIDs, such as "01J47ZV3PQ8YB2K6XG4N5RT9WD": 26 Crockford
+// base32 characters of a millisecond timestamp followed by 80 random bits,
+// which sort by time to the millisecond.
+type ULID struct{}
+
+// crockford is the Crockford base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (ULID) NewID(t time.Time) string {
+	var u [16]byte
+	ms := uint64(t.UnixMilli())
+	binary.BigEndian.PutUint64(u[:8], ms<<16)
+	rand.Read(u[6:])
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- { // 128 bits, 5 at a time from the right
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// validateRowIDs checks that the column of RowIDs is one of the columns.
+func (r *Service) validateRowIDs() error {
+	if r.RowIDs == nil {
+		return nil
+	}
+	if r.RowIDs.Column == "" {
+		return errors.New("row ID column is not set")
+	}
+	if !slices.Contains(r.Column, r.RowIDs.Column) && !r.DiscoverColumns {
+		return fmt.Errorf("row ID column %q is not one of the columns", r.RowIDs.Column)
+	}
+	return nil
+}
+
+// assignID sets the RowIDs column of fields, unless the payload has a value
+// for it.
+func (r *Service) assignID(fields map[string]interface{}) {
+	col := r.RowIDs.Column
+	if v, ok := fields[col]; ok && v != nil && v != "" {
+		return
+	}
+	var gen IDGenerator = UUIDv7{}
+	if r.RowIDs.Generator != nil {
+		gen = r.RowIDs.Generator
+	}
+	fields[col] = gen.NewID(r.clock())
+}
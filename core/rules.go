@@ -0,0 +1,315 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidValue is matched by *InvalidValueError with errors.Is.
+var ErrInvalidValue = errors.New("invalid value")
+
+// InvalidValueError is returned when a value breaks its column rule, see
+// Service.Rules.
+type InvalidValueError struct {
+	Column string
+	Value  string
+	Reason string
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("invalid value %q for column %q: %s", e.Value, e.Column, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidValue.
+func (e *InvalidValueError) Is(target error) bool {
+	return target == ErrInvalidValue
+}
+
+// ColumnType is the declared type of a column. Values are coerced to its
+// canonical cell text, e.g., "1e3" to "1000" for TypeInt.
+type ColumnType int
+
+const (
+	// TypeString writes values as they are.
+	TypeString ColumnType = iota
+	// TypeInt accepts integers, including integral floats and numeric strings.
+	TypeInt
+	// TypeFloat accepts finite numbers and numeric strings.
+	TypeFloat
+	// TypeBool accepts booleans and the strings strconv.ParseBool accepts.
+	TypeBool
+	// TypeTime accepts times in the rule's Layout, RFC 3339 (the encoding of
+	// time.Time values) or Unix seconds, and writes them in Layout.
+	TypeTime
+	// TypeDecimal accepts numbers and numeric strings like TypeFloat, but
+	// without converting them to binary floating point, so amounts of money
+	// keep the digits they were sent with, e.g., "19.90", or are rounded to
+	// the rule's Scale.
+	TypeDecimal
+)
+
+var columnTypeNames = []string{"string", "int", "float", "bool", "time", "decimal"}
+
+func (t ColumnType) String() string {
+	if t < 0 || int(t) >= len(columnTypeNames) {
+		return fmt.Sprintf("ColumnType(%d)", int(t))
+	}
+	return columnTypeNames[t]
+}
+
+// numeric reports whether the cells of the type are numbers, which are
+// written in the column's NumberLocale.
+func (t ColumnType) numeric() bool {
+	return t == TypeInt || t == TypeFloat || t == TypeDecimal
+}
+
+// MarshalText encodes the type by name, e.g., "int", for configuration files.
+func (t ColumnType) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(columnTypeNames) {
+		return nil, fmt.Errorf("unknown column type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a type name written by MarshalText.
+func (t *ColumnType) UnmarshalText(text []byte) error {
+	i := slices.Index(columnTypeNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown column type %q", text)
+	}
+	*t = ColumnType(i)
+	return nil
+}
+
+// InvalidPolicy decides what happens to a record with a value that breaks its
+// column rule.
+type InvalidPolicy int
+
+const (
+	// InvalidReject fails the record with an *InvalidValueError.
+	InvalidReject InvalidPolicy = iota
+	// InvalidNull writes the value as an empty cell.
+	InvalidNull
+	// InvalidQuarantine writes the record to the quarantine file instead, see
+	// QuarantinePath.
+	InvalidQuarantine
+)
+
+var invalidPolicyNames = []string{"reject", "null", "quarantine"}
+
+func (p InvalidPolicy) String() string {
+	if p < 0 || int(p) >= len(invalidPolicyNames) {
+		return fmt.Sprintf("InvalidPolicy(%d)", int(p))
+	}
+	return invalidPolicyNames[p]
+}
+
+// MarshalText encodes the policy by name, e.g., "quarantine".
+func (p InvalidPolicy) MarshalText() ([]byte, error) {
+	if p < 0 || int(p) >= len(invalidPolicyNames) {
+		return nil, fmt.Errorf("unknown invalid value policy %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a policy name written by MarshalText.
+func (p *InvalidPolicy) UnmarshalText(text []byte) error {
+	i := slices.Index(invalidPolicyNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown invalid value policy %q", text)
+	}
+	*p = InvalidPolicy(i)
+	return nil
+}
+
+// ColumnRule declares the type and constraints of a column. Missing, null and
+// empty values are left alone; use RequiredColumns to insist on a value.
+type ColumnRule struct {
+	Type ColumnType `json:"type,omitempty"`
+
+	// Layout is the time layout of TypeTime cells, RFC 3339 by default.
+	Layout string `json:"layout,omitempty"`
+
+	// Scale, if set, writes TypeDecimal cells with exactly this many
+	// decimals, e.g., "19.90" for 19.9 with a Scale of 2, rounding half away
+	// from zero. Without it, cells keep the decimals they were given.
+	Scale int `json:"scale,omitempty"`
+
+	// Pattern is a regular expression the cell must match. Anchor it with ^
+	// and $ to match the whole cell.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Enum, if set, lists the allowed cells.
+	Enum []string `json:"enum,omitempty"`
+
+	// MaxLength is the maximum number of characters of the cell.
+	MaxLength int `json:"max_length,omitempty"`
+
+	// Locale, if set, replaces the service's NumberLocale for the cells of a
+	// TypeInt, TypeFloat or TypeDecimal column.
+	Locale *NumberLocale `json:"locale,omitempty"`
+
+	// OnInvalid is applied to values that can't be coerced to Type or break a
+	// constraint.
+	OnInvalid InvalidPolicy `json:"on_invalid,omitempty"`
+}
+
+// patterns caches the compiled Pattern of the rules.
+var patterns sync.Map // string -> *regexp.Regexp
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// validateRules checks that every rule can be applied.
+func (r *Service) validateRules() error {
+	for col, rule := range r.Rules {
+		if rule.Type < TypeString || rule.Type > TypeDecimal {
+			return fmt.Errorf("rule for column %q: unknown type %d", col, int(rule.Type))
+		}
+		if rule.Scale < 0 || rule.Scale > maxDecimalExp {
+			return fmt.Errorf("rule for column %q: scale %d out of range", col, rule.Scale)
+		}
+		if rule.Scale > 0 && rule.Type != TypeDecimal {
+			return fmt.Errorf("rule for column %q: scale is only supported for decimal columns", col)
+		}
+		if rule.OnInvalid < InvalidReject || rule.OnInvalid > InvalidQuarantine {
+			return fmt.Errorf("rule for column %q: unknown invalid value policy %d", col, int(rule.OnInvalid))
+		}
+		if _, err := compilePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("rule for column %q: invalid pattern: %w", col, err)
+		}
+	}
+	return nil
+}
+
+// applyRules coerces the ruled columns of fields in place and nulls invalid
+// values where the rule says so. It returns the violation that quarantines
+// the row, if any, or an error for a rule that rejects it.
+func (r *Service) applyRules(column []string, fields map[string]interface{}) (*InvalidValueError, error) {
+	if len(r.Rules) == 0 {
+		return nil, nil
+	}
+	var quarantine *InvalidValueError
+	for _, col := range column {
+		rule, ok := r.Rules[col]
+		if !ok {
+			continue
+		}
+		cell, invalid := checkRule(col, rule, fields[col])
+		if invalid == nil {
+			if cell != "" && rule.Type.numeric() {
+				cell = r.numberLocale(col).Format(cell)
+			}
+			if cell != "" {
+				fields[col] = cell
+			}
+			continue
+		}
+		switch rule.OnInvalid {
+		case InvalidNull:
+			fields[col] = nil
+		case InvalidQuarantine:
+			if quarantine == nil {
+				quarantine = invalid
+			}
+		default:
+			return nil, invalid
+		}
+	}
+	return quarantine, nil
+}
+
+// checkRule coerces a field value to the rule's type and checks its
+// constraints. It returns an empty cell for values the rule leaves alone.
+func checkRule(col string, rule ColumnRule, val interface{}) (string, *InvalidValueError) {
+	raw := formatValue(val)
+	if raw == "" {
+		return "", nil
+	}
+	fail := func(format string, args ...any) (string, *InvalidValueError) {
+		return "", &InvalidValueError{Column: col, Value: raw, Reason: fmt.Sprintf(format, args...)}
+	}
+	if isNested(val) && rule.Type != TypeString {
+		return fail("%s expected, got an object or array", rule.Type)
+	}
+
+	cell := raw
+	switch rule.Type {
+	case TypeInt:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(raw, 64)
+			if ferr != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return fail("not an integer")
+			}
+			n = int64(f)
+		}
+		cell = strconv.FormatInt(n, 10)
+	case TypeFloat:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return fail("not a number")
+		}
+		cell, _ = formatFloat(f, 64)
+	case TypeDecimal:
+		var ok bool
+		if cell, ok = formatDecimal(raw, rule.Scale); !ok {
+			return fail("not a decimal number")
+		}
+	case TypeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fail("not a boolean")
+		}
+		cell = strconv.FormatBool(b)
+	case TypeTime:
+		layout := rule.Layout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, raw)
+		if err != nil {
+			var ok bool
+			if t, ok = parseTimestamp(raw); !ok {
+				if t, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+					return fail("not a time in layout %q", layout)
+				}
+			}
+		}
+		cell = t.Format(layout)
+	}
+
+	if rule.MaxLength > 0 && utf8.RuneCountInString(cell) > rule.MaxLength {
+		return fail("longer than %d characters", rule.MaxLength)
+	}
+	if len(rule.Enum) > 0 && !slices.Contains(rule.Enum, cell) {
+		return fail("not one of %s", strings.Join(rule.Enum, ", "))
+	}
+	if rule.Pattern != "" {
+		re, err := compilePattern(rule.Pattern)
+		if err != nil {
+			return fail("invalid pattern: %v", err)
+		}
+		if !re.MatchString(cell) {
+			return fail("doesn't match %q", rule.Pattern)
+		}
+	}
+	return cell, nil
+}
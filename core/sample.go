@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+)
+
+// SamplingOptions configures writing only a sample of the records, so
+// recording can stay enabled on high-volume production traffic. Set either
+// Rate or Every.
+type SamplingOptions struct {
+	// Rate is the fraction of records kept, e.g., 0.01 for 1%, picked at
+	// random unless Key is set.
+	Rate float64
+
+	// Every, if positive, keeps the first of every Every records instead of
+	// a random fraction.
+	Every int
+
+	// Key, if set, names a payload field whose value decides, with Rate,
+	// whether a record is kept, so all records with the same key are kept or
+	// skipped together, e.g., every event of a sampled session. It doesn't
+	// have to be one of the columns. Records without the field are sampled at
+	// random.
+	Key string
+}
+
+// validate checks that exactly one of Rate and Every is set.
+func (o *SamplingOptions) validate() error {
+	switch {
+	case o.Every < 0:
+		return fmt.Errorf("sampling every %d records, must be positive", o.Every)
+	case o.Every > 0 && o.Rate != 0:
+		return fmt.Errorf("sampling sets both a rate and every %d records", o.Every)
+	case o.Every > 0 && o.Key != "":
+		return fmt.Errorf("sampling by key %q needs a rate, not every %d records", o.Key, o.Every)
+	case o.Every == 0 && !(o.Rate > 0 && o.Rate <= 1):
+		return fmt.Errorf("sampling rate %v, must be in (0, 1]", o.Rate)
+	}
+	return nil
+}
+
+// SampledOut returns the number of records skipped by Sampling.
+func (r *Service) SampledOut() int64 {
+	return r.sampledOut.Load()
+}
+
+// sample drops the rows left out by Sampling. The caller must hold r.mu.
+func (r *Service) sample(mapped []mappedRow) ([]mappedRow, error) {
+	opts := r.Sampling
+	if opts == nil {
+		return mapped, nil
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if r.inTx && len(mapped) > 0 {
+		// Kept or left out as a whole, by its first row
+		if r.keep(opts, mapped[0]) {
+			return mapped, nil
+		}
+		r.sampledOut.Add(int64(len(mapped)))
+		return nil, nil
+	}
+	kept := mapped[:0:0]
+	for _, m := range mapped {
+		if r.keep(opts, m) {
+			kept = append(kept, m)
+		}
+	}
+	if skipped := len(mapped) - len(kept); skipped > 0 {
+		r.sampledOut.Add(int64(skipped))
+	}
+	return kept, nil
+}
+
+// keep reports whether a row is part of the sample.
+func (r *Service) keep(opts *SamplingOptions, m mappedRow) bool {
+	if opts.Every > 0 {
+		n := r.sampleCount
+		r.sampleCount++
+		return n%uint64(opts.Every) == 0
+	}
+	if val, ok := m.fields[opts.Key]; opts.Key != "" && ok && val != nil {
+		h := fnv.New64a()
+		h.Write([]byte(formatValue(val)))
+		return float64(mix(h.Sum64())) < opts.Rate*math.MaxUint64
+	}
+	return rand.Float64() < opts.Rate
+}
+
+// mix spreads the bits of an FNV hash over its high bits, which barely vary
+// for short keys such as small numbers (the finalizer of MurmurHash3).
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
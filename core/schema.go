@@ -0,0 +1,279 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SchemaSuffix is appended to Filename for the file in Dir that persists the
+// columns found by DiscoverColumns and the schema changes of AddColumn and
+// RenameColumn, e.g., "booking_record.schema.json". With SchemaFiles, it is
+// also appended to the name of each CSV file for its FileSchema.
+const SchemaSuffix = ".schema.json"
+
+// ColumnPolicy decides what happens to payload keys that aren't one of the
+// columns.
+type ColumnPolicy int
+
+const (
+	// ColumnsIgnore drops unknown keys. This is the default.
+	ColumnsIgnore ColumnPolicy = iota
+
+	// ColumnsAppend adds unknown keys as new columns at the end of the header.
+	// The header of existing files is rewritten on their next write.
+	ColumnsAppend
+
+	// ColumnsReject fails the Record with an *UnknownColumnsError.
+	ColumnsReject
+)
+
+// UnknownColumnsError is returned for payloads with keys that aren't columns,
+// see ColumnsReject.
+type UnknownColumnsError struct {
+	// Columns lists the unknown keys in payload order.
+	Columns []string
+}
+
+func (e *UnknownColumnsError) Error() string {
+	return fmt.Sprintf("payload has unknown columns: %s", strings.Join(e.Columns, ", "))
+}
+
+// schemaFile is the JSON layout of the persisted schema.
+type schemaFile struct {
+	Columns    []string    `json:"columns"`
+	Version    int         `json:"version,omitempty"`
+	Migrations []Migration `json:"migrations,omitempty"`
+}
+
+// SchemaPath returns the path of the file persisting discovered columns and
+// schema changes.
+func (r *Service) SchemaPath() string {
+	return filepath.Join(r.Dir, r.filename()+SchemaSuffix)
+}
+
+// discover applies DiscoverColumns and NewColumns to the payload, updating
+// Column when it changes. The caller must hold r.mu.
+func (r *Service) discover(payload interface{}) error {
+	if !r.DiscoverColumns && r.NewColumns == ColumnsIgnore {
+		return nil
+	}
+
+	if r.DiscoverColumns && len(r.Column) == 0 {
+		column, err := r.loadSchema()
+		if err != nil {
+			return err
+		}
+		r.Column = column
+	}
+
+	items, _ := splitPayload(payload)
+	var added []string
+	for _, item := range items {
+		keys, err := payloadKeys(item)
+		if err != nil {
+			return err
+		}
+		discovering := len(r.Column) == 0 && len(added) == 0
+		for _, key := range keys {
+			if slices.Contains(r.Column, key) || slices.Contains(added, key) {
+				continue
+			}
+			if !discovering && r.NewColumns != ColumnsAppend {
+				if r.NewColumns == ColumnsReject {
+					return &UnknownColumnsError{Columns: unknownKeys(r.Column, keys)}
+				}
+				continue
+			}
+			added = append(added, key)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	column := append(slices.Clip(r.Column), added...)
+	if err := ValidateColumns(column); err != nil {
+		return fmt.Errorf("invalid discovered columns: %w", err)
+	}
+	if r.DiscoverColumns {
+		if err := r.saveSchema(column); err != nil {
+			return err
+		}
+	}
+	r.logInfo("discovered columns", "columns", added)
+	if len(r.Headers) > 0 {
+		r.Headers = append(slices.Clip(r.Headers), added...) // Labeled by their key
+	}
+	r.Column = column
+	return nil
+}
+
+// unknownKeys returns the keys that aren't one of the columns.
+func unknownKeys(column, keys []string) []string {
+	var unknown []string
+	for _, key := range keys {
+		if !slices.Contains(column, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+// payloadKeys returns the top-level keys of a single payload as encoded to
+// JSON: in field order for structs and sorted for maps.
+func payloadKeys(data interface{}) ([]string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w to JSON: %w", ErrMarshalPayload, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("%w: payload is not a JSON object", ErrMarshalPayload)
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload keys: %w", err)
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, fmt.Errorf("failed to read payload keys: %w", err)
+		}
+	}
+	return keys, nil
+}
+
+// loadSchema returns the persisted columns, or nil if none were discovered yet.
+func (r *Service) loadSchema() ([]string, error) {
+	s, err := r.registry()
+	if err != nil {
+		return nil, err
+	}
+	return s.Columns, nil
+}
+
+// saveSchema atomically replaces the persisted columns.
+func (r *Service) saveSchema(column []string) error {
+	s, err := r.registry()
+	if err != nil {
+		return err
+	}
+	next := *s
+	next.Columns = column
+	return r.writeRegistry(&next)
+}
+
+// registry returns the persisted schema, read on first use. A missing file is
+// an empty schema.
+func (r *Service) registry() (*schemaFile, error) {
+	if r.schema != nil {
+		return r.schema, nil
+	}
+	b, err := readFile(r.fs(), r.SchemaPath())
+	if errors.Is(err, os.ErrNotExist) {
+		r.schema = &schemaFile{}
+		return r.schema, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %q: %w", r.SchemaPath(), err)
+	}
+	var s schemaFile
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %q: %w", r.SchemaPath(), err)
+	}
+	r.schema = &s
+	return r.schema, nil
+}
+
+// writeRegistry atomically replaces the persisted schema.
+func (r *Service) writeRegistry(s *schemaFile) error {
+	if err := r.mkdirAll(); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+	if err := replaceFile(r.fs(), r.SchemaPath(), b); err != nil {
+		return fmt.Errorf("failed to save schema: %w", err)
+	}
+	r.schema = s
+	return nil
+}
+
+// widenHeader rewrites the file at filename with column as its header if the
+// file's header is a shorter prefix of column, padding the existing rows with
+// empty cells. Headers already checked are remembered, so the file is only
+// read again after the columns changed.
+func (r *Service) widenHeader(filename string, column []string) error {
+	if r.headers[filename] == len(column) {
+		return nil
+	}
+
+	release, err := r.hold(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // Created with the full header on first write
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rows, err := r.readRows(filename)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	header := rows[0]
+	if len(header) >= len(column) || !slices.Equal(header, column[:len(header)]) {
+		r.rememberHeader(filename, len(column))
+		return nil // Up to date, or not ours to change
+	}
+
+	records := rows[1:]
+	for i, row := range records {
+		if len(row) < len(column) {
+			records[i] = append(row, make([]string, len(column)-len(row))...)
+		}
+	}
+	if err := r.rewrite(filename, column, records); err != nil {
+		return fmt.Errorf("failed to widen header of %q: %w", filename, err)
+	}
+	r.logInfo("widened CSV header", "path", filename, "columns", len(column))
+	r.rememberHeader(filename, len(column))
+	return nil
+}
+
+// readRows reads every row of a CSV file written by the service.
+func (r *Service) readRows(filename string) ([][]string, error) {
+	f, err := r.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := r.csvReader(f)
+	rows, err := cr.ReadAll()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read CSV file %q: %w", filename, err)
+	}
+	return rows, nil
+}
+
+// rememberHeader records the header width of filename.
+func (r *Service) rememberHeader(filename string, width int) {
+	if r.headers == nil {
+		r.headers = make(map[string]int)
+	}
+	r.headers[filename] = width
+}
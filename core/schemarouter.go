@@ -0,0 +1,206 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ErrUnknownSchema is returned by a SchemaRouter for a payload whose Field
+// names no schema, when there is no Default.
+var ErrUnknownSchema = errors.New("payload matches no schema")
+
+// Schema is the columns of one type of payload, see SchemaRouter.
+type Schema struct {
+	Column  []string `json:"column"`
+	Headers []string `json:"headers,omitempty"` // header labels, see Service.Headers
+
+	// Filename is the name of the schema's files. Defaults to the base
+	// Filename, a dot and the schema's name, e.g., "events.payment" for
+	// schema "payment" of "events".
+	Filename string `json:"filename,omitempty"`
+}
+
+// SchemaRouter records payloads of several types, told apart by a field such
+// as "event_type", each to the files of its schema with the schema's
+// columns. The service of every schema is created from one base
+// configuration, so they can't drift apart:
+//
+//	events, err := core.NewSchemaRouter(&core.Config{
+//		Dir:        "files/events",
+//		Filename:   "events",
+//		RecordType: "daily",
+//		Rules:      rules,
+//	}, "event_type", map[string]core.Schema{
+//		"payment": {Column: []string{"id", "event_type", "amount", "currency"}},
+//		"refund":  {Column: []string{"id", "event_type", "amount", "reason"}},
+//	}, func(name string, s *core.Service) error {
+//		s.Compression = core.CompressionZstd
+//		return nil
+//	})
+//
+// Rules, Templates and Defaults of columns a schema lacks are ignored by its
+// service. A SchemaRouter is a Recorder and is safe for concurrent use.
+type SchemaRouter struct {
+	// Field is the payload field whose value names the schema.
+	Field string
+
+	// Default, if set, is the schema of payloads without Field, or whose
+	// Field names no schema.
+	Default string
+
+	// CSVTags reads Field from struct payloads named by their csv tags, like
+	// Service.CSVTags. Set it when configure sets it on the services.
+	CSVTags bool
+
+	schemas  map[string]Schema
+	registry *Registry
+}
+
+var _ Recorder = (*SchemaRouter)(nil)
+
+// NewSchemaRouter creates a SchemaRouter selecting schemas by field, and the
+// service of every schema from base with the schema's columns, headers and
+// filename, see NewFromConfig. configure, if set, is called with each new
+// service to set what Config doesn't hold, e.g., FS or Compression.
+func NewSchemaRouter(base *Config, field string, schemas map[string]Schema, configure func(name string, s *Service) error) (*SchemaRouter, error) {
+	if field == "" {
+		return nil, errors.New("schema field is not set")
+	}
+	if len(schemas) == 0 {
+		return nil, errors.New("no schemas")
+	}
+
+	router := &SchemaRouter{Field: field, schemas: maps.Clone(schemas)}
+	router.registry = NewRegistry(func(name string) (*Service, error) {
+		schema := router.schemas[name]
+		cfg := *base
+		cfg.Column = schema.Column
+		cfg.Headers = schema.Headers
+		cfg.Filename = schema.Filename
+		if cfg.Filename == "" {
+			cfg.Filename = base.Filename + "." + name
+		}
+		s, err := NewFromConfig(&cfg)
+		if err != nil {
+			return nil, err
+		}
+		if configure != nil {
+			if err := configure(name, s); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	})
+
+	// Create every service now, so a bad schema fails here and not on its
+	// first payload
+	for _, name := range slices.Sorted(maps.Keys(router.schemas)) {
+		if _, err := router.registry.Get(name); err != nil {
+			router.registry.Close()
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// Service returns the service of the schema with the given name.
+func (g *SchemaRouter) Service(name string) (*Service, bool) {
+	return g.registry.Lookup(name)
+}
+
+// Names returns the names of the schemas, sorted.
+func (g *SchemaRouter) Names() []string {
+	return slices.Sorted(maps.Keys(g.schemas))
+}
+
+// Record records the payload with the service of its schema. The elements
+// of a slice payload are grouped by schema and each group is recorded like
+// RecordBatch, so a failed group can follow groups already written.
+func (g *SchemaRouter) Record(payload interface{}) error {
+	items, _ := splitPayload(payload)
+	return g.RecordBatch(items)
+}
+
+// RecordBatch is like Record for the payloads together.
+func (g *SchemaRouter) RecordBatch(payloads []interface{}) error {
+	var names []string
+	groups := map[string][]interface{}{}
+	for _, payload := range payloads {
+		items, _ := splitPayload(payload)
+		for _, item := range items {
+			name, err := g.schemaOf(item)
+			if err != nil {
+				return err
+			}
+			if _, ok := groups[name]; !ok {
+				names = append(names, name)
+			}
+			groups[name] = append(groups[name], item)
+		}
+	}
+
+	var errs []error
+	for _, name := range names {
+		s, err := g.registry.Get(name)
+		if err == nil {
+			err = s.RecordBatch(groups[name])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schema %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RecordAsync queues the payload for the service of its schema, or every
+// element of a slice payload for the service of its own, see
+// Registry.RecordAsync.
+func (g *SchemaRouter) RecordAsync(payload interface{}) error {
+	items, _ := splitPayload(payload)
+	names := make([]string, len(items))
+	for i, item := range items {
+		name, err := g.schemaOf(item)
+		if err != nil {
+			return err
+		}
+		names[i] = name
+	}
+	for i, item := range items {
+		if err := g.registry.RecordAsync(names[i], item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush blocks until the payloads queued by RecordAsync so far have been
+// written or reported as failed.
+func (g *SchemaRouter) Flush() error {
+	return g.registry.Flush()
+}
+
+// Close writes the queued payloads and closes the service of every schema.
+func (g *SchemaRouter) Close() error {
+	return g.registry.Close()
+}
+
+// schemaOf returns the name of the schema of a single payload.
+func (g *SchemaRouter) schemaOf(payload interface{}) (string, error) {
+	fields, err := fieldsOf(payload, g.CSVTags)
+	if err != nil {
+		return "", err
+	}
+	name := ""
+	if val, ok := fields[g.Field]; ok && val != nil {
+		name = formatValue(val)
+	}
+	if _, ok := g.schemas[name]; ok {
+		return name, nil
+	}
+	if _, ok := g.schemas[g.Default]; ok && g.Default != "" {
+		return g.Default, nil
+	}
+	return "", fmt.Errorf("%w: %s %q", ErrUnknownSchema, g.Field, name)
+}
@@ -0,0 +1,1311 @@
+// Package core implements the CSV writer behind recordtocsv: column mapping,
+// time-based file rotation and safe appends.
+//
+// Most users only need the root recordtocsv package, which keeps the original
+// NewRecordToCSV/Record API on top of this package.
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/time/rate"
+)
+
+// Service manages the process of recording data to CSV files.
+type Service struct {
+	// Dir is the desired folder name, e.g., "files/record".
+	Dir string
+
+	// BaseDir, if set, confines Dir: a Dir outside of it, e.g.,
+	// "files/../../etc", is rejected with ErrInvalidFilename. Set it when Dir
+	// comes from untrusted configuration.
+	BaseDir string
+
+	// Filename is the desired base filename, e.g., "agoda_booking_record".
+	Filename string
+
+	// Environment, if set, names the deployment environment, e.g., "prod" or
+	// "staging". It is put in front of the names of the files and their
+	// sidecars, e.g., "prod_booking_record_2025_08_26.csv", so environments
+	// sharing a directory never write to the same files, and services of
+	// different environments can't share files under CollisionShare.
+	Environment string
+
+	// Column represents the CSV header columns.
+	// Example: []string{"id", "request", "response"}
+	Column []string
+
+	// Headers, if set, holds the header label written for each entry of
+	// Column, e.g., "Request ID" for the payload key "req_id". See Columns.
+	Headers []string
+
+	// HeaderAliases maps header labels of older files to the current ones,
+	// e.g., {"cust_id": "customer_id"} after RenameColumn("cust_id",
+	// "customer_id"), which leaves the files of closed periods with the old
+	// label. Query, Records, DecodeAll and Merge then read those files as if
+	// they had the current label, see reader.AliasHeader. Files are never
+	// rewritten.
+	HeaderAliases map[string]string
+
+	// ColumnsFrom, if set, is a struct value or pointer, possibly nil, whose
+	// fields give Column in declaration order (see StructColumns) when Column
+	// is nil. If Column is set too, the first write fails unless both list the
+	// same columns in the same order, catching drift between the two.
+	ColumnsFrom interface{}
+
+	// CSVTags names the fields of struct payloads after their csv tags,
+	// falling back to the json tag and then the Go name. By default fields
+	// are named like encoding/json names them, so structs carrying csv tags
+	// for another library keep their columns. Types with a MarshalJSON or
+	// MarshalText method are mapped from their JSON either way. The inline
+	// option, which flattens a struct field into columns, is always read
+	// from the csv tag.
+	CSVTags bool
+
+	// DiscoverColumns lets Column be nil: the header is then taken from the
+	// keys of the first payload, in field order for structs and sorted for
+	// maps, and persisted next to the files (see SchemaPath) for later runs.
+	DiscoverColumns bool
+
+	// NewColumns decides what happens to payload keys that aren't one of the
+	// columns. Defaults to ColumnsIgnore.
+	NewColumns ColumnPolicy
+
+	// SchemaFiles writes the FileSchema of every CSV file next to it (see
+	// SchemaSuffix): its columns, their types from Rules and the schema
+	// version, so loaders know how to read files written before AddColumn
+	// or RenameColumn.
+	SchemaFiles bool
+
+	// RecordType determines the time-based suffix for the filename: "daily", "monthly", "yearly".
+	RecordType string
+
+	// Namer, if set, names the file of each period instead of Filename, "_"
+	// and the suffix of RecordType, e.g., LayoutNamer("2006/01/02/{base}.csv")
+	// for date-first directories. It should also implement NameParser, or the
+	// files can't be listed.
+	Namer Namer
+
+	// DirLayout, if set, is a time layout of nested folders in Dir for the
+	// files of each period, e.g., "2006/01" for
+	// "files/record/2025/08/booking_record_2025_08_26.csv", so no directory
+	// holds thousands of files. Its elements must be zero-padded. Combines
+	// with Namer, prefixing its names.
+	DirLayout string
+
+	// Location is the time zone of the rotation periods, which start at its
+	// midnight. Defaults to Asia/Jakarta. See ClockPolicy for zones with
+	// daylight saving time.
+	Location *time.Location
+
+	// ClockPolicy decides where records go when the clock goes back to an
+	// earlier period, see ClockWall and ClockMonotonic.
+	ClockPolicy ClockPolicy
+
+	// Clock, if set, replaces time.Now as the source of the current time, e.g.,
+	// to test day boundaries or to replay records at their original time. It
+	// drives rotation suffixes, dedup windows, compaction and manifest stages,
+	// not write latencies.
+	Clock func() time.Time
+
+	// ConfigFile is the path of the JSON configuration the service was loaded
+	// from. It is used by Reload and WatchConfig.
+	ConfigFile string
+
+	// FileLock takes an OS advisory lock (flock on Unix, LockFileEx on Windows)
+	// around each append, so several processes can safely share one file.
+	FileLock bool
+
+	// FS is the filesystem the files are kept on. Defaults to the OS
+	// filesystem.
+	FS FS
+
+	// DirPerm and FilePerm are the permissions of the directories and files
+	// the service creates, including sidecars and rewritten files. They
+	// default to 0755 and 0644 and, like os.OpenFile, are subject to the
+	// process's umask.
+	DirPerm  fs.FileMode
+	FilePerm fs.FileMode
+
+	// Owner, if set, gives the files and directories the service creates to
+	// this user and group, on filesystems that implement Chowner, such as
+	// OSFS on Unix. Changing the owner usually needs root or CAP_CHOWN.
+	Owner *Owner
+
+	// Retry controls retries of writes that fail with transient I/O errors
+	// (disk full, EBUSY, network filesystems). Retries are disabled by default.
+	Retry RetryPolicy
+
+	// QueueSize is the capacity of the RecordAsync queue. Defaults to 1024.
+	QueueSize int
+
+	// AsyncBatch, if greater than 1, lets the RecordAsync queue write up to
+	// this many queued payloads of the same period with one write, so a busy
+	// queue pays for opening, locking and appending to a file once per batch
+	// instead of once per payload. If a payload fails to map, the batch is
+	// written payload by payload, so only the failing ones are reported; a
+	// failed write reports every payload of the batch. Ignored with
+	// DeadLetter.
+	AsyncBatch int
+
+	// FlushInterval is how long the RecordAsync queue waits for more payloads
+	// to fill an AsyncBatch before writing it. Zero writes the payloads
+	// already queued right away; a longer interval makes larger batches at
+	// the cost of rows reaching the files later.
+	FlushInterval time.Duration
+
+	// Backpressure decides what RecordAsync does when the queue is full.
+	// Defaults to BackpressureBlock; see Dropped for the payloads dropped by
+	// the other policies.
+	Backpressure BackpressurePolicy
+
+	// PausePolicy decides what happens to records while the service is
+	// paused, see Pause. Defaults to PauseReject.
+	PausePolicy PausePolicy
+
+	// PauseBuffer is the number of records buffered while paused under the
+	// PauseBuffer policy; later ones fail with ErrPaused. Defaults to 1024.
+	PauseBuffer int
+
+	// RecordsPerSecond and BytesPerSecond, if positive, limit the rate of rows
+	// and CSV bytes written, so recording can't starve the disk shared with
+	// the main application. Writes over the rate wait, blocking Record and,
+	// through the queue, RecordAsync.
+	RecordsPerSecond float64
+	BytesPerSecond   int
+
+	// OnError, if set, is called with every record queued by RecordAsync that
+	// ultimately failed. The error is an *AsyncError holding the payload.
+	OnError func(err error)
+
+	// Errors, if set, receives the same errors as OnError. Sends block, so the
+	// channel must be drained by the caller.
+	Errors chan<- error
+
+	// FailedFile, if set, is a JSON lines file on the OS filesystem, e.g.,
+	// "/var/spool/records/failed.jsonl", that records queued by RecordAsync
+	// are saved to when they ultimately fail, other than with a
+	// *PayloadError, such as on a full disk or with PausePolicy's buffer
+	// dropped by Close. Replay records them once the cause is fixed.
+	FailedFile string
+
+	// Mirrors lists other formats every row written to the CSV files is also
+	// written in, to files of the same name and rotation with the format's
+	// extension, e.g., FormatNDJSON for "booking_record_2025_08_26.jsonl"
+	// next to the CSV file, see MirrorPath. Mirror objects are keyed by
+	// column, with numbers and bools for the columns of those types in Rules.
+	// Mirror files can't be encrypted, compressed or re-encoded, and aren't
+	// read by Query, Compact or MaxTotalBytes.
+	Mirrors []Format
+
+	// Projections write subsets of the columns to files of their own from the
+	// same records, e.g., a slim index next to the full file, see Projection.
+	Projections []Projection
+
+	// PartitionBy, if set, names a payload field whose value splits records
+	// into separate files, e.g., "merchant_id" writes
+	// "record_merchant123_2024_05_01.csv". The field doesn't have to be one of
+	// the columns. Records without the field go to the unpartitioned file.
+	PartitionBy string
+
+	// GroupBy, if set, replaces PartitionBy with a callback computing the
+	// partition of each record from its fields, e.g., a tenant derived from
+	// several fields. Values are made safe for file names like those of
+	// PartitionBy, and records it returns "" for go to the unpartitioned
+	// file.
+	GroupBy func(f Fields) string
+
+	// MaxOpenFiles keeps up to this many CSV files open between writes,
+	// closing the least recently written when another one is needed, so
+	// services writing the files of hundreds of partitions don't open and
+	// close a file on every write. Files are also closed on rotation and by
+	// Close. Zero opens the file for every write.
+	MaxOpenFiles int
+
+	// Dedup, if set, skips records whose key was already written, see
+	// DedupOptions.
+	Dedup *DedupOptions
+
+	// Filter, if set, decides from the fields of each payload, including
+	// derived columns, whether it is written, e.g., only failed API
+	// responses, see FieldIn. Skipped payloads aren't validated by
+	// RequiredColumns and Rules. See FilterCounts for the counts of both.
+	Filter func(f Fields) bool
+
+	// Sampling, if set, writes only a sample of the records passed to Record
+	// and RecordAsync, see SamplingOptions and SampledOut.
+	Sampling *SamplingOptions
+
+	// Compaction, if set, enables Compact and RunCompactor, which drop rows
+	// older than a TTL from the files.
+	Compaction *CompactOptions
+
+	// Shred, if set, overwrites files before Compaction and QuotaDeleteOldest
+	// delete them, and can log a proof of every deletion, see ShredOptions.
+	Shred *ShredOptions
+
+	// MaxTotalBytes, if positive, caps the disk space used by the service's
+	// files in Dir, including their sidecars: mirror, checksum, schema, stats,
+	// row index, acknowledgement and dead-letter files, and the blob and spill
+	// files. What happens once it is exceeded depends on Quota.
+	MaxTotalBytes int64
+
+	// Quota is the policy applied when MaxTotalBytes is exceeded. Defaults to
+	// QuotaReject.
+	Quota QuotaPolicy
+
+	// OnQuota, if set, is called with the usage and the limit whenever a
+	// Record finds MaxTotalBytes exceeded, whatever the policy.
+	OnQuota func(usage, limit int64)
+
+	// Sinks receive every recorded batch. When empty, records go to the
+	// rotating CSV files in Dir, see FileSink.
+	Sinks []Sink
+
+	// Metrics, if set, receives counts and latencies of writes, errors and
+	// rotations. See the metrics/prommetrics package for Prometheus.
+	Metrics Metrics
+
+	// Tracer, if set, wraps every Record and Append in a span. Pass the
+	// request's context to RecordContext to nest it in the request trace.
+	Tracer Tracer
+
+	// Logger, if set, receives internal events: directory and file creation,
+	// rotations, retries and failed async records.
+	Logger *slog.Logger
+
+	// OnRotate, if set, is called when the first record of a new period is
+	// written, once for every file of the closed period. It runs while the
+	// service is locked, so it must not record itself; start a goroutine for
+	// slow work such as triggering an ETL job.
+	OnRotate func(e RotateEvent)
+
+	// Summary, if set, generates a report with row and error counts, and
+	// optionally timestamps and sums, for each rotation period once it is
+	// closed.
+	Summary *SummaryOptions
+
+	// TrackColumns, if set, keeps the length and emptiness of every column
+	// for the current and previous rotation periods (see ColumnStats) and
+	// warns when a column that had values turns empty in every row, the usual
+	// sign of a renamed upstream field.
+	TrackColumns *ColumnStatsOptions
+
+	// TrackDelivery adds every finalized file to the manifest in Dir (see
+	// ManifestName) with its row count, size and checksum, so downstream
+	// ingestion can list complete files without walking the directory, and
+	// its delivery can be followed with MarkDelivered, Acknowledge and
+	// Undelivered.
+	TrackDelivery bool
+
+	// Checksums writes the SHA-256 of every finalized file to a sidecar file
+	// (see ChecksumSuffix), so downstream consumers and Verify can detect
+	// truncation or tampering.
+	Checksums bool
+
+	// Collision decides what happens when another service already writes to the
+	// same files. Defaults to CollisionShare.
+	Collision CollisionPolicy
+
+	// Strict rejects payloads that are missing any of the columns, instead of
+	// writing empty cells.
+	Strict bool
+
+	// RequiredColumns lists columns that must be present and non-null in every
+	// payload. Ignored when Strict is set, since every column is then required.
+	RequiredColumns []string
+
+	// DeadLetter writes payloads that can't be mapped onto the columns, e.g.,
+	// failing Strict or Rules, as JSON lines to the dead-letter file of the
+	// period, see DeadLetterPath, so they can be analyzed and replayed later.
+	// Record still fails with a *PayloadError naming the file.
+	DeadLetter bool
+
+	// Rules declares the type and constraints of columns, keyed by column.
+	// Values are coerced to the declared type before they are written; see
+	// ColumnRule.OnInvalid for values that don't fit.
+	Rules map[string]ColumnRule
+
+	// NumberLocale writes the cells of the TypeInt, TypeFloat and TypeDecimal
+	// columns of Rules with a decimal comma or thousands separators, e.g.,
+	// "1.234,5" for finance teams expecting European formatting.
+	// ColumnRule.Locale replaces it for a column. Constraints of the rules
+	// see the cells unformatted.
+	NumberLocale NumberLocale
+
+	// Derive computes columns from the other fields of each payload, in
+	// order, before RequiredColumns and Rules are checked, e.g.:
+	//
+	//	service.Derive = []core.DerivedColumn{{
+	//		Column: "status_class",
+	//		Func: func(f core.Fields) (interface{}, error) {
+	//			return f.String("status")[:1] + "xx", nil
+	//		},
+	//	}}
+	//
+	// The columns must be listed in Column to be written.
+	Derive []DerivedColumn
+
+	// Enrichers resolve columns of each payload from external sources, e.g.,
+	// a user's country from their ID, in order, after ContextColumns and
+	// before Derive, which sees their values. See Enricher.
+	Enrichers []Enricher
+
+	// Templates render columns from the other fields of each payload with
+	// text/template, keyed by column, e.g.,
+	// `{{.currency}} {{printf "%.2f" .amount}}` for "IDR 15000.00". They run
+	// after Derive and before Rules. Missing and null fields render empty,
+	// but reading into a missing object, e.g., {{.user.name}} without user,
+	// fails the record.
+	Templates map[string]string
+
+	// Defaults fill the fields missing from a payload, or null in it, keyed
+	// by column, e.g., {"currency": "USD"}, so their cells aren't empty. They
+	// are set before Derive, RequiredColumns and Rules, which see them like
+	// payload fields.
+	Defaults map[string]string
+
+	// Normalize cleans up the string fields of every column after Templates,
+	// e.g., trimming them, so Filter, Dedup and Rules see them as written.
+	Normalize Normalization
+
+	// NormalizeColumns replaces Normalize for the columns it has, e.g.,
+	// {"email": {Trim: true, Lower: true}}.
+	NormalizeColumns map[string]Normalization
+
+	// Receipts, if set, emit a Receipt for every row appended to the CSV
+	// files, see ReceiptOptions.
+	Receipts *ReceiptOptions
+
+	// Provenance, if set, stamps the host, pod, process and actor of every
+	// row into columns, see Provenance.
+	Provenance *Provenance
+
+	// ContextColumns, if set, fills columns with values taken from the
+	// context of RecordContext and RecordResult by their extractor, e.g.,
+	// the trace, request or user ID, so correlation IDs reach the files
+	// without every caller adding them to the payloads. Each key must be one
+	// of the columns. A non-empty value replaces the payload field of the
+	// same key; it is set with Provenance, before Derive and Filter.
+	ContextColumns map[string]ContextExtractor
+
+	// RowIDs, if set, fills a column with a generated UUIDv7, ULID or other
+	// identifier for every row, see RowIDs.
+	RowIDs *RowIDs
+
+	// RowChecksums, if set, fills a column with a checksum of the other cells
+	// of every row, see RowChecksums and VerifyRows.
+	RowChecksums *RowChecksums
+
+	// EncryptionKey, if set, encrypts everything written to the CSV files with
+	// AES-GCM, so records never land on disk in plaintext. It must be 16, 24 or
+	// 32 bytes long. Read the files back with NewDecryptReader or OpenFile,
+	// which fail on frames that were altered, removed, reordered or cut off.
+	EncryptionKey []byte
+
+	// Compression compresses the CSV files, adding its extension to their
+	// names, e.g., "booking_record_2025_08_26.csv.zst". Each batch is its own
+	// frame, so files stay appendable; with EncryptionKey, batches are
+	// compressed before they are encrypted. OpenFile decompresses them.
+	Compression Compression
+
+	// EscapeFormulas prefixes cells starting with =, +, -, @, a tab or a
+	// carriage return with FormulaPrefix, so spreadsheets don't run them as
+	// formulas (CSV injection). Numbers are written unchanged.
+	EscapeFormulas bool
+
+	// FormulaPrefix is prepended by EscapeFormulas. Defaults to a single
+	// quote; a tab is a common alternative.
+	FormulaPrefix string
+
+	// NullValue is written for null values and missing keys, e.g., `\N` for
+	// MySQL's LOAD DATA or "NULL". Defaults to an empty cell, which loaders
+	// can't tell apart from an empty string.
+	NullValue string
+
+	// DistinguishMissing writes keys absent from the payload as empty cells, so
+	// only keys present with a null value get NullValue.
+	DistinguishMissing bool
+
+	// CellCompression compresses the cells of the columns it maps, e.g., large
+	// request and response bodies, with gzip or zstd. Compressed cells are
+	// written in base64 after a marker, reader.GzipCellPrefix or
+	// reader.ZstdCellPrefix, and decompressed by Query and Records, or by
+	// reader.Options.DecompressCells. They aren't truncated by MaxCellLength.
+	CellCompression map[string]Compression
+
+	// SkipRepeatedHeaders makes Query, Records and DecodeAll skip rows equal
+	// to the header of their file after the first, left in files written by
+	// processes racing to create them, instead of reading them as rows. They
+	// are logged and counted, see SkippedHeaders.
+	SkipRepeatedHeaders bool
+
+	// MaxCellLength, if positive, truncates cells to this many characters,
+	// ending with TruncationMarker.
+	MaxCellLength int
+
+	// TruncationMarker ends truncated cells. Defaults to "…".
+	TruncationMarker string
+
+	// MaxCellBytes and MaxRowBytes, if positive, limit the size of a cell and
+	// the total size of a row's cells, e.g., to keep multi-megabyte response
+	// bodies out of the files. Oversize decides what happens to larger ones.
+	MaxCellBytes int
+	MaxRowBytes  int
+
+	// Oversize is applied to cells and rows over MaxCellBytes or MaxRowBytes.
+	// Defaults to OversizeTruncate.
+	Oversize OversizePolicy
+
+	// BlobColumns lists the columns, e.g., full response bodies, whose cells
+	// are always moved to sidecar files in SpillDir named after the SHA-256
+	// of their content, so the files stay small and scannable. The cell holds
+	// a reference to the file after reader.BlobCellPrefix, resolved by
+	// ResolveBlob or reader.ResolveBlob. Blob files are encrypted like the
+	// CSV files when EncryptionKey is set.
+	BlobColumns []string
+
+	// WriteBOM starts every file with a byte order mark, which Excel on
+	// Windows needs to detect UTF-8.
+	WriteBOM bool
+
+	// Preamble, if set, is written as comment lines starting with
+	// CommentPrefix above the header of every file the service creates,
+	// e.g., "schema_version=2, generated_by=svc-x", so files describe
+	// themselves. The service skips them when reading its files back; other
+	// readers need to honor comment lines, see reader.Options.Comment. First
+	// cells starting with CommentPrefix are quoted, so no row is taken for a
+	// comment.
+	Preamble []string
+
+	// Encoding, if set, converts the files from UTF-8, e.g., to
+	// japanese.ShiftJIS. Records with characters the encoding can't represent
+	// fail. Use an encoding that doesn't add its own BOM, such as
+	// unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), with WriteBOM.
+	Encoding encoding.Encoding
+
+	// DryRun runs the full mapping and validation pipeline on every Record but
+	// writes nothing, neither to files nor to Sinks.
+	DryRun bool
+
+	// AppendOnly verifies that every file only ever grows between writes and
+	// refuses to write with a *TruncatedError if it shrank, protecting audit
+	// records from accidental truncation.
+	AppendOnly bool
+
+	// OnTruncate, if set, is called when AppendOnly detects a shrunken file.
+	OnTruncate func(err *TruncatedError)
+
+	// WriteMode is how files that already exist are treated on the first
+	// write to them: appended to, truncated or refused, see WriteMode.
+	WriteMode WriteMode
+
+	// RecordTerminator is the line break ending the rows of the files and of
+	// WriteHeader, WriteRecord and Merge. Defaults to TerminatorLF.
+	RecordTerminator Terminator
+
+	// NoTrailingNewline leaves out the line break after the last row of the
+	// files: each append starts with the line break ending the previous
+	// row instead. Files must always be written with the same setting, or
+	// rows run together or are separated by empty lines.
+	NoTrailingNewline bool
+
+	// EscapeNewlines writes the line breaks of cells as the two characters
+	// \r and \n, doubling backslashes, so every row is one line and
+	// line-oriented tools such as wc -l, tail and awk count and split the
+	// rows of the files right. Query, Records and DecodeAll restore them, as
+	// do reader.Options.UnescapeNewlines and reader.UnescapeNewlines. Unlike
+	// Normalization.CollapseNewlines, no text is lost. MaxCellLength and
+	// MaxCellBytes limit the escaped cells, never cutting an escape sequence
+	// in half. Cells of BlobColumns and CellCompression, spill references
+	// and NullValue are written and read as they are.
+	EscapeNewlines bool
+
+	// RFC4180 makes the files strictly conform to RFC 4180, for consumers
+	// whose parsers reject anything else: rows end with CRLF whatever
+	// RecordTerminator is, and every batch is checked with reader.LintReader
+	// before it is written, failing the record with ErrNonConforming if it
+	// doesn't conform. Preamble and WriteBOM can't be combined with it. Check
+	// existing files with Lint.
+	RFC4180 bool
+
+	// WAL journals every append to JournalPath before writing it to the CSV
+	// file. If the process dies mid-write, e.g., when it is OOM-killed, the
+	// interrupted append is completed the next time the service registers. The
+	// journal is not synced to disk, so it doesn't protect against power loss.
+	// Only appends are journaled, not records waiting to be written: those
+	// kept by PauseBuffer are lost with the process, and RecordAsync, whose
+	// queue would be too, fails with WAL, as does Validate with AsyncBatch or
+	// FlushInterval.
+	// With FileLock, every writer keeps its own journal. A journal that no
+	// longer matches its CSV file is renamed with FailedJournalSuffix and logged.
+	WAL bool
+
+	// FallbackDir, if set, receives the writes of the file sink while writing
+	// to Dir fails with a filesystem error, e.g., when the disk is read-only or
+	// full or its mount is gone. Dir is probed every 10 seconds while failed
+	// over; once it is writable again, the files in FallbackDir are merged into
+	// those of Dir and removed. Failover happens on the first failed write
+	// rather than after the attempts of Retry.
+	FallbackDir string
+
+	// OnFailover, if set, is called when writes switch to FallbackDir and
+	// when they recover to Dir. It runs while the service is locked, so it
+	// must not record itself.
+	OnFailover func(e FailoverEvent)
+
+	// Watchdog, if set, detects record calls that block beyond its
+	// Threshold and logs, counts, fails over or cancels them, see Watchdog.
+	Watchdog *Watchdog
+
+	// TimeColumn, if set, is the column holding each row's timestamp, as RFC
+	// 3339 or Unix seconds. AppendFrom writes every row to the file of the
+	// period of its timestamp. Defaults to EventTimeColumn.
+	TimeColumn string
+
+	// EventTimeColumn, if set, makes Record write every row to the file of
+	// the period of the timestamp in this column instead of the current one,
+	// so late events land in their day's file. A row without a valid
+	// timestamp fails the record. Files are still rotated by the clock: late
+	// rows reopen closed files without rotating the current ones.
+	EventTimeColumn string
+
+	// EventTimeLayout is the time layout of string timestamps in
+	// EventTimeColumn and TimeColumn, e.g., "2006-01-02 15:04:05", read in
+	// the service's time zone unless the layout has one. RFC 3339 and Unix
+	// seconds are always accepted too.
+	EventTimeLayout string
+
+	// Warmup, if positive, creates the next period's files, with their header,
+	// this long before the rotation boundary, so the first write of the period
+	// doesn't pay for creating them. Files are created for the partitions
+	// written in the current period.
+	Warmup time.Duration
+
+	// RotateOnTime rotates the files right at the end of their period, running
+	// OnRotate, TrackDelivery, Checksums and Summary then, so the last file of
+	// a period is delivered even if no record arrives after it. Without it,
+	// files are rotated by the first record of a later period.
+	RotateOnTime bool
+
+	// MaxFileOpenDuration, if set, rotates the files of a period at most this
+	// long after it ended, like RotateOnTime does at its end, so even with
+	// little traffic its last files are finalized and handed to OnRotate,
+	// e.g., for an upload.Uploader, by a known time. A record of a later
+	// period still rotates them as soon as it arrives. RotateOnTime takes
+	// precedence.
+	MaxFileOpenDuration time.Duration
+
+	// OrderedRotation keeps the rows of each file in time order around the
+	// rotation boundary when RecordAsync is used. Queued records are written
+	// to the period they were queued in, and a rotation, by Record or
+	// RotateOnTime, first waits for the queue to write the records queued
+	// before it. Records placed by EventTimeColumn are not affected.
+	OrderedRotation bool
+
+	// PreallocateBytes, if positive, reserves disk blocks for the files in
+	// chunks of this size ahead of the writes, so appends don't wait for the
+	// filesystem to allocate them. The file size doesn't change, but up to one
+	// chunk per file stays allocated. Only supported on Linux, through
+	// fallocate; elsewhere it does nothing.
+	PreallocateBytes int64
+
+	// mu serializes writes with each other and with configuration reloads.
+	mu sync.Mutex
+
+	// entry is the registered path pattern shared with other services, and name
+	// the filename resolved by the collision policy. claimant holds the claim
+	// on entry.
+	entry    *pathEntry
+	entryKey string
+	name     string
+	claimant *claimant
+
+	// journalPath is the journal claimed by the service with FileLock, kept
+	// locked through journalLock, see claimJournal.
+	journalPath string
+	journalLock File
+
+	// lastSuffix is the rotation suffix of the last successful write, used to
+	// detect rotations.
+	lastSuffix string
+
+	// clockSuffix is the latest period of the clock seen by a record, held by
+	// ClockMonotonic, and clockBehind the earlier period of the clock last
+	// logged.
+	clockSuffix, clockBehind string
+
+	// partitions counts the rows written to each partition since the last
+	// rotation.
+	partitions map[string]int
+
+	// headers holds the header width of files checked by ColumnsAppend.
+	headers map[string]int
+
+	// reheadered is set once UpdateConfig changed the header, so the
+	// version of each file is picked, see pickVersion.
+	reheadered atomic.Bool
+	versions   fileVersions
+
+	// schema is the persisted schema, see SchemaPath, and schemas the version
+	// of the FileSchema written for each file by SchemaFiles.
+	schema  *schemaFile
+	schemas map[string]int
+
+	// placed collects the batches written by RecordResult, and rowCounts the
+	// data rows of the files it numbered rows in.
+	placed    []*Batch
+	rowCounts map[string]int64
+
+	// host caches the values stamped by Provenance, and actor is the actor of
+	// the record being written and ctxValues the values of its ContextColumns.
+	host      *hostInfo
+	actor     string
+	ctxValues map[string]string
+
+	// ctx is the context of the record being written, for Enrichers.
+	ctx context.Context
+
+	// inTx is set while the rows of a Tx are written, see txRows, and txKeys
+	// holds the Dedup keys of its rows, which don't drop its other rows.
+	inTx   bool
+	txKeys map[string]bool
+
+	// configSink is the Config.Sink that Sinks were last set from.
+	configSink string
+
+	// seen holds the keys remembered for Dedup, or bloom their filters with
+	// FalsePositiveRate.
+	seen  *dedupState
+	bloom *bloomState
+
+	// periodErrors counts failed Record calls since the last rotation.
+	periodErrors int
+
+	// manifestFile is the opened manifest of Dir.
+	manifestFile *Manifest
+
+	// sizes holds the size of each file after its last write, for AppendOnly.
+	sizes map[string]int64
+
+	// written holds each file as it was after the last append, to detect
+	// files rotated or truncated by another process.
+	written map[string]writtenFile
+
+	// claimed holds the files WriteMode was applied to.
+	claimed map[string]bool
+
+	// usage is the tracked size of the files for MaxTotalBytes, valid while
+	// usageKnown is set.
+	usage      int64
+	usageKnown bool
+
+	// failover tracks writes to FallbackDir.
+	failover failoverState
+
+	// stallFailover is set by the Watchdog to switch the next write to
+	// FallbackDir.
+	stallFailover atomic.Bool
+
+	// reserved holds the space allocated for each file by PreallocateBytes.
+	reserved map[string]int64
+
+	// rowLimiter and byteLimiter enforce RecordsPerSecond and BytesPerSecond.
+	rowLimiter  *rate.Limiter
+	byteLimiter *rate.Limiter
+
+	// dropped counts the payloads dropped by Backpressure.
+	dropped atomic.Int64
+
+	// skippedHeaders counts the header rows skipped by SkipRepeatedHeaders.
+	skippedHeaders atomic.Int64
+
+	// stats holds the counters of Stats.
+	stats stats
+
+	// paused is set by Pause, and pauseBuffer holds the records kept by
+	// PauseBuffer meanwhile.
+	paused      atomic.Bool
+	pauseBuffer []pausedRecord
+
+	// accepted and filtered count the rows accepted and skipped by Filter.
+	accepted atomic.Int64
+	filtered atomic.Int64
+
+	// sampledOut counts the records skipped by Sampling, and sampleCount the
+	// records it has seen, for Every.
+	sampledOut  atomic.Int64
+	sampleCount uint64
+
+	// followMu guards the queues of the Follow loops, apart from mu so a
+	// loop never waits for a write.
+	followMu     sync.Mutex
+	followers    []*follower
+	followClosed bool
+
+	// warmupTimer creates the files of the period after warmupSuffix.
+	warmupTimer  *time.Timer
+	warmupSuffix string
+
+	// rotationTimer rotates the files of rotationSuffix at the end of its
+	// period, for RotateOnTime.
+	rotationTimer  *time.Timer
+	rotationSuffix string
+
+	// suffixCache and pathCache keep the suffix and file paths of the
+	// current period, see Suffix and pathIn.
+	suffixCache atomic.Pointer[cachedSuffix]
+	pathCache   pathCache
+
+	// openFiles keeps the file handles of MaxOpenFiles.
+	openFiles openFiles
+
+	// colStats holds the column statistics of TrackColumns.
+	colStats columnStats
+
+	// closed is set by Close.
+	closed bool
+
+	// background tracks goroutines started by writes, e.g., period summaries.
+	background sync.WaitGroup
+
+	// asyncMu guards the lazily started RecordAsync queue, which drain closes
+	// drained after emptying.
+	asyncMu     sync.Mutex
+	queue       chan interface{}
+	drained     chan struct{}
+	asyncClosed bool
+
+	// failedMu guards FailedFile.
+	failedMu sync.Mutex
+}
+
+// New creates and returns a new Service instance.
+// Invalid columns are reported by the first Record; use NewChecked to catch
+// them at construction.
+func New(dir, filename string, column []string, recordType string) *Service {
+	return &Service{
+		Dir:        dir,
+		Filename:   filename,
+		Column:     column,
+		RecordType: recordType,
+	}
+}
+
+// NewChecked is like New but returns an error if the columns are duplicated,
+// empty or contain characters that break the header line, or if filename
+// isn't a valid file name, see ValidateFilename.
+func NewChecked(dir, filename string, column []string, recordType string) (*Service, error) {
+	if err := ValidateColumns(column); err != nil {
+		return nil, fmt.Errorf("invalid columns: %w", err)
+	}
+	if err := ValidateFilename(filename); err != nil {
+		return nil, err
+	}
+	return New(dir, filename, column, recordType), nil
+}
+
+// Record processes the given payload and appends it to a time-suffixed CSV file,
+// or to Sinks when they are configured.
+func (r *Service) Record(payload interface{}) error {
+	return r.RecordContext(context.Background(), payload)
+}
+
+// RecordContext is like Record. ctx carries the trace of the write's span, see
+// Tracer, the actor of WithActor and the values of ContextColumns. A write
+// that has started isn't canceled with ctx, but with a Watchdog taking
+// StallCancel, a call still waiting for the service returns ctx.Err() once ctx
+// is canceled, without writing.
+func (r *Service) RecordContext(ctx context.Context, payload interface{}) error {
+	_, err := r.recordTraced(ctx, payload, time.Time{}, false)
+	return err
+}
+
+// RecordAt is like Record, but writes the rows to the files of the rotation
+// period of t instead of the current one, e.g., to replay a backlog of
+// yesterday's events without adding them to today's file. t takes precedence
+// over EventTimeColumn. Writing to an earlier period doesn't rotate the
+// current files.
+func (r *Service) RecordAt(t time.Time, payload interface{}) error {
+	_, err := r.recordTraced(context.Background(), payload, t, false)
+	return err
+}
+
+// record writes the payload and returns the written batches, one per
+// partition, or none if there was nothing to write. Unless at is zero, the
+// rows go to the files of its period. The caller must hold r.mu.
+func (r *Service) record(payload interface{}, at time.Time) ([]*Batch, error) {
+	if err := r.register(); err != nil {
+		return nil, err
+	}
+	if _, ok := payload.(txRows); ok {
+		r.inTx = true
+		defer func() { r.inTx, r.txKeys = false, nil }()
+	}
+
+	timeNow, err := r.Now()
+	if err != nil {
+		return nil, err
+	}
+
+	suffix, err := r.Suffix(timeNow)
+	if err != nil {
+		return nil, err
+	}
+	suffix = r.holdSuffix(suffix)
+
+	if err := r.discover(payload); err != nil {
+		if unknown := (*UnknownColumnsError)(nil); errors.As(err, &unknown) {
+			err = r.payloadError(suffix, payload, err)
+		}
+		return nil, err
+	}
+
+	// Map the payload first, so a bad payload doesn't leave a header-only file
+	mapped, err := r.mapRows(r.Column, payload)
+	if err != nil {
+		return nil, r.payloadError(suffix, payload, err)
+	}
+	if mapped, err = r.sample(mapped); err != nil {
+		return nil, err
+	}
+	if !at.IsZero() {
+		times := make([]time.Time, len(mapped))
+		for i := range times {
+			times[i] = at.In(timeNow.Location())
+		}
+		return r.writeByTime(timeNow, mapped, times)
+	}
+	if r.EventTimeColumn != "" {
+		times, err := r.eventTimes(payload, mapped, timeNow)
+		if err != nil {
+			return nil, r.payloadError(suffix, payload, err)
+		}
+		return r.writeByTime(timeNow, mapped, times)
+	}
+	return r.writeMapped(timeNow, suffix, mapped)
+}
+
+// writeMapped writes already mapped rows to the files of the given period,
+// applying Dedup, PartitionBy and the disk quota. The caller must hold r.mu.
+func (r *Service) writeMapped(timeNow time.Time, suffix string, mapped []mappedRow) ([]*Batch, error) {
+	if len(mapped) == 0 {
+		return nil, nil // Empty slice, nothing to write
+	}
+
+	if r.DryRun {
+		return nil, nil // Mapped and validated, but nothing is written
+	}
+
+	if err := r.writeSpills(mapped); err != nil {
+		return nil, err
+	}
+	mapped, err := r.quarantine(suffix, mapped)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped, keys, err := r.dedup(timeNow, suffix, mapped)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := r.partition(timeNow, suffix, mapped)
+	if err := r.checkQuota(batches); err != nil {
+		return nil, err
+	}
+	for _, b := range batches {
+		r.throttleRows(len(b.Rows))
+		if err := r.write(b); err != nil {
+			return nil, err
+		}
+		r.follow(b)
+		r.throttleBytes(b.bytes)
+	}
+	if err := r.remember(timeNow, keys); err != nil {
+		// The rows are written, only later duplicates may slip through
+		r.logError("failed to persist dedup state", "error", err)
+	}
+	return batches, nil
+}
+
+// write delivers the batch to every sink, retrying each one on its own so a
+// failing sink doesn't cause duplicates in the others.
+func (r *Service) write(b *Batch) error {
+	sinks := r.Sinks
+	if len(sinks) == 0 {
+		sinks = []Sink{r.FileSink()}
+	}
+
+	var errs []error
+	for _, sink := range sinks {
+		if err := r.Retry.do(func() error { return sink.WriteBatch(b) }, r.logRetry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 && r.placing() {
+		r.placed = append(r.placed, b)
+	}
+	return errors.Join(errs...)
+}
+
+// Now returns the current time in the time zone used for rotation suffixes,
+// see Location.
+func (r *Service) Now() (time.Time, error) {
+	if r.Location != nil {
+		return r.clock().In(r.Location), nil
+	}
+	loc, err := jakarta()
+	if err != nil {
+		// Log the error or return a more specific error if needed
+		return time.Time{}, fmt.Errorf("failed to load time zone 'Asia/Jakarta': %w", err)
+	}
+	return r.clock().In(loc), nil
+}
+
+// clock returns the current time from Clock or time.Now.
+func (r *Service) clock() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
+
+// ErrUnsupportedRecordType is returned for a RecordType other than "daily",
+// "monthly" and "yearly".
+var ErrUnsupportedRecordType = errors.New("unsupported record type")
+
+// suffixLayouts maps each RecordType to the time layout of its filename
+// suffix.
+var suffixLayouts = map[string]string{
+	"daily":   "2006_01_02",
+	"monthly": "2006_01",
+	"yearly":  "2006",
+}
+
+// Suffix returns the time-based filename suffix for t according to RecordType,
+// e.g., "2025_08_26" for daily records.
+func (r *Service) Suffix(t time.Time) (string, error) {
+	if suffix, ok := r.cachedSuffixOf(t); ok {
+		return suffix, nil
+	}
+	layout, ok := suffixLayouts[r.RecordType]
+	if !ok {
+		return "", fmt.Errorf("%w: %q. Must be 'daily', 'monthly', or 'yearly'", ErrUnsupportedRecordType, r.RecordType)
+	}
+	suffix := t.Format(layout)
+	r.cacheSuffix(t, suffix)
+	return suffix, nil
+}
+
+// Path returns the CSV file path that records written at t belong to.
+func (r *Service) Path(t time.Time) (string, error) {
+	suffix, err := r.Suffix(t)
+	if err != nil {
+		return "", err
+	}
+	return r.path(suffix, ""), nil
+}
+
+// PartitionPath is like Path for the files of a partition, see PartitionBy.
+func (r *Service) PartitionPath(t time.Time, partition string) (string, error) {
+	suffix, err := r.Suffix(t)
+	if err != nil {
+		return "", err
+	}
+	return r.path(suffix, partition), nil
+}
+
+// path returns the CSV file path for the given rotation suffix and partition.
+func (r *Service) path(suffix, partition string) string {
+	return r.pathIn(r.Dir, suffix, partition)
+}
+
+// pathIn is like path for the files in dir, see FallbackDir.
+func (r *Service) pathIn(dir, suffix, partition string) string {
+	name := r.baseName()
+	if r.reheadered.Load() {
+		partition = versionedPartition(partition, r.versions.get(suffix, partition))
+	}
+	if partition != "" {
+		name += "_" + partition
+	}
+	return r.cachedName(dir, name, suffix)
+}
+
+// Append writes a data record to the specified CSV file. Slice payloads write
+// one record per element through a single file open.
+// It handles creating the file and writing headers if the file doesn't exist.
+func (r *Service) Append(filename string, column []string, data interface{}) error {
+	return r.AppendContext(context.Background(), filename, column, data)
+}
+
+// AppendContext is like Append, with ctx carrying the trace of the write's
+// span, see Tracer.
+func (r *Service) AppendContext(ctx context.Context, filename string, column []string, data interface{}) error {
+	end := r.startSpan(ctx, "recordtocsv.Append")
+	if r.paused.Load() {
+		end(nil, ErrPaused)
+		return ErrPaused
+	}
+
+	// Map the payload first, so a bad payload doesn't leave a header-only file
+	records, err := r.rows(column, data)
+	if err != nil {
+		err = &PayloadError{Err: err}
+		end(nil, err)
+		return err
+	}
+	n, err := r.appendRows(filename, column, records)
+	if err != nil {
+		err = &WriteError{Path: filename, Rows: len(records), Err: err}
+	}
+	end(map[string]any{AttrFile: filename, AttrRows: len(records), AttrBytes: n}, err)
+	return err
+}
+
+// appendRows writes already mapped records to the CSV file, adding the header
+// if the file is empty. It returns the number of bytes written.
+func (r *Service) appendRows(filename string, column []string, records [][]string) (int64, error) {
+	_, n, err := r.appendAt(filename, column, records)
+	return n, err
+}
+
+// appendAt is like appendRows and also returns the offset the written bytes
+// start at: the size of the file before the write, or with EncryptionKey the
+// start of the final frame they replace.
+func (r *Service) appendAt(filename string, column []string, records [][]string) (offset, n int64, err error) {
+	if len(records) == 0 {
+		return 0, 0, nil // Empty slice, nothing to write
+	}
+
+	// Open the file in append mode. If it doesn't exist, create it.
+	file, done, err := r.appendFile(filename)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open/create CSV file %q: %w", filename, err)
+	}
+	defer func() { done(err == nil) }() // Keep the handle only if it works
+
+	if r.FileLock {
+		// Hold the lock until the record is flushed, so the header check and
+		// the write below can't interleave with another process.
+		if err := lockFile(file); err != nil {
+			return 0, 0, fmt.Errorf("failed to lock CSV file %q: %w", filename, err)
+		}
+		defer unlockFile(file)
+	}
+
+	// Check if the file is empty (newly created or truly empty) to write headers
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get file info for %q: %w", filename, err)
+	}
+
+	if r.AppendOnly {
+		if err := r.checkGrowth(filename, stat.Size()); err != nil {
+			return 0, 0, err
+		}
+	}
+	r.checkReplaced(filename, stat)
+
+	// Encode the whole batch first, so it reaches the file in a single write
+	data, release, err := r.encodePooled(filename, column, records, stat.Size() == 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer release()
+	offset = stat.Size()
+	if r.EncryptionKey != nil {
+		// Written over the final frame, see sealAppend
+		if data, offset, err = sealAppend(r.EncryptionKey, file, stat.Size(), data); err != nil {
+			return 0, 0, fmt.Errorf("failed to encrypt record for %q: %w", filename, err)
+		}
+	}
+
+	if r.WAL {
+		if err := r.journal(journalEntry{Path: filename, Offset: offset, Data: data}); err != nil {
+			return 0, 0, err
+		}
+		// A failed write is reported to the caller, so it isn't replayed either
+		defer r.clearJournal()
+	}
+
+	var written int
+	if r.EncryptionKey != nil {
+		written, err = file.WriteAt(data, offset)
+	} else {
+		written, err = file.Write(data)
+	}
+	n = int64(written)
+	if err != nil {
+		return offset, n, fmt.Errorf("failed to write CSV record to %q: %w", filename, err)
+	}
+	r.reserve(file, filename, offset+n)
+	r.trackWritten(filename, stat, offset+n-stat.Size())
+	r.countRows(filename, len(records))
+	if stat.Size() == 0 {
+		r.logDebug("created CSV file", "path", filename)
+	}
+
+	if r.AppendOnly {
+		after, err := file.Stat()
+		if err != nil {
+			return offset, n, fmt.Errorf("failed to get file info for %q: %w", filename, err)
+		}
+		r.trackSize(filename, after.Size())
+	}
+
+	return offset, n, nil
+}
+
+// encode renders records as CSV, preceded by the header if header is set, and
+// encrypts the result when EncryptionKey is set. filename is only used in
+// errors.
+func (r *Service) encode(filename string, column []string, records [][]string, header bool) ([]byte, error) {
+	data, release, err := r.encodePooled(filename, column, records, header)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if r.EncryptionKey != nil {
+		if data, err = sealFrames(r.EncryptionKey, data, 0); err != nil {
+			return nil, fmt.Errorf("failed to encrypt record for %q: %w", filename, err)
+		}
+		return data, nil
+	}
+	return bytes.Clone(data), nil
+}
+
+// encoder is a CSV writer over a reusable buffer.
+type encoder struct {
+	buf bytes.Buffer
+	csv *csv.Writer
+}
+
+// encoders keeps the encoders of finished writes, so steady appends don't
+// allocate a buffer and a CSV writer for every batch.
+var encoders = sync.Pool{New: func() any {
+	e := new(encoder)
+	e.csv = csv.NewWriter(&e.buf)
+	return e
+}}
+
+// maxPooledBuffer is the largest buffer put back in encoders; the buffers of
+// unusually big batches are left to the garbage collector. A variable, so
+// benchmarks can turn the pool off.
+var maxPooledBuffer = 1 << 20
+
+// encodePooled is like encode without the encryption, which appendAt applies
+// to the end of the file, with the result in a pooled buffer that is only
+// valid until release is called.
+func (r *Service) encodePooled(filename string, column []string, records [][]string, header bool) (data []byte, release func(), err error) {
+	e := encoders.Get().(*encoder)
+	e.buf.Reset()
+	release = func() {
+		if e.buf.Cap() <= maxPooledBuffer {
+			encoders.Put(e)
+		}
+	}
+	// On error, the encoder is left to the garbage collector rather than
+	// released: its CSV writer may still buffer rows of the failed batch
+
+	r.csvWriter(e.csv)
+	term := r.terminator().bytes()
+	if r.NoTrailingNewline && !header && len(records) > 0 {
+		e.buf.WriteString(term) // Ends the last row of the file
+	}
+	if header {
+		r.writePreamble(&e.buf)
+		if err := e.csv.Write(column); err != nil {
+			return nil, nil, fmt.Errorf("failed to write CSV header to %q: %w", filename, err)
+		}
+	}
+
+	for _, record := range records {
+		if err := r.writeRow(e.csv, &e.buf, record); err != nil {
+			return nil, nil, fmt.Errorf("failed to write CSV record to %q: %w", filename, err)
+		}
+	}
+
+	e.csv.Flush()
+	// Check for any errors that occurred during writing
+	if err := e.csv.Error(); err != nil && err != io.EOF { // io.EOF can be ignored when flushing
+		return nil, nil, fmt.Errorf("CSV writer encountered an error: %w", err)
+	}
+	if r.NoTrailingNewline && e.buf.Len() > 0 {
+		e.buf.Truncate(e.buf.Len() - len(term))
+	}
+	if r.RFC4180 {
+		rows := e.buf.Bytes()
+		if r.NoTrailingNewline && !header {
+			rows = bytes.TrimPrefix(rows, []byte(term))
+		}
+		if err := checkConforming(rows, len(column)); err != nil {
+			return nil, nil, fmt.Errorf("failed to write CSV record to %q: %w", filename, err)
+		}
+	}
+
+	data, err = r.transcode(e.buf.Bytes(), header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert record for %q to the output encoding: %w", filename, err)
+	}
+	if data, err = r.compress(data); err != nil {
+		return nil, nil, fmt.Errorf("failed to compress record for %q: %w", filename, err)
+	}
+	return data, release, nil
+}
+
+// hold opens filename and, with FileLock, locks it until release is called,
+// keeping other processes from appending during a rewrite. A missing file is
+// reported as os.ErrNotExist.
+func (r *Service) hold(filename string) (release func(), err error) {
+	file, err := r.fs().OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file %q: %w", filename, err)
+	}
+	if r.FileLock {
+		if err := lockFile(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock CSV file %q: %w", filename, err)
+		}
+	}
+	return func() {
+		if r.FileLock {
+			unlockFile(file)
+		}
+		file.Close()
+	}, nil
+}
+
+// rewrite atomically replaces filename with the header and records, for
+// maintenance that can't append, e.g., widening the header or compaction.
+// The caller must hold the file's locks.
+func (r *Service) rewrite(filename string, column []string, records [][]string) error {
+	data, err := r.encode(filename, column, records, true)
+	if err != nil {
+		return err
+	}
+	r.openFiles.close(filename)
+	if err := replaceFile(r.fs(), filename, data); err != nil {
+		return err
+	}
+	delete(r.rowCounts, filename)
+	delete(r.written, filename)
+	if r.AppendOnly {
+		r.trackSize(filename, int64(len(data)))
+	}
+	r.usageKnown = false // The size changed outside of appendRows
+	return nil
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ShredOptions make the retention cleanup of Compaction and
+// QuotaDeleteOldest overwrite the content of files before it is deleted, and
+// record every deletion in an audit file. Overwriting is best-effort:
+// journaling and copy-on-write filesystems, SSDs and backups may keep copies
+// of the data that can't be reached through the file.
+type ShredOptions struct {
+	// Passes is the number of times the content is overwritten with random
+	// bytes. Defaults to 1.
+	Passes int
+
+	// AuditFile, if set, receives a JSON line for every shredded file, see
+	// DeletionRecord. A relative path is in Dir.
+	AuditFile string
+}
+
+// DeletionRecord is the proof of deletion written to ShredOptions.AuditFile.
+type DeletionRecord struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Reason string    `json:"reason"` // "quota", or "compaction" for the replaced content of a compacted file
+	Bytes  int64     `json:"bytes"`
+	SHA256 string    `json:"sha256"` // of the content before it was overwritten
+	Passes int       `json:"passes"`
+	Rows   int       `json:"rows,omitempty"` // rows dropped by compaction
+}
+
+// deleteShredded removes the file at path, shredding it first with Shred.
+func (r *Service) deleteShredded(path, reason string) error {
+	delete(r.written, path)
+	if r.Shred == nil {
+		return r.fs().Remove(path)
+	}
+	f, err := r.fs().OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = r.shred(f, path, reason, 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return r.fs().Remove(path)
+}
+
+// shred overwrites the content of f, the file at path or the content it had
+// before being replaced, and records its deletion in AuditFile.
+func (r *Service) shred(f File, path, reason string, rows int) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to shred %q: %w", path, err)
+	}
+	size := stat.Size()
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return fmt.Errorf("failed to shred %q: %w", path, err)
+	}
+
+	passes := max(r.Shred.Passes, 1)
+	buf := make([]byte, min(size, 64<<10))
+	for range passes {
+		for off := int64(0); off < size; off += int64(len(buf)) {
+			chunk := buf[:min(int64(len(buf)), size-off)]
+			rand.Read(chunk)
+			if _, err := f.WriteAt(chunk, off); err != nil {
+				return fmt.Errorf("failed to shred %q: %w", path, err)
+			}
+		}
+		if s, ok := f.(interface{ Sync() error }); ok {
+			if err := s.Sync(); err != nil {
+				return fmt.Errorf("failed to shred %q: %w", path, err)
+			}
+		}
+	}
+	r.logInfo("shredded file", "path", path, "reason", reason, "bytes", size, "passes", passes)
+
+	if r.Shred.AuditFile == "" {
+		return nil
+	}
+	return r.auditDeletion(DeletionRecord{
+		Time:   r.clock(),
+		Path:   path,
+		Reason: reason,
+		Bytes:  size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Passes: passes,
+		Rows:   rows,
+	})
+}
+
+// auditDeletion appends the record to AuditFile.
+func (r *Service) auditDeletion(rec DeletionRecord) error {
+	path := r.Shred.AuditFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := r.fs().OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, r.FileMode())
+	if err != nil {
+		return fmt.Errorf("failed to open deletion audit file %q: %w", path, err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write deletion audit file %q: %w", path, err)
+	}
+	return nil
+}
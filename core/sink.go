@@ -0,0 +1,248 @@
+package core
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Batch is the set of rows produced by one Record call.
+type Batch struct {
+	// Time is the record time used for rotation.
+	Time time.Time
+
+	// Suffix is the rotation suffix for Time, e.g., "2025_08_26".
+	Suffix string
+
+	// Partition is the value of the PartitionBy field, or of GroupBy, shared
+	// by all rows, or empty when the service isn't partitioned.
+	Partition string
+
+	// Column lists the payload keys, in the same order as the cells of each
+	// row.
+	Column []string
+
+	// Header holds the header labels, see Service.Headers. Use HeaderRow,
+	// which falls back to Column when it's empty.
+	Header []string
+
+	// Rows holds one entry per record, e.g., one per element of a slice payload.
+	Rows [][]string
+
+	// bytes counts the bytes written to CSV files for this batch.
+	bytes int64
+
+	// firstRow is the data row of the file the first row was written to, for
+	// RecordResult.
+	firstRow int64
+}
+
+// HeaderRow returns the header row of the batch.
+func (b *Batch) HeaderRow() []string {
+	if len(b.Header) > 0 {
+		return b.Header
+	}
+	return b.Column
+}
+
+// Sink is a destination for recorded rows.
+type Sink interface {
+	WriteBatch(b *Batch) error
+}
+
+// Pinger is implemented by Sinks that can check they are reachable without
+// writing a row, e.g., that a database accepts connections. Validate pings
+// them.
+type Pinger interface {
+	Ping() error
+}
+
+// fileSink writes batches to the rotating CSV files of a service.
+type fileSink struct {
+	r *Service
+}
+
+// FileSink returns the default sink, which appends batches to the rotating CSV
+// files in Dir. Add it to Sinks to keep writing files alongside other sinks.
+func (r *Service) FileSink() Sink {
+	return fileSink{r: r}
+}
+
+func (s fileSink) WriteBatch(b *Batch) error {
+	r := s.r
+
+	// Services sharing these files write one record at a time
+	if r.entry != nil {
+		r.entry.mu.Lock()
+		defer r.entry.mu.Unlock()
+	}
+
+	if r.FallbackDir != "" {
+		return r.writeFailover(b)
+	}
+	return r.writeFile(r.Dir, b)
+}
+
+// writeFile appends the batch to its file in dir. The caller must hold the
+// entry lock.
+func (r *Service) writeFile(dir string, b *Batch) error {
+	if r.reheadered.Load() {
+		if err := r.pickVersion(b.Suffix, b.Partition, b.HeaderRow()); err != nil {
+			return &WriteError{Path: r.pathIn(dir, b.Suffix, b.Partition), Rows: len(b.Rows), Err: err}
+		}
+	}
+	filePath := r.pathIn(dir, b.Suffix, b.Partition)
+
+	// Ensure the directory exists, with those of the Namer
+	if err := r.mkdir(filepath.Dir(filePath)); err != nil {
+		return &WriteError{Path: filePath, Rows: len(b.Rows), Err: err}
+	}
+	if err := r.openMode(filePath); err != nil {
+		return &WriteError{Path: filePath, Rows: len(b.Rows), Err: err}
+	}
+
+	if r.NewColumns == ColumnsAppend || r.SchemaFiles || r.migrated() {
+		if err := r.widenHeader(filePath, b.HeaderRow()); err != nil {
+			return &WriteError{Path: filePath, Rows: len(b.Rows), Err: err}
+		}
+	}
+
+	if r.placing() {
+		if rows, err := r.fileRows(filePath); err != nil {
+			r.logError("failed to count rows", "path", filePath, "error", err)
+		} else {
+			b.firstRow = rows + 1
+		}
+	}
+
+	offset, n, err := r.appendAt(filePath, b.HeaderRow(), b.Rows)
+	b.bytes += n
+	if err != nil {
+		return &WriteError{Path: filePath, Rows: len(b.Rows), Err: err}
+	}
+	if r.Receipts != nil {
+		r.emitReceipts(filePath, b.HeaderRow(), b.Rows, offset, n)
+	}
+	if r.SchemaFiles && dir == r.Dir {
+		r.writeFileSchema(filePath)
+	}
+	if err := r.writeMirrors(filePath, b); err != nil {
+		return err
+	}
+	return r.writeProjections(dir, b)
+}
+
+// ErrWriteFailed is matched by *WriteError with errors.Is.
+var ErrWriteFailed = errors.New("write failed")
+
+// WriteError is returned when rows couldn't be appended to a CSV file. Err is
+// the cause, e.g., a *fs.PathError or a *TruncatedError.
+type WriteError struct {
+	Path string
+	Rows int // rows of the failed write, none of which may have been written
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	if e.Rows == 1 {
+		return fmt.Sprintf("failed to append record to %q: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("failed to append %d records to %q: %v", e.Rows, e.Path, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+func (e *WriteError) Is(target error) bool {
+	return target == ErrWriteFailed
+}
+
+// BatchPath returns the CSV file path the batch belongs to, for sinks that
+// write files next to the CSV files.
+func (r *Service) BatchPath(b *Batch) string {
+	return r.path(b.Suffix, b.Partition)
+}
+
+// WriterSink streams CSV rows to an io.Writer, such as an HTTP response, a pipe
+// or an in-memory buffer in tests. The header is written before the first row.
+type WriterSink struct {
+	// NoHeader skips the header row.
+	NoHeader bool
+
+	mu            sync.Mutex
+	w             *csv.Writer
+	headerWritten bool
+}
+
+// NewWriterSink creates a WriterSink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: csv.NewWriter(w)}
+}
+
+func (s *WriterSink) WriteBatch(b *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.headerWritten && !s.NoHeader {
+		if err := s.w.Write(b.HeaderRow()); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+	s.headerWritten = true
+
+	for _, record := range b.Rows {
+		if err := s.w.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV record: %w", err)
+		}
+	}
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		return fmt.Errorf("CSV writer encountered an error: %w", err)
+	}
+	return nil
+}
+
+// WriteHeader writes the service's header row to w.
+func (r *Service) WriteHeader(w io.Writer) error {
+	csvWriter := r.csvWriter(csv.NewWriter(w))
+	if err := csvWriter.Write(r.HeaderRow()); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// EncodeBatch writes the rows of the batch to w as they are written to CSV
+// files, preceded by its header row if header is set, for sinks that keep CSV
+// files elsewhere.
+func (r *Service) EncodeBatch(w io.Writer, b *Batch, header bool) error {
+	csvWriter := r.csvWriter(csv.NewWriter(w))
+	if header {
+		if err := csvWriter.Write(b.HeaderRow()); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+	if err := csvWriter.WriteAll(b.Rows); err != nil {
+		return fmt.Errorf("failed to write CSV record: %w", err)
+	}
+	return nil
+}
+
+// WriteRecord maps the payload onto the service columns and writes the
+// resulting rows to w, without a header and without touching any file.
+func (r *Service) WriteRecord(w io.Writer, payload interface{}) error {
+	records, err := r.Rows(payload)
+	if err != nil {
+		return err
+	}
+	csvWriter := r.csvWriter(csv.NewWriter(w))
+	if err := csvWriter.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write CSV record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters of a service since it was created, for
+// operators inspecting a live service, e.g., through expvar or
+// recordtocsvhttp.StatsHandler.
+type Stats struct {
+	Rows      int64 `json:"rows"`      // rows written
+	Bytes     int64 `json:"bytes"`     // CSV bytes written, before Encoding, Compression and EncryptionKey
+	Rotations int64 `json:"rotations"` // files closed by rotations
+	Errors    int64 `json:"errors"`    // records that failed, by Record or from the RecordAsync queue
+	Stalls    int64 `json:"stalls"`    // record calls that blocked beyond the Watchdog's Threshold, see StallMetric
+
+	Queued  int   `json:"queued"`  // payloads waiting in the RecordAsync queue
+	Dropped int64 `json:"dropped"` // payloads discarded by Backpressure, see Dropped
+
+	// LastWrite is the time of the last successful write, by Clock, or zero
+	// if there was none.
+	LastWrite time.Time `json:"last_write"`
+}
+
+// stats holds the counters of Stats, updated under r.mu and read without it,
+// so a slow write doesn't block Stats.
+type stats struct {
+	rows, bytes, rotations, errors atomic.Int64
+	stalls                         atomic.Int64
+	lastWrite                      atomic.Int64 // Unix nanoseconds
+	queue                          atomic.Pointer[chan interface{}]
+}
+
+// Stats returns the counters of the service. It doesn't lock the service, so
+// it can be called while a write is in progress; the counters may then be
+// from either side of it.
+func (r *Service) Stats() Stats {
+	s := Stats{
+		Rows:      r.stats.rows.Load(),
+		Bytes:     r.stats.bytes.Load(),
+		Rotations: r.stats.rotations.Load(),
+		Errors:    r.stats.errors.Load(),
+		Stalls:    r.stats.stalls.Load(),
+		Dropped:   r.dropped.Load(),
+	}
+	if q := r.stats.queue.Load(); q != nil {
+		s.Queued = len(*q)
+	}
+	if ns := r.stats.lastWrite.Load(); ns != 0 {
+		s.LastWrite = time.Unix(0, ns)
+	}
+	return s
+}
+
+// Stats returns the Stats of every service of the registry, by name. Payloads
+// waiting in the registry's own RecordAsync queue aren't counted as Queued.
+func (g *Registry) Stats() map[string]Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := make(map[string]Stats, len(g.services))
+	for name, s := range g.services {
+		stats[name] = s.Stats()
+	}
+	return stats
+}
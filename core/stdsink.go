@@ -0,0 +1,29 @@
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// Targets of StandardSink and Config.Sink.
+const (
+	SinkFiles  = ""       // the rotating CSV files, see FileSink
+	SinkStdout = "-"      // standard output
+	SinkStderr = "stderr" // standard error
+)
+
+// StandardSink returns the sink of a target: a WriterSink streaming CSV to
+// standard output for SinkStdout or to standard error for SinkStderr, e.g.,
+// in a container whose log collector captures the stream, or nil for
+// SinkFiles. The header is written before the first row, once per sink.
+func StandardSink(target string) (Sink, error) {
+	switch target {
+	case SinkFiles:
+		return nil, nil
+	case SinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	case SinkStderr:
+		return NewWriterSink(os.Stderr), nil
+	}
+	return nil, fmt.Errorf("unknown sink %q, must be %q for standard output, %q or empty for files", target, SinkStdout, SinkStderr)
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// jakarta loads the time zone of the rotation suffixes once; loading it reads
+// the zone database.
+var jakarta = sync.OnceValues(func() (*time.Location, error) {
+	return time.LoadLocation("Asia/Jakarta")
+})
+
+// cachedSuffix is the suffix of the rotation period from start to end in loc.
+type cachedSuffix struct {
+	recordType string
+	loc        *time.Location
+	start, end time.Time
+	suffix     string
+}
+
+// cachedSuffixOf returns the suffix of t if it is in the cached period.
+func (r *Service) cachedSuffixOf(t time.Time) (string, bool) {
+	c := r.suffixCache.Load()
+	if c == nil || c.recordType != r.RecordType || c.loc != t.Location() || t.Before(c.start) || !t.Before(c.end) {
+		return "", false
+	}
+	return c.suffix, true
+}
+
+// cacheSuffix caches the suffix of the period of t until it ends.
+func (r *Service) cacheSuffix(t time.Time, suffix string) {
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	switch r.RecordType {
+	case "monthly":
+		start = time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case "yearly":
+		start = time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	r.suffixCache.Store(&cachedSuffix{recordType: r.RecordType, loc: t.Location(), start: start, end: r.nextPeriod(t), suffix: suffix})
+}
+
+// pathSettings are the settings the cached paths were built with.
+type pathSettings struct {
+	suffix, recordType, dirLayout string
+	compression                   Compression
+}
+
+// pathCache holds the paths of the files of the current period, by directory
+// and base name, so they are built once per period. Paths of other periods,
+// e.g., for EventTimeColumn, replace them.
+type pathCache struct {
+	mu    sync.Mutex
+	key   pathSettings
+	paths map[[2]string]string
+}
+
+// cachedName is nameIn through the path cache. Custom Namers aren't cached,
+// since their names might not depend on the suffix alone.
+func (r *Service) cachedName(dir, base, suffix string) string {
+	if r.Namer != nil {
+		return r.nameIn(dir, base, suffix)
+	}
+	key := pathSettings{suffix: suffix, recordType: r.RecordType, dirLayout: r.DirLayout, compression: r.Compression}
+	c := &r.pathCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key != key || c.paths == nil {
+		c.key, c.paths = key, make(map[[2]string]string)
+	}
+	name := [2]string{dir, base}
+	if path, ok := c.paths[name]; ok {
+		return path
+	}
+	path := r.nameIn(dir, base, suffix)
+	c.paths[name] = path
+	return path
+}
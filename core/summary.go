@@ -0,0 +1,393 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// SummaryFormat selects how a period summary report is rendered.
+type SummaryFormat int
+
+const (
+	SummaryMarkdown SummaryFormat = iota
+	SummaryHTML
+)
+
+// SummaryOptions configures the human-readable report generated for each
+// rotation period once the service has moved on to the next file.
+type SummaryOptions struct {
+	// Format of the report. Defaults to SummaryMarkdown.
+	Format SummaryFormat
+
+	// TopColumn, if set, adds the most frequent values of this column.
+	TopColumn string
+
+	// TopN is the number of top values listed. Defaults to 5.
+	TopN int
+
+	// TimeColumn, if set, adds the earliest and latest timestamps of this
+	// column, RFC 3339 or Unix seconds like for Compaction. Defaults to the
+	// service's TimeColumn.
+	TimeColumn string
+
+	// SumColumns adds the total of each of these numeric columns. Sums are
+	// exact decimals, so they can be reconciled with the ledger to the cent.
+	SumColumns []string
+
+	// StatsFile writes the row count, timestamps and sums as JSON next to the
+	// CSV file (see StatsSuffix). With TrackDelivery they are also recorded in
+	// the file's ManifestEntry.
+	StatsFile bool
+
+	// WriteFile writes the report next to the CSV file, e.g.,
+	// "booking_record_2025_08_26.summary.md".
+	WriteFile bool
+
+	// OnSummary, if set, receives every summary and its rendered report, e.g.,
+	// to email it to stakeholders.
+	OnSummary func(s *Summary, report []byte)
+
+	// sumLocales holds the NumberLocale of each SumColumns column, set by the
+	// service.
+	sumLocales []NumberLocale
+}
+
+// Summary describes one closed rotation period.
+type Summary struct {
+	Path   string // CSV file of the period
+	Rows   int    // data rows in the file
+	Errors int    // failed Record calls during the period
+
+	TopColumn string       // column of Top, if configured
+	Top       []ValueCount // most frequent TopColumn values, most frequent first
+
+	TimeColumn string    // column of MinTime and MaxTime, if configured
+	MinTime    time.Time // earliest TimeColumn timestamp, zero if none parsed
+	MaxTime    time.Time // latest TimeColumn timestamp
+
+	Sums    map[string]string // exact decimal total of each SumColumns column
+	Skipped map[string]int    // non-numeric cells left out of each sum, if any
+}
+
+// StatsSuffix is appended to a file name for the JSON file of
+// SummaryOptions.StatsFile, e.g., "booking_record_2025_08_26.csv.stats.json".
+const StatsSuffix = ".stats.json"
+
+// PeriodStats are the totals of a closed period, as written by
+// SummaryOptions.StatsFile and recorded in the manifest.
+type PeriodStats struct {
+	Rows    int               `json:"rows"`
+	MinTime *time.Time        `json:"min_time,omitempty"`
+	MaxTime *time.Time        `json:"max_time,omitempty"`
+	Sums    map[string]string `json:"sums,omitempty"`
+	Skipped map[string]int    `json:"skipped,omitempty"`
+}
+
+// Stats returns the totals of the summary.
+func (s *Summary) Stats() *PeriodStats {
+	st := &PeriodStats{Rows: s.Rows, Sums: s.Sums, Skipped: s.Skipped}
+	if !s.MinTime.IsZero() {
+		minTime, maxTime := s.MinTime, s.MaxTime
+		st.MinTime, st.MaxTime = &minTime, &maxTime
+	}
+	return st
+}
+
+// ValueCount is a cell value and how many rows hold it.
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// File returns the base name of the summarized file, for links in reports.
+func (s *Summary) File() string {
+	return filepath.Base(s.Path)
+}
+
+// Summarize reads the CSV file at path and computes its summary according to
+// opts. errorCount is reported as is.
+func Summarize(path string, opts SummaryOptions, errorCount int) (*Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer f.Close()
+	return summarize(path, f, opts, errorCount, 0)
+}
+
+func summarize(path string, f io.Reader, opts SummaryOptions, errorCount int, comment rune) (*Summary, error) {
+	rd, err := reader.NewReader(f, reader.Options{Comment: comment})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	col := slices.Index(rd.Header, opts.TopColumn)
+	timeCol := slices.Index(rd.Header, opts.TimeColumn)
+	sums := make([]decimalSum, len(opts.SumColumns))
+	for i, column := range opts.SumColumns {
+		sums[i] = decimalSum{col: slices.Index(rd.Header, column)}
+		if i < len(opts.sumLocales) {
+			sums[i].locale = opts.sumLocales[i]
+		}
+	}
+
+	s := &Summary{Path: path, Errors: errorCount, TopColumn: opts.TopColumn, TimeColumn: opts.TimeColumn}
+	counts := map[string]int{}
+	for {
+		row, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %w", path, err)
+		}
+		s.Rows++
+		if col >= 0 && col < len(row) {
+			counts[row[col]]++
+		}
+		if timeCol >= 0 && timeCol < len(row) {
+			if t, ok := parseTimestamp(row[timeCol]); ok {
+				if s.MinTime.IsZero() || t.Before(s.MinTime) {
+					s.MinTime = t
+				}
+				if t.After(s.MaxTime) {
+					s.MaxTime = t
+				}
+			}
+		}
+		for i := range sums {
+			if c := sums[i].col; c >= 0 && c < len(row) {
+				sums[i].add(row[c])
+			}
+		}
+	}
+
+	for i, column := range opts.SumColumns {
+		if s.Sums == nil {
+			s.Sums = map[string]string{}
+		}
+		s.Sums[column] = sums[i].String()
+		if sums[i].skipped > 0 {
+			if s.Skipped == nil {
+				s.Skipped = map[string]int{}
+			}
+			s.Skipped[column] = sums[i].skipped
+		}
+	}
+
+	for v, n := range counts {
+		s.Top = append(s.Top, ValueCount{Value: v, Count: n})
+	}
+	slices.SortFunc(s.Top, func(a, b ValueCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+	})
+	topN := opts.TopN
+	if topN <= 0 {
+		topN = 5
+	}
+	if len(s.Top) > topN {
+		s.Top = s.Top[:topN]
+	}
+	return s, nil
+}
+
+// decimalSum adds up the numeric cells of a column without rounding.
+type decimalSum struct {
+	col     int
+	sum     big.Rat
+	scale   int // most decimal places of a cell
+	skipped int
+	locale  NumberLocale
+}
+
+// add adds cell, e.g., "1250.50" or "-3" in the column's locale, to the sum.
+// Empty cells are ignored and other cells are counted as skipped.
+func (d *decimalSum) add(cell string) {
+	cell = d.locale.Parse(strings.TrimSpace(cell))
+	if cell == "" {
+		return
+	}
+	var v big.Rat
+	if _, ok := v.SetString(cell); !ok || strings.Contains(cell, "/") { // SetString accepts fractions
+
+		d.skipped++
+		return
+	}
+	if _, frac, ok := strings.Cut(cell, "."); ok {
+		frac, _, _ = strings.Cut(strings.ToLower(frac), "e")
+		d.scale = max(d.scale, len(frac))
+	}
+	d.sum.Add(&d.sum, &v)
+}
+
+// String formats the sum with the decimal places of the cells, or more if an
+// exponent made it necessary.
+func (d *decimalSum) String() string {
+	scale := d.scale
+	for ; scale < 30; scale++ {
+		pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+		if new(big.Rat).Mul(&d.sum, new(big.Rat).SetInt(pow)).IsInt() {
+			break
+		}
+	}
+	return d.sum.FloatString(scale)
+}
+
+var markdownSummary = template.Must(template.New("summary").Parse(`# Summary of {{.File}}
+
+- File: [{{.File}}]({{.File}})
+- Rows: {{.Rows}}
+- Errors: {{.Errors}}
+{{if not .MinTime.IsZero}}- {{.TimeColumn}}: {{.MinTime.Format "2006-01-02T15:04:05Z07:00"}} to {{.MaxTime.Format "2006-01-02T15:04:05Z07:00"}}
+{{end}}{{if .Sums}}
+## Totals
+
+| Column | Sum |
+|---|---|
+{{range $column, $sum := .Sums}}| {{$column}} | {{$sum}} |
+{{end}}{{end}}{{if .TopColumn}}
+## Top {{.TopColumn}} values
+
+| {{.TopColumn}} | Rows |
+|---|---|
+{{range .Top}}| {{.Value}} | {{.Count}} |
+{{end}}{{end}}`))
+
+var htmlSummary = htmltemplate.Must(htmltemplate.New("summary").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Summary of {{.File}}</title></head>
+<body>
+<h1>Summary of {{.File}}</h1>
+<ul>
+<li>File: <a href="{{.File}}">{{.File}}</a></li>
+<li>Rows: {{.Rows}}</li>
+<li>Errors: {{.Errors}}</li>
+{{if not .MinTime.IsZero}}<li>{{.TimeColumn}}: {{.MinTime.Format "2006-01-02T15:04:05Z07:00"}} to {{.MaxTime.Format "2006-01-02T15:04:05Z07:00"}}</li>
+{{end}}</ul>
+{{if .Sums}}<h2>Totals</h2>
+<table>
+<tr><th>Column</th><th>Sum</th></tr>
+{{range $column, $sum := .Sums}}<tr><td>{{$column}}</td><td>{{$sum}}</td></tr>
+{{end}}</table>
+{{end}}{{if .TopColumn}}<h2>Top {{.TopColumn}} values</h2>
+<table>
+<tr><th>{{.TopColumn}}</th><th>Rows</th></tr>
+{{range .Top}}<tr><td>{{.Value}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// Render renders the summary in the given format.
+func (s *Summary) Render(format SummaryFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == SummaryHTML {
+		err = htmlSummary.Execute(&buf, s)
+	} else {
+		err = markdownSummary.Execute(&buf, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render summary of %q: %w", s.Path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// summaryPath returns where the report of the CSV file at path is written.
+func summaryPath(path string, format SummaryFormat) string {
+	ext := ".summary.md"
+	if format == SummaryHTML {
+		ext = ".summary.html"
+	}
+	return path[:len(path)-len(filepath.Ext(path))] + ext
+}
+
+// summaryOptions returns a copy of Summary with TopColumn translated to its
+// header label, as found in the files. The caller must hold r.mu.
+func (r *Service) summaryOptions() SummaryOptions {
+	opts := *r.Summary
+	opts.TopColumn = r.label(opts.TopColumn)
+	if opts.TimeColumn == "" {
+		opts.TimeColumn = r.timeColumn()
+	}
+	opts.TimeColumn = r.label(opts.TimeColumn)
+	opts.SumColumns = make([]string, len(r.Summary.SumColumns))
+	opts.sumLocales = make([]NumberLocale, len(r.Summary.SumColumns))
+	for i, column := range r.Summary.SumColumns {
+		opts.SumColumns[i] = r.label(column)
+		opts.sumLocales[i] = r.numberLocale(column)
+	}
+	return opts
+}
+
+// summarize generates and delivers the summary of a closed period. It runs in
+// its own goroutine, so errors are only logged.
+func (r *Service) summarize(opts SummaryOptions, path string, errorCount int) {
+	f, err := r.OpenFile(path)
+	if err != nil {
+		r.logError("failed to summarize period", "path", path, "error", err)
+		return
+	}
+	defer f.Close()
+
+	s, err := summarize(path, f, opts, errorCount, r.comment())
+	if err != nil {
+		r.logError("failed to summarize period", "path", path, "error", err)
+		return
+	}
+	if now, err := r.Now(); err == nil && !s.MinTime.IsZero() {
+		s.MinTime, s.MaxTime = s.MinTime.In(now.Location()), s.MaxTime.In(now.Location())
+	}
+	report, err := s.Render(opts.Format)
+	if err != nil {
+		r.logError("failed to summarize period", "path", path, "error", err)
+		return
+	}
+	if opts.StatsFile {
+		r.writeStats(path, s.Stats())
+	}
+	if opts.WriteFile {
+		dst := summaryPath(path, opts.Format)
+		if err := writeFile(r.fs(), dst, report); err != nil {
+			r.logError("failed to write summary", "path", dst, "error", err)
+		}
+	}
+	if opts.OnSummary != nil {
+		opts.OnSummary(s, report)
+	}
+}
+
+// writeStats writes the JSON file of StatsFile and, with TrackDelivery, adds
+// the stats to the manifest entry of path.
+func (r *Service) writeStats(path string, stats *PeriodStats) {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err == nil {
+		err = replaceFile(r.fs(), path+StatsSuffix, append(data, '\n'))
+	}
+	if err != nil {
+		r.logError("failed to write stats", "path", path+StatsSuffix, "error", err)
+	}
+	if !r.TrackDelivery {
+		return
+	}
+	m, err := r.manifest()
+	if err == nil {
+		err = m.update(filepath.Base(path), "", func(e *ManifestEntry) { e.Stats = stats })
+	}
+	if err != nil {
+		r.logError("failed to update manifest", "path", path, "error", err)
+	}
+}
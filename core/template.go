@@ -0,0 +1,174 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// cellTemplate is a parsed template with the top-level fields it reads.
+type cellTemplate struct {
+	*template.Template
+	fields []string
+}
+
+// templates caches the parsed Templates by their text.
+var templates sync.Map // string -> *cellTemplate
+
+func parseTemplate(text string) (*cellTemplate, error) {
+	if t, ok := templates.Load(text); ok {
+		return t.(*cellTemplate), nil
+	}
+	t, err := template.New("cell").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	ct := &cellTemplate{Template: t}
+	walkFields(t.Root, func(name string) {
+		if !slices.Contains(ct.fields, name) {
+			ct.fields = append(ct.fields, name)
+		}
+	})
+	templates.Store(text, ct)
+	return ct, nil
+}
+
+// walkFields calls fn with the first name of every field, e.g., "user" for
+// {{.user.name}}, read under node.
+func walkFields(node parse.Node, fn func(name string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkFields(child, fn)
+		}
+	case *parse.ActionNode:
+		walkFields(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkFields(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkFields(arg, fn)
+		}
+	case *parse.FieldNode:
+		fn(n.Ident[0])
+	case *parse.ChainNode:
+		walkFields(n.Node, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkFields(n.Pipe, fn)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, fn func(name string)) {
+	walkFields(n.Pipe, fn)
+	walkFields(n.List, fn)
+	walkFields(n.ElseList, fn)
+}
+
+// validateTemplates checks that every template parses and renders a column.
+func (r *Service) validateTemplates() error {
+	for col, text := range r.Templates {
+		if _, err := parseTemplate(text); err != nil {
+			return fmt.Errorf("template for column %q: %w", col, err)
+		}
+		if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+			return fmt.Errorf("template for column %q, which is not one of the columns", col)
+		}
+	}
+	return nil
+}
+
+// render sets the Templates columns of fields, in column order so the result
+// doesn't depend on map iteration. Templates see the fields before any of
+// them is rendered.
+func (r *Service) render(column []string, fields map[string]interface{}) error {
+	data := templateData(fields).(map[string]interface{})
+	for _, col := range column {
+		text, ok := r.Templates[col]
+		if !ok {
+			continue
+		}
+		t, err := parseTemplate(text)
+		if err != nil {
+			return fmt.Errorf("template for column %q: %w", col, err)
+		}
+		for _, name := range t.fields {
+			if _, ok := data[name]; !ok {
+				data[name] = "" // Rather than "<no value>"
+			}
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return fmt.Errorf("failed to render column %q: %w", col, err)
+		}
+		fields[col] = b.String()
+	}
+	return nil
+}
+
+// templateData converts fields for templates: numbers become templateNumber,
+// so printf formats them with any verb, and null values render empty.
+func templateData(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		return templateNumber(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			m[key] = templateData(field)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, elem := range v {
+			s[i] = templateData(elem)
+		}
+		return s
+	case nil:
+		return ""
+	}
+	return val
+}
+
+// templateNumber is a payload number in a template. It prints as its JSON
+// text, and as a float or an integer for the verbs of those, e.g.,
+// {{printf "%.2f" .amount}}.
+type templateNumber json.Number
+
+func (n templateNumber) Format(s fmt.State, verb rune) {
+	format := fmt.FormatString(s, verb)
+	switch verb {
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		if f, err := json.Number(n).Float64(); err == nil {
+			fmt.Fprintf(s, format, f)
+			return
+		}
+	case 'd', 'x', 'X', 'o', 'O', 'b':
+		if i, err := json.Number(n).Int64(); err == nil {
+			fmt.Fprintf(s, format, i)
+			return
+		}
+		if f, err := json.Number(n).Float64(); err == nil {
+			fmt.Fprintf(s, format, int64(f))
+			return
+		}
+	}
+	fmt.Fprintf(s, format, string(n))
+}
@@ -0,0 +1,48 @@
+package core
+
+import "encoding/csv"
+
+// Terminator is the line break ending each CSV row.
+type Terminator int
+
+const (
+	// TerminatorLF ends rows with a line feed. This is the default.
+	TerminatorLF Terminator = iota
+
+	// TerminatorCRLF ends rows with a carriage return and a line feed, as
+	// RFC 4180 and many Windows and mainframe loaders expect.
+	TerminatorCRLF
+)
+
+func (t Terminator) String() string {
+	switch t {
+	case TerminatorLF:
+		return "lf"
+	case TerminatorCRLF:
+		return "crlf"
+	}
+	return "unknown"
+}
+
+// bytes returns the line break.
+func (t Terminator) bytes() string {
+	if t == TerminatorCRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// terminator returns the line break ending the rows: RecordTerminator, or
+// CRLF with RFC4180.
+func (r *Service) terminator() Terminator {
+	if r.RFC4180 {
+		return TerminatorCRLF
+	}
+	return r.RecordTerminator
+}
+
+// csvWriter configures w to end rows with the service's terminator.
+func (r *Service) csvWriter(w *csv.Writer) *csv.Writer {
+	w.UseCRLF = r.terminator() == TerminatorCRLF
+	return w
+}
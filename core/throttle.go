@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// BackpressurePolicy decides what RecordAsync does when its queue is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock makes RecordAsync wait for room in the queue. This is
+	// the default.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest discards the oldest queued payload to make room.
+	BackpressureDropOldest
+	// BackpressureDropNewest discards the payload being queued.
+	BackpressureDropNewest
+)
+
+// Dropped returns the number of payloads RecordAsync discarded under the
+// Backpressure policy.
+func (r *Service) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+// enqueue sends payload to the async queue under the Backpressure policy. The
+// caller must hold r.asyncMu.
+func (r *Service) enqueue(payload interface{}) {
+	switch r.Backpressure {
+	case BackpressureDropNewest:
+		select {
+		case r.queue <- payload:
+		default:
+			r.drop()
+		}
+		return
+	case BackpressureDropOldest:
+		for {
+			select {
+			case r.queue <- payload:
+				return
+			default:
+			}
+			select {
+			case old := <-r.queue:
+				if done, ok := old.(flushMarker); ok {
+					close(done) // Everything queued before it is gone
+					continue
+				}
+				r.drop()
+			default: // Drained meanwhile
+			}
+		}
+	}
+	r.queue <- payload
+}
+
+func (r *Service) drop() {
+	n := r.dropped.Add(1)
+	r.logDebug("dropped async record, queue is full", "dropped", n)
+}
+
+// throttleRows waits until RecordsPerSecond allows writing rows. The caller
+// must hold r.mu, so concurrent Record calls wait too.
+func (r *Service) throttleRows(rows int) {
+	if r.RecordsPerSecond <= 0 {
+		return
+	}
+	limit := rate.Limit(r.RecordsPerSecond)
+	if r.rowLimiter == nil || r.rowLimiter.Limit() != limit {
+		r.rowLimiter = rate.NewLimiter(limit, max(int(math.Ceil(r.RecordsPerSecond)), 1))
+	}
+	waitN(r.rowLimiter, int64(rows))
+}
+
+// throttleBytes charges bytes just written to BytesPerSecond, waiting until
+// the rate allows them, so the next write is delayed. The caller must hold
+// r.mu.
+func (r *Service) throttleBytes(bytes int64) {
+	if r.BytesPerSecond <= 0 {
+		return
+	}
+	limit := rate.Limit(r.BytesPerSecond)
+	if r.byteLimiter == nil || r.byteLimiter.Limit() != limit {
+		r.byteLimiter = rate.NewLimiter(limit, r.BytesPerSecond)
+	}
+	waitN(r.byteLimiter, bytes)
+}
+
+// waitN waits for n tokens, in steps of at most the burst, which is all WaitN
+// accepts at once.
+func waitN(l *rate.Limiter, n int64) {
+	for n > 0 {
+		step := min(n, int64(l.Burst()))
+		l.WaitN(context.Background(), int(step))
+		n -= step
+	}
+}
@@ -0,0 +1,59 @@
+package core
+
+import "context"
+
+// Tracer starts a span around each Record and Append, so CSV write latency
+// shows up inside request traces. Implementations must be safe for concurrent
+// use; see tracing/oteltracing for OpenTelemetry.
+type Tracer interface {
+	// Start starts a span named name as a child of the span in ctx, if any.
+	Start(ctx context.Context, name string) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute attaches key to the span. Values are strings, ints, int64s
+	// or bools.
+	SetAttribute(key string, value any)
+
+	// End ends the span, marking it as failed if err is not nil.
+	End(err error)
+}
+
+// Span attributes set by the Service.
+const (
+	AttrFile       = "recordtocsv.file"        // first file written
+	AttrRows       = "recordtocsv.rows"        // rows written
+	AttrBytes      = "recordtocsv.bytes"       // CSV bytes written
+	AttrRecordType = "recordtocsv.record_type" // rotation type, e.g., "daily"
+	AttrRotated    = "recordtocsv.rotated"     // whether the write started a new period
+)
+
+// startSpan starts a span if Tracer is set. The returned func ends it.
+func (r *Service) startSpan(ctx context.Context, name string) func(attrs map[string]any, err error) {
+	if r.Tracer == nil {
+		return func(map[string]any, error) {}
+	}
+	span := r.Tracer.Start(ctx, name)
+	return func(attrs map[string]any, err error) {
+		for key, value := range attrs {
+			span.SetAttribute(key, value)
+		}
+		span.End(err)
+	}
+}
+
+// batchAttrs describes written batches as span attributes.
+func (r *Service) batchAttrs(batches []*Batch, rotated bool) map[string]any {
+	attrs := map[string]any{AttrRecordType: r.RecordType, AttrRotated: rotated}
+	rows, bytes := 0, int64(0)
+	for _, b := range batches {
+		rows += len(b.Rows)
+		bytes += b.bytes
+	}
+	attrs[AttrRows], attrs[AttrBytes] = rows, bytes
+	if len(batches) > 0 {
+		attrs[AttrFile] = r.BatchPath(batches[0])
+	}
+	return attrs
+}
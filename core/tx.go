@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTxDone is returned by the methods of a Tx after Commit or Rollback.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx collects the payloads of a business event that spans several rows, so
+// they are recorded together or not at all. Nothing is written until Commit,
+// which records the rows like a single Record of all of them: every payload
+// is mapped and validated before anything is written, and the rows of each
+// file reach it in a single write under one hold of the service's lock, so
+// other records can't interleave with them. Rows that go to several files,
+// e.g., with PartitionBy or EventTimeColumn, are written file by file, and a
+// failed write can leave the files written before it.
+//
+// Filter doesn't apply to the rows of a Tx, which record an event the caller
+// decided to keep, and Sampling keeps or leaves out the transaction as a
+// whole, as one record, by its first row. Dedup only drops the rows whose key
+// was written before the commit, so retrying a commit writes just the rows
+// the earlier attempt didn't; keys repeated within the Tx are kept. Keys are
+// remembered once their rows are written, so a rolled back or failed commit
+// leaves none behind. Rules still reject the whole commit or quarantine rows
+// like for Record.
+//
+//	tx := service.Begin()
+//	tx.Add(order, payment)
+//	tx.Add(items) // One row per element
+//	if err := tx.Commit(); err != nil {
+//		return err
+//	}
+//
+// A Tx is safe for concurrent use.
+type Tx struct {
+	service *Service
+
+	mu    sync.Mutex
+	items txRows
+	done  bool
+}
+
+// txRows is the payload of a committed Tx, which record recognizes to write
+// its rows as a whole, also when the commit is buffered by PauseBuffer.
+type txRows []interface{}
+
+// Begin starts a transaction on the service.
+func (r *Service) Begin() *Tx {
+	return &Tx{service: r}
+}
+
+// Add adds payloads to the transaction. A slice payload adds one row per
+// element, like Record.
+func (tx *Tx) Add(payloads ...interface{}) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	for _, payload := range payloads {
+		items, _ := splitPayload(payload)
+		tx.items = append(tx.items, items...)
+	}
+	return nil
+}
+
+// Len returns the number of rows added so far.
+func (tx *Tx) Len() int {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return len(tx.items)
+}
+
+// Commit records the rows of the transaction, see Tx. Committing an empty
+// transaction writes nothing. The transaction is done even if Commit fails,
+// so a failed commit is retried with a new one.
+func (tx *Tx) Commit() error {
+	return tx.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit, with ctx used like RecordContext uses it.
+func (tx *Tx) CommitContext(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	items := tx.items
+	tx.items = nil
+	if len(items) == 0 {
+		return nil
+	}
+	_, err := tx.service.recordTraced(ctx, items, time.Time{}, false)
+	return err
+}
+
+// Rollback discards the rows of the transaction. Rolling back a committed
+// transaction does nothing, so it is safe to defer right after Begin.
+func (tx *Tx) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.done = true
+	tx.items = nil
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rows returns the data rows of the service's only file.
+func rows(t *testing.T, s *Service) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.csv"))
+	if err != nil || len(files) > 1 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	return lines[1:]
+}
+
+func commit(t *testing.T, s *Service, payloads ...interface{}) {
+	t.Helper()
+	tx := s.Begin()
+	if err := tx.Add(payloads...); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxRowsAreNotFiltered(t *testing.T) {
+	s := New(t.TempDir(), "order", []string{"id", "kind"}, "daily")
+	s.Filter = FieldIn("kind", "order")
+	commit(t, s,
+		map[string]interface{}{"id": "1", "kind": "order"},
+		map[string]interface{}{"id": "2", "kind": "payment"},
+	)
+	if got, want := rows(t, s), []string{"1,order", "2,payment"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestTxDedupRetriedCommit(t *testing.T) {
+	s := New(t.TempDir(), "order", []string{"id", "kind"}, "daily")
+	s.Dedup = &DedupOptions{Column: "id"}
+	order := map[string]interface{}{"id": "1", "kind": "order"}
+	item := map[string]interface{}{"id": "1", "kind": "item"}
+	payment := map[string]interface{}{"id": "2", "kind": "payment"}
+
+	rolledBack := s.Begin()
+	if err := rolledBack.Add(payment); err != nil {
+		t.Fatal(err)
+	}
+	rolledBack.Rollback()
+
+	// Repeats within the Tx are kept, and a retry writes nothing again
+	commit(t, s, order, item)
+	commit(t, s, order, item, payment)
+	if err := s.Record(payment); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rows(t, s), []string{"1,order", "1,item", "2,payment"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestTxSampledAsAWhole(t *testing.T) {
+	s := New(t.TempDir(), "order", []string{"id"}, "daily")
+	s.Sampling = &SamplingOptions{Every: 2}
+	for _, tx := range [][]interface{}{{"1", "2", "3"}, {"4", "5"}, {"6", "7"}} {
+		var payloads []interface{}
+		for _, id := range tx {
+			payloads = append(payloads, map[string]interface{}{"id": id})
+		}
+		commit(t, s, payloads...)
+	}
+	if got := strings.Join(rows(t, s), " "); got != "1 2 3 6 7" {
+		t.Errorf("rows = %q, want the first and third transaction", got)
+	}
+	if s.SampledOut() != 2 {
+		t.Errorf("sampled out %d rows, want 2", s.SampledOut())
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// UpdateConfig is Apply for long-running services that pick up configuration
+// changes without a restart, such as the columns, RecordType or the
+// formatting of Rules, Templates and NumberLocale. Unlike Apply, it checks cfg
+// first and keeps the current configuration if it is invalid, and no write
+// is lost or split across two configurations: payloads queued by RecordAsync
+// before the call are written with the old configuration, and writes in
+// progress finish before the swap.
+//
+// When Dir, Filename, Environment, RecordType or TimeZone change, the files
+// of the current period are closed as on a rotation, for OnRotate,
+// TrackDelivery, Checksums and Summary. When the header changes, rows meant
+// for a file that already has another header go to a new version of it
+// instead, e.g., "booking_record_v2_2025_08_26.csv" next to
+// "booking_record_2025_08_26.csv", listed by Files as partition "v2". Files
+// whose header the new one only extends are widened in place instead, as
+// with ColumnsAppend or SchemaFiles.
+func (r *Service) UpdateConfig(cfg *Config) error {
+	next, err := NewFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if err := next.validateHeaders(); err != nil {
+		return err
+	}
+	if err := next.validateRules(); err != nil {
+		return err
+	}
+	if _, err := next.Suffix(r.clock()); err != nil {
+		return err
+	}
+
+	// Queued payloads were recorded under the current configuration
+	r.Flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zone := ""
+	if r.Location != nil {
+		zone = r.Location.String()
+	}
+	moved := r.Dir != cfg.Dir || r.Filename != cfg.Filename || r.Environment != cfg.Environment || r.RecordType != cfg.RecordType || zone != cfg.TimeZone
+	oldHeader := slices.Clone(r.HeaderRow())
+	var closing map[string]string
+	var opts SummaryOptions
+	if moved && r.lastSuffix != "" {
+		closing = make(map[string]string, len(r.partitions))
+		for partition := range r.partitions {
+			closing[partition] = r.path(r.lastSuffix, partition)
+		}
+		if r.Summary != nil {
+			opts = r.summaryOptions()
+		}
+	}
+
+	if err := r.apply(cfg); err != nil {
+		return err
+	}
+	r.logInfo("updated configuration", "columns", len(r.Column), "record_type", r.RecordType)
+
+	if !slices.Equal(oldHeader, r.HeaderRow()) {
+		r.reheadered.Store(true)
+		r.versions.reset()
+		r.headers = nil // Widths are checked again against the new header
+	}
+	if !moved || r.lastSuffix == "" {
+		return nil
+	}
+
+	suffix := ""
+	if now, err := r.Now(); err == nil {
+		suffix, _ = r.Suffix(now)
+	}
+	for partition, oldPath := range closing {
+		r.closeFile(oldPath, r.path(suffix, partition), r.lastSuffix, r.partitions[partition], opts)
+	}
+	r.stopRotation()
+	r.rotationSuffix = ""
+	r.lastSuffix = ""
+	r.clockSuffix, r.clockBehind = "", ""
+	r.partitions = nil
+	r.written = nil
+	r.usageKnown = false
+	r.periodErrors = 0
+	r.reserved = nil
+	r.rowCounts = nil
+	return nil
+}
+
+// fileVersions holds the version of the files of each period and partition,
+// picked by pickVersion after UpdateConfig changed the header.
+type fileVersions struct {
+	mu sync.Mutex
+	m  map[[2]string]int // by suffix and partition
+}
+
+// get returns the version of the file of the period with the given suffix
+// and partition, 0 if it wasn't picked.
+func (v *fileVersions) get(suffix, partition string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.m[[2]string{suffix, partition}]
+}
+
+func (v *fileVersions) set(suffix, partition string, version int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.m == nil {
+		v.m = make(map[[2]string]int)
+	}
+	v.m[[2]string{suffix, partition}] = version
+}
+
+func (v *fileVersions) reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.m = nil
+}
+
+// versionedPartition returns the partition in the names of version of its
+// files: "v2" for the second version of an unpartitioned file, "eu_v2" for
+// partition "eu". The first version keeps the plain name.
+func versionedPartition(partition string, version int) string {
+	if version <= 1 {
+		return partition
+	}
+	v := "v" + strconv.Itoa(version)
+	if partition == "" {
+		return v
+	}
+	return partition + "_" + v
+}
+
+// pickVersion picks the version of the file of the period with the given
+// suffix and partition that rows with header go to: the first one that
+// doesn't exist yet, is empty, has the same header, or has one that header
+// extends while headers are widened. The caller must hold r.mu.
+func (r *Service) pickVersion(suffix, partition string, header []string) error {
+	if r.versions.get(suffix, partition) > 0 {
+		return nil
+	}
+	widen := r.NewColumns == ColumnsAppend || r.SchemaFiles || r.migrated()
+	for version := 1; ; version++ {
+		path := r.pathIn(r.Dir, suffix, versionedPartition(partition, version))
+		found, err := r.fileHeader(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to check the header of %q: %w", path, err)
+		}
+		fits := len(found) == 0 || slices.Equal(found, header) ||
+			widen && len(found) < len(header) && slices.Equal(found, header[:len(found)])
+		if !fits {
+			continue
+		}
+		if version > 1 {
+			r.logInfo("writing new file version for the changed header", "path", path, "version", version)
+		}
+		r.versions.set(suffix, partition, version)
+		return nil
+	}
+}
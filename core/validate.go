@@ -0,0 +1,228 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Validate checks the full service configuration without writing a record:
+// the record type, time zone, columns, that Dir is writable and that the
+// Sinks implementing Pinger are reachable. All problems found are returned
+// together, so a deployment can report them in one go. Nothing is created:
+// a missing Dir is reported writable if it can be created.
+func (r *Service) Validate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+
+	if err := r.checkLocation(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := r.Suffix(time.Now()); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := r.Now(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := r.resolveColumns(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(r.Column) == 0 && !r.DiscoverColumns {
+		errs = append(errs, errors.New("at least one column is required"))
+	}
+	if err := ValidateColumns(r.Column); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateHeaders(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateHeaderAliases(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, col := range r.RequiredColumns {
+		if !slices.Contains(r.Column, col) {
+			errs = append(errs, fmt.Errorf("required column %q is not one of the columns", col))
+		}
+	}
+	if err := r.validateRules(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, d := range r.Derive {
+		if d.Func == nil {
+			errs = append(errs, fmt.Errorf("derived column %q has no Func", d.Column))
+		}
+		if !slices.Contains(r.Column, d.Column) && !r.DiscoverColumns {
+			errs = append(errs, fmt.Errorf("derived column %q is not one of the columns", d.Column))
+		}
+	}
+	for col := range r.Rules {
+		if !slices.Contains(r.Column, col) && !r.DiscoverColumns {
+			errs = append(errs, fmt.Errorf("rule for column %q, which is not one of the columns", col))
+		}
+	}
+
+	if err := r.validateTemplates(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateDefaults(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateNormalize(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateCellCompression(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateBlobColumns(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateWatchdog(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateMirrors(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateProvenance(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validatePreamble(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateRFC4180(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateEnrichers(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateContextColumns(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateRowIDs(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateRowChecksums(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.validateProjections(); err != nil {
+		errs = append(errs, err)
+	}
+	if r.WAL && (r.AsyncBatch > 1 || r.FlushInterval > 0) {
+		errs = append(errs, errors.New("WAL can't be combined with AsyncBatch or FlushInterval, RecordAsync isn't journaled"))
+	}
+	if r.GroupBy != nil && r.PartitionBy != "" {
+		errs = append(errs, errors.New("GroupBy can't be combined with PartitionBy"))
+	}
+	if r.MaxFileOpenDuration < 0 {
+		errs = append(errs, fmt.Errorf("negative MaxFileOpenDuration %v", r.MaxFileOpenDuration))
+	}
+	if r.MaxOpenFiles < 0 {
+		errs = append(errs, fmt.Errorf("negative MaxOpenFiles %d", r.MaxOpenFiles))
+	}
+	if r.WriteMode == WriteTruncate && r.AppendOnly {
+		errs = append(errs, errors.New("WriteTruncate can't be combined with AppendOnly"))
+	}
+	if r.Dedup != nil {
+		if err := r.Dedup.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if r.Sampling != nil {
+		if err := r.Sampling.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if r.EncryptionKey != nil {
+		if _, err := newGCM(r.EncryptionKey); err != nil {
+			errs = append(errs, fmt.Errorf("invalid encryption key: %w", err))
+		}
+	}
+
+	if err := r.checkCollision(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := checkWritable(r.fs(), r.Dir); err != nil {
+		errs = append(errs, err)
+	}
+	if r.FallbackDir != "" {
+		if filepath.Clean(r.FallbackDir) == filepath.Clean(r.Dir) {
+			errs = append(errs, fmt.Errorf("fallback directory %q is the same as the directory", r.FallbackDir))
+		} else if err := checkWritable(r.fs(), r.FallbackDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i, sink := range r.Sinks {
+		if p, ok := sink.(Pinger); ok {
+			if err := p.Ping(); err != nil {
+				errs = append(errs, fmt.Errorf("sink %d (%T) is unreachable: %w", i, sink, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateColumns checks that the header columns are unique, non-empty and free
+// of characters that would break the header line (the delimiter, quotes and
+// line breaks).
+func ValidateColumns(column []string) error {
+	var errs []error
+	seen := make(map[string]bool, len(column))
+	for i, col := range column {
+		if col == "" {
+			errs = append(errs, fmt.Errorf("column %d has an empty name", i))
+			continue
+		}
+		if strings.ContainsAny(col, ",\"\r\n") {
+			errs = append(errs, fmt.Errorf("column %d %q contains a delimiter, quote or line break", i, col))
+		}
+		if seen[col] {
+			errs = append(errs, fmt.Errorf("duplicate column %q", col))
+		}
+		seen[col] = true
+	}
+	return errors.Join(errs...)
+}
+
+// checkWritable verifies a file can be created in dir or, if it doesn't exist
+// yet, in its closest existing parent, where dir would be created. Only a
+// probe file is created, and removed again.
+func checkWritable(fsys FS, dir string) error {
+	existing := dir
+	for {
+		info, err := fsys.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("directory %q can't be created: %q is not a directory", dir, existing)
+			}
+			break
+		}
+		parent := filepath.Dir(existing)
+		if !errors.Is(err, os.ErrNotExist) || parent == existing {
+			return fmt.Errorf("failed to check directory %q: %w", dir, err)
+		}
+		existing = parent
+	}
+	name := filepath.Join(existing, fmt.Sprintf(".recordtocsv-check-%d", rand.Int64()))
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("directory %q is not writable: %w", dir, err)
+	}
+	f.Close()
+	if err := fsys.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove probe file %q: %w", name, err)
+	}
+	return nil
+}
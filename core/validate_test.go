@@ -0,0 +1,47 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type pingSink struct{ err error }
+
+func (s pingSink) WriteBatch(b *Batch) error { return nil }
+func (s pingSink) Ping() error               { return s.err }
+
+func TestValidatePingsSinks(t *testing.T) {
+	s := New(t.TempDir(), "booking", []string{"id"}, "daily")
+	s.Sinks = []Sink{pingSink{}, pingSink{err: errors.New("connection refused")}}
+	err := s.Validate()
+	if err == nil || !strings.Contains(err.Error(), "sink 1") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("err = %v, want the failed ping of sink 1", err)
+	}
+	s.Sinks = s.Sinks[:1]
+	if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateDoesNotCreateDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "not", "yet")
+	s := New(dir, "booking", []string{"id"}, "daily")
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Validate created %q", dir)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s = New(filepath.Join(file, "dir"), "booking", []string{"id"}, "daily")
+	if err := s.Validate(); err == nil {
+		t.Error("validated a directory under a file")
+	}
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JournalSuffix is appended to Filename for the write-ahead journal kept in
+// Dir by WAL, e.g., "booking_record.wal". With FileLock, every writer of the
+// files keeps its own journal, numbered after the first one, e.g.,
+// "booking_record.1.wal".
+const JournalSuffix = ".wal"
+
+// FailedJournalSuffix is appended, with the time, to journals that couldn't be
+// replayed, e.g., "booking_record.wal.failed-20250102T150405Z".
+const FailedJournalSuffix = ".failed-"
+
+// journalMagic starts every journal file.
+const journalMagic = "RCSVWAL1"
+
+// journalEntry is a pending append: data is about to be written to Path, whose
+// size was Offset beforehand.
+//
+// On disk: magic, uint32 path length, path, uint64 offset, uint32 data
+// length, data and a CRC-32 of everything after the magic, all big-endian.
+type journalEntry struct {
+	Path   string
+	Offset int64
+	Data   []byte
+}
+
+// JournalPath returns the path of the write-ahead journal of the service, see
+// WAL. With FileLock, it is known once the service is registered.
+func (r *Service) JournalPath() string {
+	if r.journalPath != "" {
+		return r.journalPath
+	}
+	return r.journalSlot(0)
+}
+
+// journalSlot returns the path of the n-th journal of the files.
+func (r *Service) journalSlot(n int) string {
+	name := r.filename()
+	if r.name != "" {
+		name = r.name // Resolved by the collision policy
+	}
+	if n > 0 {
+		name += "." + strconv.Itoa(n)
+	}
+	return filepath.Join(r.Dir, name+JournalSuffix)
+}
+
+// journalSlots returns the highest number of the journals of the files in
+// Dir, or -1 if there are none.
+func (r *Service) journalSlots() (int, error) {
+	entries, err := r.fs().ReadDir(r.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list journals: %w", err)
+	}
+	last := -1
+	base := filepath.Base(r.journalSlot(0))
+	prefix := strings.TrimSuffix(base, JournalSuffix) + "."
+	for _, e := range entries {
+		if e.Name() == base {
+			last = max(last, 0)
+		} else if n, ok := strings.CutPrefix(e.Name(), prefix); ok {
+			if n, err := strconv.Atoi(strings.TrimSuffix(n, JournalSuffix)); err == nil && n > 0 && strings.HasSuffix(e.Name(), JournalSuffix) {
+				last = max(last, n)
+			}
+		}
+	}
+	return last, nil
+}
+
+// claimJournal replays the journals left by writers that died and, with
+// FileLock, claims the first journal no running writer holds a lock on,
+// keeping it locked until the service unregisters. Without FileLock, the
+// service is the only writer and uses the first journal. A journal that
+// can't be replayed is quarantined rather than failing the service. The
+// caller must hold r.entry.mu.
+func (r *Service) claimJournal() error {
+	last, err := r.journalSlots()
+	if err != nil {
+		return err
+	}
+	for n := 0; n <= last || (r.FileLock && r.journalPath == ""); n++ {
+		path := r.journalSlot(n)
+		var lock File
+		if r.FileLock {
+			f, err := r.fs().OpenFile(path, os.O_RDWR|os.O_CREATE, r.FileMode())
+			if err != nil {
+				return fmt.Errorf("failed to open journal %q: %w", path, err)
+			}
+			ok, err := tryLockFile(f)
+			if err != nil || !ok {
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("failed to lock journal %q: %w", path, err)
+				}
+				continue // Held by a running writer
+			}
+			lock = f
+		}
+
+		if err := r.replayJournal(path); err != nil {
+			if lock != nil {
+				lock.Close()
+			}
+			r.quarantineJournal(path, err)
+			continue
+		}
+		if lock != nil && r.journalPath == "" {
+			r.journalPath, r.journalLock = path, lock
+		} else if lock != nil {
+			lock.Close()
+		}
+	}
+	return nil
+}
+
+// releaseJournal releases the journal claimed by claimJournal.
+func (r *Service) releaseJournal() {
+	if r.journalLock != nil {
+		r.journalLock.Close()
+	}
+	r.journalPath, r.journalLock = "", nil
+}
+
+// quarantineJournal moves aside the journal at path, which failed to replay
+// with err, so the service can start with an empty one.
+func (r *Service) quarantineJournal(path string, err error) {
+	to := path + FailedJournalSuffix + time.Now().UTC().Format("20060102T150405Z")
+	if rerr := r.fs().Rename(path, to); rerr != nil {
+		r.logError("failed to quarantine journal", "path", path, "error", rerr)
+		return
+	}
+	r.logError("quarantined journal that can't be replayed", "path", path, "quarantine", to, "error", err)
+}
+
+// journal persists the entry before it is applied to the CSV file.
+func (r *Service) journal(e journalEntry) error {
+	var buf bytes.Buffer
+	buf.WriteString(journalMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(e.Path)))
+	buf.WriteString(e.Path)
+	binary.Write(&buf, binary.BigEndian, uint64(e.Offset))
+	binary.Write(&buf, binary.BigEndian, uint32(len(e.Data)))
+	buf.Write(e.Data)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()[len(journalMagic):]))
+
+	if err := writeFile(r.fs(), r.JournalPath(), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write journal %q: %w", r.JournalPath(), err)
+	}
+	return nil
+}
+
+// clearJournal marks the pending entry as done, whether it was applied or the
+// write failed and was reported to the caller.
+func (r *Service) clearJournal() {
+	r.clearJournalAt(r.JournalPath())
+}
+
+func (r *Service) clearJournalAt(path string) {
+	if err := writeFile(r.fs(), path, nil); err != nil {
+		r.logError("failed to clear journal", "path", path, "error", err)
+	}
+}
+
+// readJournal returns the pending entry of the journal at path, or nil if there is none. A torn
+// entry means the process died before the CSV write started, so it is
+// ignored.
+func (r *Service) readJournal(path string) (*journalEntry, error) {
+	data, err := readFile(r.fs(), path)
+	if errors.Is(err, os.ErrNotExist) || len(data) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal %q: %w", path, err)
+	}
+	if !bytes.HasPrefix(data, []byte(journalMagic)) || len(data) < len(journalMagic)+4 {
+		return nil, nil
+	}
+	body, sum := data[len(journalMagic):len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, nil
+	}
+
+	rd := bytes.NewReader(body)
+	var e journalEntry
+	var pathLen, dataLen uint32
+	var offset uint64
+	if err := binary.Read(rd, binary.BigEndian, &pathLen); err != nil {
+		return nil, nil
+	}
+	name := make([]byte, pathLen)
+	if _, err := io.ReadFull(rd, name); err != nil {
+		return nil, nil
+	}
+	if binary.Read(rd, binary.BigEndian, &offset) != nil || binary.Read(rd, binary.BigEndian, &dataLen) != nil {
+		return nil, nil
+	}
+	e.Path, e.Offset, e.Data = string(name), int64(offset), make([]byte, dataLen)
+	if _, err := io.ReadFull(rd, e.Data); err != nil {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// replayJournal completes the append of the journal at path interrupted by a
+// crash. The entry is skipped if its data is already in the file; a partial
+// write is cut off and written again. The caller must hold r.mu.
+func (r *Service) replayJournal(path string) error {
+	e, err := r.readJournal(path)
+	if err != nil || e == nil {
+		return err
+	}
+
+	file, err := r.fs().OpenFile(e.Path, os.O_RDWR|os.O_CREATE, r.FileMode())
+	if err != nil {
+		return fmt.Errorf("failed to open %q for journal replay: %w", e.Path, err)
+	}
+	defer file.Close()
+	if r.FileLock {
+		if err := lockFile(file); err != nil {
+			return fmt.Errorf("failed to lock %q for journal replay: %w", e.Path, err)
+		}
+		defer unlockFile(file)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info for %q: %w", e.Path, err)
+	}
+	written := make([]byte, min(max(stat.Size()-e.Offset, 0), int64(len(e.Data))))
+	if _, err := file.ReadAt(written, e.Offset); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read %q for journal replay: %w", e.Path, err)
+	}
+
+	switch {
+	case bytes.Equal(written, e.Data):
+		// Committed before the crash
+	case bytes.HasPrefix(e.Data, written) && stat.Size() == e.Offset+int64(len(written)):
+		// Missing or partial write at the end of the file
+		if _, err := file.WriteAt(e.Data, e.Offset); err != nil {
+			return fmt.Errorf("failed to replay journal into %q: %w", e.Path, err)
+		}
+		r.logInfo("replayed journal", "path", e.Path, "bytes", len(e.Data)-len(written))
+	case r.EncryptionKey != nil && stat.Size() == e.Offset+finalSize:
+		// The final frame the append replaces, or a partial write over it;
+		// other appends are longer than a final frame
+		if _, err := file.WriteAt(e.Data, e.Offset); err != nil {
+			return fmt.Errorf("failed to replay journal into %q: %w", e.Path, err)
+		}
+		r.logInfo("replayed journal", "path", e.Path, "bytes", len(e.Data))
+	default:
+		return fmt.Errorf("journal %q doesn't match %q, which changed since the crash", path, e.Path)
+	}
+
+	r.clearJournalAt(path)
+	return nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalPerWriter(t *testing.T) {
+	dir := t.TempDir()
+	var services []*Service
+	for range 2 {
+		s := New(dir, "booking", []string{"id"}, "daily")
+		s.WAL, s.FileLock = true, true
+		if err := s.Register(); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		services = append(services, s)
+	}
+	if a, b := services[0].JournalPath(), services[1].JournalPath(); a == b {
+		t.Errorf("both writers journal to %q", a)
+	}
+	for _, s := range services {
+		if err := s.Record(map[string]interface{}{"id": "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The journal of a writer that is gone is claimed again
+	path := services[1].JournalPath()
+	services[1].Unregister()
+	s := New(dir, "booking", []string{"id"}, "daily")
+	s.WAL, s.FileLock = true, true
+	if err := s.Register(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.JournalPath() != path {
+		t.Errorf("journal = %q, want %q", s.JournalPath(), path)
+	}
+}
+
+func TestJournalQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir, "booking", []string{"id"}, "daily")
+	s.WAL = true
+	if err := s.Record(map[string]interface{}{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	filename := files[0]
+	// A pending append whose file changed since
+	if err := s.journal(journalEntry{Path: filename, Offset: 1, Data: []byte("2\n")}); err != nil {
+		t.Fatal(err)
+	}
+	s.Unregister()
+
+	if err := s.Register(); err != nil {
+		t.Fatalf("register failed on an unreplayable journal: %v", err)
+	}
+	quarantined, _ := filepath.Glob(s.JournalPath() + FailedJournalSuffix + "*")
+	if len(quarantined) != 1 {
+		t.Errorf("quarantined journals = %v", quarantined)
+	}
+	if err := s.Record(map[string]interface{}{"id": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); strings.Contains(got, "2\n") || !strings.HasSuffix(got, "3\n") {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestJournalRejectsAsync(t *testing.T) {
+	s := New(t.TempDir(), "booking", []string{"id"}, "daily")
+	s.WAL = true
+	if err := s.Register(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.RecordAsync(map[string]interface{}{"id": "1"}); err == nil {
+		t.Error("RecordAsync with WAL succeeded")
+	}
+
+	s.AsyncBatch = 8
+	if err := s.Validate(); err == nil || !strings.Contains(err.Error(), "WAL") {
+		t.Errorf("Validate with WAL and AsyncBatch = %v", err)
+	}
+}
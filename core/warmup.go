@@ -0,0 +1,146 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// nextPeriod returns the start of the rotation period after the one of t.
+func (r *Service) nextPeriod(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch r.RecordType {
+	case "monthly":
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+	case "yearly":
+		return time.Date(y+1, 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// armWarmup schedules the creation of the next period's files, once per
+// period. The caller must hold r.mu.
+func (r *Service) armWarmup(suffix string) {
+	if r.Warmup <= 0 || r.DryRun || r.warmupSuffix == suffix || !r.writesFiles() {
+		return
+	}
+	now, err := r.Now()
+	if err != nil {
+		return
+	}
+	next := r.nextPeriod(now)
+	nextSuffix, err := r.Suffix(next)
+	if err != nil {
+		return
+	}
+	if r.warmupTimer != nil && r.warmupTimer.Stop() {
+		r.background.Done()
+	}
+	r.warmupSuffix = suffix
+	r.background.Add(1)
+	r.warmupTimer = time.AfterFunc(max(next.Sub(now)-r.Warmup, 0), func() {
+		defer r.background.Done()
+		r.warmup(nextSuffix)
+	})
+}
+
+// stopWarmup cancels a scheduled warmup. The caller must hold r.mu.
+func (r *Service) stopWarmup() {
+	if r.warmupTimer != nil && r.warmupTimer.Stop() {
+		r.background.Done()
+	}
+	r.warmupTimer = nil
+}
+
+// writesFiles reports whether the file sink is one of the sinks.
+func (r *Service) writesFiles() bool {
+	return len(r.Sinks) == 0 || slices.ContainsFunc(r.Sinks, func(s Sink) bool {
+		fs, ok := s.(fileSink)
+		return ok && fs.r == r
+	})
+}
+
+// warmup creates the files of the period with the given suffix, with their
+// header, for every partition written in the current period.
+func (r *Service) warmup(suffix string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.lastSuffix == suffix {
+		return // Already rotated
+	}
+	if r.entry != nil {
+		r.entry.mu.Lock()
+		defer r.entry.mu.Unlock()
+	}
+
+	partitions := []string{""}
+	if len(r.partitions) > 0 {
+		partitions = partitions[:0]
+		for partition := range r.partitions {
+			partitions = append(partitions, partition)
+		}
+	}
+	for _, partition := range partitions {
+		path := r.path(suffix, partition)
+		err := r.mkdir(filepath.Dir(path))
+		if err == nil {
+			err = r.createFile(path, r.HeaderRow())
+		}
+		if err != nil {
+			r.logError("failed to warm up file", "path", path, "error", err)
+			continue
+		}
+		r.logDebug("warmed up CSV file", "path", path)
+	}
+}
+
+// createFile creates the file at path with only the header, unless it already
+// has content. The caller must hold the entry lock.
+func (r *Service) createFile(path string, header []string) error {
+	file, err := r.fs().OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, r.FileMode())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if r.FileLock {
+		if err := lockFile(file); err != nil {
+			return err
+		}
+		defer unlockFile(file)
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.Size() > 0 {
+		return err
+	}
+	data, err := r.encode(path, header, nil, true)
+	if err != nil {
+		return err
+	}
+	n, err := file.Write(data)
+	if err != nil {
+		return err
+	}
+	if r.AppendOnly {
+		r.trackSize(path, int64(n))
+	}
+	r.reserve(file, path, int64(n))
+	return nil
+}
+
+// reserve allocates the next PreallocateBytes of the file once its size
+// reaches the space reserved so far.
+func (r *Service) reserve(f File, path string, size int64) {
+	osf, ok := f.(*os.File)
+	if r.PreallocateBytes <= 0 || !ok || size < r.reserved[path] {
+		return
+	}
+	if r.reserved == nil {
+		r.reserved = make(map[string]int64)
+	}
+	r.reserved[path] = size + r.PreallocateBytes
+	if err := reserveOSFile(osf, size, r.PreallocateBytes); err != nil {
+		r.logDebug("failed to preallocate file", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStalled is matched by *StallError with errors.Is.
+var ErrStalled = errors.New("record stalled")
+
+// StallError is returned by a record call abandoned by StallCancel.
+type StallError struct {
+	Waited time.Duration // how long the call blocked before it was abandoned
+
+	// Pending is set if the write had already started, e.g., on a slow
+	// mount, and may still complete. Otherwise the call was still waiting
+	// for the service and nothing was written.
+	Pending bool
+}
+
+func (e *StallError) Error() string {
+	if e.Pending {
+		return fmt.Sprintf("%v: write still in progress after %v", ErrStalled, e.Waited)
+	}
+	return fmt.Sprintf("%v: waited %v for the service, nothing written", ErrStalled, e.Waited)
+}
+
+func (e *StallError) Is(target error) bool {
+	return target == ErrStalled
+}
+
+// StallAction is a set of actions taken by the Watchdog when a record call
+// stalls.
+type StallAction int
+
+const (
+	// StallLog logs the stall as an error.
+	StallLog StallAction = 1 << iota
+
+	// StallMetric counts the stall in Stats and reports it to Metrics if it
+	// implements StallObserver.
+	StallMetric
+
+	// StallFailover switches writes to FallbackDir as if Dir had failed,
+	// from the next one to reach the files, which may be the stalled one.
+	// Dir is probed for recovery as after a failed write.
+	StallFailover
+
+	// StallCancel returns a *StallError to the stalled caller instead of
+	// keeping it blocked, see StallError.Pending. A caller whose context is
+	// canceled while it waits for the service is released the same way, with
+	// the context's error.
+	StallCancel
+)
+
+// StallObserver is implemented by Metrics that count stalls, see StallMetric.
+type StallObserver interface {
+	// ObserveStall is called when a record call has blocked for the
+	// Watchdog's Threshold.
+	ObserveStall(e StallEvent)
+}
+
+// StallEvent describes a record call that blocked beyond the Watchdog's
+// Threshold.
+type StallEvent struct {
+	Started time.Time     // when the call started
+	Waited  time.Duration // how long it has blocked so far
+
+	// Writing is set if the call was writing, e.g., to a slow mount, rather
+	// than waiting for the service behind another write, e.g., a stuck lock.
+	Writing bool
+}
+
+// Watchdog detects record calls that block beyond a threshold, e.g., on a
+// slow NFS mount or behind a stuck lock, which otherwise back up into the
+// callers unnoticed:
+//
+//	service.Watchdog = &core.Watchdog{
+//		Threshold: 2 * time.Second,
+//		Actions:   core.StallLog | core.StallMetric | core.StallCancel,
+//	}
+type Watchdog struct {
+	// Threshold is how long a record call may block before it is stalled,
+	// from the call to the return, including the wait for other writes.
+	Threshold time.Duration
+
+	// Actions are taken once for every stalled call. Defaults to StallLog
+	// and StallMetric.
+	Actions StallAction
+
+	// OnStall, if set, is called for every stalled call, from another
+	// goroutine than the caller's. It must not block.
+	OnStall func(e StallEvent)
+}
+
+// watch states
+const (
+	watchWaiting   = iota // waiting for the service lock
+	watchWriting          // holding the lock
+	watchAbandoned        // given up on by StallCancel before it got the lock
+)
+
+// watch tracks a record call for the Watchdog.
+type watch struct {
+	start time.Time
+	state atomic.Int32
+}
+
+// begin moves the call to writing once it holds the service lock, and
+// reports false if it was abandoned meanwhile.
+func (w *watch) begin() bool {
+	return w == nil || w.state.CompareAndSwap(watchWaiting, watchWriting)
+}
+
+// validateWatchdog checks the Watchdog's threshold and actions.
+func (r *Service) validateWatchdog() error {
+	w := r.Watchdog
+	if w == nil {
+		return nil
+	}
+	if w.Threshold <= 0 {
+		return fmt.Errorf("watchdog threshold must be positive, got %v", w.Threshold)
+	}
+	if w.Actions&StallFailover != 0 && r.FallbackDir == "" {
+		return errors.New("watchdog failover requires FallbackDir")
+	}
+	return nil
+}
+
+// watched runs the record call of fn under the Watchdog, if any.
+func (r *Service) watched(ctx context.Context, fn func(w *watch) ([]*Batch, error)) ([]*Batch, error) {
+	wd := r.Watchdog
+	if wd == nil || wd.Threshold <= 0 {
+		return fn(nil)
+	}
+	w := &watch{start: time.Now()}
+	var stalled atomic.Bool
+	timer := time.AfterFunc(wd.Threshold, func() {
+		stalled.Store(true)
+		r.stall(wd, w)
+	})
+	finish := func() {
+		if !timer.Stop() && stalled.Load() {
+			r.logInfo("stalled record finished", "duration", time.Since(w.start))
+		}
+	}
+	if wd.Actions&StallCancel == 0 {
+		defer finish()
+		return fn(w)
+	}
+
+	type result struct {
+		placed []*Batch
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		placed, err := fn(w)
+		done <- result{placed, err}
+	}()
+	deadline := time.NewTimer(wd.Threshold)
+	defer deadline.Stop()
+	cancel := ctx.Done()
+	for {
+		select {
+		case res := <-done:
+			finish()
+			return res.placed, res.err
+		case <-cancel:
+			if w.state.CompareAndSwap(watchWaiting, watchAbandoned) {
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+			cancel = nil // Already writing, wait for the write or the threshold
+		case <-deadline.C:
+			pending := !w.state.CompareAndSwap(watchWaiting, watchAbandoned)
+			return nil, &StallError{Waited: time.Since(w.start), Pending: pending}
+		}
+	}
+}
+
+// stall takes the actions of the Watchdog for a stalled call.
+func (r *Service) stall(wd *Watchdog, w *watch) {
+	e := StallEvent{Started: w.start, Waited: time.Since(w.start), Writing: w.state.Load() == watchWriting}
+	actions := wd.Actions
+	if actions == 0 {
+		actions = StallLog | StallMetric
+	}
+	if actions&StallLog != 0 {
+		r.logError("record stalled", "waited", e.Waited, "writing", e.Writing)
+	}
+	if actions&StallMetric != 0 {
+		r.stats.stalls.Add(1)
+		if o, ok := r.Metrics.(StallObserver); ok {
+			o.ObserveStall(e)
+		}
+	}
+	if actions&StallFailover != 0 {
+		r.stallFailover.Store(true)
+	}
+	if wd.OnStall != nil {
+		wd.OnStall(e)
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// WriteMode is how the service treats a file that already exists when it
+// first writes to it, e.g., one left by an earlier run of a batch job.
+type WriteMode int
+
+const (
+	// WriteAppend appends to existing files. This is the default.
+	WriteAppend WriteMode = iota
+
+	// WriteTruncate starts every file afresh on the service's first write to
+	// it, so a rerun job replaces the rows of its period instead of appending
+	// them twice. Later writes of the same service append as usual.
+	WriteTruncate
+
+	// WriteExclusive fails the first write to a file that already exists with
+	// an error matching ErrFileExists, so a job can't run twice for the same
+	// period. The file is created with O_EXCL, so of processes racing to
+	// create it, only one wins.
+	WriteExclusive
+)
+
+func (m WriteMode) String() string {
+	switch m {
+	case WriteAppend:
+		return "append"
+	case WriteTruncate:
+		return "truncate"
+	case WriteExclusive:
+		return "exclusive"
+	}
+	return "unknown"
+}
+
+// ErrFileExists is returned in WriteExclusive mode for a file that existed
+// before the service's first write to it.
+var ErrFileExists = errors.New("file already exists")
+
+// openMode applies WriteMode to the file at path on the service's first write to
+// it.
+func (r *Service) openMode(path string) error {
+	if r.WriteMode == WriteAppend || r.claimed[path] {
+		return nil
+	}
+	switch r.WriteMode {
+	case WriteTruncate:
+		err := r.fs().Remove(path)
+		if err == nil {
+			r.logInfo("truncated CSV file", "path", path)
+			delete(r.rowCounts, path)
+			delete(r.sizes, path)
+			delete(r.reserved, path)
+			delete(r.written, path)
+			r.usageKnown = false
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	case WriteExclusive:
+		f, err := r.fs().OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, r.FileMode())
+		if errors.Is(err, fs.ErrExist) {
+			return ErrFileExists
+		}
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	if r.claimed == nil {
+		r.claimed = make(map[string]bool)
+	}
+	r.claimed[path] = true
+	return nil
+}
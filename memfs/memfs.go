@@ -0,0 +1,342 @@
+// Package memfs is an in-memory core.FS, so tests of code that records can
+// run without touching disk.
+//
+//	fsys := memfs.New()
+//	service.FS = fsys
+//	service.Record(payload)
+//	data, err := fsys.ReadFile("files/record/booking_record_2025_08_26.csv")
+package memfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+var _ core.FS = (*FS)(nil)
+
+// FS is an in-memory filesystem. Paths are cleaned with filepath.Clean, and
+// relative and absolute paths name different files. The zero value is not
+// usable, create one with New.
+type FS struct {
+	mu    sync.Mutex
+	files map[string]*node
+	dirs  map[string]time.Time // modification time of each directory
+}
+
+// node is the content of a file, shared by all its open handles.
+type node struct {
+	data []byte
+	mode fs.FileMode
+	mod  time.Time
+}
+
+// New returns an empty filesystem with only the current and root directories.
+func New() *FS {
+	now := time.Now()
+	return &FS{
+		files: map[string]*node{},
+		dirs:  map[string]time.Time{".": now, string(filepath.Separator): now},
+	}
+}
+
+// ReadFile returns the content of the file at name.
+func (m *FS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, pathError("read", name, fs.ErrNotExist)
+	}
+	return slices.Clone(n.data), nil
+}
+
+func (m *FS) Open(name string) (core.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *FS) Create(name string) (core.File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *FS) OpenFile(name string, flag int, perm fs.FileMode) (core.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.dirs[name]; ok {
+		return nil, pathError("open", name, errors.New("is a directory"))
+	}
+	n, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, fs.ErrExist)
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, pathError("open", name, fs.ErrNotExist)
+	case !ok:
+		if _, ok := m.dirs[filepath.Dir(name)]; !ok {
+			return nil, pathError("open", name, fs.ErrNotExist)
+		}
+		n = &node{mode: perm, mod: time.Now()}
+		m.files[name] = n
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if flag&os.O_TRUNC != 0 && writable {
+		n.data, n.mod = nil, time.Now()
+	}
+	return &file{
+		fs:       m,
+		name:     name,
+		node:     n,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+func (m *FS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return pathError("mkdir", dir, errors.New("not a directory"))
+		}
+		if _, ok := m.dirs[dir]; ok {
+			return nil
+		}
+		m.dirs[dir] = time.Now()
+		if filepath.Dir(dir) == dir {
+			return nil // A volume root, e.g., C:\ on Windows
+		}
+	}
+}
+
+func (m *FS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if n, ok := m.files[name]; ok {
+		return fileInfo{name: filepath.Base(name), size: int64(len(n.data)), mode: n.mode, mod: n.mod}, nil
+	}
+	if mod, ok := m.dirs[name]; ok {
+		return fileInfo{name: filepath.Base(name), mode: fs.ModeDir | 0755, mod: mod}, nil
+	}
+	return nil, pathError("stat", name, fs.ErrNotExist)
+}
+
+// Rename moves a file. Renaming directories is not supported.
+func (m *FS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	n, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.dirs[filepath.Dir(newpath)]; !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = n
+	return nil
+}
+
+// Remove deletes a file or an empty directory.
+func (m *FS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if _, ok := m.dirs[name]; ok {
+		if len(m.children(name)) > 0 {
+			return pathError("remove", name, errors.New("directory not empty"))
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+	return pathError("remove", name, fs.ErrNotExist)
+}
+
+func (m *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.dirs[name]; !ok {
+		return nil, pathError("readdir", name, fs.ErrNotExist)
+	}
+	var entries []fs.DirEntry
+	for _, child := range m.children(name) {
+		path := filepath.Join(name, child)
+		var info fs.FileInfo
+		if n, ok := m.files[path]; ok {
+			info = fileInfo{name: child, size: int64(len(n.data)), mode: n.mode, mod: n.mod}
+		} else {
+			info = fileInfo{name: child, mode: fs.ModeDir | 0755, mod: m.dirs[path]}
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// children returns the sorted base names of the files and directories in dir.
+// The caller must hold m.mu.
+func (m *FS) children(dir string) []string {
+	var names []string
+	add := func(path string) {
+		if path != dir && filepath.Dir(path) == dir {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	for path := range m.files {
+		add(path)
+	}
+	for path := range m.dirs {
+		add(path)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// file is an open handle with its own offset.
+type file struct {
+	fs       *FS
+	name     string
+	node     *node
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+	closed   bool
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) readAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", f.readable); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, f.node.data[off:]), nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.append {
+		return 0, pathError("writeat", f.name, errors.New("file opened with O_APPEND"))
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *file) writeAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", f.writable); err != nil {
+		return 0, err
+	}
+	if end := off + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[off:], p)
+	f.node.mod = time.Now()
+	return len(p), nil
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+	return fileInfo{name: filepath.Base(f.name), size: int64(len(f.node.data)), mode: f.node.mode, mod: f.node.mod}, nil
+}
+
+func (f *file) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("close", true); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+// check fails operations on closed handles and those the open flags didn't
+// allow. The caller must hold f.fs.mu.
+func (f *file) check(op string, allowed bool) error {
+	if f.closed {
+		return pathError(op, f.name, fs.ErrClosed)
+	}
+	if !allowed {
+		return pathError(op, f.name, errors.New("bad file descriptor"))
+	}
+	return nil
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+	mod  time.Time
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i fileInfo) ModTime() time.Time { return i.mod }
+func (i fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i fileInfo) Sys() any           { return nil }
+
+func pathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
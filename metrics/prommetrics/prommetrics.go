@@ -0,0 +1,117 @@
+// Package prommetrics exposes recordtocsv service metrics to Prometheus.
+//
+//	m := prommetrics.New(prometheus.Labels{"stream": "booking"})
+//	prometheus.MustRegister(m)
+//	service.Metrics = m
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ core.Metrics       = (*Metrics)(nil)
+	_ core.StallObserver = (*Metrics)(nil)
+)
+
+// Metrics implements core.Metrics and core.StallObserver with Prometheus counters and histograms.
+// It is a prometheus.Collector and must be registered to be scraped.
+type Metrics struct {
+	records   prometheus.Counter
+	bytes     prometheus.Counter
+	latency   prometheus.Histogram
+	errors    prometheus.Counter
+	rotations prometheus.Counter
+	stalls    prometheus.Counter
+	lastWrite prometheus.Gauge
+}
+
+// New creates the metrics. constLabels are attached to every series, which
+// tells several services apart when they share a registry.
+func New(constLabels prometheus.Labels) *Metrics {
+	return &Metrics{
+		records: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "recordtocsv",
+			Name:        "records_written_total",
+			Help:        "Number of rows written.",
+			ConstLabels: constLabels,
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "recordtocsv",
+			Name:        "bytes_written_total",
+			Help:        "Number of CSV bytes written to files.",
+			ConstLabels: constLabels,
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "recordtocsv",
+			Name:        "write_duration_seconds",
+			Help:        "Time taken by successful Record calls.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "recordtocsv",
+			Name:        "errors_total",
+			Help:        "Number of failed Record calls.",
+			ConstLabels: constLabels,
+		}),
+		rotations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "recordtocsv",
+			Name:        "rotations_total",
+			Help:        "Number of times the active file changed to a new period.",
+			ConstLabels: constLabels,
+		}),
+		stalls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "recordtocsv",
+			Name:        "stalls_total",
+			Help:        "Number of Record calls that blocked beyond the watchdog threshold.",
+			ConstLabels: constLabels,
+		}),
+		lastWrite: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "recordtocsv",
+			Name:        "last_write_timestamp_seconds",
+			Help:        "Unix time of the last successful write, for stall alerts.",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+func (m *Metrics) ObserveWrite(rows int, bytes int64, d time.Duration) {
+	m.records.Add(float64(rows))
+	m.bytes.Add(float64(bytes))
+	m.latency.Observe(d.Seconds())
+	m.lastWrite.SetToCurrentTime()
+}
+
+func (m *Metrics) ObserveError(err error) {
+	m.errors.Inc()
+}
+
+func (m *Metrics) ObserveRotation(oldPath, newPath string) {
+	m.rotations.Inc()
+}
+
+func (m *Metrics) ObserveStall(e core.StallEvent) {
+	m.stalls.Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.records, m.bytes, m.latency, m.errors, m.rotations, m.stalls, m.lastWrite}
+}
@@ -0,0 +1,138 @@
+// Package fanout writes every payload to several recorders, e.g., to
+// dual-write during a format migration:
+//
+//	m := fanout.New(fanout.BestEffort, oldService, newService, xlsx.NewEncoder(newService))
+//	err := m.Record(payload)
+//
+// To send the rows of a single service to several destinations, use its
+// Sinks instead, which maps each payload only once.
+package fanout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// Recorder is anything that records payloads, such as a core.Recorder or an
+// xlsx.Encoder.
+type Recorder interface {
+	Record(payload interface{}) error
+}
+
+var _ core.Recorder = (*MultiRecorder)(nil)
+
+// Mode decides how a failing recorder affects the others.
+type Mode int
+
+const (
+	// FailFast stops at the first failing recorder, so later recorders don't
+	// receive the payload.
+	FailFast Mode = iota
+
+	// BestEffort writes to every recorder and reports all failures together.
+	BestEffort
+)
+
+// RecorderError is a failure of one of the recorders.
+type RecorderError struct {
+	Index int // position of the recorder in Recorders
+	Err   error
+}
+
+func (e *RecorderError) Error() string {
+	return fmt.Sprintf("recorder %d: %v", e.Index, e.Err)
+}
+
+func (e *RecorderError) Unwrap() error {
+	return e.Err
+}
+
+// MultiRecorder records each payload to all Recorders, in order.
+type MultiRecorder struct {
+	Recorders []Recorder
+	Mode      Mode
+
+	// Parallel records to all recorders concurrently. FailFast then only
+	// decides which errors are reported: the first one in recorder order.
+	Parallel bool
+}
+
+// New creates a MultiRecorder writing to recorders.
+func New(mode Mode, recorders ...Recorder) *MultiRecorder {
+	return &MultiRecorder{Recorders: recorders, Mode: mode}
+}
+
+// Record writes the payload to the recorders. Failures are returned as
+// *RecorderError values, joined with errors.Join in BestEffort mode.
+func (m *MultiRecorder) Record(payload interface{}) error {
+	return m.each(func(rec Recorder) error { return rec.Record(payload) })
+}
+
+// RecordBatch writes the payloads to the recorders, with RecordBatch for
+// those that implement core.Recorder and as a single slice payload to Record
+// for the others. Failures are reported like Record does.
+func (m *MultiRecorder) RecordBatch(payloads []interface{}) error {
+	return m.each(func(rec Recorder) error {
+		if b, ok := rec.(core.Recorder); ok {
+			return b.RecordBatch(payloads)
+		}
+		return rec.Record(payloads)
+	})
+}
+
+// each calls fn with every recorder as Mode and Parallel say.
+func (m *MultiRecorder) each(fn func(rec Recorder) error) error {
+	errs := make([]error, len(m.Recorders))
+	if m.Parallel {
+		var wg sync.WaitGroup
+		for i, rec := range m.Recorders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = call(i, rec, fn)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i, rec := range m.Recorders {
+			if errs[i] = call(i, rec, fn); errs[i] != nil && m.Mode == FailFast {
+				break
+			}
+		}
+	}
+
+	if m.Mode == FailFast {
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every recorder that implements io.Closer, such as a
+// core.Service, and reports all failures.
+func (m *MultiRecorder) Close() error {
+	var errs []error
+	for i, rec := range m.Recorders {
+		if c, ok := rec.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, &RecorderError{Index: i, Err: err})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func call(i int, rec Recorder, fn func(rec Recorder) error) error {
+	if err := fn(rec); err != nil {
+		return &RecorderError{Index: i, Err: err}
+	}
+	return nil
+}
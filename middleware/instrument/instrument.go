@@ -0,0 +1,78 @@
+// Package instrument reports the calls to a recorder to a core.Metrics, such
+// as metrics/prommetrics, for recorders that don't report their own writes,
+// or to measure the latency seen by callers, including decorators like
+// middleware/retry:
+//
+//	rec := instrument.New(retry.New(service, policy), prommetrics.New(labels))
+//	err := rec.Record(payload)
+package instrument
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+var _ core.Recorder = (*Recorder)(nil)
+
+// Recorder records to Next and reports every call to Metrics: the payloads
+// as rows to ObserveWrite, with zero bytes since only Next knows them, and
+// failures to ObserveError. Rows later left out by the recorder, e.g., by
+// Filter or Dedup, are counted too.
+type Recorder struct {
+	Next    core.Recorder
+	Metrics core.Metrics
+}
+
+// New returns a Recorder reporting the calls to next to m.
+func New(next core.Recorder, m core.Metrics) *Recorder {
+	return &Recorder{Next: next, Metrics: m}
+}
+
+func (r *Recorder) Record(payload interface{}) error {
+	start := time.Now()
+	err := r.Next.Record(payload)
+	r.observe(rows(payload), start, err)
+	return err
+}
+
+func (r *Recorder) RecordBatch(payloads []interface{}) error {
+	start := time.Now()
+	err := r.Next.RecordBatch(payloads)
+	n := 0
+	for _, payload := range payloads {
+		n += rows(payload)
+	}
+	r.observe(n, start, err)
+	return err
+}
+
+// Close closes Next.
+func (r *Recorder) Close() error {
+	return r.Next.Close()
+}
+
+func (r *Recorder) observe(rows int, start time.Time, err error) {
+	if err != nil {
+		r.Metrics.ObserveError(err)
+		return
+	}
+	r.Metrics.ObserveWrite(rows, 0, time.Since(start))
+}
+
+// rows returns the number of rows of a payload: the length of a slice or
+// array, except byte slices, and 1 for anything else.
+func rows(payload interface{}) int {
+	v := reflect.ValueOf(payload)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return v.Len()
+		}
+	}
+	return 1
+}
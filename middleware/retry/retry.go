@@ -0,0 +1,45 @@
+// Package retry retries the payloads a recorder fails to record with a
+// transient error:
+//
+//	rec := retry.New(service, core.RetryPolicy{MaxAttempts: 5})
+//	err := rec.Record(payload)
+//
+// A core.Service already retries each of its sinks with its Retry policy,
+// which never writes a row twice. Retrying a whole Record can, when only
+// some of the service's files or sinks failed, so use this package for
+// recorders without retries of their own, or with Retryable narrowed to
+// failures that leave nothing written.
+package retry
+
+import (
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+var _ core.Recorder = (*Recorder)(nil)
+
+// Recorder records to Next, retrying failed calls with Policy.
+type Recorder struct {
+	Next core.Recorder
+
+	// Policy controls the attempts; Retryable defaults to core.IsTransient,
+	// so invalid payloads are never retried.
+	Policy core.RetryPolicy
+}
+
+// New returns a Recorder retrying the calls to next with policy.
+func New(next core.Recorder, policy core.RetryPolicy) *Recorder {
+	return &Recorder{Next: next, Policy: policy}
+}
+
+func (r *Recorder) Record(payload interface{}) error {
+	return r.Policy.Do(func() error { return r.Next.Record(payload) })
+}
+
+func (r *Recorder) RecordBatch(payloads []interface{}) error {
+	return r.Policy.Do(func() error { return r.Next.RecordBatch(payloads) })
+}
+
+// Close closes Next, without retries.
+func (r *Recorder) Close() error {
+	return r.Next.Close()
+}
@@ -0,0 +1,72 @@
+package reader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// BlobCellPrefix marks cells whose content was moved to a sidecar blob file,
+// followed by the path of the file relative to the directory of the CSV
+// file, e.g., "blob:booking_record.spill/9f86d0….blob". The file is named
+// after the SHA-256 of its content.
+const BlobCellPrefix = "blob:"
+
+// BlobExt is the extension of the blob files.
+const BlobExt = ".blob"
+
+// BlobPath returns the path of the blob file of cell, relative to the
+// directory of its CSV file, and whether cell refers to one at all. Paths
+// leaving the directory aren't blob references.
+func BlobPath(cell string) (string, bool) {
+	rel, ok := strings.CutPrefix(cell, BlobCellPrefix)
+	if !ok {
+		return "", false
+	}
+	dir, name := path.Split(rel)
+	sum, ok := strings.CutSuffix(name, BlobExt)
+	if !ok || len(sum) != 2*sha256.Size || strings.Trim(sum, "0123456789abcdef") != "" {
+		return "", false
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" || strings.Contains(dir, "/") || dir == "." || dir == ".." {
+		return "", false
+	}
+	return rel, true
+}
+
+// ResolveBlob returns the content of the blob file a cell refers to, read
+// from dir, the directory of the CSV file. Cells without BlobCellPrefix are
+// returned as they are. Files whose content doesn't match their name fail
+// with an error.
+func ResolveBlob(dir, cell string) (string, error) {
+	return ResolveBlobFunc(cell, func(rel string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	})
+}
+
+// ResolveBlobFunc is ResolveBlob with the blob file read by read, given its
+// path relative to the directory of the CSV file, e.g., to decrypt it or
+// fetch it from object storage.
+func ResolveBlobFunc(cell string, read func(rel string) ([]byte, error)) (string, error) {
+	if !strings.HasPrefix(cell, BlobCellPrefix) {
+		return cell, nil
+	}
+	rel, ok := BlobPath(cell)
+	if !ok {
+		return "", fmt.Errorf("malformed blob reference %q", cell)
+	}
+	data, err := read(rel)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob %q: %w", rel, err)
+	}
+	sum := sha256.Sum256(data)
+	if want := strings.TrimSuffix(path.Base(rel), BlobExt); hex.EncodeToString(sum[:]) != want {
+		return "", fmt.Errorf("blob %q doesn't match its checksum", rel)
+	}
+	return string(data), nil
+}
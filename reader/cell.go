@@ -0,0 +1,159 @@
+package reader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Prefixes marking compressed cells, followed by the base64 of the gzip or
+// zstd compressed cell.
+const (
+	GzipCellPrefix = "gzip+base64:"
+	ZstdCellPrefix = "zstd+base64:"
+)
+
+var (
+	cellEncoder, _ = zstd.NewWriter(nil)
+	cellDecoder, _ = zstd.NewReader(nil)
+)
+
+// CompressCell compresses cell with the algorithm of prefix, GzipCellPrefix
+// or ZstdCellPrefix, and returns it in base64 after the prefix.
+func CompressCell(cell, prefix string) (string, error) {
+	var data []byte
+	switch prefix {
+	case GzipCellPrefix:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := io.WriteString(zw, cell); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	case ZstdCellPrefix:
+		data = cellEncoder.EncodeAll([]byte(cell), nil)
+	default:
+		return "", fmt.Errorf("unknown cell compression prefix %q", prefix)
+	}
+	return prefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecompressCell returns the original of a cell compressed by CompressCell.
+// Cells without one of the prefixes are returned as they are.
+func DecompressCell(cell string) (string, error) {
+	var prefix string
+	switch {
+	case strings.HasPrefix(cell, GzipCellPrefix):
+		prefix = GzipCellPrefix
+	case strings.HasPrefix(cell, ZstdCellPrefix):
+		prefix = ZstdCellPrefix
+	default:
+		return cell, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(cell[len(prefix):])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode compressed cell: %w", err)
+	}
+	if prefix == ZstdCellPrefix {
+		out, err := cellDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress cell: %w", err)
+		}
+		return string(out), nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress cell: %w", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress cell: %w", err)
+	}
+	return string(out), nil
+}
+
+// decompressRow decompresses the cells of row in place.
+func decompressRow(row []string) error {
+	for i, cell := range row {
+		out, err := DecompressCell(cell)
+		if err != nil {
+			return fmt.Errorf("cell %d: %w", i, err)
+		}
+		row[i] = out
+	}
+	return nil
+}
+
+// EscapeNewlines replaces the carriage returns and line feeds of cell with
+// the two characters \r and \n, and doubles its backslashes, so every row of
+// a file is one line for line-oriented tools such as wc -l, tail or awk.
+// UnescapeNewlines reverses it.
+func EscapeNewlines(cell string) string {
+	if !strings.ContainsAny(cell, "\\\r\n") {
+		return cell
+	}
+	var b strings.Builder
+	b.Grow(len(cell) + 8)
+	for i := 0; i < len(cell); i++ {
+		switch c := cell[i]; c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeNewlines returns the original of a cell escaped by EscapeNewlines.
+// Backslashes not starting \\, \r or \n are kept, so cells such as a `\N`
+// NullValue read as they were written.
+func UnescapeNewlines(cell string) string {
+	if !strings.Contains(cell, `\`) {
+		return cell
+	}
+	var b strings.Builder
+	b.Grow(len(cell))
+	for i := 0; i < len(cell); i++ {
+		c := cell[i]
+		if c == '\\' && i+1 < len(cell) {
+			switch cell[i+1] {
+			case '\\':
+				c = '\\'
+			case 'r':
+				c = '\r'
+			case 'n':
+				c = '\n'
+			default:
+				b.WriteByte(c)
+				continue
+			}
+			i++
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// unescapeRow unescapes the cells of row in place, except compressed cells
+// and blob references, which EscapeNewlines leaves as they are.
+func unescapeRow(row []string) {
+	for i, cell := range row {
+		if _, blob := BlobPath(cell); blob || strings.HasPrefix(cell, GzipCellPrefix) || strings.HasPrefix(cell, ZstdCellPrefix) {
+			continue
+		}
+		row[i] = UnescapeNewlines(cell)
+	}
+}
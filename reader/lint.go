@@ -0,0 +1,204 @@
+package reader
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultMaxViolations is the number of violations kept when
+// LintOptions.MaxViolations is zero.
+const defaultMaxViolations = 100
+
+// LintOptions control what Lint checks.
+type LintOptions struct {
+	// Fields is the number of fields every record must have. When zero, it is
+	// the number of fields of the first record, usually the header.
+	Fields int
+
+	// MaxViolations caps the violations kept in the report, which still
+	// counts all of them. Defaults to 100.
+	MaxViolations int
+}
+
+// Violation is a place where a file departs from RFC 4180.
+type Violation struct {
+	Line    int // physical line, from 1
+	Record  int // record, from 1, counting the header
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d (record %d): %s", v.Line, v.Record, v.Message)
+}
+
+// LintReport describes how a file departs from RFC 4180.
+type LintReport struct {
+	Records    int         // records read, including the header
+	Violations []Violation // the first violations, up to MaxViolations
+	Total      int         // violations found, including those not kept
+}
+
+// OK reports whether the file strictly conforms to RFC 4180.
+func (r LintReport) OK() bool {
+	return r.Total == 0
+}
+
+// Err returns nil if the file conforms, or an error describing the first
+// violation and how many there are.
+func (r LintReport) Err() error {
+	if r.Total == 0 {
+		return nil
+	}
+	if r.Total == 1 {
+		return errors.New(r.Violations[0].String())
+	}
+	return fmt.Errorf("%v, and %d more violations", r.Violations[0], r.Total-1)
+}
+
+// lint states
+const (
+	lintFieldStart = iota // before the first byte of a field
+	lintUnquoted          // in a field without quotes
+	lintQuoted            // in a quoted field
+	lintQuoteEnd          // after a quote in a quoted field: an escape or the end
+	lintLineEnd           // after a carriage return outside quotes
+)
+
+// LintReader checks that the CSV stream read from src strictly conforms to
+// RFC 4180, for consumers whose parsers reject anything else: no byte order
+// mark, records separated by CRLF, fields separated by commas, quotes only
+// around whole fields and doubled inside them, line breaks only in quoted
+// fields, and every record as wide as the first. The last record may end
+// without a line break. It only returns an error if src can't be read.
+func LintReader(src io.Reader, opts LintOptions) (LintReport, error) {
+	var report LintReport
+	limit := opts.MaxViolations
+	if limit <= 0 {
+		limit = defaultMaxViolations
+	}
+	line, recordLine := 1, 1
+	fields := 1
+	width := opts.Fields
+	violate := func(at int, format string, args ...interface{}) {
+		report.Total++
+		if len(report.Violations) < limit {
+			report.Violations = append(report.Violations, Violation{Line: at, Record: report.Records + 1, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+	endRecord := func() {
+		if width == 0 {
+			width = fields
+		} else if fields != width {
+			violate(recordLine, "record has %d fields, want %d", fields, width)
+		}
+		report.Records++
+		fields = 1
+	}
+
+	br := bufio.NewReader(src)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		violate(1, "file starts with a byte order mark")
+		br.Discard(3)
+	}
+	state, started := lintFieldStart, false
+	for {
+		c, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to read line %d: %w", line, err)
+		}
+		if !started {
+			started = true
+			recordLine = line
+		}
+
+		switch state {
+		case lintQuoted:
+			if c == '"' {
+				state = lintQuoteEnd
+			} else if c == '\n' {
+				line++
+			}
+			continue
+		case lintQuoteEnd:
+			if c == '"' {
+				state = lintQuoted
+				continue
+			}
+			if c != ',' && c != '\r' && c != '\n' {
+				violate(line, "text after the closing quote of field %d", fields)
+				state = lintUnquoted
+				continue
+			}
+		case lintFieldStart:
+			if c == '"' {
+				state = lintQuoted
+				continue
+			}
+		case lintUnquoted:
+			if c == '"' {
+				violate(line, "quote in unquoted field %d", fields)
+				continue
+			}
+		case lintLineEnd:
+			if c == '\n' {
+				endRecord()
+				line++
+				state, started = lintFieldStart, false
+				continue
+			}
+			violate(line, "carriage return without line feed in unquoted field %d", fields)
+			state = lintUnquoted
+			if c == '"' {
+				violate(line, "quote in unquoted field %d", fields)
+				continue
+			}
+		}
+
+		switch c {
+		case ',':
+			fields++
+			state = lintFieldStart
+		case '\r':
+			state = lintLineEnd
+		case '\n':
+			violate(line, "line feed without carriage return")
+			endRecord()
+			line++
+			state, started = lintFieldStart, false
+		default:
+			state = lintUnquoted
+		}
+	}
+
+	switch state {
+	case lintQuoted:
+		violate(recordLine, "quoted field %d is never closed", fields)
+	case lintLineEnd:
+		violate(line, "carriage return without line feed at the end of the file")
+	}
+	if started {
+		endRecord()
+	}
+	return report, nil
+}
+
+// Lint checks that the CSV file at path strictly conforms to RFC 4180, see
+// LintReader.
+func Lint(path string, opts LintOptions) (LintReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return LintReport{}, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer f.Close()
+	report, err := LintReader(f, opts)
+	if err != nil {
+		return report, fmt.Errorf("failed to lint %q: %w", path, err)
+	}
+	return report, nil
+}
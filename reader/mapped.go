@@ -0,0 +1,390 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+)
+
+// IndexSuffix is appended to a file name to form the name of the row index
+// OpenMapped caches next to it, e.g., "booking_record_2025_08_26.csv.idx".
+const IndexSuffix = ".idx"
+
+// defaultIndexEvery is the default of MapOptions.IndexEvery.
+const defaultIndexEvery = 1024
+
+// MapOptions control how OpenMapped indexes a file.
+type MapOptions struct {
+	// IndexEvery is the number of rows between the offsets kept in the index.
+	// Smaller values seek faster and make larger indexes. Defaults to 1024.
+	IndexEvery int
+
+	// NoIndexFile keeps the index in memory instead of caching it in the
+	// IndexSuffix file, e.g., for read-only directories.
+	NoIndexFile bool
+
+	// Comment, if set, skips the lines starting with it before the header,
+	// such as the Preamble of a service, which starts with '#'.
+	Comment rune
+}
+
+// rowIndex is the index of a file, persisted as JSON in its IndexSuffix file.
+type rowIndex struct {
+	Every int   `json:"every"`
+	Start int64 `json:"start"` // offset of the first data row
+	Size  int64 `json:"size"`  // bytes of the file indexed, up to the end of a row
+	Rows  int64 `json:"rows"`  // data rows in those bytes
+
+	// Tail is the CRC-32 of the last bytes indexed, so a file rewritten since,
+	// e.g., by compaction, is indexed again instead of read at stale offsets.
+	Tail uint32 `json:"tail"`
+
+	// Offsets holds the offset of rows 0, Every, 2*Every and so on.
+	Offsets []int64 `json:"offsets"`
+}
+
+// tailBytes is the number of bytes rowIndex.Tail is computed over.
+const tailBytes = 4096
+
+// MappedFile reads a large CSV file through a memory map, using an index of
+// row offsets to start reading at any row without parsing the rows before
+// it. The file is read as it was when opened; rows appended since are seen
+// by opening it again, which indexes only the new rows.
+//
+// MappedFile reads plain CSV files on the OS filesystem. Compressed,
+// encrypted and re-encoded files must be read with the service's OpenFile.
+type MappedFile struct {
+	// Header is the first row of the file, nil if it is empty.
+	Header []string
+
+	path    string
+	file    *os.File
+	data    io.ReaderAt
+	size    int64
+	release func() error
+	index   rowIndex
+	rows    int64
+}
+
+// OpenMapped maps the CSV file at path and loads its row index from the
+// IndexSuffix file, indexing the rows the file gained since it was written
+// and saving it again. Close the file when done.
+//
+//	f, err := reader.OpenMapped(path, reader.MapOptions{})
+//	...
+//	defer f.Close()
+//	row, err := f.Search(func(row []string) bool { return row[0] >= "2025-08-26T12:00:00+07:00" })
+//	for cells, err := range f.Scan(row) {
+//		...
+//	}
+func OpenMapped(path string, opts MapOptions) (*MappedFile, error) {
+	if opts.IndexEvery <= 0 {
+		opts.IndexEvery = defaultIndexEvery
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get file info for %q: %w", path, err)
+	}
+	data, release, err := mapFile(file, stat.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to map %q: %w", path, err)
+	}
+	m := &MappedFile{path: path, file: file, data: data, size: stat.Size(), release: release}
+
+	if err := m.load(opts); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close unmaps and closes the file.
+func (m *MappedFile) Close() error {
+	err := m.release()
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Rows returns the number of data rows of the file.
+func (m *MappedFile) Rows() int64 {
+	return m.rows
+}
+
+// Scan streams the data rows of the file from row on, 0 being the first row
+// after the header. Only the rows between the nearest indexed offset and row
+// are skipped over, without being parsed.
+func (m *MappedFile) Scan(row int64) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		if row >= m.rows {
+			return
+		}
+		off, err := m.offset(max(row, 0))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		cr := csv.NewReader(io.NewSectionReader(m.data, off, m.size-off))
+		cr.FieldsPerRecord = -1
+		for {
+			cells, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to read %q: %w", m.path, err))
+				return
+			}
+			if !yield(cells, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Search returns the first row for which fn is true, or Rows if there is
+// none, assuming fn is false up to some row and true from there on, like
+// sort.Search, e.g., for the first row at or after a time in a file written
+// in time order. fn is called with the indexed rows in a binary search, then
+// with the rows of one index block.
+func (m *MappedFile) Search(fn func(row []string) bool) (int64, error) {
+	var err error
+	at := func(off int64) []string {
+		if err != nil {
+			return nil
+		}
+		cr := csv.NewReader(io.NewSectionReader(m.data, off, m.size-off))
+		cr.FieldsPerRecord = -1
+		var cells []string
+		if cells, err = cr.Read(); err != nil {
+			err = fmt.Errorf("failed to read %q: %w", m.path, err)
+		}
+		return cells
+	}
+	offsets := m.index.Offsets
+	block := sort.Search(len(offsets), func(i int) bool {
+		cells := at(offsets[i])
+		return err == nil && fn(cells)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if block == 0 {
+		return 0, nil
+	}
+
+	row := int64(block-1) * int64(m.index.Every)
+	for cells, err := range m.Scan(row) {
+		if err != nil {
+			return 0, err
+		}
+		if fn(cells) {
+			return row, nil
+		}
+		row++
+		if block < len(offsets) && row == int64(block)*int64(m.index.Every) {
+			break // The indexed row of the next block is known to match
+		}
+	}
+	return row, nil
+}
+
+// offset returns the offset of the data row.
+func (m *MappedFile) offset(row int64) (int64, error) {
+	every := int64(m.index.Every)
+	block := row / every
+	if block >= int64(len(m.index.Offsets)) {
+		block = int64(len(m.index.Offsets)) - 1
+	}
+	off := m.index.Start
+	skip := row
+	if block >= 0 {
+		off, skip = m.index.Offsets[block], row-block*every
+	}
+	if skip == 0 {
+		return off, nil
+	}
+	br := bufio.NewReaderSize(io.NewSectionReader(m.data, off, m.size-off), 64<<10)
+	for skip > 0 {
+		n, err := rowEnd(br)
+		off += n
+		if err != nil {
+			return 0, fmt.Errorf("failed to seek in %q: %w", m.path, err)
+		}
+		skip--
+	}
+	return off, nil
+}
+
+// rowEnd reads up to the end of the CSV row at the start of br, returning
+// the number of bytes read. Line breaks within quoted cells don't end a row.
+func rowEnd(br *bufio.Reader) (int64, error) {
+	var n int64
+	quoted := false
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		n++
+		switch b {
+		case '"':
+			quoted = !quoted // A doubled quote toggles twice
+		case '\n':
+			if !quoted {
+				return n, nil
+			}
+		}
+	}
+}
+
+// load reads the index of the file, extends it to the rows written since and
+// saves it unless it was up to date.
+func (m *MappedFile) load(opts MapOptions) error {
+	idx, ok := m.readIndex(opts.IndexEvery)
+	if !ok {
+		start, header, err := m.readHeader(opts.Comment)
+		if err != nil {
+			return err
+		}
+		idx = rowIndex{Every: opts.IndexEvery, Start: start, Size: start}
+		m.Header = header
+	} else if _, m.Header, _ = m.readHeader(opts.Comment); m.Header == nil {
+		return fmt.Errorf("failed to read CSV header of %q", m.path)
+	}
+
+	grown := idx.Size < m.size
+	br := bufio.NewReaderSize(io.NewSectionReader(m.data, idx.Size, m.size-idx.Size), 64<<10)
+	for idx.Size < m.size {
+		n, err := rowEnd(br)
+		if errors.Is(err, io.EOF) {
+			m.rows = idx.Rows + 1 // A last row without a line break isn't indexed
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to index %q: %w", m.path, err)
+		}
+		if idx.Rows%int64(idx.Every) == 0 {
+			idx.Offsets = append(idx.Offsets, idx.Size)
+		}
+		idx.Size += n
+		idx.Rows++
+	}
+	if m.rows == 0 {
+		m.rows = idx.Rows
+	}
+	idx.Tail = m.tail(idx.Size)
+	m.index = idx
+
+	if grown && !opts.NoIndexFile {
+		return m.writeIndex()
+	}
+	return nil
+}
+
+// readHeader returns the offset of the first data row and the header,
+// skipping the lines starting with comment before it.
+func (m *MappedFile) readHeader(comment rune) (int64, []string, error) {
+	if m.size == 0 {
+		return 0, nil, nil
+	}
+	br := bufio.NewReader(io.NewSectionReader(m.data, 0, m.size))
+	var start int64
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+		start = 3
+	}
+	for comment != 0 {
+		if r, _, err := br.ReadRune(); err != nil || r != comment {
+			br.UnreadRune()
+			break
+		}
+		line, err := br.ReadBytes('\n')
+		start += int64(utf8.RuneLen(comment) + len(line))
+		if err != nil {
+			return start, nil, nil // Only comments
+		}
+	}
+	n, err := rowEnd(br)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, fmt.Errorf("failed to read CSV header of %q: %w", m.path, err)
+	}
+	line := make([]byte, n)
+	if _, err := m.data.ReadAt(line, start); err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, fmt.Errorf("failed to read CSV header of %q: %w", m.path, err)
+	}
+	cr := csv.NewReader(bytes.NewReader(line))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read CSV header of %q: %w", m.path, err)
+	}
+	return start + n, header, nil
+}
+
+// readIndex returns the cached index, or false if there is none that is
+// valid for the file.
+func (m *MappedFile) readIndex(every int) (rowIndex, bool) {
+	var idx rowIndex
+	b, err := os.ReadFile(m.path + IndexSuffix)
+	if err != nil || json.Unmarshal(b, &idx) != nil {
+		return idx, false
+	}
+	if idx.Every != every || idx.Size > m.size || idx.Start > idx.Size || idx.Tail != m.tail(idx.Size) {
+		return idx, false
+	}
+	return idx, true
+}
+
+// tail returns the CRC-32 of the bytes before size.
+func (m *MappedFile) tail(size int64) uint32 {
+	n := min(size, tailBytes)
+	buf := make([]byte, n)
+	if _, err := m.data.ReadAt(buf, size-n); err != nil && !errors.Is(err, io.EOF) {
+		return 0
+	}
+	return crc32.ChecksumIEEE(buf)
+}
+
+// writeIndex saves the index in the IndexSuffix file through a temporary
+// file and a rename.
+func (m *MappedFile) writeIndex() error {
+	b, err := json.Marshal(m.index)
+	if err != nil {
+		return err
+	}
+	path := m.path + IndexSuffix
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package reader
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads f in place where memory maps aren't supported; the file
+// stays open until the release function is called.
+func mapFile(f *os.File, size int64) (io.ReaderAt, func() error, error) {
+	return io.NewSectionReader(f, 0, size), func() error { return nil }, nil
+}
@@ -0,0 +1,23 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package reader
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first size bytes of f into memory, read-only. The release
+// function unmaps them.
+func mapFile(f *os.File, size int64) (io.ReaderAt, func() error, error) {
+	if size == 0 {
+		return bytes.NewReader(nil), func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(data), func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,248 @@
+// Package reader reads CSV files written by recordtocsv services.
+package reader
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Options control how a file is read.
+type Options struct {
+	// Schema is the known column list. A first row with a cell that isn't one of
+	// these names is treated as data, and Schema is used as the header instead.
+	// When empty, the first row is always the header.
+	Schema []string
+
+	// DecompressCells decompresses the cells written by a service's
+	// CellCompression, see DecompressCell.
+	DecompressCells bool
+
+	// UnescapeNewlines restores the line breaks of the cells written by a
+	// service's EscapeNewlines, see UnescapeNewlines.
+	UnescapeNewlines bool
+
+	// Comment, if set, skips the lines starting with it, such as the
+	// Preamble of a service, which starts with '#'.
+	Comment rune
+
+	// SkipRepeatedHeaders skips rows equal to the header after the first,
+	// left by processes racing to create the file, counting them in
+	// Reader.SkippedHeaders. Without it, they are read as data rows.
+	SkipRepeatedHeaders bool
+
+	// Aliases maps header labels of older files to the current ones, e.g.,
+	// {"cust_id": "customer_id"} after a column was renamed, so Header and
+	// ReadMap use the current names. See AliasHeader.
+	Aliases map[string]string
+}
+
+// Reader reads rows from a recorded CSV stream.
+type Reader struct {
+	// Header is the header in effect: the file's own, or Options.Schema when the
+	// file has none.
+	Header []string
+
+	// MissingHeader reports that the file started with data rather than a
+	// header, and Options.Schema was used.
+	MissingHeader bool
+
+	// SkippedHeaders counts the repeated header rows skipped so far, see
+	// Options.SkipRepeatedHeaders.
+	SkippedHeaders int
+
+	csv        *csv.Reader
+	pending    []string // first data row of a headerless file
+	decompress bool
+	unescape   bool
+	skipHeader bool
+	fileHeader []string // the header as written, before Options.Aliases
+}
+
+// NewReader reads the header of r, falling back to opts.Schema when the first
+// row is clearly data.
+func NewReader(r io.Reader, opts Options) (*Reader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // row lengths are checked by callers, not the parser
+	cr.Comment = opts.Comment
+
+	first, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		if len(opts.Schema) == 0 {
+			return nil, fmt.Errorf("file is empty and no schema was given")
+		}
+		return &Reader{Header: opts.Schema, MissingHeader: true, csv: cr, decompress: opts.DecompressCells, unescape: opts.UnescapeNewlines, skipHeader: opts.SkipRepeatedHeaders}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	rd := &Reader{Header: AliasHeader(first, opts.Aliases), csv: cr, decompress: opts.DecompressCells, unescape: opts.UnescapeNewlines, skipHeader: opts.SkipRepeatedHeaders, fileHeader: first}
+	if !IsHeader(rd.Header, opts.Schema) {
+		rd.Header, rd.MissingHeader, rd.pending, rd.fileHeader = opts.Schema, true, first, nil
+	}
+	return rd, nil
+}
+
+// IsHeader reports whether row looks like a header for schema, i.e., every
+// cell is one of the schema's column names. Any row is a header for an empty
+// schema.
+func IsHeader(row, schema []string) bool {
+	if len(schema) == 0 {
+		return true
+	}
+	for _, cell := range row {
+		if !slices.Contains(schema, cell) {
+			return false
+		}
+	}
+	return true
+}
+
+// AliasHeader returns header with each label that aliases maps replaced by
+// its current one, following chains such as a → b → c, so files written
+// before a rename read like those written after it. A label is kept if the
+// header already has its current one, so a file with both columns keeps
+// both. header itself is returned if nothing is replaced.
+func AliasHeader(header []string, aliases map[string]string) []string {
+	if len(aliases) == 0 {
+		return header
+	}
+	var out []string
+	for i, label := range header {
+		to := resolveAlias(label, aliases)
+		if to == label || slices.Contains(header, to) || out != nil && slices.Contains(out[:i], to) {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(header)
+		}
+		out[i] = to
+	}
+	if out == nil {
+		return header
+	}
+	return out
+}
+
+// resolveAlias follows aliases from label to its current label, stopping at
+// a cycle.
+func resolveAlias(label string, aliases map[string]string) string {
+	for range len(aliases) {
+		to, ok := aliases[label]
+		if !ok || to == label {
+			break
+		}
+		label = to
+	}
+	return label
+}
+
+// Read returns the next data row, or io.EOF at the end of the file.
+func (r *Reader) Read() ([]string, error) {
+	row := r.pending
+	r.pending = nil
+	for row == nil {
+		var err error
+		if row, err = r.csv.Read(); err != nil {
+			return nil, err
+		}
+		if r.skipHeader && (slices.Equal(row, r.Header) || slices.Equal(row, r.fileHeader)) {
+			r.SkippedHeaders++
+			row = nil
+		}
+	}
+	if r.unescape {
+		unescapeRow(row)
+	}
+	if r.decompress {
+		if err := decompressRow(row); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// ReadMap returns the next data row keyed by header column. Cells beyond the
+// header are dropped and missing cells are absent from the map.
+func (r *Reader) ReadMap() (map[string]string, error) {
+	row, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(r.Header))
+	for i, col := range r.Header {
+		if i < len(row) {
+			m[col] = row[i]
+		}
+	}
+	return m, nil
+}
+
+// RepairHeader checks whether the file at path starts with a header for
+// schema and, if it doesn't, rewrites it with the schema as its first row.
+// The rewrite goes through a temporary file and a rename, so readers never
+// see a partial file. It reports whether the file was repaired.
+func RepairHeader(path string, schema []string) (bool, error) {
+	if len(schema) == 0 {
+		return false, fmt.Errorf("a schema is required to repair %q", path)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer src.Close()
+
+	rd, err := NewReader(src, Options{Schema: schema})
+	if err != nil {
+		return false, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	if !rd.MissingHeader {
+		return false, nil
+	}
+
+	stat, err := src.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to get file info for %q: %w", path, err)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("failed to rewind %q: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".repair-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file for %q: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	w := csv.NewWriter(tmp)
+	if err := w.Write(schema); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write header: %w", err)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to copy %q: %w", path, err)
+	}
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, fmt.Errorf("failed to replace %q: %w", path, err)
+	}
+	return true, nil
+}
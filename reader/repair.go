@@ -0,0 +1,146 @@
+package reader
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// NormalizeOptions control how Normalize fixes a file.
+type NormalizeOptions struct {
+	// Schema is the known column list, used as the header of files that start
+	// with data, like Options.Schema.
+	Schema []string
+
+	// Rejects, if set, receives the rows Normalize can't fit under the header,
+	// as CSV, so they can be inspected instead of lost.
+	Rejects io.Writer
+}
+
+// NormalizeReport describes what Normalize changed.
+type NormalizeReport struct {
+	Rows             int  // data rows written
+	MissingHeader    bool // the file started with data, the schema was written as its header
+	DuplicateHeaders int  // repeated header lines removed
+	Padded           int  // short rows padded with empty cells
+	Trimmed          int  // rows whose empty cells beyond the header were removed
+	Rejected         int  // rows with non-empty cells beyond the header, left out
+}
+
+// Changed reports whether the output differs from the input.
+func (r NormalizeReport) Changed() bool {
+	return r.MissingHeader || r.DuplicateHeaders > 0 || r.Padded > 0 || r.Trimmed > 0 || r.Rejected > 0
+}
+
+// Normalize copies the CSV file read from src to dst with a single header
+// and every row as wide as it, salvaging files damaged by processes racing to
+// create them: header lines repeated after the first are removed, short rows
+// are padded with empty cells and empty cells beyond the header are trimmed.
+// Rows with data beyond the header are left out and sent to opts.Rejects.
+func Normalize(dst io.Writer, src io.Reader, opts NormalizeOptions) (NormalizeReport, error) {
+	var report NormalizeReport
+	rd, err := NewReader(src, Options{Schema: opts.Schema})
+	if err != nil {
+		return report, err
+	}
+	report.MissingHeader = rd.MissingHeader
+	header := rd.Header
+
+	w := csv.NewWriter(dst)
+	if err := w.Write(header); err != nil {
+		return report, fmt.Errorf("failed to write header: %w", err)
+	}
+	var rejects *csv.Writer
+	if opts.Rejects != nil {
+		rejects = csv.NewWriter(opts.Rejects)
+	}
+
+	for {
+		row, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to read row %d: %w", report.Rows+1, err)
+		}
+		switch {
+		case slices.Equal(row, header):
+			report.DuplicateHeaders++
+			continue
+		case len(row) < len(header):
+			row = append(row, make([]string, len(header)-len(row))...)
+			report.Padded++
+		case len(row) > len(header):
+			if slices.ContainsFunc(row[len(header):], func(cell string) bool { return cell != "" }) {
+				report.Rejected++
+				if rejects != nil {
+					if err := rejects.Write(row); err != nil {
+						return report, fmt.Errorf("failed to write rejected row: %w", err)
+					}
+				}
+				continue
+			}
+			row = row[:len(header)]
+			report.Trimmed++
+		}
+		if err := w.Write(row); err != nil {
+			return report, fmt.Errorf("failed to write row: %w", err)
+		}
+		report.Rows++
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return report, fmt.Errorf("failed to write rows: %w", err)
+	}
+	if rejects != nil {
+		rejects.Flush()
+		if err := rejects.Error(); err != nil {
+			return report, fmt.Errorf("failed to write rejected rows: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// Repair writes a normalized copy of the file at path to dst, see Normalize.
+// dst may be path itself to repair the file in place; it is replaced through
+// a temporary file and a rename, so readers never see a partial file, and
+// keeps the permissions of path.
+func Repair(path, dst string, opts NormalizeOptions) (NormalizeReport, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return NormalizeReport{}, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return NormalizeReport{}, fmt.Errorf("failed to get file info for %q: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".repair-*")
+	if err != nil {
+		return NormalizeReport{}, fmt.Errorf("failed to create temporary file for %q: %w", dst, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	report, err := Normalize(tmp, src, opts)
+	if err != nil {
+		tmp.Close()
+		return report, fmt.Errorf("failed to repair %q: %w", path, err)
+	}
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		tmp.Close()
+		return report, fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return report, fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return report, fmt.Errorf("failed to replace %q: %w", dst, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,43 @@
+package reader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+)
+
+// RowChecksum returns the checksum a service's RowChecksums writes for a row
+// whose other cells are cells, in file order: the hex SHA-256, or
+// HMAC-SHA256 with key, of the cells, each prefixed with its length.
+// Trailing empty cells are left out, so rows padded when columns were added
+// to the file still match.
+func RowChecksum(cells []string, key []byte) string {
+	for len(cells) > 0 && cells[len(cells)-1] == "" {
+		cells = cells[:len(cells)-1]
+	}
+	var h hash.Hash
+	if key != nil {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	var n [binary.MaxVarintLen64]byte
+	for _, cell := range cells {
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(cell)))])
+		h.Write([]byte(cell))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyRow reports whether the cell at index col of row is the RowChecksum
+// of its other cells.
+func VerifyRow(row []string, col int, key []byte) bool {
+	if col < 0 || col >= len(row) {
+		return false
+	}
+	cells := make([]string, 0, len(row)-1)
+	cells = append(append(cells, row[:col]...), row[col+1:]...)
+	return hmac.Equal([]byte(row[col]), []byte(RowChecksum(cells, key)))
+}
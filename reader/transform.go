@@ -0,0 +1,153 @@
+package reader
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Mapper converts a row of a file, keyed by its header, to a row of the new
+// schema, keyed by the new columns, for Transform. Keys of the result that
+// aren't one of the new columns are ignored, and missing ones are written as
+// empty cells. A nil row drops the row.
+type Mapper func(row map[string]string) (map[string]string, error)
+
+// TransformReport describes what Transform wrote.
+type TransformReport struct {
+	Files   int // files written
+	Rows    int // rows written
+	Dropped int // rows the mapper dropped
+}
+
+// Transform rewrites every CSV file matching srcPattern, a filepath.Glob
+// pattern, into a file of the same name in dstDir with the columns given,
+// mapping each row with mapper, e.g., to rename, reorder or drop columns or
+// to recompute values. A nil mapper copies the cells of the columns found in
+// a file's header. Rows are streamed, so files of any size are rewritten
+// without being loaded, through a temporary file and a rename: dstDir may be
+// the directory of the files to rewrite them in place.
+//
+// A mapper error stops the transformation with the file and row that caused
+// it; the files written before are kept.
+//
+//	report, err := reader.Transform("logs/booking_record_*.csv", "migrated", []string{"id", "status"},
+//		func(row map[string]string) (map[string]string, error) {
+//			return map[string]string{"id": row["booking_id"], "status": strings.ToLower(row["state"])}, nil
+//		})
+func Transform(srcPattern, dstDir string, columns []string, mapper Mapper) (TransformReport, error) {
+	var report TransformReport
+	files, err := filepath.Glob(srcPattern)
+	if err != nil {
+		return report, fmt.Errorf("invalid pattern %q: %w", srcPattern, err)
+	}
+	if len(columns) == 0 {
+		return report, errors.New("no columns to transform to")
+	}
+	if mapper == nil {
+		mapper = func(row map[string]string) (map[string]string, error) { return row, nil }
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return report, fmt.Errorf("failed to create directory %q: %w", dstDir, err)
+	}
+
+	for _, path := range files {
+		rows, dropped, err := transformFile(path, filepath.Join(dstDir, filepath.Base(path)), columns, mapper)
+		report.Rows += rows
+		report.Dropped += dropped
+		if err != nil {
+			return report, err
+		}
+		report.Files++
+	}
+	return report, nil
+}
+
+// transformFile writes the mapped rows of the file at path to dst and returns
+// the numbers of rows written and dropped.
+func transformFile(path, dst string, columns []string, mapper Mapper) (int, int, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get file info for %q: %w", path, err)
+	}
+
+	cr := csv.NewReader(src)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, 0, fmt.Errorf("failed to read CSV header of %q: %w", path, err)
+	}
+	header = append([]string(nil), header...) // Not reused by the next Read
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".transform-*")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create temporary file for %q: %w", dst, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	w := csv.NewWriter(tmp)
+	if err := w.Write(columns); err != nil {
+		tmp.Close()
+		return 0, 0, fmt.Errorf("failed to write header: %w", err)
+	}
+	rows, dropped := 0, 0
+	out := make([]string, len(columns))
+	for line := 1; ; line++ {
+		cells, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			tmp.Close()
+			return rows, dropped, fmt.Errorf("failed to read row %d of %q: %w", line, path, err)
+		}
+		in := make(map[string]string, len(header))
+		for i, label := range header {
+			if i < len(cells) {
+				in[label] = cells[i]
+			}
+		}
+		mapped, err := mapper(in)
+		if err != nil {
+			tmp.Close()
+			return rows, dropped, fmt.Errorf("failed to transform row %d of %q: %w", line, path, err)
+		}
+		if mapped == nil {
+			dropped++
+			continue
+		}
+		for i, col := range columns {
+			out[i] = mapped[col]
+		}
+		if err := w.Write(out); err != nil {
+			tmp.Close()
+			return rows, dropped, fmt.Errorf("failed to write row: %w", err)
+		}
+		rows++
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		tmp.Close()
+		return rows, dropped, fmt.Errorf("failed to write rows: %w", err)
+	}
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		tmp.Close()
+		return rows, dropped, fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return rows, dropped, fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return rows, dropped, fmt.Errorf("failed to replace %q: %w", dst, err)
+	}
+	return rows, dropped, nil
+}
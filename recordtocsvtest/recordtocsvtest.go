@@ -0,0 +1,246 @@
+// Package recordtocsvtest helps unit-test code that records with a
+// core.Service: a service that writes to memory at a fixed time, assertions
+// on the rows it recorded and golden-file comparisons of its files.
+//
+//	func TestCheckout(t *testing.T) {
+//		service := recordtocsvtest.NewService(t, "order_id", "status", "total")
+//		checkout(service.Service, order)
+//
+//		service.AssertRecorded(t, recordtocsvtest.Fields{"order_id": "42", "status": "paid"})
+//		service.AssertGolden(t, "testdata/checkout.csv")
+//	}
+//
+// Run the tests with -recordtocsvtest.update to write the golden files.
+package recordtocsvtest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"github.com/ojipoji/recordtocsv/v2/memfs"
+)
+
+var update = flag.Bool("recordtocsvtest.update", false, "write the golden files of recordtocsvtest instead of comparing them")
+
+// Time is the time the services of NewService are set to, so their file
+// names don't depend on the day the tests run.
+var Time = time.Date(2025, 8, 26, 9, 0, 0, 0, time.UTC)
+
+// Service is a core.Service whose files are kept in FS.
+type Service struct {
+	*core.Service
+	FS *memfs.FS
+}
+
+// NewService returns a daily service with the given columns writing to
+// memory, with its Clock set to Time. It is closed when the test ends.
+func NewService(t testing.TB, column ...string) *Service {
+	t.Helper()
+	service := core.New("records", "record", column, "daily")
+	service.Clock = func() time.Time { return Time }
+	return Wrap(t, service)
+}
+
+// Wrap makes service write to memory, for services configured by the code
+// under test. Its other settings, including Clock, are kept. It is closed
+// when the test ends.
+func Wrap(t testing.TB, service *core.Service) *Service {
+	t.Helper()
+	fsys := memfs.New()
+	service.FS = fsys
+	t.Cleanup(func() {
+		if err := service.Close(); err != nil {
+			t.Errorf("failed to close service: %v", err)
+		}
+	})
+	return &Service{Service: service, FS: fsys}
+}
+
+// Row is a recorded row, keyed by column.
+type Row map[string]string
+
+func (r Row) String() string {
+	keys := slices.Sorted(maps.Keys(r))
+	cells := make([]string, len(keys))
+	for i, key := range keys {
+		cells[i] = fmt.Sprintf("%s=%q", key, r[key])
+	}
+	return "{" + strings.Join(cells, " ") + "}"
+}
+
+// Rows returns every row recorded so far, oldest file first, after waiting
+// for the payloads queued by RecordAsync. It fails the test if the files
+// can't be read.
+func (s *Service) Rows(t testing.TB) []Row {
+	t.Helper()
+	s.Flush()
+	var rows []Row
+	for row, err := range s.Records(time.Time{}, time.Time{}) {
+		if err != nil {
+			t.Fatalf("failed to read recorded rows: %v", err)
+		}
+		rows = append(rows, Row(row.Fields))
+	}
+	return rows
+}
+
+// Matcher selects rows for AssertRecorded.
+type Matcher interface {
+	Match(row Row) bool
+	String() string
+}
+
+// Fields matches rows with these cells. Other columns may hold anything.
+type Fields map[string]string
+
+func (f Fields) Match(row Row) bool {
+	for key, cell := range f {
+		if got, ok := row[key]; !ok || got != cell {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Fields) String() string { return Row(f).String() }
+
+// Func returns a Matcher calling match, described as desc in failures.
+//
+//	recordtocsvtest.Func("total over 100", func(row recordtocsvtest.Row) bool {
+//		total, _ := strconv.ParseFloat(row["total"], 64)
+//		return total > 100
+//	})
+func Func(desc string, match func(row Row) bool) Matcher {
+	return funcMatcher{desc: desc, match: match}
+}
+
+type funcMatcher struct {
+	desc  string
+	match func(row Row) bool
+}
+
+func (m funcMatcher) Match(row Row) bool { return m.match(row) }
+func (m funcMatcher) String() string     { return m.desc }
+
+// AssertRecorded fails the test unless a recorded row matches m.
+func (s *Service) AssertRecorded(t testing.TB, m Matcher) {
+	t.Helper()
+	rows := s.Rows(t)
+	if slices.ContainsFunc(rows, m.Match) {
+		return
+	}
+	t.Errorf("no recorded row matches %v; recorded:%s", m, list(rows))
+}
+
+// AssertNotRecorded fails the test if a recorded row matches m.
+func (s *Service) AssertNotRecorded(t testing.TB, m Matcher) {
+	t.Helper()
+	for _, row := range s.Rows(t) {
+		if m.Match(row) {
+			t.Errorf("recorded row %v matches %v", row, m)
+			return
+		}
+	}
+}
+
+// AssertCount fails the test unless n rows were recorded.
+func (s *Service) AssertCount(t testing.TB, n int) {
+	t.Helper()
+	if rows := s.Rows(t); len(rows) != n {
+		t.Errorf("recorded %d rows, want %d:%s", len(rows), n, list(rows))
+	}
+}
+
+// list formats rows one per line for failure messages.
+func list(rows []Row) string {
+	if len(rows) == 0 {
+		return " none"
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		b.WriteString("\n\t")
+		b.WriteString(row.String())
+	}
+	return b.String()
+}
+
+// Contents returns the recorded files as they are kept in FS. A single file
+// is returned as is; several are each preceded by a "==> path <==" line.
+func (s *Service) Contents(t testing.TB) []byte {
+	t.Helper()
+	s.Flush()
+	files, err := s.Files()
+	if err != nil {
+		t.Fatalf("failed to list recorded files: %v", err)
+	}
+	var buf bytes.Buffer
+	for _, path := range files {
+		data, err := s.FS.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %q: %v", path, err)
+		}
+		if len(files) > 1 {
+			fmt.Fprintf(&buf, "==> %s <==\n", filepath.ToSlash(path))
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// AssertGolden compares the Contents of the service with the golden file at
+// path, see Golden.
+func (s *Service) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+	Golden(t, path, s.Contents(t))
+}
+
+// Golden fails the test unless got equals the content of the golden file at
+// path, a file on the OS filesystem such as "testdata/checkout.csv". With
+// the -recordtocsvtest.update flag, it writes got to the file instead.
+func Golden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory of golden file: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -recordtocsvtest.update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("content differs from golden file %s (run with -recordtocsvtest.update to update it)%s", path, diff(want, got))
+	}
+}
+
+// diff describes the first line where got differs from want.
+func diff(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("\nline %d:\n\twant %q\n\tgot  %q", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,5 @@
+// Package recordtocsvpb holds the protocol buffer messages and gRPC stubs
+// generated from recordtocsv.proto.
+package recordtocsvpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative recordtocsv.proto
@@ -0,0 +1,352 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.5
+// 	protoc        (unknown)
+// source: recordtocsv.proto
+
+// Package recordtocsv.v1 records payloads into the rotated CSV files of a
+// recordtocsv service.
+
+package recordtocsvpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Payload is a record, keyed by column.
+type Payload struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Value:
+	//
+	//	*Payload_Fields
+	//	*Payload_Json
+	Value         isPayload_Value `protobuf_oneof:"value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Payload) Reset() {
+	*x = Payload{}
+	mi := &file_recordtocsv_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload) ProtoMessage() {}
+
+func (x *Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_recordtocsv_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload.ProtoReflect.Descriptor instead.
+func (*Payload) Descriptor() ([]byte, []int) {
+	return file_recordtocsv_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Payload) GetValue() isPayload_Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Payload) GetFields() *structpb.Struct {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Fields); ok {
+			return x.Fields
+		}
+	}
+	return nil
+}
+
+func (x *Payload) GetJson() []byte {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Json); ok {
+			return x.Json
+		}
+	}
+	return nil
+}
+
+type isPayload_Value interface {
+	isPayload_Value()
+}
+
+type Payload_Fields struct {
+	// Fields holds the payload as a structured value. Numbers are doubles,
+	// so integers beyond 2^53 lose precision; send them as json instead.
+	Fields *structpb.Struct `protobuf:"bytes,1,opt,name=fields,proto3,oneof"`
+}
+
+type Payload_Json struct {
+	// Json holds the payload as a JSON object, whose numbers are kept as
+	// written.
+	Json []byte `protobuf:"bytes,2,opt,name=json,proto3,oneof"`
+}
+
+func (*Payload_Fields) isPayload_Value() {}
+
+func (*Payload_Json) isPayload_Value() {}
+
+type RecordRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Payload       *Payload               `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecordRequest) Reset() {
+	*x = RecordRequest{}
+	mi := &file_recordtocsv_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecordRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordRequest) ProtoMessage() {}
+
+func (x *RecordRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recordtocsv_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordRequest.ProtoReflect.Descriptor instead.
+func (*RecordRequest) Descriptor() ([]byte, []int) {
+	return file_recordtocsv_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RecordRequest) GetPayload() *Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type RecordBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Payloads      []*Payload             `protobuf:"bytes,1,rep,name=payloads,proto3" json:"payloads,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecordBatchRequest) Reset() {
+	*x = RecordBatchRequest{}
+	mi := &file_recordtocsv_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecordBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordBatchRequest) ProtoMessage() {}
+
+func (x *RecordBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recordtocsv_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordBatchRequest.ProtoReflect.Descriptor instead.
+func (*RecordBatchRequest) Descriptor() ([]byte, []int) {
+	return file_recordtocsv_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RecordBatchRequest) GetPayloads() []*Payload {
+	if x != nil {
+		return x.Payloads
+	}
+	return nil
+}
+
+type RecordResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Recorded is the number of payloads written.
+	Recorded      int32 `protobuf:"varint,1,opt,name=recorded,proto3" json:"recorded,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecordResponse) Reset() {
+	*x = RecordResponse{}
+	mi := &file_recordtocsv_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecordResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordResponse) ProtoMessage() {}
+
+func (x *RecordResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_recordtocsv_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordResponse.ProtoReflect.Descriptor instead.
+func (*RecordResponse) Descriptor() ([]byte, []int) {
+	return file_recordtocsv_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RecordResponse) GetRecorded() int32 {
+	if x != nil {
+		return x.Recorded
+	}
+	return 0
+}
+
+var File_recordtocsv_proto protoreflect.FileDescriptor
+
+var file_recordtocsv_proto_rawDesc = string([]byte{
+	0x0a, 0x11, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x0e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76,
+	0x2e, 0x76, 0x31, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2f, 0x73, 0x74, 0x72, 0x75, 0x63, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x22, 0x5b, 0x0a, 0x07, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x31, 0x0a, 0x06,
+	0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53,
+	0x74, 0x72, 0x75, 0x63, 0x74, 0x48, 0x00, 0x52, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12,
+	0x14, 0x0a, 0x04, 0x6a, 0x73, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52,
+	0x04, 0x6a, 0x73, 0x6f, 0x6e, 0x42, 0x07, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x42,
+	0x0a, 0x0d, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x31, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x17, 0x2e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f,
+	0x61, 0x64, 0x22, 0x49, 0x0a, 0x12, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x42, 0x61, 0x74, 0x63,
+	0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x33, 0x0a, 0x08, 0x70, 0x61, 0x79, 0x6c,
+	0x6f, 0x61, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x63,
+	0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x79, 0x6c,
+	0x6f, 0x61, 0x64, 0x52, 0x08, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x73, 0x22, 0x2c, 0x0a,
+	0x0e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x08, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x65, 0x64, 0x32, 0xa6, 0x01, 0x0a, 0x08,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x47, 0x0a, 0x06, 0x52, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x12, 0x1d, 0x2e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76,
+	0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x1e, 0x2e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e,
+	0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x51, 0x0a, 0x0b, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x42, 0x61, 0x74, 0x63, 0x68,
+	0x12, 0x22, 0x2e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e, 0x76,
+	0x31, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63,
+	0x73, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x42, 0x48, 0x5a, 0x46, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x6f, 0x6a, 0x69, 0x70, 0x6f, 0x6a, 0x69, 0x2f, 0x72, 0x65, 0x63, 0x6f, 0x72,
+	0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2f, 0x76, 0x32, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x2f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x67, 0x72, 0x70, 0x63,
+	0x2f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x70, 0x62, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+})
+
+var (
+	file_recordtocsv_proto_rawDescOnce sync.Once
+	file_recordtocsv_proto_rawDescData []byte
+)
+
+func file_recordtocsv_proto_rawDescGZIP() []byte {
+	file_recordtocsv_proto_rawDescOnce.Do(func() {
+		file_recordtocsv_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_recordtocsv_proto_rawDesc), len(file_recordtocsv_proto_rawDesc)))
+	})
+	return file_recordtocsv_proto_rawDescData
+}
+
+var file_recordtocsv_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_recordtocsv_proto_goTypes = []any{
+	(*Payload)(nil),            // 0: recordtocsv.v1.Payload
+	(*RecordRequest)(nil),      // 1: recordtocsv.v1.RecordRequest
+	(*RecordBatchRequest)(nil), // 2: recordtocsv.v1.RecordBatchRequest
+	(*RecordResponse)(nil),     // 3: recordtocsv.v1.RecordResponse
+	(*structpb.Struct)(nil),    // 4: google.protobuf.Struct
+}
+var file_recordtocsv_proto_depIdxs = []int32{
+	4, // 0: recordtocsv.v1.Payload.fields:type_name -> google.protobuf.Struct
+	0, // 1: recordtocsv.v1.RecordRequest.payload:type_name -> recordtocsv.v1.Payload
+	0, // 2: recordtocsv.v1.RecordBatchRequest.payloads:type_name -> recordtocsv.v1.Payload
+	1, // 3: recordtocsv.v1.Recorder.Record:input_type -> recordtocsv.v1.RecordRequest
+	2, // 4: recordtocsv.v1.Recorder.RecordBatch:input_type -> recordtocsv.v1.RecordBatchRequest
+	3, // 5: recordtocsv.v1.Recorder.Record:output_type -> recordtocsv.v1.RecordResponse
+	3, // 6: recordtocsv.v1.Recorder.RecordBatch:output_type -> recordtocsv.v1.RecordResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_recordtocsv_proto_init() }
+func file_recordtocsv_proto_init() {
+	if File_recordtocsv_proto != nil {
+		return
+	}
+	file_recordtocsv_proto_msgTypes[0].OneofWrappers = []any{
+		(*Payload_Fields)(nil),
+		(*Payload_Json)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_recordtocsv_proto_rawDesc), len(file_recordtocsv_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_recordtocsv_proto_goTypes,
+		DependencyIndexes: file_recordtocsv_proto_depIdxs,
+		MessageInfos:      file_recordtocsv_proto_msgTypes,
+	}.Build()
+	File_recordtocsv_proto = out.File
+	file_recordtocsv_proto_goTypes = nil
+	file_recordtocsv_proto_depIdxs = nil
+}
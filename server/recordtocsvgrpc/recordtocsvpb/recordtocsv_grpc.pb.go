@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: recordtocsv.proto
+
+// Package recordtocsv.v1 records payloads into the rotated CSV files of a
+// recordtocsv service.
+
+package recordtocsvpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Recorder_Record_FullMethodName      = "/recordtocsv.v1.Recorder/Record"
+	Recorder_RecordBatch_FullMethodName = "/recordtocsv.v1.Recorder/RecordBatch"
+)
+
+// RecorderClient is the client API for Recorder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Recorder writes payloads to the CSV files of a service.
+//
+// Failed calls carry a google.rpc.ErrorInfo detail with the domain
+// "recordtocsv" and a reason, e.g., "INVALID_PAYLOAD", so callers can tell
+// bad payloads from a busy or paused service without parsing messages.
+type RecorderClient interface {
+	// Record writes one payload.
+	Record(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (*RecordResponse, error)
+	// RecordBatch writes the payloads as one batch: all of them or, on error,
+	// none of them, unless the error says otherwise.
+	RecordBatch(ctx context.Context, in *RecordBatchRequest, opts ...grpc.CallOption) (*RecordResponse, error)
+}
+
+type recorderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRecorderClient(cc grpc.ClientConnInterface) RecorderClient {
+	return &recorderClient{cc}
+}
+
+func (c *recorderClient) Record(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (*RecordResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RecordResponse)
+	err := c.cc.Invoke(ctx, Recorder_Record_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recorderClient) RecordBatch(ctx context.Context, in *RecordBatchRequest, opts ...grpc.CallOption) (*RecordResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RecordResponse)
+	err := c.cc.Invoke(ctx, Recorder_RecordBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RecorderServer is the server API for Recorder service.
+// All implementations must embed UnimplementedRecorderServer
+// for forward compatibility.
+//
+// Recorder writes payloads to the CSV files of a service.
+//
+// Failed calls carry a google.rpc.ErrorInfo detail with the domain
+// "recordtocsv" and a reason, e.g., "INVALID_PAYLOAD", so callers can tell
+// bad payloads from a busy or paused service without parsing messages.
+type RecorderServer interface {
+	// Record writes one payload.
+	Record(context.Context, *RecordRequest) (*RecordResponse, error)
+	// RecordBatch writes the payloads as one batch: all of them or, on error,
+	// none of them, unless the error says otherwise.
+	RecordBatch(context.Context, *RecordBatchRequest) (*RecordResponse, error)
+	mustEmbedUnimplementedRecorderServer()
+}
+
+// UnimplementedRecorderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRecorderServer struct{}
+
+func (UnimplementedRecorderServer) Record(context.Context, *RecordRequest) (*RecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Record not implemented")
+}
+func (UnimplementedRecorderServer) RecordBatch(context.Context, *RecordBatchRequest) (*RecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecordBatch not implemented")
+}
+func (UnimplementedRecorderServer) mustEmbedUnimplementedRecorderServer() {}
+func (UnimplementedRecorderServer) testEmbeddedByValue()                  {}
+
+// UnsafeRecorderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RecorderServer will
+// result in compilation errors.
+type UnsafeRecorderServer interface {
+	mustEmbedUnimplementedRecorderServer()
+}
+
+func RegisterRecorderServer(s grpc.ServiceRegistrar, srv RecorderServer) {
+	// If the following call pancis, it indicates UnimplementedRecorderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Recorder_ServiceDesc, srv)
+}
+
+func _Recorder_Record_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecorderServer).Record(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Recorder_Record_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecorderServer).Record(ctx, req.(*RecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Recorder_RecordBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecorderServer).RecordBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Recorder_RecordBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecorderServer).RecordBatch(ctx, req.(*RecordBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Recorder_ServiceDesc is the grpc.ServiceDesc for Recorder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Recorder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "recordtocsv.v1.Recorder",
+	HandlerType: (*RecorderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Record",
+			Handler:    _Recorder_Record_Handler,
+		},
+		{
+			MethodName: "RecordBatch",
+			Handler:    _Recorder_RecordBatch_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "recordtocsv.proto",
+}
@@ -0,0 +1,253 @@
+// Package recordtocsvgrpc accepts records over gRPC, so services written in
+// other languages can write into the same rotated CSV store as Go code. The
+// Recorder service is defined in recordtocsvpb/recordtocsv.proto; generate
+// clients for other languages from that file.
+//
+//	srv := recordtocsvgrpc.NewServer(service)
+//	srv.Authenticator = auth.APIKeys{"secret": "billing-team"}
+//	srv.MaxInFlight = 64
+//	gs := grpc.NewServer()
+//	recordtocsvpb.RegisterRecorderServer(gs, srv)
+//	gs.Serve(lis)
+package recordtocsvgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ojipoji/recordtocsv/v2/auth"
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"github.com/ojipoji/recordtocsv/v2/server/recordtocsvgrpc/recordtocsvpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail of failed
+// calls.
+const ErrorDomain = "recordtocsv"
+
+// Reasons of the google.rpc.ErrorInfo detail of failed calls, with the
+// status code they come with.
+const (
+	ReasonUnauthenticated = "UNAUTHENTICATED" // Unauthenticated
+	ReasonInvalidPayload  = "INVALID_PAYLOAD" // InvalidArgument, a payload can't be mapped
+	ReasonInvalidValue    = "INVALID_VALUE"   // InvalidArgument, a value breaks the Rules
+	ReasonOversized       = "OVERSIZED"       // InvalidArgument, a record is over the size limits
+	ReasonBatchTooLarge   = "BATCH_TOO_LARGE" // InvalidArgument, over MaxBatch payloads
+	ReasonOverloaded      = "OVERLOADED"      // ResourceExhausted, MaxInFlight calls are running
+	ReasonQuotaExceeded   = "QUOTA_EXCEEDED"  // ResourceExhausted, the disk quota is used up
+	ReasonPaused          = "PAUSED"          // Unavailable, the service is paused
+	ReasonClosed          = "CLOSED"          // Unavailable, the service is closed
+	ReasonWriteFailed     = "WRITE_FAILED"    // Internal
+)
+
+// Server implements the Recorder service on top of a core.Service. Every
+// call is recorded with RecordContext, so the caller's trace and principal
+// reach the service.
+type Server struct {
+	recordtocsvpb.UnimplementedRecorderServer
+
+	// Service records the payloads.
+	Service *core.Service
+
+	// Authenticator, if set, must accept the caller before anything is
+	// recorded. It sees the call's metadata as headers and the TLS state of
+	// its connection.
+	Authenticator auth.Authenticator
+
+	// MaxBatch limits the number of payloads of a RecordBatch call. 0 means
+	// no limit.
+	MaxBatch int
+
+	// MaxInFlight limits the number of calls recording at once. Calls beyond
+	// it fail right away with ResourceExhausted, so clients back off instead
+	// of piling up on the service's lock. 0 means no limit.
+	MaxInFlight int
+
+	// Logger, if set, receives the errors behind Internal statuses, whose
+	// message is generic, so file paths and system errors aren't shown to
+	// callers. Defaults to the Service's Logger.
+	Logger *slog.Logger
+
+	inFlight atomic.Int64
+}
+
+// NewServer creates a Server recording into service.
+func NewServer(service *core.Service) *Server {
+	return &Server{Service: service}
+}
+
+// Record writes one payload.
+func (s *Server) Record(ctx context.Context, req *recordtocsvpb.RecordRequest) (*recordtocsvpb.RecordResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decode(req.GetPayload())
+	if err != nil {
+		return nil, err
+	}
+	return s.record(ctx, payload, 1)
+}
+
+// RecordBatch writes the payloads as one batch.
+func (s *Server) RecordBatch(ctx context.Context, req *recordtocsvpb.RecordBatchRequest) (*recordtocsvpb.RecordResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.MaxBatch > 0 && len(req.GetPayloads()) > s.MaxBatch {
+		return nil, statusError(codes.InvalidArgument, ReasonBatchTooLarge, fmt.Errorf("batch exceeds %d records", s.MaxBatch), nil)
+	}
+	payloads := make([]interface{}, len(req.GetPayloads()))
+	for i, p := range req.GetPayloads() {
+		payload, err := decode(p)
+		if err != nil {
+			return nil, err
+		}
+		payloads[i] = payload
+	}
+	return s.record(ctx, payloads, len(payloads))
+}
+
+// authenticate returns ctx with the caller's principal, if there is an
+// Authenticator.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.Authenticator == nil {
+		return ctx, nil
+	}
+	p, err := s.Authenticator.Authenticate(ctx, credentialsOf(ctx))
+	if err != nil {
+		return ctx, statusError(codes.Unauthenticated, ReasonUnauthenticated, errors.New("unauthenticated"), nil)
+	}
+	return auth.NewContext(ctx, p), nil
+}
+
+// record records count payloads, holding one of the MaxInFlight slots.
+func (s *Server) record(ctx context.Context, payload interface{}, count int) (*recordtocsvpb.RecordResponse, error) {
+	if s.MaxInFlight > 0 {
+		defer s.inFlight.Add(-1)
+		if n := s.inFlight.Add(1); n > int64(s.MaxInFlight) {
+			return nil, statusError(codes.ResourceExhausted, ReasonOverloaded, fmt.Errorf("more than %d calls in flight", s.MaxInFlight), nil)
+		}
+	}
+	if count == 0 {
+		return &recordtocsvpb.RecordResponse{}, nil
+	}
+	if err := s.Service.RecordContext(ctx, payload); err != nil {
+		st := statusFor(err)
+		if status.Code(st) == codes.Internal {
+			s.logger().Error("failed to record payload", "records", count, "error", err)
+		}
+		return nil, st
+	}
+	return &recordtocsvpb.RecordResponse{Recorded: int32(count)}, nil
+}
+
+// logger returns Logger, the Service's Logger or the default one.
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	if s.Service.Logger != nil {
+		return s.Service.Logger
+	}
+	return slog.Default()
+}
+
+// decode returns the payload as a map of its fields, with the numbers of
+// JSON payloads as json.Number so they are written as sent.
+func decode(p *recordtocsvpb.Payload) (map[string]interface{}, error) {
+	switch v := p.GetValue().(type) {
+	case *recordtocsvpb.Payload_Fields:
+		return v.Fields.AsMap(), nil
+	case *recordtocsvpb.Payload_Json:
+		dec := json.NewDecoder(bytes.NewReader(v.Json))
+		dec.UseNumber()
+		var fields map[string]interface{}
+		if err := dec.Decode(&fields); err != nil || fields == nil {
+			if err == nil {
+				err = errors.New("not an object")
+			}
+			return nil, statusError(codes.InvalidArgument, ReasonInvalidPayload, fmt.Errorf("invalid JSON payload: %w", err), nil)
+		}
+		return fields, nil
+	}
+	return nil, statusError(codes.InvalidArgument, ReasonInvalidPayload, errors.New("empty payload"), nil)
+}
+
+// credentialsOf returns the metadata and TLS state of the call as
+// credentials for the Authenticator.
+func credentialsOf(ctx context.Context) auth.Credentials {
+	var creds auth.Credentials
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		creds.Header = make(http.Header, len(md))
+		for key, values := range md {
+			creds.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			creds.TLS = &info.State
+		}
+	}
+	return creds
+}
+
+// statusFor maps a recording error to a status with an error reason:
+// payload errors to InvalidArgument, a paused or closed service to
+// Unavailable, a full disk quota to ResourceExhausted and everything else to
+// Internal, with a generic message.
+func statusFor(err error) error {
+	var (
+		invalid *core.InvalidValueError
+		payload *core.PayloadError
+	)
+	meta := map[string]string{}
+	if errors.As(err, &payload) && payload.DeadLetter != "" {
+		meta["dead_letter"] = payload.DeadLetter
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.As(err, &invalid):
+		meta["column"] = invalid.Column
+		return statusError(codes.InvalidArgument, ReasonInvalidValue, err, meta)
+	case errors.Is(err, core.ErrInvalidValue):
+		return statusError(codes.InvalidArgument, ReasonInvalidValue, err, meta)
+	case errors.Is(err, core.ErrOversized):
+		return statusError(codes.InvalidArgument, ReasonOversized, err, meta)
+	case errors.Is(err, core.ErrInvalidPayload):
+		return statusError(codes.InvalidArgument, ReasonInvalidPayload, err, meta)
+	case errors.Is(err, core.ErrQuotaExceeded):
+		return statusError(codes.ResourceExhausted, ReasonQuotaExceeded, err, meta)
+	case errors.Is(err, core.ErrPaused):
+		return statusError(codes.Unavailable, ReasonPaused, err, meta)
+	case errors.Is(err, core.ErrClosed):
+		return statusError(codes.Unavailable, ReasonClosed, err, meta)
+	}
+	return statusError(codes.Internal, ReasonWriteFailed, errors.New("failed to record payload"), meta)
+}
+
+// statusError returns a status error with the code and message of err and an
+// ErrorInfo detail with the reason and metadata.
+func statusError(code codes.Code, reason string, err error, meta map[string]string) error {
+	st := status.New(code, err.Error())
+	if len(meta) == 0 {
+		meta = nil
+	}
+	if detailed, derr := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain, Metadata: meta}); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,42 @@
+package recordtocsvgrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"github.com/ojipoji/recordtocsv/v2/server/recordtocsvgrpc/recordtocsvpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type failingSink struct{}
+
+func (failingSink) WriteBatch(b *core.Batch) error {
+	return errors.New("open /secret/path: permission denied")
+}
+
+func TestServerHidesInternalErrors(t *testing.T) {
+	s := core.New(t.TempDir(), "booking", []string{"id"}, "daily")
+	s.Sinks = []core.Sink{failingSink{}}
+	var logged bytes.Buffer
+	srv := NewServer(s)
+	srv.Logger = slog.New(slog.NewTextHandler(&logged, nil))
+
+	req := &recordtocsvpb.RecordRequest{Payload: &recordtocsvpb.Payload{Value: &recordtocsvpb.Payload_Json{Json: []byte(`{"id":"1"}`)}}}
+	_, err := srv.Record(context.Background(), req)
+	st := status.Convert(err)
+	if st.Code() != codes.Internal {
+		t.Fatalf("code = %v, want Internal", st.Code())
+	}
+	if strings.Contains(st.Message(), "/secret/path") {
+		t.Errorf("status shows the error: %q", st.Message())
+	}
+	if !strings.Contains(logged.String(), "/secret/path") {
+		t.Errorf("error not logged: %q", logged.String())
+	}
+}
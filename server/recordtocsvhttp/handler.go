@@ -0,0 +1,165 @@
+// Package recordtocsvhttp accepts records over HTTP, so non-Go services can
+// write into the same rotated CSV store, serves the files as downloads with
+// ServeCSV, and exposes the Stats of services with StatsHandler and
+// PublishExpvar.
+//
+//	h := recordtocsvhttp.NewHandler(service)
+//	h.Authenticator = auth.APIKeys{"secret": "billing-team"}
+//	http.Handle("/records", h)
+package recordtocsvhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/ojipoji/recordtocsv/v2/auth"
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// DefaultMaxBodyBytes is the request size limit used when MaxBodyBytes is 0.
+const DefaultMaxBodyBytes = 1 << 20
+
+// Handler is an http.Handler that records POSTed JSON payloads. The body is a
+// single JSON object or an array of objects, which are recorded as one batch.
+type Handler struct {
+	// Service records the payloads.
+	Service *core.Service
+
+	// Authenticator, if set, must accept the caller before anything is
+	// recorded. Rejected requests get 401 Unauthorized.
+	Authenticator auth.Authenticator
+
+	// MaxBodyBytes limits the request body size. Defaults to 1 MiB; larger
+	// bodies get 413 Request Entity Too Large.
+	MaxBodyBytes int64
+
+	// MaxBatch limits the number of elements of an array body. 0 means no limit.
+	MaxBatch int
+
+	// Logger, if set, receives the errors behind 500 Internal Server Error
+	// replies, whose body only has a generic message, so file paths and
+	// system errors aren't shown to callers. Defaults to the Service's Logger.
+	Logger *slog.Logger
+}
+
+// NewHandler creates a Handler recording into service.
+func NewHandler(service *core.Service) *Handler {
+	return &Handler{Service: service}
+}
+
+// response is the JSON body of every reply.
+type response struct {
+	Recorded int    `json:"recorded"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		reply(w, http.StatusMethodNotAllowed, 0, errors.New("only POST is allowed"))
+		return
+	}
+
+	if h.Authenticator != nil {
+		p, err := h.Authenticator.Authenticate(r.Context(), auth.FromHTTP(r))
+		if err != nil {
+			reply(w, http.StatusUnauthorized, 0, errors.New("unauthenticated"))
+			return
+		}
+		r = r.WithContext(auth.NewContext(r.Context(), p))
+	}
+
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			reply(w, http.StatusRequestEntityTooLarge, 0, fmt.Errorf("body exceeds %d bytes", limit))
+			return
+		}
+		reply(w, http.StatusBadRequest, 0, fmt.Errorf("failed to read body: %w", err))
+		return
+	}
+
+	var payload interface{}
+	if err := core.DecodeJSON(body, &payload); err != nil {
+		reply(w, http.StatusBadRequest, 0, fmt.Errorf("invalid JSON: %w", err))
+		return
+	}
+
+	count := 1
+	switch p := payload.(type) {
+	case []interface{}:
+		if h.MaxBatch > 0 && len(p) > h.MaxBatch {
+			reply(w, http.StatusRequestEntityTooLarge, 0, fmt.Errorf("batch exceeds %d records", h.MaxBatch))
+			return
+		}
+		for _, item := range p {
+			if _, ok := item.(map[string]interface{}); !ok {
+				reply(w, http.StatusBadRequest, 0, errors.New("body must be a JSON object or an array of objects"))
+				return
+			}
+		}
+		count = len(p)
+	case map[string]interface{}:
+	default:
+		reply(w, http.StatusBadRequest, 0, errors.New("body must be a JSON object or an array of objects"))
+		return
+	}
+
+	if err := h.Service.RecordContext(r.Context(), payload); err != nil {
+		status := statusFor(err)
+		if status == http.StatusInternalServerError {
+			h.logger().Error("failed to record payload", "records", count, "error", err)
+			err = errors.New("failed to record payload")
+		} else if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+		reply(w, status, 0, err)
+		return
+	}
+	reply(w, http.StatusOK, count, nil)
+}
+
+// logger returns Logger, the Service's Logger or the default one.
+func (h *Handler) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	if h.Service.Logger != nil {
+		return h.Service.Logger
+	}
+	return slog.Default()
+}
+
+// statusFor maps recording errors like the gRPC server: errors caused by the
+// payload to 422, a paused or closed service to 503, a full disk quota to
+// 507 and everything else to 500.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, core.ErrInvalidPayload), errors.Is(err, core.ErrInvalidValue), errors.Is(err, core.ErrOversized):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, core.ErrPaused), errors.Is(err, core.ErrClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, core.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
+
+func reply(w http.ResponseWriter, status, recorded int, err error) {
+	resp := response{Recorded: recorded}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
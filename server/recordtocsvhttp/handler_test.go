@@ -0,0 +1,75 @@
+package recordtocsvhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+func post(t *testing.T, h http.Handler, body string) (*httptest.ResponseRecorder, response) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(body)))
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return w, resp
+}
+
+func TestHandlerStatus(t *testing.T) {
+	tests := map[string]struct {
+		setup func(s *core.Service)
+		want  int
+	}{
+		"recorded": {func(s *core.Service) {}, http.StatusOK},
+		"paused":   {func(s *core.Service) { s.Pause() }, http.StatusServiceUnavailable},
+		"closed":   {func(s *core.Service) { s.Close() }, http.StatusServiceUnavailable},
+		"quota": {func(s *core.Service) {
+			s.MaxTotalBytes = 1
+			s.Record(map[string]interface{}{"id": "0"})
+		}, http.StatusInsufficientStorage},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := core.New(t.TempDir(), "booking", []string{"id"}, "daily")
+			tt.setup(s)
+			w, _ := post(t, NewHandler(s), `{"id":"1"}`)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerHidesInternalErrors(t *testing.T) {
+	s := core.New(t.TempDir(), "booking", []string{"id"}, "daily")
+	s.Sinks = []core.Sink{failingSink{}}
+	var logged bytes.Buffer
+	h := NewHandler(s)
+	h.Logger = slog.New(slog.NewTextHandler(&logged, nil))
+
+	w, resp := post(t, h, `{"id":"1"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if strings.Contains(resp.Error, "/secret/path") {
+		t.Errorf("reply shows the error: %q", resp.Error)
+	}
+	if !strings.Contains(logged.String(), "/secret/path") {
+		t.Errorf("error not logged: %q", logged.String())
+	}
+}
+
+type failingSink struct{}
+
+func (failingSink) WriteBatch(b *core.Batch) error {
+	return errors.New("open /secret/path: permission denied")
+}
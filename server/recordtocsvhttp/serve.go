@@ -0,0 +1,206 @@
+package recordtocsvhttp
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"github.com/ojipoji/recordtocsv/v2/reader"
+)
+
+// ServeOptions tunes ServeCSV.
+type ServeOptions struct {
+	// Filename is the download name in Content-Disposition. Defaults to the
+	// file's name for a single file, and to the service's Filename with the
+	// range's suffixes, e.g., "booking_record_2025_08_01-2025_08_26.csv",
+	// for several.
+	Filename string
+
+	// Gzip compresses the response on the fly for clients that accept gzip.
+	Gzip bool
+}
+
+// ServeCSV streams the files of the rotation periods in dates to w as one CSV
+// download, oldest first, without reading them into memory. Pass the same
+// time as From and To for a single period. Encrypted and re-encoded files are
+// decoded like Service.OpenFile does, and the response is UTF-8.
+//
+// Files whose headers differ, e.g., after columns were appended, are merged
+// under the union of their headers, with empty cells for the missing
+// columns, and labels renamed since through the service's HeaderAliases. If
+// no file matches, it replies 404 Not Found and returns nil.
+// Errors after the response started can't change its status; they are
+// returned so the caller can log them.
+//
+//	http.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+//		day, _ := time.Parse(time.DateOnly, r.URL.Query().Get("date"))
+//		dates := core.DateRange{From: day, To: day}
+//		if err := recordtocsvhttp.ServeCSV(w, r, service, dates, recordtocsvhttp.ServeOptions{Gzip: true}); err != nil {
+//			log.Print(err)
+//		}
+//	})
+func ServeCSV(w http.ResponseWriter, r *http.Request, service *core.Service, dates core.DateRange, opts ServeOptions) error {
+	files, err := service.FilesBetween(dates)
+	if err != nil {
+		http.Error(w, "failed to list files", http.StatusInternalServerError)
+		return err
+	}
+	if len(files) == 0 {
+		http.Error(w, "no files in the date range", http.StatusNotFound)
+		return nil
+	}
+
+	headers := make([][]string, len(files))
+	var union []string
+	for i, path := range files {
+		header, err := readHeader(service, path)
+		if err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return err
+		}
+		header = reader.AliasHeader(header, service.HeaderAliases)
+		headers[i] = header
+		for _, label := range header {
+			if !slices.Contains(union, label) {
+				union = append(union, label)
+			}
+		}
+	}
+
+	name := opts.Filename
+	if name == "" {
+		name = downloadName(service, files, dates)
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/csv; charset=utf-8")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	var out io.Writer = w
+	if opts.Gzip {
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			h.Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	cw := csv.NewWriter(out)
+	if err := cw.Write(union); err != nil {
+		return err
+	}
+	for i, path := range files {
+		if err := copyRows(cw, service, path, headers[i], union); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readHeader returns the first row of the file at path.
+func readHeader(service *core.Service, path string) ([]string, error) {
+	f, err := service.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %q: %w", path, err)
+	}
+	return header, nil
+}
+
+// copyRows writes the rows of the file at path, after its header, with the
+// cells moved from the file's columns to those of union.
+func copyRows(cw *csv.Writer, service *core.Service, path string, header, union []string) error {
+	f, err := service.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	index := make([]int, len(header))
+	for i, label := range header {
+		index[i] = slices.Index(union, label)
+	}
+	out := make([]string, len(union))
+	for first := true; ; first = false {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", path, err)
+		}
+		if first {
+			continue // The header
+		}
+		clear(out)
+		for i, cell := range row {
+			if i < len(index) {
+				out[index[i]] = cell
+			}
+		}
+		if err := cw.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+// downloadName is the default ServeOptions.Filename.
+func downloadName(service *core.Service, files []string, dates core.DateRange) string {
+	if len(files) == 1 {
+		// Served decompressed
+		return strings.TrimSuffix(filepath.Base(files[0]), service.Compression.Extension())
+	}
+	name := service.Filename
+	now, err := service.Now()
+	if err != nil || dates.From.IsZero() || dates.To.IsZero() {
+		return name + ".csv"
+	}
+	// Named in the service's time zone, like the files
+	from, ferr := service.Suffix(dates.From.In(now.Location()))
+	to, terr := service.Suffix(dates.To.In(now.Location()))
+	if ferr == nil && terr == nil {
+		if from == to {
+			return name + "_" + from + ".csv"
+		}
+		return name + "_" + from + "-" + to + ".csv"
+	}
+	return name + ".csv"
+}
+
+// acceptsGzip reports whether the client accepts a gzip response.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+		}
+	}
+	return false
+}
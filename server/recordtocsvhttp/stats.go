@@ -0,0 +1,47 @@
+package recordtocsvhttp
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// StatsHandler serves the Stats of service as JSON to GET requests, so a live
+// service can be inspected without metrics infrastructure. Mount it on the
+// debug listener, next to net/http/pprof's handlers, since it doesn't
+// authenticate callers:
+//
+//	mux.Handle("/debug/recordtocsv", recordtocsvhttp.StatsHandler(service))
+func StatsHandler(service *core.Service) http.Handler {
+	return statsHandler(func() interface{} { return service.Stats() })
+}
+
+// RegistryStatsHandler is StatsHandler for every service of registry, keyed
+// by name.
+func RegistryStatsHandler(registry *core.Registry) http.Handler {
+	return statsHandler(func() interface{} { return registry.Stats() })
+}
+
+func statsHandler(stats func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(stats())
+	})
+}
+
+// PublishExpvar publishes the Stats of service as the expvar variable name,
+// served with the other variables by expvar's /debug/vars. Like
+// expvar.Publish, it panics if name is already published.
+func PublishExpvar(name string, service *core.Service) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return service.Stats() }))
+}
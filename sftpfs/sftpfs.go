@@ -0,0 +1,185 @@
+// Package sftpfs is a core.FS on an SFTP server, so a service writes and
+// rotates its files directly on a remote host, such as a partner's drop
+// server.
+//
+//	fsys, err := sftpfs.Dial("sftp.partner.example:22", &ssh.ClientConfig{
+//		User:            "records",
+//		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//		HostKeyCallback: ssh.FixedHostKey(hostKey),
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer fsys.Close()
+//	service.FS = fsys
+package sftpfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+var (
+	_ core.FS      = (*FS)(nil)
+	_ core.Chowner = (*FS)(nil)
+)
+
+// posixRename is the OpenSSH extension for a rename that replaces its
+// target, which plain SFTP renames refuse to do.
+const posixRename = "posix-rename@openssh.com"
+
+// FS is a filesystem on an SFTP server. Paths are relative to the login
+// directory unless absolute, and use the local separator, which is
+// converted to a slash. The perm of created files is applied with a chmod;
+// directories get the server's default mode.
+type FS struct {
+	client *sftp.Client
+	conn   *ssh.Client // Closed by Close, if Dial opened it
+}
+
+// New returns the filesystem of client. Closing the client is left to the
+// caller.
+func New(client *sftp.Client) *FS {
+	return &FS{client: client}
+}
+
+// Dial connects to the SSH server at addr, e.g., "host:22", and starts an
+// SFTP session on it. Close the filesystem to end the session and the
+// connection.
+func Dial(addr string, config *ssh.ClientConfig, opts ...sftp.ClientOption) (*FS, error) {
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	client, err := sftp.NewClient(conn, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP session on %s: %w", addr, err)
+	}
+	return &FS{client: client, conn: conn}, nil
+}
+
+// Client returns the SFTP client of the filesystem.
+func (s *FS) Client() *sftp.Client {
+	return s.client
+}
+
+// Close ends the SFTP session, and the SSH connection if Dial opened it.
+func (s *FS) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *FS) Open(name string) (core.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (s *FS) Create(name string) (core.File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (s *FS) OpenFile(name string, flag int, perm fs.FileMode) (core.File, error) {
+	name = remote(name)
+	created := false
+	if flag&os.O_CREATE != 0 {
+		_, err := s.client.Stat(name)
+		created = errors.Is(err, fs.ErrNotExist)
+	}
+	f, err := s.client.OpenFile(name, flag)
+	if err != nil {
+		return nil, err
+	}
+	if created && perm != 0 {
+		if err := f.Chmod(perm.Perm()); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		// Not every server honors the append flag, so start writing at the end
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (s *FS) MkdirAll(path string, perm fs.FileMode) error {
+	return s.client.MkdirAll(remote(path))
+}
+
+func (s *FS) Stat(name string) (fs.FileInfo, error) {
+	return s.client.Stat(remote(name))
+}
+
+// Rename replaces newpath with oldpath. Servers without the OpenSSH
+// posix-rename extension can't replace a file in one step, so newpath is
+// removed first and readers may briefly find it missing.
+func (s *FS) Rename(oldpath, newpath string) error {
+	oldpath, newpath = remote(oldpath), remote(newpath)
+	if _, ok := s.client.HasExtension(posixRename); ok {
+		return s.client.PosixRename(oldpath, newpath)
+	}
+	if err := s.client.Remove(newpath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return s.client.Rename(oldpath, newpath)
+}
+
+func (s *FS) Remove(name string) error {
+	return s.client.Remove(remote(name))
+}
+
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.client.ReadDir(remote(name))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries, nil
+}
+
+// Chown sets the owner of a file. Like os.Chown, -1 keeps the current user
+// or group.
+func (s *FS) Chown(name string, uid, gid int) error {
+	name = remote(name)
+	if uid == -1 || gid == -1 {
+		info, err := s.client.Stat(name)
+		if err != nil {
+			return err
+		}
+		if st, ok := info.Sys().(*sftp.FileStat); ok {
+			if uid == -1 {
+				uid = int(st.UID)
+			}
+			if gid == -1 {
+				gid = int(st.GID)
+			}
+		}
+	}
+	return s.client.Chown(name, uid, gid)
+}
+
+// remote converts a local path to the slash-separated path of the server.
+func remote(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
@@ -0,0 +1,303 @@
+// Package arrowipc converts record files to the Apache Arrow IPC file format,
+// also known as Feather v2, so analytics notebooks can load them zero-copy,
+// e.g., with pandas.read_feather, polars.read_ipc or pyarrow.ipc.open_file.
+//
+// Arrow files have a footer and can't be appended to, so files are converted
+// once their period is closed. Set the Converter as the service's OnRotate to
+// write an Arrow file next to every rotated CSV file:
+//
+//	converter := arrowipc.NewConverter(service)
+//	service.OnRotate = converter.OnRotate
+//	defer converter.Wait()
+//
+// The package lives apart from core to keep the Arrow dependency out of
+// programs that only write CSV.
+package arrowipc
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// Extension replaces the extension of a converted CSV file, e.g.,
+// "booking_record_2025_08_26.arrow" for "booking_record_2025_08_26.csv.gz".
+const Extension = ".arrow"
+
+// defaultBatchRows is the number of rows of a record batch when BatchRows is
+// zero.
+const defaultBatchRows = 64 * 1024
+
+// Converter writes CSV files of a service as Arrow IPC files. Columns are
+// typed from the service's Rules: TypeInt columns become int64, TypeFloat
+// float64, TypeBool bool and TypeTime UTC timestamps in microseconds, with
+// empty cells as nulls. Numbers are parsed in the NumberLocale they were
+// written in. TypeDecimal columns stay utf8 strings to keep their digits,
+// converted out of their NumberLocale. Other columns are utf8 strings.
+type Converter struct {
+	// Service provides the files, their decoding and the column types.
+	Service *core.Service
+
+	// BatchRows is the number of rows per record batch. Defaults to 65536.
+	BatchRows int
+
+	// OnError, if set, receives the failures of conversions started by
+	// OnRotate, which can't return them.
+	OnError func(path string, err error)
+
+	wg sync.WaitGroup
+}
+
+// NewConverter creates a Converter for the files of service.
+func NewConverter(service *core.Service) *Converter {
+	return &Converter{Service: service}
+}
+
+// Path returns the path of the Arrow file converted from the CSV file at path.
+func (c *Converter) Path(path string) string {
+	path = strings.TrimSuffix(path, c.Service.Compression.Extension())
+	return strings.TrimSuffix(path, filepath.Ext(path)) + Extension
+}
+
+// OnRotate converts the closed file of e in the background, see Path. It can
+// be set as the service's OnRotate.
+func (c *Converter) OnRotate(e core.RotateEvent) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if _, err := c.Convert(e.OldPath); err != nil && c.OnError != nil {
+			c.OnError(e.OldPath, err)
+		}
+	}()
+}
+
+// Wait blocks until the conversions started by OnRotate are done.
+func (c *Converter) Wait() {
+	c.wg.Wait()
+}
+
+// Convert writes the CSV file at path as an Arrow file next to it, see Path,
+// and returns the Arrow file's path. The file is replaced through a temporary
+// file and a rename, so readers never see a partial file.
+func (c *Converter) Convert(path string) (string, error) {
+	dst := c.Path(path)
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for %q: %w", dst, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := c.Write(tmp, path); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(c.Service.FileMode()); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", fmt.Errorf("failed to replace %q: %w", dst, err)
+	}
+	return dst, nil
+}
+
+// Write writes the CSV file at path as an Arrow IPC file to dst and returns
+// the number of rows written. An empty file is written with the service's
+// header.
+func (c *Converter) Write(dst io.Writer, path string) (int, error) {
+	f, err := c.Service.OpenFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		header = c.Service.HeaderRow()
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read header of %q: %w", path, err)
+	}
+	cols, err := c.columns(path, header)
+	if err != nil {
+		return 0, err
+	}
+	schema := schemaOf(cols)
+
+	w, err := ipc.NewFileWriter(dst, ipc.WithSchema(schema))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Arrow writer: %w", err)
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+
+	batchRows := c.BatchRows
+	if batchRows <= 0 {
+		batchRows = defaultBatchRows
+	}
+	rows, pending := 0, 0
+	flush := func() error {
+		rec := b.NewRecord()
+		defer rec.Release()
+		if err := w.Write(rec); err != nil {
+			return fmt.Errorf("failed to write record batch: %w", err)
+		}
+		pending = 0
+		return nil
+	}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rows, fmt.Errorf("failed to read %q: %w", path, err)
+		}
+		for i, col := range cols {
+			var cell string
+			if i < len(row) {
+				cell = row[i]
+			}
+			if err := col.append(b.Field(i), cell); err != nil {
+				return rows, fmt.Errorf("failed to convert row %d of %q: column %q: %w", rows+1, path, col.name, err)
+			}
+		}
+		rows++
+		if pending++; pending == batchRows {
+			if err := flush(); err != nil {
+				return rows, err
+			}
+		}
+	}
+	if pending > 0 || rows == 0 {
+		if err := flush(); err != nil {
+			return rows, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return rows, fmt.Errorf("failed to finish Arrow file: %w", err)
+	}
+	return rows, nil
+}
+
+// column is a column of a converted file.
+type column struct {
+	name   string
+	typ    core.ColumnType
+	layout string
+	locale core.NumberLocale
+}
+
+// columns types the header labels of the file at path from its schema
+// sidecar, if SchemaFiles wrote one, or else from the service's schema.
+// Labels of neither are strings.
+func (c *Converter) columns(path string, header []string) ([]column, error) {
+	schema, err := c.Service.ReadSchema(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if schema, err = c.Service.Schema(); err != nil {
+			return nil, err
+		}
+	}
+	cols := make([]column, len(header))
+	for i, label := range header {
+		cols[i] = column{name: label}
+		for _, sc := range schema.Columns {
+			if sc.Header == label {
+				cols[i].typ, cols[i].layout = sc.Type, sc.Layout
+				if sc.Locale != nil {
+					cols[i].locale = *sc.Locale
+				}
+				break
+			}
+		}
+	}
+	return cols, nil
+}
+
+// schemaOf returns the Arrow schema of cols.
+func schemaOf(cols []column) *arrow.Schema {
+	fields := make([]arrow.Field, len(cols))
+	for i, col := range cols {
+		fields[i] = arrow.Field{Name: col.name, Type: col.arrowType(), Nullable: col.typ != core.TypeString}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// arrowType returns the Arrow type of the column's cells.
+func (col column) arrowType() arrow.DataType {
+	switch col.typ {
+	case core.TypeInt:
+		return arrow.PrimitiveTypes.Int64
+	case core.TypeFloat:
+		return arrow.PrimitiveTypes.Float64
+	case core.TypeBool:
+		return arrow.FixedWidthTypes.Boolean
+	case core.TypeTime:
+		return arrow.FixedWidthTypes.Timestamp_us
+	}
+	return arrow.BinaryTypes.String
+}
+
+// append parses cell and appends it to the builder of the column.
+func (col column) append(b array.Builder, cell string) error {
+	if col.typ != core.TypeString && cell == "" {
+		b.AppendNull()
+		return nil
+	}
+	switch col.typ {
+	case core.TypeInt:
+		v, err := strconv.ParseInt(col.locale.Parse(cell), 10, 64)
+		if err != nil {
+			return err
+		}
+		b.(*array.Int64Builder).Append(v)
+	case core.TypeFloat:
+		v, err := strconv.ParseFloat(col.locale.Parse(cell), 64)
+		if err != nil {
+			return err
+		}
+		b.(*array.Float64Builder).Append(v)
+	case core.TypeBool:
+		v, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		b.(*array.BooleanBuilder).Append(v)
+	case core.TypeTime:
+		layout := col.layout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, cell)
+		if err != nil {
+			return err
+		}
+		b.(*array.TimestampBuilder).Append(arrow.Timestamp(t.UnixMicro()))
+	case core.TypeDecimal:
+		b.(*array.StringBuilder).Append(col.locale.Parse(cell))
+	default:
+		b.(*array.StringBuilder).Append(cell)
+	}
+	return nil
+}
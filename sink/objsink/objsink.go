@@ -0,0 +1,401 @@
+// Package objsink writes the CSV files of a service to S3-compatible object
+// storage, for hosts without a persistent local disk, such as containers and
+// serverless functions.
+//
+// Objects can't be appended to, so rows are staged in memory and every
+// completed chunk of a file is stored as a numbered part next to it, e.g.,
+// "records/booking_record_2025_08_26.part0001.csv", then
+// "records/booking_record_2025_08_26.part0002.csv". Only the first part has
+// the header, so the parts in order make up the file. Once the period is
+// over, Finalize stores the last chunk and, with Compose, joins the parts
+// into "records/booking_record_2025_08_26.csv":
+//
+//	objects := objsink.New(service, store, "records")
+//	objects.Compose = true
+//	service.Sinks = []core.Sink{objects}
+//	service.OnRotate = objects.OnRotate
+//	service.RotateOnTime = true
+//
+// The object store client is abstracted by Store and Composer, which take a
+// few lines with the AWS SDK, minio-go or the GCS client.
+package objsink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// DefaultPartSize is the size of the staged chunks when PartSize is zero, the
+// smallest part S3 accepts in a multipart upload.
+const DefaultPartSize = 5 << 20
+
+// Store is an S3-compatible object store. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// PutObject stores body, of size bytes, under key, replacing any object
+	// of that key.
+	PutObject(ctx context.Context, key string, body io.Reader, size int64) error
+
+	// ListObjects returns the keys of the objects starting with prefix.
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Composer is a Store that joins objects on the server, e.g., with S3's
+// UploadPartCopy or a GCS compose request, needed by Compose.
+type Composer interface {
+	Store
+
+	// ComposeObject stores the objects of parts, in order, as one object
+	// under key. key itself may be the first of parts.
+	ComposeObject(ctx context.Context, key string, parts []string) error
+
+	// DeleteObject removes the object of key.
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// Sink stages the rows of each file of the service in memory and stores them
+// as numbered parts, see the package documentation. Parts are stored when
+// the staged chunk reaches PartSize, every FlushInterval, by Flush and Close,
+// and by Finalize.
+//
+// Rows are staged when WriteBatch returns, so a failed store doesn't fail
+// the record: it is reported to OnError and the chunk is stored again with
+// the next part. Staged rows are lost if the process dies before they are
+// stored.
+type Sink struct {
+	// Service provides the file names and the CSV format.
+	Service *core.Service
+
+	// Store receives the parts.
+	Store Store
+
+	// Prefix is put in front of the file names, relative to the service's
+	// Dir, to make the object keys, e.g., "records". It may be empty.
+	Prefix string
+
+	// PartSize is the size a staged chunk is stored at. Defaults to
+	// DefaultPartSize.
+	PartSize int64
+
+	// FlushInterval, if set, also stores the staged chunks this often, to
+	// bound the rows lost with the process. S3 composes parts of at least
+	// 5 MiB only, except the last, so leave it unset there with Compose.
+	FlushInterval time.Duration
+
+	// Compose makes Finalize join the parts of a file into one object and
+	// delete them. Store must implement Composer.
+	Compose bool
+
+	// Timeout bounds each call to the Store. Zero means no timeout.
+	Timeout time.Duration
+
+	// OnError, if set, receives the failures that can't be returned, with
+	// the key of the composed object: of stores by WriteBatch, of Finalize
+	// started by OnRotate, and of FlushInterval, with an empty key.
+	OnError func(key string, err error)
+
+	mu    sync.Mutex
+	files map[string]*file // by CSV path
+	stop  chan struct{}
+
+	wg sync.WaitGroup
+}
+
+// file is a CSV file being written as parts.
+type file struct {
+	key    string   // of the composed object
+	parts  []string // keys of the stored parts, in order
+	next   int      // number of the next part
+	listed bool     // parts holds the parts stored before this process
+	joined bool     // the object of key exists, composed from earlier parts
+	staged bytes.Buffer
+}
+
+// New creates a Sink storing the files of service in store under prefix.
+func New(service *core.Service, store Store, prefix string) *Sink {
+	return &Sink{Service: service, Store: store, Prefix: prefix}
+}
+
+// Ping lists the objects under Prefix, to check Store is reachable, see
+// core.Pinger.
+func (s *Sink) Ping() error {
+	ctx, cancel := s.context(context.Background())
+	defer cancel()
+	if _, err := s.Store.ListObjects(ctx, s.Prefix); err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	return nil
+}
+
+// Key returns the object key of the CSV file at path once composed, e.g.,
+// "records/booking_record_2025_08_26.csv".
+func (s *Sink) Key(csvPath string) string {
+	rel, err := filepath.Rel(s.Service.Dir, csvPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(csvPath)
+	}
+	return path.Join(s.Prefix, filepath.ToSlash(rel))
+}
+
+// PartKey returns the object key of the part with the given number, from 1,
+// of the CSV file at path, e.g., "records/booking_record_2025_08_26.part0001.csv".
+func (s *Sink) PartKey(csvPath string, number int) string {
+	return partKey(s.Key(csvPath), number)
+}
+
+func partKey(key string, number int) string {
+	ext := path.Ext(key)
+	return fmt.Sprintf("%s.part%04d%s", strings.TrimSuffix(key, ext), number, ext)
+}
+
+// partNumber returns the number of the part of key with the given part key,
+// or 0 if it isn't one.
+func partNumber(key, part string) int {
+	ext := path.Ext(key)
+	prefix := strings.TrimSuffix(key, ext) + ".part"
+	digits, ok := strings.CutPrefix(part, prefix)
+	if !ok {
+		return 0
+	}
+	digits, ok = strings.CutSuffix(digits, ext)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+// WriteBatch stages the rows of the batch and stores the chunk of their file
+// once it reaches PartSize.
+func (s *Sink) WriteBatch(b *core.Batch) error {
+	csvPath := s.Service.BatchPath(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.startFlusher()
+	f, err := s.file(context.Background(), csvPath)
+	if err != nil {
+		return err
+	}
+	header := !f.joined && len(f.parts) == 0 && f.staged.Len() == 0
+	if err := s.Service.EncodeBatch(&f.staged, b, header); err != nil {
+		return err
+	}
+
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	if int64(f.staged.Len()) >= partSize {
+		if err := s.store(context.Background(), f); err != nil {
+			s.report(f.key, err)
+		}
+	}
+	return nil
+}
+
+// file returns the file at csvPath, listing the parts stored before when it
+// is first written by the process. The caller must hold s.mu.
+func (s *Sink) file(ctx context.Context, csvPath string) (*file, error) {
+	f := s.files[csvPath]
+	if f == nil {
+		f = &file{key: s.Key(csvPath), next: 1}
+		if s.files == nil {
+			s.files = make(map[string]*file)
+		}
+		s.files[csvPath] = f
+	}
+	if f.listed {
+		return f, nil
+	}
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+	ext := path.Ext(f.key)
+	keys, err := s.Store.ListObjects(ctx, strings.TrimSuffix(f.key, ext))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts of %q: %w", f.key, err)
+	}
+	numbers := make(map[string]int)
+	for _, key := range keys {
+		if key == f.key {
+			f.joined = true
+		} else if n := partNumber(f.key, key); n > 0 {
+			numbers[key] = n
+			f.parts = append(f.parts, key)
+		}
+	}
+	slices.SortFunc(f.parts, func(a, b string) int { return numbers[a] - numbers[b] })
+	if len(f.parts) > 0 {
+		f.next = numbers[f.parts[len(f.parts)-1]] + 1
+	}
+	f.listed = true
+	return f, nil
+}
+
+// store stores the staged chunk of f as its next part. The caller must hold
+// s.mu.
+func (s *Sink) store(ctx context.Context, f *file) error {
+	if f.staged.Len() == 0 {
+		return nil
+	}
+	key := partKey(f.key, f.next)
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+	data := f.staged.Bytes()
+	if err := s.Store.PutObject(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to store part %q: %w", key, err)
+	}
+	f.staged.Reset()
+	f.parts = append(f.parts, key)
+	f.next++
+	return nil
+}
+
+// Flush stores the staged chunks of every file.
+func (s *Sink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, f := range s.files {
+		if err := s.store(ctx, f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Finalize stores the staged chunk of the CSV file at path and, with Compose,
+// joins its parts into the object of Key and deletes them. Call it once no
+// more rows are written to the file, e.g., from OnRotate. Files of an earlier
+// run of the process are finalized from the parts already stored, and rows
+// written to a file after it was composed, e.g., late rows placed by
+// EventTimeColumn, are appended to its object by the next Finalize.
+func (s *Sink) Finalize(ctx context.Context, csvPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.file(ctx, csvPath)
+	if err != nil {
+		return err
+	}
+	if err := s.store(ctx, f); err != nil {
+		return err
+	}
+	delete(s.files, csvPath)
+	if !s.Compose || len(f.parts) == 0 {
+		return nil
+	}
+
+	composer, ok := s.Store.(Composer)
+	if !ok {
+		return fmt.Errorf("failed to compose %q: store doesn't implement objsink.Composer", f.key)
+	}
+	parts := f.parts
+	if f.joined {
+		// Rows written after an earlier Finalize are added to its object
+		parts = append([]string{f.key}, parts...)
+	}
+	cctx, cancel := s.context(ctx)
+	err = composer.ComposeObject(cctx, f.key, parts)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to compose %q: %w", f.key, err)
+	}
+	var errs []error
+	for _, part := range f.parts {
+		cctx, cancel := s.context(ctx)
+		if err := composer.DeleteObject(cctx, part); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete part %q: %w", part, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// OnRotate finalizes the closed file of e in the background, see Finalize.
+// It can be set as the service's OnRotate.
+func (s *Sink) OnRotate(e core.RotateEvent) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.Finalize(context.Background(), e.OldPath); err != nil {
+			s.report(s.Key(e.OldPath), err)
+		}
+	}()
+}
+
+// Wait blocks until the finalizations started by OnRotate are done.
+func (s *Sink) Wait() {
+	s.wg.Wait()
+}
+
+// Close waits for the finalizations started by OnRotate and stores the staged
+// chunks. Files of the current period are left as parts, to be continued by
+// the next run of the process. The service closes the sink when it is one of
+// its Sinks.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mu.Unlock()
+
+	s.Wait()
+	return s.Flush(context.Background())
+}
+
+// startFlusher starts storing the staged chunks every FlushInterval, if set.
+// The caller must hold s.mu.
+func (s *Sink) startFlusher() {
+	if s.FlushInterval <= 0 || s.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	go func() {
+		ticker := time.NewTicker(s.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := s.Flush(context.Background()); err != nil {
+					s.report("", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Sink) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(ctx, s.Timeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *Sink) report(key string, err error) {
+	if s.OnError != nil {
+		s.OnError(key, err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package natspub adapts a NATS connection to a pubsink.Publisher.
+//
+//	nc, err := nats.Connect(nats.DefaultURL)
+//	...
+//	service.Sinks = []core.Sink{
+//		service.FileSink(),
+//		pubsink.New(natspub.New(nc), "records.booking"),
+//	}
+package natspub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/ojipoji/recordtocsv/v2/sink/pubsink"
+)
+
+// Publisher publishes to NATS subjects. Message keys are dropped, since core
+// NATS has none; encode the partition in the subject instead if needed.
+type Publisher struct {
+	Conn *nats.Conn
+
+	// Flush waits for the server to acknowledge each message, so a failed
+	// delivery is reported to the service (and retried per its Retry policy)
+	// instead of being lost in the client buffer.
+	Flush bool
+}
+
+var _ pubsink.Publisher = (*Publisher)(nil)
+
+// Ping reports an error unless Conn is connected, for core.Service.Validate
+// through pubsink.Sink.
+func (p *Publisher) Ping() error {
+	if !p.Conn.IsConnected() {
+		return fmt.Errorf("nats connection is %v", p.Conn.Status())
+	}
+	return nil
+}
+
+// New creates a Publisher on nc.
+func New(nc *nats.Conn) *Publisher {
+	return &Publisher{Conn: nc}
+}
+
+func (p *Publisher) Publish(ctx context.Context, subject string, _, msg []byte) error {
+	if err := p.Conn.Publish(subject, msg); err != nil {
+		return err
+	}
+	if !p.Flush {
+		return nil
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return p.Conn.Flush() // FlushWithContext requires a deadline
+	}
+	return p.Conn.FlushWithContext(ctx)
+}
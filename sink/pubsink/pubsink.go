@@ -0,0 +1,128 @@
+// Package pubsink publishes recorded rows to a message broker, so downstream
+// consumers can follow records in real time instead of waiting for files.
+//
+// The broker client is abstracted by Publisher; sink/pubsink/natspub adapts a
+// NATS connection. Kafka clients fit in a few lines, e.g., with
+// segmentio/kafka-go:
+//
+//	pubsink.PublisherFunc(func(ctx context.Context, topic string, key, msg []byte) error {
+//		return w.WriteMessages(ctx, kafka.Message{Topic: topic, Key: key, Value: msg})
+//	})
+package pubsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// Publisher sends one message to a topic (a Kafka topic or a NATS subject).
+// key is the record's partition, see core.Service.PartitionBy, and may be
+// empty; brokers without message keys ignore it.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, key, msg []byte) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, topic string, key, msg []byte) error
+
+func (f PublisherFunc) Publish(ctx context.Context, topic string, key, msg []byte) error {
+	return f(ctx, topic, key, msg)
+}
+
+// Encoding selects the message format of a record.
+type Encoding int
+
+const (
+	// EncodeCSV sends the record as a single CSV line without header.
+	EncodeCSV Encoding = iota
+
+	// EncodeJSON sends the record as a JSON object of column names to cells.
+	EncodeJSON
+)
+
+// Sink publishes every record of a batch as its own message.
+type Sink struct {
+	// Publisher delivers the messages.
+	Publisher Publisher
+
+	// Topic receives every message.
+	Topic string
+
+	// Encoding of the messages. Defaults to EncodeCSV.
+	Encoding Encoding
+
+	// Timeout bounds each Publish call. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// New creates a Sink publishing to topic.
+func New(p Publisher, topic string) *Sink {
+	return &Sink{Publisher: p, Topic: topic}
+}
+
+// Ping pings Publisher if it implements core.Pinger, e.g., to check the
+// broker connection.
+func (s *Sink) Ping() error {
+	if p, ok := s.Publisher.(core.Pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// WriteBatch publishes the batch records in order and stops at the first
+// failure.
+func (s *Sink) WriteBatch(b *core.Batch) error {
+	for _, record := range b.Rows {
+		msg, err := s.encode(b.Column, record)
+		if err != nil {
+			return err
+		}
+		if err := s.publish([]byte(b.Partition), msg); err != nil {
+			return fmt.Errorf("failed to publish record to %q: %w", s.Topic, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sink) publish(key, msg []byte) error {
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	return s.Publisher.Publish(ctx, s.Topic, key, msg)
+}
+
+// encode renders one record in the sink's Encoding.
+func (s *Sink) encode(column, record []string) ([]byte, error) {
+	switch s.Encoding {
+	case EncodeJSON:
+		obj := make(map[string]string, len(column))
+		for i, col := range column {
+			if i < len(record) {
+				obj[col] = record[i]
+			}
+		}
+		msg, err := json.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode record as JSON: %w", err)
+		}
+		return msg, nil
+	default:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(record)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, fmt.Errorf("failed to encode record as CSV: %w", err)
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+}
@@ -0,0 +1,151 @@
+// Package sqlsink inserts recorded rows into a database table through
+// database/sql, so records become queryable without a second ingestion path.
+//
+// Add it to a service's Sinks, next to core.Service.FileSink to keep writing
+// the CSV files as well:
+//
+//	service.Sinks = []core.Sink{service.FileSink(), sqlsink.New(db, "booking_record")}
+//
+// The package doesn't import a driver; open db with the driver of your choice.
+package sqlsink
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// Sink inserts each batch into Table, one row per record, with one column per
+// service column. Cells are inserted as strings.
+type Sink struct {
+	// DB is the database to write to. The caller owns and closes it.
+	DB *sql.DB
+
+	// Table is the name of the destination table.
+	Table string
+
+	// Placeholder returns the parameter marker for the n-th value of a
+	// statement, counting from 1. Defaults to QuestionMark (MySQL, SQLite);
+	// use Dollar for PostgreSQL.
+	Placeholder func(n int) string
+
+	// Quote quotes table and column names. Defaults to ANSI double quotes; use
+	// Backtick for MySQL.
+	Quote func(name string) string
+
+	// CreateTable creates Table with a TEXT column per service column before
+	// the first insert, if it doesn't exist yet.
+	CreateTable bool
+
+	mu      sync.Mutex
+	created []string // columns Table was last created for
+}
+
+// New creates a Sink inserting into table of db.
+func New(db *sql.DB, table string) *Sink {
+	return &Sink{DB: db, Table: table}
+}
+
+// Ping checks the connection to DB, see core.Pinger.
+func (s *Sink) Ping() error {
+	return s.DB.Ping()
+}
+
+// QuestionMark is the "?" placeholder style.
+func QuestionMark(int) string { return "?" }
+
+// Dollar is the "$1" placeholder style.
+func Dollar(n int) string { return "$" + strconv.Itoa(n) }
+
+// DoubleQuote quotes name as an ANSI SQL identifier.
+func DoubleQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Backtick quotes name as a MySQL identifier.
+func Backtick(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// WriteBatch inserts the batch rows in a single transaction, so a batch is
+// either fully stored or not at all.
+func (s *Sink) WriteBatch(b *core.Batch) error {
+	if len(b.Rows) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.CreateTable && !slices.Equal(s.created, b.Column) {
+		if _, err := s.DB.Exec(s.createStatement(b.Column)); err != nil {
+			return fmt.Errorf("failed to create table %q: %w", s.Table, err)
+		}
+		s.created = slices.Clone(b.Column)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after Commit
+
+	stmt, err := tx.Prepare(s.insertStatement(b.Column))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into %q: %w", s.Table, err)
+	}
+	defer stmt.Close()
+
+	args := make([]any, len(b.Column))
+	for _, record := range b.Rows {
+		for i := range args {
+			args[i] = nil
+			if i < len(record) {
+				args[i] = record[i]
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("failed to insert record into %q: %w", s.Table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit insert into %q: %w", s.Table, err)
+	}
+	return nil
+}
+
+func (s *Sink) createStatement(column []string) string {
+	quote := s.quote()
+	defs := make([]string, len(column))
+	for i, col := range column {
+		defs[i] = quote(col) + " TEXT"
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quote(s.Table), strings.Join(defs, ", "))
+}
+
+func (s *Sink) insertStatement(column []string) string {
+	quote, placeholder := s.quote(), s.Placeholder
+	if placeholder == nil {
+		placeholder = QuestionMark
+	}
+	names := make([]string, len(column))
+	params := make([]string, len(column))
+	for i, col := range column {
+		names[i] = quote(col)
+		params[i] = placeholder(i + 1)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(s.Table), strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+func (s *Sink) quote() func(string) string {
+	if s.Quote != nil {
+		return s.Quote
+	}
+	return DoubleQuote
+}
@@ -0,0 +1,294 @@
+// Package xlsx writes records to Excel workbooks instead of CSV files.
+//
+// It reuses the column and rotation configuration of a core.Service, so the
+// same service can be pointed at Excel output without duplicating its setup.
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"github.com/xuri/excelize/v2"
+)
+
+// defaultSaveInterval is how often open workbooks are saved when
+// SaveInterval is zero.
+const defaultSaveInterval = 10 * time.Second
+
+// Encoder appends records as rows to a time-suffixed .xlsx workbook.
+// Each rotation period gets its own workbook with a single sheet named after
+// the period suffix, e.g., "files/record/booking_record_2025_08_26.xlsx" with
+// sheet "2025_08_26".
+//
+// The workbooks of the current period are kept open, so a batch doesn't read
+// and rewrite the whole workbook. They are saved every SaveInterval, when the
+// period rotates, and on Flush and Close; rows appended since the last save
+// are lost if the process dies. A workbook is saved to a temporary file that
+// replaces it, so a crash never leaves a corrupt one.
+type Encoder struct {
+	// Service provides Dir, Filename, Column and RecordType.
+	Service *core.Service
+
+	// SaveInterval is how often the open workbooks are saved while rows are
+	// appended. Defaults to 10 seconds; a negative interval saves them only
+	// on rotation, Flush and Close.
+	SaveInterval time.Duration
+
+	mu    sync.Mutex
+	books map[string]*workbook // open, by path
+}
+
+// workbook is a workbook kept open by an Encoder.
+type workbook struct {
+	file   *excelize.File
+	period string         // sheet last appended to
+	next   map[string]int // next row of each sheet, 1-based
+	dirty  bool           // appended to since it was saved
+	saved  time.Time
+}
+
+// NewEncoder creates an Encoder that follows the configuration of service.
+func NewEncoder(service *core.Service) *Encoder {
+	return &Encoder{Service: service}
+}
+
+// Record maps the payload onto the service columns and appends it to the
+// workbook of the current rotation period.
+func (e *Encoder) Record(payload interface{}) error {
+	timeNow, err := e.Service.Now()
+	if err != nil {
+		return err
+	}
+
+	suffix, err := e.Service.Suffix(timeNow)
+	if err != nil {
+		return err
+	}
+
+	records, err := e.Service.Rows(payload)
+	if err != nil {
+		return err
+	}
+
+	return e.WriteBatch(&core.Batch{Time: timeNow, Suffix: suffix, Column: e.Service.Column, Header: e.Service.Headers, Rows: records})
+}
+
+// WriteBatch appends the batch to the workbook of its rotation period, so the
+// Encoder can also be used as one of the service's Sinks, which closes it with
+// the service.
+func (e *Encoder) WriteBatch(b *core.Batch) error {
+	csvPath := e.Service.BatchPath(b)
+	filePath := strings.TrimSuffix(csvPath, filepath.Ext(csvPath)) + ".xlsx"
+
+	if err := os.MkdirAll(filepath.Dir(filePath), e.Service.DirMode()); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(filePath), err)
+	}
+
+	if err := e.Append(filePath, b.Suffix, b.HeaderRow(), b.Rows...); err != nil {
+		return fmt.Errorf("failed to append record to %q: %w", filePath, err)
+	}
+	return nil
+}
+
+// Append writes rows to the given sheet of the workbook at filename.
+// It creates the workbook and sheet, including the header row, when they don't
+// exist yet. Open workbooks last appended to another sheet belong to an
+// earlier period and are saved and closed.
+func (e *Encoder) Append(filename, sheet string, column []string, records ...[]string) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for path, wb := range e.books {
+		if path != filename && wb.period != sheet {
+			if err := e.close(path, wb); err != nil {
+				return err
+			}
+		}
+	}
+	wb, err := e.open(filename)
+	if err != nil {
+		return err
+	}
+	next, err := wb.nextRow(sheet)
+	if err != nil {
+		return err
+	}
+
+	if next == 1 { // Sheet is empty, write header
+		if err := setRow(wb.file, sheet, 1, column); err != nil {
+			return fmt.Errorf("failed to write header to %q: %w", filename, err)
+		}
+		next = 2
+	}
+	for i, record := range records {
+		if err := setRow(wb.file, sheet, next+i, record); err != nil {
+			return fmt.Errorf("failed to write record to %q: %w", filename, err)
+		}
+	}
+	wb.next[sheet] = next + len(records)
+	wb.period, wb.dirty = sheet, true
+
+	interval := e.SaveInterval
+	if interval == 0 {
+		interval = defaultSaveInterval
+	}
+	if interval > 0 && time.Since(wb.saved) >= interval {
+		return e.save(filename, wb)
+	}
+	return nil
+}
+
+// Flush saves the open workbooks with rows appended since they were saved.
+func (e *Encoder) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for path, wb := range e.books {
+		if err := e.save(path, wb); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close saves and closes the open workbooks. The Encoder can still be used
+// afterwards, reopening them.
+func (e *Encoder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for path, wb := range e.books {
+		if err := e.close(path, wb); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// open returns the open workbook at filename, opening it or starting a new
+// empty one if the file doesn't exist. The caller must hold e.mu.
+func (e *Encoder) open(filename string) (*workbook, error) {
+	if wb, ok := e.books[filename]; ok {
+		return wb, nil
+	}
+	f, err := excelize.OpenFile(filename)
+	if os.IsNotExist(err) {
+		f, err = excelize.NewFile(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook %q: %w", filename, err)
+	}
+	wb := &workbook{file: f, next: map[string]int{}, saved: time.Now()}
+	if e.books == nil {
+		e.books = map[string]*workbook{}
+	}
+	e.books[filename] = wb
+	return wb, nil
+}
+
+// close saves the workbook at path and forgets it. The caller must hold e.mu.
+func (e *Encoder) close(path string, wb *workbook) error {
+	if err := e.save(path, wb); err != nil {
+		return err // Kept open, to be saved again
+	}
+	delete(e.books, path)
+	if err := wb.file.Close(); err != nil {
+		return fmt.Errorf("failed to close workbook %q: %w", path, err)
+	}
+	return nil
+}
+
+// save writes the workbook to a temporary file that replaces the one at path,
+// if it was appended to since it was saved. The caller must hold e.mu.
+func (e *Encoder) save(path string, wb *workbook) error {
+	if !wb.dirty {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if err := wb.file.Write(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save workbook %q: %w", path, err)
+	}
+	if err := tmp.Chmod(e.Service.FileMode()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save workbook %q: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %q: %w", path, err)
+	}
+	wb.dirty, wb.saved = false, time.Now()
+	return nil
+}
+
+// nextRow returns the next row of sheet, creating the sheet if it doesn't
+// exist yet. Its rows are only counted the first time.
+func (wb *workbook) nextRow(sheet string) (int, error) {
+	if next, ok := wb.next[sheet]; ok {
+		return next, nil
+	}
+	idx, err := wb.file.GetSheetIndex(sheet)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up sheet %q: %w", sheet, err)
+	}
+	if idx == -1 {
+		if err := addSheet(wb.file, sheet); err != nil {
+			return 0, err
+		}
+	}
+	rows, err := wb.file.GetRows(sheet)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rows of sheet %q: %w", sheet, err)
+	}
+	wb.next[sheet] = len(rows) + 1
+	return len(rows) + 1, nil
+}
+
+// addSheet creates sheet in f. A freshly created workbook only contains the
+// default "Sheet1", which is renamed instead so the file has no stray sheet.
+func addSheet(f *excelize.File, sheet string) error {
+	if sheets := f.GetSheetList(); len(sheets) == 1 && sheets[0] == "Sheet1" {
+		if rows, err := f.GetRows("Sheet1"); err == nil && len(rows) == 0 {
+			if err := f.SetSheetName("Sheet1", sheet); err != nil {
+				return fmt.Errorf("failed to rename default sheet to %q: %w", sheet, err)
+			}
+			return nil
+		}
+	}
+	if _, err := f.NewSheet(sheet); err != nil {
+		return fmt.Errorf("failed to create sheet %q: %w", sheet, err)
+	}
+	return nil
+}
+
+// setRow writes values into row (1-based) starting at column A.
+func setRow(f *excelize.File, sheet string, row int, values []string) error {
+	cell, err := excelize.CoordinatesToCellName(1, row)
+	if err != nil {
+		return err
+	}
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = v
+	}
+	return f.SetSheetRow(sheet, cell, &cells)
+}
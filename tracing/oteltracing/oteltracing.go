@@ -0,0 +1,64 @@
+// Package oteltracing traces recordtocsv writes with OpenTelemetry.
+//
+//	service.Tracer = oteltracing.New(otel.Tracer("recordtocsv"))
+//	err := service.RecordContext(r.Context(), payload)
+package oteltracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ core.Tracer = (*Tracer)(nil)
+
+// Tracer implements core.Tracer with an OpenTelemetry tracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New creates a Tracer that starts its spans with t.
+func New(t trace.Tracer) *Tracer {
+	return &Tracer{tracer: t}
+}
+
+// Start starts an internal span as a child of the span in ctx.
+func (t *Tracer) Start(ctx context.Context, name string) core.Span {
+	_, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+	return Span{span: span}
+}
+
+// Span implements core.Span with an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+// SetAttribute converts value to the matching attribute type. Other types are
+// recorded in their fmt form.
+func (s Span) SetAttribute(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// End records err, if any, and ends the span.
+func (s Span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
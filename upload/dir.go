@@ -0,0 +1,124 @@
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ojipoji/recordtocsv/v2/core"
+)
+
+// DirDestination uploads to a directory, typically a mounted network share,
+// or to a directory on another core.FS, such as an SFTP server (see
+// SFTPDestination). Parts are staged in a hidden directory next to the
+// target and concatenated on completion, so the final file only appears once
+// it is complete.
+type DirDestination struct {
+	Dir string
+
+	// FS holds Dir. Defaults to the OS filesystem.
+	FS core.FS
+}
+
+func (d DirDestination) CreateUpload(ctx context.Context, key string) (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	if err := d.fs().MkdirAll(d.partsDir(key, id), 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return id, nil
+}
+
+func (d DirDestination) UploadPart(ctx context.Context, key, uploadID string, number int, body io.Reader, size int64) (string, error) {
+	dir := d.partsDir(key, uploadID)
+	if _, err := d.fs().Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: staging directory %q is gone", ErrUnknownUpload, dir)
+	}
+	name := filepath.Join(dir, strconv.Itoa(number))
+	f, err := d.fs().Create(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create part %q: %w", name, err)
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write part %q: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write part %q: %w", name, err)
+	}
+	return strconv.Itoa(number), nil
+}
+
+func (d DirDestination) CompleteUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	fsys := d.fs()
+	dst := filepath.Join(d.Dir, key)
+	if err := fsys.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %q: %w", dst, err)
+	}
+	tmp := dst + ".uploading"
+	out, err := fsys.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %w", tmp, err)
+	}
+	for _, p := range parts {
+		in, err := fsys.Open(filepath.Join(d.partsDir(key, uploadID), strconv.Itoa(p.Number)))
+		if errors.Is(err, fs.ErrNotExist) {
+			out.Close()
+			fsys.Remove(tmp)
+			return fmt.Errorf("%w: part %d is gone", ErrUnknownUpload, p.Number)
+		}
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("failed to open part %d: %w", p.Number, err)
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("failed to copy part %d: %w", p.Number, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", tmp, err)
+	}
+	if err := fsys.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("failed to move %q into place: %w", dst, err)
+	}
+	return d.removeParts(key, uploadID)
+}
+
+// removeParts removes the staging directory of an upload.
+func (d DirDestination) removeParts(key, uploadID string) error {
+	fsys := d.fs()
+	dir := d.partsDir(key, uploadID)
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list staged parts in %q: %w", dir, err)
+	}
+	for _, e := range entries {
+		if err := fsys.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("failed to remove staged part: %w", err)
+		}
+	}
+	return fsys.Remove(dir)
+}
+
+func (d DirDestination) partsDir(key, uploadID string) string {
+	return filepath.Join(d.Dir, filepath.Dir(key), "."+filepath.Base(key)+"."+uploadID+".parts")
+}
+
+func (d DirDestination) fs() core.FS {
+	if d.FS != nil {
+		return d.FS
+	}
+	return core.OSFS{}
+}
@@ -0,0 +1,16 @@
+package upload
+
+import "github.com/ojipoji/recordtocsv/v2/sftpfs"
+
+// SFTPDestination uploads to dir on an SFTP server, e.g., a partner's drop
+// server, staging the parts there like DirDestination:
+//
+//	fsys, err := sftpfs.Dial("sftp.partner.example:22", sshConfig)
+//	if err != nil {
+//		return err
+//	}
+//	defer fsys.Close()
+//	uploader, err := upload.New(upload.SFTPDestination(fsys, "inbox"), "upload-state.json")
+func SFTPDestination(fsys *sftpfs.FS, dir string) DirDestination {
+	return DirDestination{Dir: dir, FS: fsys}
+}
@@ -0,0 +1,367 @@
+// Package upload ships finalized record files to remote storage.
+//
+// Uploads are multi-part and resumable: the queue and the parts already
+// uploaded are persisted in a state file, so a restart or a flaky WAN link
+// resumes where it stopped instead of stranding files locally. Bandwidth can
+// be capped so uploads don't saturate the link.
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Part is an uploaded part of a file.
+type Part struct {
+	Number int    `json:"number"` // 1-based
+	ETag   string `json:"etag"`
+}
+
+// ErrUnknownUpload is matched by the errors of a Destination for an upload ID
+// it doesn't know (anymore), e.g., an upload that expired or was aborted on
+// the server. The Uploader then starts the upload of the file over.
+var ErrUnknownUpload = errors.New("unknown upload")
+
+// Destination is a remote store that accepts multi-part uploads, such as S3,
+// GCS or an SFTP server, see DirDestination and SFTPDestination.
+// Implementations must be safe for concurrent use.
+type Destination interface {
+	// CreateUpload starts a multi-part upload of key and returns its ID.
+	CreateUpload(ctx context.Context, key string) (uploadID string, err error)
+
+	// UploadPart uploads one part of an upload started by CreateUpload.
+	UploadPart(ctx context.Context, key, uploadID string, number int, body io.Reader, size int64) (etag string, err error)
+
+	// CompleteUpload assembles the parts into the final object.
+	CompleteUpload(ctx context.Context, key, uploadID string, parts []Part) error
+}
+
+// Job is a queued file upload and its progress.
+type Job struct {
+	Path      string `json:"path"`
+	Key       string `json:"key"`
+	UploadID  string `json:"upload_id,omitempty"`
+	Parts     []Part `json:"parts,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Uploader uploads queued files to a Destination, one at a time. New also
+// loads the persisted queue; an Uploader made without it starts empty.
+type Uploader struct {
+	// Destination receives the files.
+	Destination Destination
+
+	// StateFile persists the queue and upload progress across restarts.
+	StateFile string
+
+	// PartSize is the size of each uploaded part. Defaults to 8 MiB.
+	PartSize int64
+
+	// BytesPerSecond caps the upload bandwidth. 0 means unlimited.
+	BytesPerSecond int
+
+	// RetryInterval is the delay before a failed upload is tried again.
+	// Defaults to 30s.
+	RetryInterval time.Duration
+
+	// RemoveAfterUpload deletes the local file once it is uploaded.
+	RemoveAfterUpload bool
+
+	// OnUploaded, if set, is called after each completed upload.
+	OnUploaded func(job Job)
+
+	// OnError, if set, is called when an upload attempt fails.
+	OnError func(job Job, err error)
+
+	mu      sync.Mutex
+	jobs    []*Job
+	wake    chan struct{}
+	limiter *rate.Limiter
+}
+
+// New creates an Uploader and loads the queue persisted in stateFile, if any.
+func New(dest Destination, stateFile string) (*Uploader, error) {
+	u := &Uploader{Destination: dest, StateFile: stateFile}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload state %q: %w", stateFile, err)
+	}
+	if err := json.Unmarshal(data, &u.jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse upload state %q: %w", stateFile, err)
+	}
+	return u, nil
+}
+
+// Enqueue adds the file at path to the queue, to be stored under key. A file
+// that is already queued is not added twice.
+func (u *Uploader) Enqueue(path, key string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if slices.ContainsFunc(u.jobs, func(j *Job) bool { return j.Path == path }) {
+		return nil
+	}
+	u.jobs = append(u.jobs, &Job{Path: path, Key: key})
+	if err := u.save(); err != nil {
+		return err
+	}
+
+	select {
+	case u.signal() <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// signal returns the channel Enqueue wakes Run with, created on first use so
+// an Uploader that wasn't made by New works too. The caller must hold u.mu.
+func (u *Uploader) signal() chan struct{} {
+	if u.wake == nil {
+		u.wake = make(chan struct{}, 1)
+	}
+	return u.wake
+}
+
+// Pending returns a copy of the queued jobs, including failed ones awaiting a
+// retry.
+func (u *Uploader) Pending() []Job {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	jobs := make([]Job, len(u.jobs))
+	for i, j := range u.jobs {
+		jobs[i] = *j
+		jobs[i].Parts = slices.Clone(j.Parts)
+	}
+	return jobs
+}
+
+// Run uploads queued files until ctx is done. Failed uploads stay queued and
+// are retried after RetryInterval.
+func (u *Uploader) Run(ctx context.Context) error {
+	retry := u.RetryInterval
+	if retry <= 0 {
+		retry = 30 * time.Second
+	}
+	u.mu.Lock()
+	wake := u.signal()
+	u.mu.Unlock()
+
+	for {
+		failed := false
+		for _, job := range u.queued() {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := u.upload(ctx, job); err != nil {
+				failed = true
+				u.fail(job, err)
+				continue
+			}
+			u.done(job)
+		}
+
+		var timer <-chan time.Time
+		if failed {
+			timer = time.After(retry)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-timer:
+		}
+	}
+}
+
+// queued returns the jobs to process in this round.
+func (u *Uploader) queued() []*Job {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return slices.Clone(u.jobs)
+}
+
+// upload uploads the missing parts of job and completes it. An upload the
+// destination no longer knows is started over once.
+func (u *Uploader) upload(ctx context.Context, job *Job) error {
+	err := u.uploadParts(ctx, job)
+	if !errors.Is(err, ErrUnknownUpload) {
+		return err
+	}
+	if err := u.update(job, func() { job.UploadID, job.Parts = "", nil }); err != nil {
+		return err
+	}
+	return u.uploadParts(ctx, job)
+}
+
+// uploadParts resumes the upload of job where it stopped.
+func (u *Uploader) uploadParts(ctx context.Context, job *Job) error {
+	f, err := os.Open(job.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", job.Path, err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info for %q: %w", job.Path, err)
+	}
+
+	u.mu.Lock()
+	uploadID := job.UploadID
+	u.mu.Unlock()
+	if uploadID == "" {
+		if uploadID, err = u.Destination.CreateUpload(ctx, job.Key); err != nil {
+			return fmt.Errorf("failed to start upload of %q: %w", job.Path, err)
+		}
+		if err := u.update(job, func() { job.UploadID = uploadID }); err != nil {
+			return err
+		}
+	}
+
+	partSize := u.PartSize
+	if partSize <= 0 {
+		partSize = 8 << 20
+	}
+	count := int((stat.Size() + partSize - 1) / partSize)
+	if count == 0 {
+		count = 1 // Empty files still need one (empty) part
+	}
+
+	for number := 1; number <= count; number++ {
+		u.mu.Lock()
+		uploaded := slices.ContainsFunc(job.Parts, func(p Part) bool { return p.Number == number })
+		u.mu.Unlock()
+		if uploaded {
+			continue // Resumed upload
+		}
+
+		offset := int64(number-1) * partSize
+		size := min(partSize, stat.Size()-offset)
+		body := u.throttle(ctx, io.NewSectionReader(f, offset, size))
+
+		etag, err := u.Destination.UploadPart(ctx, job.Key, uploadID, number, body, size)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d of %q: %w", number, job.Path, err)
+		}
+		if err := u.update(job, func() { job.Parts = append(job.Parts, Part{Number: number, ETag: etag}) }); err != nil {
+			return err
+		}
+	}
+
+	u.mu.Lock()
+	parts := slices.Clone(job.Parts)
+	u.mu.Unlock()
+	slices.SortFunc(parts, func(a, b Part) int { return a.Number - b.Number })
+
+	if err := u.Destination.CompleteUpload(ctx, job.Key, uploadID, parts); err != nil {
+		return fmt.Errorf("failed to complete upload of %q: %w", job.Path, err)
+	}
+	return nil
+}
+
+// update applies fn to a job under the lock and persists the new state.
+func (u *Uploader) update(job *Job, fn func()) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fn()
+	return u.save()
+}
+
+// fail records a failed attempt; the job stays queued.
+func (u *Uploader) fail(job *Job, err error) {
+	u.update(job, func() {
+		job.Attempts++
+		job.LastError = err.Error()
+	})
+	if u.OnError != nil {
+		u.OnError(*job, err)
+	}
+}
+
+// done removes a completed job from the queue.
+func (u *Uploader) done(job *Job) {
+	u.mu.Lock()
+	u.jobs = slices.DeleteFunc(u.jobs, func(j *Job) bool { return j == job })
+	err := u.save()
+	u.mu.Unlock()
+
+	if err != nil && u.OnError != nil {
+		u.OnError(*job, err)
+	}
+	if u.RemoveAfterUpload {
+		if err := os.Remove(job.Path); err != nil && u.OnError != nil {
+			u.OnError(*job, fmt.Errorf("failed to remove uploaded file %q: %w", job.Path, err))
+		}
+	}
+	if u.OnUploaded != nil {
+		u.OnUploaded(*job)
+	}
+}
+
+// save persists the queue atomically. The caller must hold u.mu.
+func (u *Uploader) save() error {
+	data, err := json.MarshalIndent(u.jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode upload state: %w", err)
+	}
+	tmp := u.StateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(u.StateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %q: %w", u.StateFile, err)
+	}
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write upload state %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, u.StateFile); err != nil {
+		return fmt.Errorf("failed to replace upload state %q: %w", u.StateFile, err)
+	}
+	return nil
+}
+
+// throttle limits reads from r to BytesPerSecond, shared by all uploads.
+func (u *Uploader) throttle(ctx context.Context, r io.Reader) io.Reader {
+	if u.BytesPerSecond <= 0 {
+		return r
+	}
+	u.mu.Lock()
+	if u.limiter == nil {
+		u.limiter = rate.NewLimiter(rate.Limit(u.BytesPerSecond), u.BytesPerSecond)
+	}
+	limiter := u.limiter
+	u.mu.Unlock()
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Never ask for more than the bucket holds, or WaitN fails
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,100 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ojipoji/recordtocsv/v2/memfs"
+)
+
+func TestUploadToFS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "booking.csv")
+	if err := os.WriteFile(path, []byte("id\n1\n2\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := memfs.New()
+	u, err := New(DirDestination{Dir: "inbox", FS: fsys}, filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.PartSize = 4
+	if err := u.Enqueue(path, "2025/booking.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.upload(context.Background(), u.queued()[0]); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fsys.ReadFile("inbox/2025/booking.csv")
+	if err != nil || string(data) != "id\n1\n2\n3\n" {
+		t.Errorf("uploaded %q, %v", data, err)
+	}
+	if entries, _ := fsys.ReadDir("inbox/2025"); len(entries) != 1 {
+		t.Errorf("staging left behind: %v", entries)
+	}
+}
+
+func TestUploadRestartsUnknownUpload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "booking.csv")
+	if err := os.WriteFile(path, []byte("id\n1\n2\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dest := DirDestination{Dir: filepath.Join(dir, "inbox")}
+	u, err := New(dest, filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.PartSize = 4
+	if err := u.Enqueue(path, "booking.csv"); err != nil {
+		t.Fatal(err)
+	}
+	// Resume state of an upload whose staged parts were cleaned up on the
+	// destination
+	job := u.queued()[0]
+	job.UploadID = "0123456789abcdef"
+	job.Parts = []Part{{Number: 1, ETag: "1"}}
+
+	if err := u.upload(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest.Dir, "booking.csv"))
+	if err != nil || string(data) != "id\n1\n2\n3\n" {
+		t.Errorf("uploaded %q, %v", data, err)
+	}
+	if job.UploadID == "0123456789abcdef" {
+		t.Error("stale upload ID kept")
+	}
+}
+
+func TestZeroUploaderWakesOnEnqueue(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "booking.csv")
+	if err := os.WriteFile(path, []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := make(chan Job, 1)
+	u := &Uploader{
+		Destination: DirDestination{Dir: filepath.Join(dir, "inbox")},
+		StateFile:   filepath.Join(dir, "state.json"),
+		OnUploaded:  func(job Job) { uploaded <- job },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go u.Run(ctx)
+
+	if err := u.Enqueue(path, "booking.csv"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case job := <-uploaded:
+		if job.Key != "booking.csv" {
+			t.Errorf("uploaded %q", job.Key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't pick up the enqueued file")
+	}
+}